@@ -44,7 +44,6 @@ require (
 	google.golang.org/grpc v1.46.2
 	google.golang.org/protobuf v1.34.2
 	gotest.tools/v3 v3.3.0
-	muzzammil.xyz/jsonc v1.0.0
 )
 
 require (
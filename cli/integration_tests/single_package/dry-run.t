@@ -7,15 +7,16 @@ Check
   
   Tasks to Run
   build
-    Task            = build                  
-    Hash            = e1872eef9417d83e       
-    Cached (Local)  = false                  
-    Cached (Remote) = false                  
-    Command         = echo 'building' > foo  
-    Outputs         = foo                    
-    Log File        = .titan/titan-build.log 
-    Dependencies    =                        
-    Dependendents   =                        
+    Task                  = build                  
+    Hash                  = e1872eef9417d83e       
+    Cached (Local)        = false                  
+    Cached (Remote)       = false                  
+    Command               = echo 'building' > foo  
+    Outputs               = foo                    
+    Log File              = .titan/titan-build.log 
+    Dependencies          =                        
+    Dependendents         =                        
+    Environment Variables =                        
 
   $ ${TITAN} run build --dry=json --single-package
   {
@@ -30,7 +31,8 @@ Check
         "excludedOutputs": null,
         "logFile": ".titan/titan-build.log",
         "dependencies": [],
-        "dependents": []
+        "dependents": [],
+        "environmentVariables": []
       }
     ]
   }
@@ -7,25 +7,27 @@ Check
   
   Tasks to Run
   build
-    Task            = build                  
-    Hash            = 6dab35f71988610e       
-    Cached (Local)  = false                  
-    Cached (Remote) = false                  
-    Command         = echo 'building' > foo  
-    Outputs         = foo                    
-    Log File        = .titan/titan-build.log 
-    Dependencies    =                        
-    Dependendents   = test                   
+    Task                  = build                  
+    Hash                  = 6dab35f71988610e       
+    Cached (Local)        = false                  
+    Cached (Remote)       = false                  
+    Command               = echo 'building' > foo  
+    Outputs               = foo                    
+    Log File              = .titan/titan-build.log 
+    Dependencies          =                        
+    Dependendents         = test                   
+    Environment Variables =                        
   test
-    Task            = test                                         
-    Hash            = a4039f6c1959b8db                             
-    Cached (Local)  = false                                        
-    Cached (Remote) = false                                        
-    Command         = [[ ( -f foo ) && $(cat foo) == 'building' ]] 
-    Outputs         =                                              
-    Log File        = .titan/titan-test.log                        
-    Dependencies    = build                                        
-    Dependendents   =                                              
+    Task                  = test                                         
+    Hash                  = a4039f6c1959b8db                             
+    Cached (Local)        = false                                        
+    Cached (Remote)       = false                                        
+    Command               = [[ ( -f foo ) && $(cat foo) == 'building' ]] 
+    Outputs               =                                              
+    Log File              = .titan/titan-test.log                        
+    Dependencies          = build                                        
+    Dependendents         =                                              
+    Environment Variables =                                              
 
   $ ${TITAN} run test --dry=json --single-package
   {
@@ -42,7 +44,8 @@ Check
         "dependencies": [],
         "dependents": [
           "test"
-        ]
+        ],
+        "environmentVariables": []
       },
       {
         "task": "test",
@@ -54,7 +57,8 @@ Check
         "dependencies": [
           "build"
         ],
-        "dependents": []
+        "dependents": [],
+        "environmentVariables": []
       }
     ]
   }
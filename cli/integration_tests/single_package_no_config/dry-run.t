@@ -7,15 +7,16 @@ Check
   
   Tasks to Run
   build
-    Task            = build                  
-    Hash            = 983caf383ff15c7a       
-    Cached (Local)  = false                  
-    Cached (Remote) = false                  
-    Command         = echo 'building'        
-    Outputs         =                        
-    Log File        = .titan/titan-build.log 
-    Dependencies    =                        
-    Dependendents   =                        
+    Task                  = build                  
+    Hash                  = 983caf383ff15c7a       
+    Cached (Local)        = false                  
+    Cached (Remote)       = false                  
+    Command               = echo 'building'        
+    Outputs               =                        
+    Log File              = .titan/titan-build.log 
+    Dependencies          =                        
+    Dependendents         =                        
+    Environment Variables =                        
 
   $ ${TITAN} run build --dry=json --single-package
   {
@@ -28,7 +29,8 @@ Check
         "excludedOutputs": null,
         "logFile": ".titan/titan-build.log",
         "dependencies": [],
-        "dependents": []
+        "dependents": [],
+        "environmentVariables": []
       }
     ]
   }
@@ -11,7 +11,9 @@ Test help flag
   Available Commands:
     bin         Get the path to the Turbo binary
     completion  Generate the autocompletion script for the specified shell
+    config      Work with titan.json
     daemon      Runs the Titanrepo background daemon
+    deps        Query the external dependencies resolved from your lockfile
     help        Help about any command
     link        Link your local directory to a Khulnasoft organization and enable remote caching.
     login       Login to your Khulnasoft account
@@ -47,7 +49,9 @@ Test help flag
   Available Commands:
     bin         Get the path to the Turbo binary
     completion  Generate the autocompletion script for the specified shell
+    config      Work with titan.json
     daemon      Runs the Titanrepo background daemon
+    deps        Query the external dependencies resolved from your lockfile
     help        Help about any command
     link        Link your local directory to a Khulnasoft organization and enable remote caching.
     login       Login to your Khulnasoft account
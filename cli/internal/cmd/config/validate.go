@@ -0,0 +1,115 @@
+// Package config implements the titan config command, which checks titan.json
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/khulnasoft/titanrepo/cli/internal/cmdutil"
+	"github.com/khulnasoft/titanrepo/cli/internal/context"
+	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/packagemanager"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// GetCmd returns the config command and its subcommands for use with cobra
+func GetCmd(helper *cmdutil.Helper) *cobra.Command {
+	outputJSON := false
+	cmd := &cobra.Command{
+		Use:           "config",
+		Short:         "Work with titan.json",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	validateCmd := &cobra.Command{
+		Use:           "validate",
+		Short:         "Check titan.json and the titan.json of each workspace for mistakes",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			base, err := helper.GetCmdBase(cmd.Flags())
+			if err != nil {
+				return err
+			}
+			diagnostics, err := validate(base)
+			if err != nil {
+				base.LogError("%v", err)
+				return err
+			}
+			if outputJSON {
+				if diagnostics == nil {
+					diagnostics = []fs.ConfigDiagnostic{}
+				}
+				rendered, err := json.MarshalIndent(diagnostics, "", "  ")
+				if err != nil {
+					return err
+				}
+				base.UI.Output(string(rendered))
+			}
+			problems := 0
+			for _, diagnostic := range diagnostics {
+				if !diagnostic.Warning {
+					problems++
+				}
+				if outputJSON {
+					continue
+				}
+				if diagnostic.Warning {
+					base.UI.Warn(diagnostic.String())
+				} else {
+					base.UI.Error(diagnostic.String())
+				}
+			}
+			if problems > 0 {
+				err := fmt.Errorf("found %d problem(s) in the configuration", problems)
+				if !outputJSON {
+					base.LogError("%v", err)
+				}
+				return err
+			}
+			if !outputJSON {
+				base.UI.Output(color.GreenString("The configuration is valid"))
+			}
+			return nil
+		},
+	}
+	validateCmd.Flags().BoolVar(&outputJSON, "json", false, "Output the problems found in JSON format")
+	cmd.AddCommand(validateCmd)
+	return cmd
+}
+
+// validate returns the problems in the configuration of the repository, including warnings.
+// Only the schema is checked in single-package repositories, since their tasks come from
+// package.json.
+func validate(base *cmdutil.CmdBase) ([]fs.ConfigDiagnostic, error) {
+	rootPackageJSON, err := fs.ReadPackageJSON(base.RepoRoot.UntypedJoin("package.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read package.json: %w", err)
+	}
+	_, packageMode := packagemanager.InferRoot(base.RepoRoot)
+	singlePackage := packageMode == packagemanager.Single
+	titanJSON, err := fs.LoadTurboConfig(base.RepoRoot, rootPackageJSON, singlePackage)
+	if err != nil {
+		var configErr *fs.ConfigError
+		if errors.As(err, &configErr) {
+			return configErr.Diagnostics, nil
+		}
+		return nil, err
+	}
+	if singlePackage {
+		return titanJSON.Warnings(), nil
+	}
+	ctx, err := context.BuildPackageGraph(base.RepoRoot, rootPackageJSON)
+	if err != nil {
+		// Problems with the lockfile don't affect the configuration
+		var warnings *context.Warnings
+		if !errors.As(err, &warnings) {
+			return nil, errors.Wrap(err, "could not construct graph")
+		}
+		base.Logger.Debug("issues occurred when constructing package graph", "error", err)
+	}
+	return fs.ValidateTurboConfig(base.RepoRoot, titanJSON, ctx.PackageInfos)
+}
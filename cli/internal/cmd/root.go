@@ -7,9 +7,11 @@ import (
 	"runtime/trace"
 
 	"github.com/khulnasoft/titanrepo/cli/internal/cmd/auth"
+	"github.com/khulnasoft/titanrepo/cli/internal/cmd/config"
 	"github.com/khulnasoft/titanrepo/cli/internal/cmd/info"
 	"github.com/khulnasoft/titanrepo/cli/internal/cmdutil"
 	"github.com/khulnasoft/titanrepo/cli/internal/daemon"
+	"github.com/khulnasoft/titanrepo/cli/internal/deps"
 	"github.com/khulnasoft/titanrepo/cli/internal/login"
 	"github.com/khulnasoft/titanrepo/cli/internal/process"
 	"github.com/khulnasoft/titanrepo/cli/internal/prune"
@@ -140,7 +142,9 @@ func getCmd(helper *cmdutil.Helper, signalWatcher *signals.Watcher) *cobra.Comma
 	cmd.AddCommand(auth.LogoutCmd(helper))
 	cmd.AddCommand(auth.UnlinkCmd(helper))
 	cmd.AddCommand(info.BinCmd(helper))
+	cmd.AddCommand(config.GetCmd(helper))
 	cmd.AddCommand(daemon.GetCmd(helper, signalWatcher))
+	cmd.AddCommand(deps.GetCmd(helper))
 	cmd.AddCommand(prune.GetCmd(helper))
 	cmd.AddCommand(run.GetCmd(helper, signalWatcher))
 	return cmd
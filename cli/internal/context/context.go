@@ -215,6 +215,89 @@ func BuildPackageGraph(repoRoot titanpath.AbsoluteSystemPath, rootPackageJSON *f
 	return c, warnings.errorOrNil()
 }
 
+// PackageGraphFromResolvedPackages constructs a Context instance from packages whose Name, Dir,
+// InternalDeps and ExternalDepsHash were resolved elsewhere, such as by the daemon. The root
+// package is the one named util.RootPkgName. Only the package.json of each package and the
+// lockfile are read, so ExternalDeps and TransitiveDeps are not filled in.
+func PackageGraphFromResolvedPackages(repoRoot titanpath.AbsoluteSystemPath, rootPackageJSON *fs.PackageJSON, packages []*fs.PackageJSON) (*Context, error) {
+	c := &Context{}
+	c.PackageInfos = make(map[interface{}]*fs.PackageJSON)
+	c.RootNode = core.ROOT_NODE_NAME
+
+	var warnings Warnings
+
+	packageManager, err := packagemanager.GetPackageManager(repoRoot, rootPackageJSON)
+	if err != nil {
+		return nil, err
+	}
+	c.PackageManager = packageManager
+
+	if lockfile, err := c.PackageManager.ReadLockfile(repoRoot); err != nil {
+		warnings.append(err)
+	} else {
+		c.Lockfile = lockfile
+	}
+
+	var rootPackage *fs.PackageJSON
+	parseJSONWaitGroup := &errgroup.Group{}
+	for _, resolved := range packages {
+		if resolved.Name == util.RootPkgName {
+			rootPackage = resolved
+			continue
+		}
+		pkgJSONPath := repoRoot.UntypedJoin(resolved.Dir.ToString(), "package.json")
+		parseJSONWaitGroup.Go(func() error {
+			return c.parsePackageJSON(repoRoot, pkgJSONPath)
+		})
+	}
+	if err := parseJSONWaitGroup.Wait(); err != nil {
+		return nil, err
+	}
+	if rootPackage == nil {
+		return nil, fmt.Errorf("missing the root package")
+	}
+
+	for _, resolved := range packages {
+		if resolved.Name == util.RootPkgName {
+			continue
+		}
+		pkg, ok := c.PackageInfos[resolved.Name]
+		if !ok || pkg.Dir != resolved.Dir {
+			return nil, fmt.Errorf("package %v is not at %v", resolved.Name, resolved.Dir)
+		}
+		c.addResolvedDeps(pkg, pkg.Name, resolved)
+	}
+	c.addResolvedDeps(rootPackageJSON, util.RootPkgName, rootPackage)
+	c.PackageInfos[util.RootPkgName] = rootPackageJSON
+
+	return c, warnings.errorOrNil()
+}
+
+// addResolvedDeps fills in the dependencies of pkg from resolved, adding the same edges to the
+// graph as populateTopologicGraphForPackageJSON.
+func (c *Context) addResolvedDeps(pkg *fs.PackageJSON, vertexName string, resolved *fs.PackageJSON) {
+	pkg.InternalDeps = resolved.InternalDeps
+	pkg.ExternalDepsHash = resolved.ExternalDepsHash
+
+	internalDeps := make(util.Set)
+	for _, dep := range pkg.InternalDeps {
+		internalDeps.Add(dep)
+		c.TopologicalGraph.Connect(dag.BasicEdge(vertexName, dep))
+	}
+	if len(pkg.InternalDeps) == 0 {
+		c.TopologicalGraph.Connect(dag.BasicEdge(pkg.Name, core.ROOT_NODE_NAME))
+	}
+
+	pkg.UnresolvedExternalDeps = make(map[string]string)
+	for _, deps := range []map[string]string{pkg.DevDependencies, pkg.OptionalDependencies, pkg.Dependencies} {
+		for dep, version := range deps {
+			if !internalDeps.Includes(dep) {
+				pkg.UnresolvedExternalDeps[dep] = version
+			}
+		}
+	}
+}
+
 func (c *Context) resolveWorkspaceRootDeps(rootPackageJSON *fs.PackageJSON, warnings *Warnings) error {
 	seen := mapset.NewSet()
 	var lockfileEg errgroup.Group
@@ -401,3 +484,114 @@ func (c *Context) resolveDepGraph(wg *errgroup.Group, workspace *fs.PackageJSON,
 		})
 	}
 }
+
+// ProductionInternalDeps returns the workspaces that pkg depends on through its dependencies
+// and optionalDependencies, leaving out those it only needs as devDependencies
+func ProductionInternalDeps(pkg *fs.PackageJSON) []string {
+	deps := []string{}
+	for _, dep := range pkg.InternalDeps {
+		_, isDependency := pkg.Dependencies[dep]
+		_, isOptionalDependency := pkg.OptionalDependencies[dep]
+		if isDependency || isOptionalDependency {
+			deps = append(deps, dep)
+		}
+	}
+	return deps
+}
+
+// ProductionTransitiveDeps returns the lockfile keys of the external dependencies and
+// optionalDependencies of pkg, along with everything they depend on. Unlike pkg.TransitiveDeps,
+// these leave out the packages that pkg only needs for its devDependencies.
+func (c *Context) ProductionTransitiveDeps(pkg *fs.PackageJSON) ([]string, error) {
+	if c.Lockfile == nil {
+		return []string{}, nil
+	}
+	internalDeps := make(util.Set)
+	for _, dep := range pkg.InternalDeps {
+		internalDeps.Add(dep)
+	}
+	directDeps := make(map[string]string)
+	for dep, version := range pkg.OptionalDependencies {
+		if !internalDeps.Includes(dep) {
+			directDeps[dep] = version
+		}
+	}
+	for dep, version := range pkg.Dependencies {
+		if !internalDeps.Includes(dep) {
+			directDeps[dep] = version
+		}
+	}
+
+	resolved, err := resolveLockfileDeps(c.Lockfile, pkg.Dir.ToUnixPath(), directDeps)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(resolved))
+	for key := range resolved {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// ResolveExternalDeps returns the lockfile entries that the external dependencies of pkg resolve to
+// in the given lockfile, along with everything they depend on. The result maps each lockfile key to
+// its version. Unlike pkg.TransitiveDeps, it works with any lockfile, e.g. from a previous commit.
+func ResolveExternalDeps(lf lockfile.Lockfile, pkg *fs.PackageJSON) (map[string]string, error) {
+	return resolveLockfileDeps(lf, pkg.Dir.ToUnixPath(), pkg.UnresolvedExternalDeps)
+}
+
+// ExternalDepVisitor is called by WalkExternalDeps for each dependency that resolves to a lockfile
+// entry. parent is the lockfile key of the entry with the dependency, or "" for a dependency of the
+// workspace itself, and name is the dependency as it was declared.
+type ExternalDepVisitor func(parent string, name string, lockfilePkg lockfile.Package)
+
+// WalkExternalDeps resolves the external dependencies of pkg in the given lockfile, and everything
+// they depend on, calling visit for each dependency. An entry's own dependencies are only walked
+// the first time it is reached.
+func WalkExternalDeps(lf lockfile.Lockfile, pkg *fs.PackageJSON, visit ExternalDepVisitor) error {
+	return walkLockfileDeps(lf, pkg.Dir.ToUnixPath(), pkg.UnresolvedExternalDeps, visit)
+}
+
+// resolveLockfileDeps resolves directDeps of the given workspace, and everything they depend on,
+// to their lockfile keys and versions
+func resolveLockfileDeps(lf lockfile.Lockfile, workspace titanpath.AnchoredUnixPath, directDeps map[string]string) (map[string]string, error) {
+	resolved := make(map[string]string)
+	err := walkLockfileDeps(lf, workspace, directDeps, func(_ string, _ string, lockfilePkg lockfile.Package) {
+		resolved[lockfilePkg.Key] = lockfilePkg.Version
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
+
+func walkLockfileDeps(lf lockfile.Lockfile, workspace titanpath.AnchoredUnixPath, directDeps map[string]string, visit ExternalDepVisitor) error {
+	walked := make(util.Set)
+	var walk func(parent string, deps map[string]string) error
+	walk = func(parent string, deps map[string]string) error {
+		for name, version := range deps {
+			lockfilePkg, err := lf.ResolvePackage(workspace, name, version)
+			if err != nil {
+				return err
+			}
+			if !lockfilePkg.Found {
+				continue
+			}
+			visit(parent, name, lockfilePkg)
+			if walked.Includes(lockfilePkg.Key) {
+				continue
+			}
+			walked.Add(lockfilePkg.Key)
+			allDeps, ok := lf.AllDependencies(lockfilePkg.Key)
+			if !ok {
+				return fmt.Errorf("unable to find lockfile entry for %s", lockfilePkg.Key)
+			}
+			if err := walk(lockfilePkg.Key, allDeps); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk("", directDeps)
+}
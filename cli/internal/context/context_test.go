@@ -1,8 +1,13 @@
 package context
 
 import (
+	"errors"
 	"path/filepath"
+	"reflect"
 	"testing"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
 )
 
 func Test_isWorkspaceReference(t *testing.T) {
@@ -121,3 +126,81 @@ func Test_isWorkspaceReference(t *testing.T) {
 		})
 	}
 }
+
+func Test_PackageGraphFromResolvedPackages(t *testing.T) {
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	writeFile := func(path string, contents string) {
+		t.Helper()
+		file := repoRoot.UntypedJoin(path)
+		if err := file.EnsureDir(); err != nil {
+			t.Fatalf("failed to create the directory for %v: %v", path, err)
+		}
+		if err := file.WriteFile([]byte(contents), 0644); err != nil {
+			t.Fatalf("failed to write %v: %v", path, err)
+		}
+	}
+	writeFile("package.json", `{"name": "root", "packageManager": "npm@8.19.2", "workspaces": ["packages/*"], "devDependencies": {"c": "*", "prettier": "^2.0.0"}}`)
+	writeFile("packages/a/package.json", `{"name": "a", "dependencies": {"b": "*", "react": "^18.0.0"}, "devDependencies": {"typescript": "^5.0.0"}}`)
+	writeFile("packages/b/package.json", `{"name": "b", "optionalDependencies": {"c": "*"}}`)
+	writeFile("packages/c/package.json", `{"name": "c"}`)
+	readRootPackageJSON := func() *fs.PackageJSON {
+		t.Helper()
+		rootPackageJSON, err := fs.ReadPackageJSON(repoRoot.UntypedJoin("package.json"))
+		if err != nil {
+			t.Fatalf("failed to read package.json: %v", err)
+		}
+		return rootPackageJSON
+	}
+
+	built, err := BuildPackageGraph(repoRoot, readRootPackageJSON())
+	var warnings *Warnings
+	if err != nil && !errors.As(err, &warnings) {
+		t.Fatalf("failed to build the package graph: %v", err)
+	}
+	resolved := []*fs.PackageJSON{}
+	for name, pkg := range built.PackageInfos {
+		resolved = append(resolved, &fs.PackageJSON{
+			Name:             name.(string),
+			Dir:              pkg.Dir,
+			InternalDeps:     pkg.InternalDeps,
+			ExternalDepsHash: pkg.ExternalDepsHash,
+		})
+	}
+
+	graph, err := PackageGraphFromResolvedPackages(repoRoot, readRootPackageJSON(), resolved)
+	if err != nil && !errors.As(err, &warnings) {
+		t.Fatalf("failed to construct the package graph: %v", err)
+	}
+	if graph.TopologicalGraph.String() != built.TopologicalGraph.String() {
+		t.Errorf("graph mismatch. got\n%v\nwant\n%v", graph.TopologicalGraph.String(), built.TopologicalGraph.String())
+	}
+	if len(graph.PackageInfos) != len(built.PackageInfos) {
+		t.Errorf("got %v packages, want %v", len(graph.PackageInfos), len(built.PackageInfos))
+	}
+	for name, expected := range built.PackageInfos {
+		actual, ok := graph.PackageInfos[name]
+		if !ok {
+			t.Errorf("missing package %v", name)
+			continue
+		}
+		if actual.Name != expected.Name || actual.Dir != expected.Dir || actual.ExternalDepsHash != expected.ExternalDepsHash {
+			t.Errorf("package %v mismatch. got %v at %v with %v, want %v at %v with %v", name, actual.Name, actual.Dir, actual.ExternalDepsHash, expected.Name, expected.Dir, expected.ExternalDepsHash)
+		}
+		if !reflect.DeepEqual(actual.InternalDeps, expected.InternalDeps) {
+			t.Errorf("internal dependencies of %v mismatch. got %v, want %v", name, actual.InternalDeps, expected.InternalDeps)
+		}
+		if !reflect.DeepEqual(actual.UnresolvedExternalDeps, expected.UnresolvedExternalDeps) {
+			t.Errorf("external dependencies of %v mismatch. got %v, want %v", name, actual.UnresolvedExternalDeps, expected.UnresolvedExternalDeps)
+		}
+	}
+
+	// Packages that have moved since the graph was resolved are an error, rather than a stale graph
+	writeFile("packages/d/package.json", `{"name": "d"}`)
+	_, err = PackageGraphFromResolvedPackages(repoRoot, readRootPackageJSON(), append(resolved, &fs.PackageJSON{
+		Name: "d",
+		Dir:  titanpath.AnchoredUnixPath("packages/e").ToSystemPath(),
+	}))
+	if err == nil || errors.As(err, &warnings) {
+		t.Errorf("expected an error for a package that moved, got %v", err)
+	}
+}
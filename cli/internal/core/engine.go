@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/khulnasoft/titanrepo/cli/internal/fs"
 	"github.com/khulnasoft/titanrepo/cli/internal/util"
 
 	"github.com/pyr-sh/dag"
@@ -247,6 +248,33 @@ func (e *Engine) AddTask(task *Task) *Engine {
 	return e
 }
 
+// AddPipeline adds a task for each entry in the pipeline, along with any dependencies between package-tasks
+func (e *Engine) AddPipeline(pipeline fs.Pipeline) error {
+	for taskName, taskDefinition := range pipeline {
+		topoDeps := make(util.Set)
+		deps := make(util.Set)
+		isPackageTask := util.IsPackageTask(taskName)
+		for _, dependency := range taskDefinition.TaskDependencies {
+			if isPackageTask && util.IsPackageTask(dependency) {
+				if err := e.AddDep(dependency, taskName); err != nil {
+					return err
+				}
+			} else {
+				deps.Add(dependency)
+			}
+		}
+		for _, dependency := range taskDefinition.TopologicalDependencies {
+			topoDeps.Add(dependency)
+		}
+		e.AddTask(&Task{
+			Name:     taskName,
+			TopoDeps: topoDeps,
+			Deps:     deps,
+		})
+	}
+	return nil
+}
+
 // AddDep adds tuples from+to task ID combos in tuple format so they can be looked up later.
 func (e *Engine) AddDep(fromTaskID string, toTaskID string) error {
 	fromPkg, _ := util.GetPackageTaskFromId(fromTaskID)
@@ -256,3 +284,43 @@ func (e *Engine) AddDep(fromTaskID string, toTaskID string) error {
 	e.PackageTaskDeps = append(e.PackageTaskDeps, []string{fromTaskID, toTaskID})
 	return nil
 }
+
+// RetainTasks restricts the task graph to the given tasks, the tasks that depend on them,
+// and the tasks that any of those depend on. Dependencies are kept so that hashing and
+// execution can still see them; they will typically be cache hits. Every other task is
+// removed from the graph.
+func (e *Engine) RetainTasks(taskIDs util.Set) error {
+	retained := make(util.Set)
+	retained.Add(ROOT_NODE_NAME)
+	for _, taskID := range taskIDs {
+		if !e.TaskGraph.HasVertex(taskID) {
+			continue
+		}
+		retained.Add(taskID)
+		dependents, err := e.TaskGraph.Descendents(taskID)
+		if err != nil {
+			return fmt.Errorf("failed to get dependents of task %v: %w", taskID, err)
+		}
+		for dependent := range dependents {
+			retained.Add(dependent)
+		}
+	}
+	for _, taskID := range retained.UnsafeListOfStrings() {
+		if !e.TaskGraph.HasVertex(taskID) {
+			continue
+		}
+		dependencies, err := e.TaskGraph.Ancestors(taskID)
+		if err != nil {
+			return fmt.Errorf("failed to get dependencies of task %v: %w", taskID, err)
+		}
+		for dependency := range dependencies {
+			retained.Add(dependency)
+		}
+	}
+	for _, v := range e.TaskGraph.Vertices() {
+		if !retained.Includes(v) {
+			e.TaskGraph.Remove(v)
+		}
+	}
+	return nil
+}
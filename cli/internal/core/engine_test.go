@@ -448,6 +448,58 @@ func TestEngineTasksOnly(t *testing.T) {
 	}
 }
 
+func TestRetainTasks(t *testing.T) {
+	// app1 -> libA -> libB
+	graph := &dag.AcyclicGraph{}
+	graph.Add("app1")
+	graph.Add("libA")
+	graph.Add("libB")
+	graph.Connect(dag.BasicEdge("app1", "libA"))
+	graph.Connect(dag.BasicEdge("libA", "libB"))
+
+	p := NewEngine(graph)
+	dependOnBuild := make(util.Set)
+	dependOnBuild.Add("build")
+	p.AddTask(&Task{
+		Name:     "build",
+		TopoDeps: dependOnBuild,
+		Deps:     make(util.Set),
+	})
+	p.AddTask(&Task{
+		Name:     "test",
+		TopoDeps: dependOnBuild,
+		Deps:     make(util.Set),
+	})
+	err := p.Prepare(&EngineExecutionOptions{
+		Packages:  []string{"app1", "libA", "libB"},
+		TaskNames: []string{"test"},
+	})
+	assert.NilError(t, err, "Prepare")
+
+	// Only libA#build is affected. app1#test depends on it, so it stays, along with
+	// libB#build which is needed to run libA#build. libA#test and libB#test are
+	// unaffected and nothing depends on them.
+	affected := make(util.Set)
+	affected.Add("libA#build")
+	err = p.RetainTasks(affected)
+	assert.NilError(t, err, "RetainTasks")
+
+	expected := `
+___ROOT___
+app1#test
+  libA#build
+libA#build
+  libB#build
+libB#build
+  ___ROOT___
+`
+	expected = strings.TrimSpace(expected)
+	actual := strings.TrimSpace(p.TaskGraph.String())
+	if actual != expected {
+		t.Errorf("task graph got:\n%v\nwant:\n%v", actual, expected)
+	}
+}
+
 const leafStringAll = `
 ___ROOT___
 a#build
@@ -2,6 +2,8 @@ package connector
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"os"
 	"os/exec"
@@ -15,6 +17,7 @@ import (
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/status"
 )
@@ -29,6 +32,8 @@ var (
 	// ErrDaemonNotRunning is returned when the client cannot contact the daemon and has
 	// been instructed not to attempt to start a new daemon
 	ErrDaemonNotRunning = errors.New("the daemon is not running")
+	// ErrUnauthenticated is returned when a daemon listening on TCP rejects our token
+	ErrUnauthenticated = errors.New("the daemon rejected the token. Check that TITAN_DAEMON_TOKEN matches the daemon's")
 )
 
 // Opts is the set of configurable options for the client connection,
@@ -37,6 +42,15 @@ var (
 type Opts struct {
 	ServerTimeout time.Duration
 	DontStart     bool // if true, don't attempt to start the daemon
+	// Addr is the host:port of a daemon listening on TCP, such as one shared between
+	// containers. If set, we connect to it instead of a local daemon, and never start
+	// or restart it.
+	Addr string
+	// Token authenticates us to a daemon listening on TCP
+	Token string
+	// CAFile is the path to the PEM-encoded certificates that the TLS certificate of a
+	// daemon listening on TCP must be signed by. If unset, we connect without TLS.
+	CAFile string
 }
 
 // Client represents a connection to the daemon process
@@ -46,6 +60,24 @@ type Client struct {
 	SockPath titanpath.AbsoluteSystemPath
 	PidPath  titanpath.AbsoluteSystemPath
 	LogPath  titanpath.AbsoluteSystemPath
+	// Addr is set instead of the paths above when connected to a daemon over TCP
+	Addr string
+}
+
+// tokenCredentials sends a bearer token with each request. Tokens are only used
+// over TCP, where the daemon can't rely on filesystem permissions to limit access.
+type tokenCredentials string
+
+// GetRequestMetadata implements credentials.PerRPCCredentials.GetRequestMetadata
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{
+		"authorization": "Bearer " + string(t),
+	}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials.RequireTransportSecurity
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
 }
 
 // Connector instances are used to create a connection to titan's daemon process
@@ -197,6 +229,13 @@ func (c *Connector) killDeadServer(pid int) error {
 // Retries and daemon restarts are built in. If this fails,
 // it is unlikely to succeed after an automated retry.
 func (c *Connector) Connect(ctx context.Context) (*Client, error) {
+	if c.Opts.Addr != "" {
+		client, err := c.connectRemote(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "connection to titan daemon at %v failed", c.Opts.Addr)
+		}
+		return client, nil
+	}
 	client, err := c.connectInternal(ctx)
 	if err != nil {
 		return nil, c.wrapConnectionError(err)
@@ -265,6 +304,49 @@ func (c *Connector) connectInternal(ctx context.Context) (*Client, error) {
 	return nil, ErrTooManyAttempts
 }
 
+// remoteCredentials returns the transport credentials for a daemon listening on TCP, which
+// use TLS if we were given the certificates to trust
+func (c *Connector) remoteCredentials() (credentials.TransportCredentials, error) {
+	if c.Opts.CAFile == "" {
+		return insecure.NewCredentials(), nil
+	}
+	contents, err := os.ReadFile(c.Opts.CAFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the daemon's CA certificate")
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(contents) {
+		return nil, fmt.Errorf("no certificates found in %v", c.Opts.CAFile)
+	}
+	return credentials.NewTLS(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}), nil
+}
+
+// connectRemote connects to a daemon listening on TCP. Someone else manages that daemon,
+// so unlike with a local daemon, we don't try to start or replace it.
+func (c *Connector) connectRemote(ctx context.Context) (*Client, error) {
+	creds, err := c.remoteCredentials()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := grpc.Dial(c.Opts.Addr, grpc.WithTransportCredentials(creds), grpc.WithPerRPCCredentials(tokenCredentials(c.Opts.Token)))
+	if err != nil {
+		return nil, err
+	}
+	client := &Client{
+		TurbodClient: titandprotocol.NewTurbodClient(conn),
+		ClientConn:   conn,
+		Addr:         c.Opts.Addr,
+	}
+	if err := c.sendHello(ctx, client); err != nil {
+		_ = client.Close()
+		if errors.Is(err, errConnectionFailure) {
+			return nil, ErrDaemonNotRunning
+		}
+		return nil, err
+	}
+	return client, nil
+}
+
 // getOrStartDaemon returns the PID of the daemon process on success. It may start
 // the daemon if it doesn't find one running.
 func (c *Connector) getOrStartDaemon() (int, error) {
@@ -317,6 +399,8 @@ func (c *Connector) sendHello(ctx context.Context, client titandprotocol.TurbodC
 		return errVersionMismatch
 	case codes.Unavailable:
 		return errConnectionFailure
+	case codes.Unauthenticated:
+		return ErrUnauthenticated
 	default:
 		return err
 	}
@@ -234,3 +234,16 @@ func TestKillLiveServer(t *testing.T) {
 		t.Errorf("expected socket file to have been deleted: %v", sockPath)
 	}
 }
+
+func TestRemoteCredentials(t *testing.T) {
+	c := &Connector{Opts: Opts{Addr: "devbox:7777"}}
+	creds, err := c.remoteCredentials()
+	assert.NilError(t, err, "remoteCredentials")
+	assert.Equal(t, creds.Info().SecurityProtocol, "insecure")
+
+	caFile := fs.AbsoluteSystemPathFromUpstream(t.TempDir()).UntypedJoin("ca.pem")
+	assert.NilError(t, caFile.WriteFile([]byte("not a certificate"), 0644), "WriteFile")
+	c.Opts.CAFile = caFile.ToString()
+	_, err = c.remoteCredentials()
+	assert.ErrorContains(t, err, "no certificates found")
+}
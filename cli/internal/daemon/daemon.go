@@ -3,11 +3,16 @@ package daemon
 import (
 	"context"
 	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
@@ -23,6 +28,8 @@ import (
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
@@ -32,8 +39,26 @@ type daemon struct {
 	timeout    time.Duration
 	reqCh      chan struct{}
 	timedOutCh chan struct{}
+	// activeStreams counts open streaming requests, which keep the daemon from timing out
+	activeStreams int32
+	// streamsDone is closed when the daemon stops, ending any open streams
+	streamsDone chan struct{}
+	// tcpAddr, if set, is an additional address to listen on, for clients that
+	// can't reach our unix socket. Requests over TCP must include token.
+	tcpAddr string
+	token   string
+	// tlsConfig encrypts connections over TCP. Without it, tcpAddr must be a loopback address.
+	tlsConfig *tls.Config
 }
 
+// Clients outside of the daemon's environment, such as in another container, can
+// reach a daemon listening on TCP with these environment variables.
+const (
+	_daemonAddrEnv  = "TITAN_DAEMON_ADDR"
+	_daemonTokenEnv = "TITAN_DAEMON_TOKEN"
+	_daemonCAEnv    = "TITAN_DAEMON_CA"
+)
+
 func getRepoHash(repoRoot titanpath.AbsoluteSystemPath) string {
 	pathHash := sha256.Sum256([]byte(repoRoot.ToString()))
 	// We grab a substring of the hash because there is a 108-character limit on the length
@@ -56,6 +81,13 @@ func getLogFilePath(repoRoot titanpath.AbsoluteSystemPath) (titanpath.AbsoluteSy
 	return logsDir.UntypedJoin(logFilename), nil
 }
 
+// GetFileHashCachePath returns the location of the persistent file hash cache for the
+// repository. It is written by runs, and kept up to date by the daemon's file watching.
+func GetFileHashCachePath(repoRoot titanpath.AbsoluteSystemPath) titanpath.AbsoluteSystemPath {
+	hexHash := getRepoHash(repoRoot)
+	return fs.GetTurboDataDir().UntypedJoin("file-hashes", hexHash+".json")
+}
+
 func getUnixSocket(repoRoot titanpath.AbsoluteSystemPath) titanpath.AbsoluteSystemPath {
 	root := getDaemonFileRoot(repoRoot)
 	return root.UntypedJoin("titand.sock")
@@ -66,6 +98,42 @@ func getPidFile(repoRoot titanpath.AbsoluteSystemPath) titanpath.AbsoluteSystemP
 	return root.UntypedJoin("titand.pid")
 }
 
+// loadTLSConfig returns the configuration with which to serve TLS over TCP, or nil if
+// neither certFile nor keyFile is set
+func loadTLSConfig(certFile string, keyFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	} else if certFile == "" || keyFile == "" {
+		return nil, errors.New("--tls-cert and --tls-key must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load the TLS certificate")
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		// gRPC runs over HTTP/2
+		NextProtos: []string{"h2"},
+	}, nil
+}
+
+// checkLoopbackAddr returns an error unless addr only accepts connections from this machine,
+// since the token would otherwise cross the network in plaintext
+func checkLoopbackAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return errors.Wrapf(err, "invalid TCP address %v", addr)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("listening on %v without TLS would send the token in plaintext. Set --tls-cert and --tls-key, or use a loopback address", addr)
+}
+
 // logError logs an error and outputs it to the UI.
 func (d *daemon) logError(err error) {
 	d.logger.Error(fmt.Sprintf("error %v", err))
@@ -78,6 +146,9 @@ var _logFileFlags = os.O_WRONLY | os.O_APPEND | os.O_CREATE
 // GetCmd returns the root daemon command
 func GetCmd(helper *cmdutil.Helper, signalWatcher *signals.Watcher) *cobra.Command {
 	var idleTimeout time.Duration
+	var tcpAddr string
+	var tlsCert string
+	var tlsKey string
 	cmd := &cobra.Command{
 		Use:           "daemon",
 		Short:         "Runs the Titanrepo background daemon",
@@ -88,6 +159,19 @@ func GetCmd(helper *cmdutil.Helper, signalWatcher *signals.Watcher) *cobra.Comma
 			if err != nil {
 				return err
 			}
+			token := os.Getenv(_daemonTokenEnv)
+			if tcpAddr != "" && token == "" {
+				return fmt.Errorf("listening on TCP requires a token. Set %v to a secret shared with clients", _daemonTokenEnv)
+			}
+			tlsConfig, err := loadTLSConfig(tlsCert, tlsKey)
+			if err != nil {
+				return err
+			}
+			if tcpAddr != "" && tlsConfig == nil {
+				if err := checkLoopbackAddr(tcpAddr); err != nil {
+					return err
+				}
+			}
 			logFilePath, err := getLogFilePath(base.RepoRoot)
 			if err != nil {
 				return err
@@ -107,15 +191,26 @@ func GetCmd(helper *cmdutil.Helper, signalWatcher *signals.Watcher) *cobra.Comma
 				Name:   "titand",
 			})
 			ctx := cmd.Context()
+			opts, err := readDaemonOptions(base.RepoRoot)
+			if err != nil {
+				logger.Warn(fmt.Sprintf("Using the default daemon configuration, since we failed to read it: %v", err))
+			}
+			// An explicit flag takes precedence over titan.json
+			if !cmd.Flags().Changed("idle-time") && opts.IdleTimeout != 0 {
+				idleTimeout = opts.IdleTimeout
+			}
 			d := &daemon{
 				logger:     logger,
 				repoRoot:   base.RepoRoot,
 				timeout:    idleTimeout,
 				reqCh:      make(chan struct{}),
 				timedOutCh: make(chan struct{}),
+				tcpAddr:    tcpAddr,
+				token:      token,
+				tlsConfig:  tlsConfig,
 			}
 			serverName := getRepoHash(base.RepoRoot)
-			titanServer, err := server.New(serverName, d.logger.Named("rpc server"), base.RepoRoot, base.TurboVersion, logFilePath)
+			titanServer, err := server.New(serverName, d.logger.Named("rpc server"), base.RepoRoot, base.TurboVersion, logFilePath, GetFileHashCachePath(base.RepoRoot), opts)
 			if err != nil {
 				d.logError(err)
 				return err
@@ -129,16 +224,36 @@ func GetCmd(helper *cmdutil.Helper, signalWatcher *signals.Watcher) *cobra.Comma
 			return nil
 		},
 	}
-	cmd.Flags().DurationVar(&idleTimeout, "idle-time", 4*time.Hour, "Set the idle timeout for titand")
+	cmd.Flags().DurationVar(&idleTimeout, "idle-time", 4*time.Hour, "Set the idle timeout for titand. Overrides daemon.idleTimeout in titan.json")
+	cmd.Flags().StringVar(&tcpAddr, "tcp-addr", "", fmt.Sprintf("Also listen on the given TCP address, such as 0.0.0.0:7777, for clients in other containers. Requires %v to be set. The token is sent in plaintext unless --tls-cert and --tls-key are set, so without them the address must be a loopback one, such as 127.0.0.1:7777", _daemonTokenEnv))
+	cmd.Flags().StringVar(&tlsCert, "tls-cert", "", "Path to a PEM-encoded certificate with which to encrypt connections to --tcp-addr. Requires --tls-key")
+	cmd.Flags().StringVar(&tlsKey, "tls-key", "", "Path to the PEM-encoded private key of --tls-cert")
 	addDaemonSubcommands(cmd, helper)
 	return cmd
 }
 
+// readDaemonOptions reads the daemon's configuration from titan.json. Repositories without
+// a titan.json get the defaults.
+func readDaemonOptions(repoRoot titanpath.AbsoluteSystemPath) (fs.DaemonOptions, error) {
+	rootPackageJSON, err := fs.ReadPackageJSON(repoRoot.UntypedJoin("package.json"))
+	if err != nil {
+		return fs.DaemonOptions{}, err
+	}
+	titanJSON, err := fs.ReadTurboConfig(repoRoot, rootPackageJSON)
+	if errors.Is(err, os.ErrNotExist) {
+		return fs.DaemonOptions{}, nil
+	} else if err != nil {
+		return fs.DaemonOptions{}, err
+	}
+	return titanJSON.DaemonOptions, nil
+}
+
 func addDaemonSubcommands(cmd *cobra.Command, helper *cmdutil.Helper) {
 	addStatusCmd(cmd, helper)
 	addStartCmd(cmd, helper)
 	addStopCmd(cmd, helper)
 	addRestartCmd(cmd, helper)
+	addEventsCmd(cmd, helper)
 }
 
 var errInactivityTimeout = errors.New("titand shut down from inactivity")
@@ -169,6 +284,7 @@ type rpcServer interface {
 func (d *daemon) runTurboServer(parentContext context.Context, rpcServer rpcServer, signalWatcher *signals.Watcher) error {
 	ctx, cancel := context.WithCancel(parentContext)
 	defer cancel()
+	d.streamsDone = make(chan struct{})
 	pidPath := getPidFile(d.repoRoot)
 	lock, err := tryAcquirePidfileLock(pidPath)
 	if err != nil {
@@ -202,23 +318,55 @@ func (d *daemon) runTurboServer(parentContext context.Context, rpcServer rpcServ
 	if err != nil {
 		return err
 	}
-	// We don't need to explicitly close 'lis', the grpc server will handle that
+	listeners := []net.Listener{lis}
+	if d.tcpAddr != "" {
+		tcpLis, err := net.Listen("tcp", d.tcpAddr)
+		if err != nil {
+			_ = lis.Close()
+			return err
+		}
+		if d.tlsConfig != nil {
+			tcpLis = tls.NewListener(tcpLis, d.tlsConfig)
+		}
+		d.logger.Info(fmt.Sprintf("Listening on %v", tcpLis.Addr()))
+		listeners = append(listeners, tcpLis)
+	}
+	// We don't need to explicitly close the listeners, the grpc server will handle that
 	s := grpc.NewServer(
 		grpc.ChainUnaryInterceptor(
+			d.authorizeRequest,
 			d.onRequest,
 			grpc_recovery.UnaryServerInterceptor(grpc_recovery.WithRecoveryHandler(panicHandler)),
 		),
+		grpc.ChainStreamInterceptor(
+			d.authorizeStream,
+			d.onStream,
+			grpc_recovery.StreamServerInterceptor(grpc_recovery.WithRecoveryHandler(panicHandler)),
+		),
 	)
+	// Streams don't finish on their own, so end them before waiting for requests to complete
+	gracefulStop := func() {
+		close(d.streamsDone)
+		s.GracefulStop()
+	}
 	go d.timeoutLoop(ctx)
 
 	rpcServer.Register(s)
-	errCh := make(chan error)
-	go func(errCh chan<- error) {
-		if err := s.Serve(lis); err != nil {
-			errCh <- err
-		}
+	errCh := make(chan error, len(listeners))
+	serving := &sync.WaitGroup{}
+	for _, lis := range listeners {
+		serving.Add(1)
+		go func(lis net.Listener) {
+			defer serving.Done()
+			if err := s.Serve(lis); err != nil {
+				errCh <- err
+			}
+		}(lis)
+	}
+	go func() {
+		serving.Wait()
 		close(errCh)
-	}(errCh)
+	}()
 
 	// Note that we aren't deferring s.GracefulStop here because we also need
 	// to drain the error channel, which isn't guaranteed to happen until
@@ -231,17 +379,19 @@ func (d *daemon) runTurboServer(parentContext context.Context, rpcServer rpcServ
 		// The server exited
 		if ok {
 			exitErr = err
+			// Stop serving on any other listeners too
+			gracefulStop()
 		}
 	case <-d.timedOutCh:
 		// This is the inactivity timeout case
 		exitErr = errInactivityTimeout
-		s.GracefulStop()
+		gracefulStop()
 	case <-ctx.Done():
 		// If a request handler panics, it will cancel this context
-		s.GracefulStop()
+		gracefulStop()
 	case <-signalWatcher.Done():
 		// This is fired if caught a signal
-		s.GracefulStop()
+		gracefulStop()
 	}
 	// Wait for the server to exit, if it hasn't already.
 	// When it does, this channel will close. We don't
@@ -258,6 +408,70 @@ func (d *daemon) onRequest(ctx context.Context, req interface{}, info *grpc.Unar
 	return handler(ctx, req)
 }
 
+// authorize checks the token sent with requests over TCP. Requests over the unix
+// socket are trusted, since only the socket's owner can connect to it. Requests
+// without a peer can't be told apart, so they must carry the token as well.
+func (d *daemon) authorize(ctx context.Context) error {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr.Network() == "unix" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		token := strings.TrimPrefix(value, "Bearer ")
+		if d.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(d.token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid or missing token")
+}
+
+func (d *daemon) authorizeRequest(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	if err := d.authorize(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (d *daemon) authorizeStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := d.authorize(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// streamWithContext overrides the context of a grpc.ServerStream
+type streamWithContext struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *streamWithContext) Context() context.Context {
+	return s.ctx
+}
+
+func (d *daemon) onStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	d.reqCh <- struct{}{}
+	atomic.AddInt32(&d.activeStreams, 1)
+	defer func() {
+		atomic.AddInt32(&d.activeStreams, -1)
+		// Restart the idle timeout, unless we're already stopping
+		select {
+		case d.reqCh <- struct{}{}:
+		case <-d.streamsDone:
+		}
+	}()
+	ctx, cancel := context.WithCancel(ss.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-d.streamsDone:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return handler(srv, &streamWithContext{ServerStream: ss, ctx: ctx})
+}
+
 func (d *daemon) timeoutLoop(ctx context.Context) {
 	timeoutCh := time.After(d.timeout)
 outer:
@@ -266,6 +480,11 @@ outer:
 		case <-d.reqCh:
 			timeoutCh = time.After(d.timeout)
 		case <-timeoutCh:
+			if atomic.LoadInt32(&d.activeStreams) > 0 {
+				// Someone is still subscribed, so we're not idle
+				timeoutCh = time.After(d.timeout)
+				continue
+			}
 			close(d.timedOutCh)
 			break outer
 		case <-ctx.Done():
@@ -288,6 +507,15 @@ func GetClient(ctx context.Context, repoRoot titanpath.AbsoluteSystemPath, logge
 	if err != nil {
 		return nil, err
 	}
+	if opts.Addr == "" {
+		opts.Addr = os.Getenv(_daemonAddrEnv)
+	}
+	if opts.Token == "" {
+		opts.Token = os.Getenv(_daemonTokenEnv)
+	}
+	if opts.CAFile == "" {
+		opts.CAFile = os.Getenv(_daemonCAEnv)
+	}
 	bin, err := os.Executable()
 	if err != nil {
 		return nil, err
@@ -2,11 +2,20 @@ package daemon
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"errors"
+	"math/big"
+	"net"
 	"os/exec"
 	"runtime"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -17,7 +26,11 @@ import (
 	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
 	"github.com/nightlyone/lockfile"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/grpc_testing"
 	"gotest.tools/v3/assert"
 )
@@ -83,6 +96,12 @@ func (ts *testRPCServer) EmptyCall(ctx context.Context, req *grpc_testing.Empty)
 	panic("intended to panic")
 }
 
+// FullDuplexCall holds the stream open until it is ended by either side
+func (ts *testRPCServer) FullDuplexCall(stream grpc_testing.TestService_FullDuplexCallServer) error {
+	<-stream.Context().Done()
+	return nil
+}
+
 func (ts *testRPCServer) Register(grpcServer server.GRPCServer) {
 	grpc_testing.RegisterTestServiceServer(grpcServer, ts)
 	ts.registered <- struct{}{}
@@ -260,3 +279,303 @@ func TestCleanupOnPanic(t *testing.T) {
 		t.Errorf("expected to clean up %v, but it still exists", pidPath)
 	}
 }
+
+func TestStreamKeepsDaemonAlive(t *testing.T) {
+	logger := hclog.Default()
+	logger.SetLevel(hclog.Debug)
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+
+	ts := newTestRPCServer()
+	watcher := signals.NewWatcher()
+	ctx := context.Background()
+
+	d := &daemon{
+		logger:     logger,
+		repoRoot:   repoRoot,
+		timeout:    50 * time.Millisecond,
+		reqCh:      make(chan struct{}),
+		timedOutCh: make(chan struct{}),
+	}
+	errCh := make(chan error)
+	go func() {
+		err := d.runTurboServer(ctx, ts, watcher)
+		errCh <- err
+	}()
+	<-ts.registered
+
+	creds := insecure.NewCredentials()
+	sockFile := getUnixSocket(repoRoot)
+	conn, err := grpc.Dial("unix://"+sockFile.ToString(), grpc.WithTransportCredentials(creds))
+	assert.NilError(t, err, "Dial")
+	defer func() { _ = conn.Close() }()
+
+	client := grpc_testing.NewTestServiceClient(conn)
+	streamCtx, cancelStream := context.WithCancel(ctx)
+	stream, err := client.FullDuplexCall(streamCtx)
+	assert.NilError(t, err, "FullDuplexCall")
+	// Wait for the stream to reach the server
+	assert.NilError(t, stream.Send(&grpc_testing.StreamingOutputCallRequest{}), "Send")
+	for atomic.LoadInt32(&d.activeStreams) == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// The daemon stays up well past its idle timeout while the stream is open
+	select {
+	case err := <-errCh:
+		t.Fatalf("daemon exited with an open stream: %v", err)
+	case <-time.After(250 * time.Millisecond):
+	}
+
+	// Once the stream closes, the daemon times out as usual
+	cancelStream()
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, errInactivityTimeout) {
+			t.Errorf("server error got %v, want %v", err, errInactivityTimeout)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("timed out waiting for the daemon to exit")
+	}
+}
+
+func TestShutdownEndsStreams(t *testing.T) {
+	logger := hclog.Default()
+	logger.SetLevel(hclog.Debug)
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+
+	ts := newTestRPCServer()
+	watcher := signals.NewWatcher()
+	ctx := context.Background()
+
+	d := &daemon{
+		logger:     logger,
+		repoRoot:   repoRoot,
+		timeout:    5 * time.Second,
+		reqCh:      make(chan struct{}),
+		timedOutCh: make(chan struct{}),
+	}
+	errCh := make(chan error)
+	go func() {
+		err := d.runTurboServer(ctx, ts, watcher)
+		errCh <- err
+	}()
+	<-ts.registered
+
+	creds := insecure.NewCredentials()
+	sockFile := getUnixSocket(repoRoot)
+	conn, err := grpc.Dial("unix://"+sockFile.ToString(), grpc.WithTransportCredentials(creds))
+	assert.NilError(t, err, "Dial")
+	defer func() { _ = conn.Close() }()
+
+	client := grpc_testing.NewTestServiceClient(conn)
+	stream, err := client.FullDuplexCall(ctx)
+	assert.NilError(t, err, "FullDuplexCall")
+	assert.NilError(t, stream.Send(&grpc_testing.StreamingOutputCallRequest{}), "Send")
+	for atomic.LoadInt32(&d.activeStreams) == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// An open stream doesn't stop the daemon from shutting down
+	watcher.Close()
+	select {
+	case err := <-errCh:
+		assert.NilError(t, err, "runTurboServer")
+	case <-time.After(5 * time.Second):
+		t.Error("timed out waiting for the daemon to exit")
+	}
+}
+
+func TestTCPRequiresToken(t *testing.T) {
+	logger := hclog.Default()
+	logger.SetLevel(hclog.Debug)
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+
+	// Find a free port to listen on
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err, "Listen")
+	tcpAddr := lis.Addr().String()
+	assert.NilError(t, lis.Close(), "Close")
+
+	ts := newTestRPCServer()
+	watcher := signals.NewWatcher()
+	ctx := context.Background()
+
+	d := &daemon{
+		logger:     logger,
+		repoRoot:   repoRoot,
+		timeout:    5 * time.Second,
+		reqCh:      make(chan struct{}),
+		timedOutCh: make(chan struct{}),
+		tcpAddr:    tcpAddr,
+		token:      "secret",
+	}
+	errCh := make(chan error)
+	go func() {
+		err := d.runTurboServer(ctx, ts, watcher)
+		errCh <- err
+	}()
+	<-ts.registered
+
+	creds := insecure.NewCredentials()
+	assertCode := func(conn *grpc.ClientConn, callCtx context.Context, expected codes.Code) {
+		t.Helper()
+		client := grpc_testing.NewTestServiceClient(conn)
+		// The test server doesn't implement UnaryCall, so requests that get
+		// past authorization fail as unimplemented
+		_, err := client.UnaryCall(callCtx, &grpc_testing.SimpleRequest{})
+		assert.Equal(t, status.Code(err), expected)
+	}
+
+	tcpConn, err := grpc.Dial(tcpAddr, grpc.WithTransportCredentials(creds))
+	assert.NilError(t, err, "Dial")
+	defer func() { _ = tcpConn.Close() }()
+	assertCode(tcpConn, ctx, codes.Unauthenticated)
+	wrongToken := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer wrong")
+	assertCode(tcpConn, wrongToken, codes.Unauthenticated)
+	rightToken := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret")
+	assertCode(tcpConn, rightToken, codes.Unimplemented)
+
+	// The unix socket doesn't need a token
+	sockFile := getUnixSocket(repoRoot)
+	unixConn, err := grpc.Dial("unix://"+sockFile.ToString(), grpc.WithTransportCredentials(creds))
+	assert.NilError(t, err, "Dial")
+	defer func() { _ = unixConn.Close() }()
+	assertCode(unixConn, ctx, codes.Unimplemented)
+
+	// Shutting down stops both listeners
+	watcher.Close()
+	select {
+	case err := <-errCh:
+		assert.NilError(t, err, "runTurboServer")
+	case <-time.After(5 * time.Second):
+		t.Error("timed out waiting for the daemon to exit")
+	}
+}
+
+func TestAuthorizeWithoutPeer(t *testing.T) {
+	d := &daemon{token: "secret"}
+	assert.Equal(t, status.Code(d.authorize(context.Background())), codes.Unauthenticated)
+	withToken := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer secret"))
+	assert.NilError(t, d.authorize(withToken), "authorize")
+}
+
+func TestCheckLoopbackAddr(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1:7777", "localhost:7777", "[::1]:7777"} {
+		assert.NilError(t, checkLoopbackAddr(addr), addr)
+	}
+	for _, addr := range []string{"0.0.0.0:7777", ":7777", "devbox:7777", "10.0.0.2:7777"} {
+		assert.ErrorContains(t, checkLoopbackAddr(addr), "without TLS")
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate for 127.0.0.1 and its key,
+// returning their paths
+func writeTestCertificate(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err, "GenerateKey")
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "titand"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NilError(t, err, "CreateCertificate")
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NilError(t, err, "MarshalECPrivateKey")
+	dir := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	certFile := dir.UntypedJoin("cert.pem")
+	keyFile := dir.UntypedJoin("key.pem")
+	assert.NilError(t, certFile.WriteFile(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644), "WriteFile")
+	assert.NilError(t, keyFile.WriteFile(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600), "WriteFile")
+	return certFile.ToString(), keyFile.ToString()
+}
+
+func TestTCPWithTLS(t *testing.T) {
+	logger := hclog.Default()
+	logger.SetLevel(hclog.Debug)
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	certFile, keyFile := writeTestCertificate(t)
+	tlsConfig, err := loadTLSConfig(certFile, keyFile)
+	assert.NilError(t, err, "loadTLSConfig")
+	_, err = loadTLSConfig(certFile, "")
+	assert.ErrorContains(t, err, "must be set together")
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err, "Listen")
+	tcpAddr := lis.Addr().String()
+	assert.NilError(t, lis.Close(), "Close")
+
+	ts := newTestRPCServer()
+	watcher := signals.NewWatcher()
+	ctx := context.Background()
+	d := &daemon{
+		logger:     logger,
+		repoRoot:   repoRoot,
+		timeout:    5 * time.Second,
+		reqCh:      make(chan struct{}),
+		timedOutCh: make(chan struct{}),
+		tcpAddr:    tcpAddr,
+		token:      "secret",
+		tlsConfig:  tlsConfig,
+	}
+	errCh := make(chan error)
+	go func() {
+		err := d.runTurboServer(ctx, ts, watcher)
+		errCh <- err
+	}()
+	<-ts.registered
+
+	creds, err := credentials.NewClientTLSFromFile(certFile, "")
+	assert.NilError(t, err, "NewClientTLSFromFile")
+	conn, err := grpc.Dial(tcpAddr, grpc.WithTransportCredentials(creds))
+	assert.NilError(t, err, "Dial")
+	defer func() { _ = conn.Close() }()
+	client := grpc_testing.NewTestServiceClient(conn)
+	rightToken := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret")
+	_, err = client.UnaryCall(rightToken, &grpc_testing.SimpleRequest{})
+	assert.Equal(t, status.Code(err), codes.Unimplemented)
+
+	// Plaintext connections are refused
+	plainConn, err := grpc.Dial(tcpAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NilError(t, err, "Dial")
+	defer func() { _ = plainConn.Close() }()
+	shortCtx, cancel := context.WithTimeout(rightToken, time.Second)
+	defer cancel()
+	_, err = grpc_testing.NewTestServiceClient(plainConn).UnaryCall(shortCtx, &grpc_testing.SimpleRequest{})
+	assert.Assert(t, status.Code(err) != codes.Unimplemented, "expected a plaintext request to fail, got %v", err)
+
+	watcher.Close()
+	select {
+	case err := <-errCh:
+		assert.NilError(t, err, "runTurboServer")
+	case <-time.After(5 * time.Second):
+		t.Error("timed out waiting for the daemon to exit")
+	}
+}
+
+func TestReadDaemonOptions(t *testing.T) {
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	err := repoRoot.UntypedJoin("package.json").WriteFile([]byte(`{"name": "root"}`), 0644)
+	assert.NilError(t, err, "WriteFile")
+
+	// Without a titan.json, we use the defaults
+	opts, err := readDaemonOptions(repoRoot)
+	assert.NilError(t, err, "readDaemonOptions")
+	assert.DeepEqual(t, opts, fs.DaemonOptions{})
+
+	err = repoRoot.UntypedJoin("titan.json").WriteFile([]byte(`{"daemon": {"idleTimeout": "10m", "ignore": ["tmp"]}, "pipeline": {}}`), 0644)
+	assert.NilError(t, err, "WriteFile")
+	opts, err = readDaemonOptions(repoRoot)
+	assert.NilError(t, err, "readDaemonOptions")
+	assert.DeepEqual(t, opts, fs.DaemonOptions{
+		IdleTimeout: 10 * time.Minute,
+		Ignore:      []string{"tmp"},
+	})
+}
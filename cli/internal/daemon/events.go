@@ -0,0 +1,52 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/cmdutil"
+	"github.com/khulnasoft/titanrepo/cli/internal/daemonclient"
+	"github.com/spf13/cobra"
+)
+
+func addEventsCmd(root *cobra.Command, helper *cmdutil.Helper) {
+	cmd := &cobra.Command{
+		Use:           "events",
+		Short:         "Streams changes to packages, outputs and runs from the titan daemon as JSON",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			base, err := helper.GetCmdBase(cmd.Flags())
+			if err != nil {
+				return err
+			}
+			l := &lifecycle{
+				base,
+			}
+			if err := l.events(cmd.Context()); err != nil {
+				l.logError(err)
+				return err
+			}
+			return nil
+		},
+	}
+	root.AddCommand(cmd)
+}
+
+// events prints each event from the daemon as a line of JSON, starting the daemon if necessary
+func (l *lifecycle) events(ctx context.Context) error {
+	client, err := GetClient(ctx, l.base.RepoRoot, l.base.Logger, l.base.TurboVersion, ClientOpts{})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+	titanClient := daemonclient.New(client)
+	return titanClient.Subscribe(ctx, func(event daemonclient.Event) error {
+		rendered, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		l.base.UI.Output(string(rendered))
+		return nil
+	})
+}
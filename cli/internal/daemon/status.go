@@ -63,12 +63,36 @@ func (l *lifecycle) status(ctx context.Context, outputJSON bool) error {
 		uptime := time.Duration(int64(status.UptimeMs * 1000 * 1000))
 		l.base.UI.Output(fmt.Sprintf("Daemon log file: %v", status.LogFile))
 		l.base.UI.Output(fmt.Sprintf("Daemon uptime: %v", uptime.String()))
-		l.base.UI.Output(fmt.Sprintf("Daemon pid file: %v", client.PidPath))
-		l.base.UI.Output(fmt.Sprintf("Daemon socket file: %v", client.SockPath))
+		if client.Addr != "" {
+			l.base.UI.Output(fmt.Sprintf("Daemon address: %v", client.Addr))
+		} else {
+			l.base.UI.Output(fmt.Sprintf("Daemon pid file: %v", client.PidPath))
+			l.base.UI.Output(fmt.Sprintf("Daemon socket file: %v", client.SockPath))
+		}
+		l.base.UI.Output(fmt.Sprintf("Daemon version: %v", status.Version))
+		l.base.UI.Output(fmt.Sprintf("Repository root: %v", status.RepoRoot))
+		l.base.UI.Output(fmt.Sprintf("Memory: %v heap, %v total", formatBytes(status.HeapBytes), formatBytes(status.MemoryBytes)))
+		if status.Watching {
+			l.base.UI.Output(fmt.Sprintf("File watching: %v paths watched", status.WatchedPaths))
+		} else {
+			l.base.UI.Output("File watching: stopped")
+		}
+		l.base.UI.Output(fmt.Sprintf("Tracked outputs: %v globs across %v task hashes", status.TrackedGlobs, status.TrackedHashes))
+		if len(status.RecentErrors) > 0 {
+			l.base.UI.Output("Recent file watching errors:")
+			for _, watchErr := range status.RecentErrors {
+				l.base.UI.Output(fmt.Sprintf("  %v: %v", watchErr.Time.Format(time.RFC3339), watchErr.Message))
+			}
+		}
 	}
 	return nil
 }
 
+// formatBytes renders a number of bytes in MiB, which is the right scale for the daemon's memory use
+func formatBytes(bytes uint64) string {
+	return fmt.Sprintf("%.1f MiB", float64(bytes)/(1<<20))
+}
+
 func (l *lifecycle) reportStatusError(err error, outputJSON bool) error {
 	var msg string
 	if errors.Is(err, connector.ErrDaemonNotRunning) {
@@ -4,6 +4,7 @@ package daemonclient
 
 import (
 	"context"
+	"time"
 
 	"github.com/khulnasoft/titanrepo/cli/internal/daemon/connector"
 	"github.com/khulnasoft/titanrepo/cli/internal/fs"
@@ -18,10 +19,26 @@ type DaemonClient struct {
 
 // Status provides details about the daemon's status
 type Status struct {
-	UptimeMs uint64                       `json:"uptimeMs"`
-	LogFile  titanpath.AbsoluteSystemPath `json:"logFile"`
-	PidFile  titanpath.AbsoluteSystemPath `json:"pidFile"`
-	SockFile titanpath.AbsoluteSystemPath `json:"sockFile"`
+	UptimeMs      uint64                       `json:"uptimeMs"`
+	LogFile       titanpath.AbsoluteSystemPath `json:"logFile"`
+	PidFile       titanpath.AbsoluteSystemPath `json:"pidFile"`
+	SockFile      titanpath.AbsoluteSystemPath `json:"sockFile"`
+	Addr          string                       `json:"addr,omitempty"`
+	Version       string                       `json:"version"`
+	RepoRoot      titanpath.AbsoluteSystemPath `json:"repoRoot"`
+	Watching      bool                         `json:"watching"`
+	WatchedPaths  uint64                       `json:"watchedPaths"`
+	TrackedHashes uint64                       `json:"trackedHashes"`
+	TrackedGlobs  uint64                       `json:"trackedGlobs"`
+	RecentErrors  []WatchError                 `json:"recentErrors"`
+	HeapBytes     uint64                       `json:"heapBytes"`
+	MemoryBytes   uint64                       `json:"memoryBytes"`
+}
+
+// WatchError is an error that the daemon encountered while watching files
+type WatchError struct {
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
 }
 
 // New creates a new instance of a DaemonClient.
@@ -61,10 +78,84 @@ func (d *DaemonClient) Status(ctx context.Context) (*Status, error) {
 		return nil, err
 	}
 	daemonStatus := resp.DaemonStatus
+	recentErrors := make([]WatchError, len(daemonStatus.RecentErrors))
+	for i, watchErr := range daemonStatus.RecentErrors {
+		recentErrors[i] = WatchError{
+			Message: watchErr.Message,
+			Time:    time.UnixMilli(int64(watchErr.TimestampMsec)),
+		}
+	}
+	logFile := d.client.LogPath
+	if logFile == "" {
+		// A daemon we reach over TCP may not share our filesystem, so report its path
+		logFile = titanpath.AbsoluteSystemPath(daemonStatus.LogFile)
+	}
 	return &Status{
-		UptimeMs: daemonStatus.UptimeMsec,
-		LogFile:  d.client.LogPath,
-		PidFile:  d.client.PidPath,
-		SockFile: d.client.SockPath,
+		UptimeMs:      daemonStatus.UptimeMsec,
+		LogFile:       logFile,
+		PidFile:       d.client.PidPath,
+		SockFile:      d.client.SockPath,
+		Addr:          d.client.Addr,
+		Version:       daemonStatus.Version,
+		RepoRoot:      titanpath.AbsoluteSystemPath(daemonStatus.RepoRoot),
+		Watching:      daemonStatus.Watching,
+		WatchedPaths:  daemonStatus.WatchedPaths,
+		TrackedHashes: daemonStatus.TrackedHashes,
+		TrackedGlobs:  daemonStatus.TrackedGlobs,
+		RecentErrors:  recentErrors,
+		HeapBytes:     daemonStatus.HeapBytes,
+		MemoryBytes:   daemonStatus.MemoryBytes,
 	}, nil
 }
+
+// GetPackageGraph returns the packages of the package graph that the daemon keeps, including
+// the root package. Only their Name, Dir, InternalDeps and ExternalDepsHash are set.
+func (d *DaemonClient) GetPackageGraph(ctx context.Context) ([]*fs.PackageJSON, error) {
+	resp, err := d.client.GetPackageGraph(ctx, &titandprotocol.GetPackageGraphRequest{})
+	if err != nil {
+		return nil, err
+	}
+	packages := make([]*fs.PackageJSON, len(resp.Packages))
+	for i, pkg := range resp.Packages {
+		packages[i] = &fs.PackageJSON{
+			Name:             pkg.Name,
+			Dir:              titanpath.AnchoredUnixPath(pkg.Path).ToSystemPath(),
+			InternalDeps:     pkg.Dependencies,
+			ExternalDepsHash: pkg.ExternalDepsHash,
+		}
+	}
+	return packages, nil
+}
+
+// GetFileHashes returns the hashes of the files in the given package that match inputPatterns,
+// or of all of its files if there are no patterns, keyed by their path within the package.
+func (d *DaemonClient) GetFileHashes(ctx context.Context, packagePath titanpath.AnchoredSystemPath, inputPatterns []string) (map[titanpath.AnchoredUnixPath]string, error) {
+	resp, err := d.client.GetFileHashes(ctx, &titandprotocol.GetFileHashesRequest{
+		PackagePath:   packagePath.ToUnixPath().ToString(),
+		InputPatterns: inputPatterns,
+	})
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[titanpath.AnchoredUnixPath]string, len(resp.FileHashes))
+	for _, fileHash := range resp.FileHashes {
+		hashes[titanpath.AnchoredUnixPath(fileHash.Path)] = fileHash.Hash
+	}
+	return hashes, nil
+}
+
+// GetChangedPackages returns the names of the packages with files that have changed between
+// fromRef and toRef. Changes to files matching globalDepPatterns affect every package, while
+// changes to files matching ignorePatterns are not considered.
+func (d *DaemonClient) GetChangedPackages(ctx context.Context, fromRef string, toRef string, globalDepPatterns []string, ignorePatterns []string) ([]string, error) {
+	resp, err := d.client.GetChangedPackages(ctx, &titandprotocol.GetChangedPackagesRequest{
+		FromRef:           fromRef,
+		ToRef:             toRef,
+		GlobalDepPatterns: globalDepPatterns,
+		IgnorePatterns:    ignorePatterns,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Packages, nil
+}
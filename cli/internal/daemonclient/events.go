@@ -0,0 +1,119 @@
+package daemonclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/titandprotocol"
+)
+
+// RunStatus is the state of a titan run, as reported to subscribers
+type RunStatus string
+
+const (
+	// RunStarted is reported when a run starts executing tasks
+	RunStarted RunStatus = "started"
+	// RunSucceeded is reported when every task in a run has succeeded
+	RunSucceeded RunStatus = "succeeded"
+	// RunFailed is reported when a run stops with an error
+	RunFailed RunStatus = "failed"
+)
+
+var _runStatusToProto = map[RunStatus]titandprotocol.RunStatus{
+	RunStarted:   titandprotocol.RunStatus_RUN_STATUS_STARTED,
+	RunSucceeded: titandprotocol.RunStatus_RUN_STATUS_SUCCEEDED,
+	RunFailed:    titandprotocol.RunStatus_RUN_STATUS_FAILED,
+}
+
+// EventType identifies the kind of change an Event describes
+type EventType string
+
+const (
+	// PackagesChanged events list packages containing files that have changed
+	PackagesChanged EventType = "packagesChanged"
+	// OutputsInvalidated events list the outputs of a task hash that have changed on disk
+	OutputsInvalidated EventType = "outputsInvalidated"
+	// OutputsWritten events list the outputs written for a task hash
+	OutputsWritten EventType = "outputsWritten"
+	// RunStatusChanged events report the progress of a run
+	RunStatusChanged EventType = "runStatusChanged"
+)
+
+// Event is a change in the repository or a run against it, as reported by the daemon
+type Event struct {
+	Type        EventType `json:"type"`
+	Time        time.Time `json:"time"`
+	Packages    []string  `json:"packages,omitempty"`
+	Hash        string    `json:"hash,omitempty"`
+	OutputGlobs []string  `json:"outputGlobs,omitempty"`
+	RunID       string    `json:"runId,omitempty"`
+	RunStatus   RunStatus `json:"runStatus,omitempty"`
+	Targets     []string  `json:"targets,omitempty"`
+}
+
+// NotifyRunStatus tells the daemon about the progress of a run, so that it can be reported to subscribers
+func (d *DaemonClient) NotifyRunStatus(ctx context.Context, runID string, status RunStatus, targets []string) error {
+	_, err := d.client.NotifyRunStatus(ctx, &titandprotocol.NotifyRunStatusRequest{
+		RunId:   runID,
+		Status:  _runStatusToProto[status],
+		Targets: targets,
+	})
+	return err
+}
+
+// Subscribe calls onEvent with each event from the daemon, until ctx is cancelled or
+// the daemon ends the stream.
+func (d *DaemonClient) Subscribe(ctx context.Context, onEvent func(Event) error) error {
+	stream, err := d.client.Subscribe(ctx, &titandprotocol.SubscribeRequest{})
+	if err != nil {
+		return err
+	}
+	for {
+		ev, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if event, ok := eventFromProto(ev); ok {
+			if err := onEvent(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// eventFromProto converts an event from the daemon. Events of kinds that
+// we don't know about are skipped.
+func eventFromProto(ev *titandprotocol.Event) (Event, bool) {
+	event := Event{
+		Time: time.UnixMilli(int64(ev.TimestampMsec)),
+	}
+	switch e := ev.Event.(type) {
+	case *titandprotocol.Event_PackagesChanged:
+		event.Type = PackagesChanged
+		event.Packages = e.PackagesChanged.Packages
+	case *titandprotocol.Event_OutputsInvalidated:
+		event.Type = OutputsInvalidated
+		event.Hash = e.OutputsInvalidated.Hash
+		event.OutputGlobs = e.OutputsInvalidated.OutputGlobs
+	case *titandprotocol.Event_OutputsWritten:
+		event.Type = OutputsWritten
+		event.Hash = e.OutputsWritten.Hash
+		event.OutputGlobs = e.OutputsWritten.OutputGlobs
+	case *titandprotocol.Event_RunStatusChanged:
+		event.Type = RunStatusChanged
+		event.RunID = e.RunStatusChanged.RunId
+		event.Targets = e.RunStatusChanged.Targets
+		for status, protoStatus := range _runStatusToProto {
+			if protoStatus == e.RunStatusChanged.Status {
+				event.RunStatus = status
+			}
+		}
+	default:
+		return Event{}, false
+	}
+	return event, true
+}
@@ -0,0 +1,42 @@
+package daemonclient
+
+import (
+	"context"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/hashing"
+	"github.com/khulnasoft/titanrepo/cli/internal/scm"
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+)
+
+// daemonSCM asks the daemon for package file hashes and changed packages, which it keeps
+// up to date as files change, and defers everything else to the wrapped SCM.
+type daemonSCM struct {
+	scm.SCM
+	ctx    context.Context
+	client *DaemonClient
+}
+
+// SCM returns an SCM that gets package file hashes and changed packages from the daemon.
+// If the daemon can't provide them, they are calculated by fallback instead.
+func (d *DaemonClient) SCM(ctx context.Context, fallback scm.SCM) scm.SCM {
+	return &daemonSCM{
+		SCM:    fallback,
+		ctx:    ctx,
+		client: d,
+	}
+}
+
+// GetPackageFileHashes implements scm.SCM.GetPackageFileHashes
+func (s *daemonSCM) GetPackageFileHashes(rootPath titanpath.AbsoluteSystemPath, opts *hashing.PackageDepsOptions) (map[titanpath.AnchoredUnixPath]string, error) {
+	hashes, err := s.client.GetFileHashes(s.ctx, opts.PackagePath, opts.InputPatterns)
+	if err != nil {
+		return s.SCM.GetPackageFileHashes(rootPath, opts)
+	}
+	return hashes, nil
+}
+
+// ChangedPackages returns the packages that the daemon finds to have changed between fromRef
+// and toRef, using its copy of the package graph
+func (s *daemonSCM) ChangedPackages(fromRef string, toRef string, globalDepPatterns []string, ignorePatterns []string) ([]string, error) {
+	return s.client.GetChangedPackages(s.ctx, fromRef, toRef, globalDepPatterns, ignorePatterns)
+}
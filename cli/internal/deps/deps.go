@@ -0,0 +1,185 @@
+// Package deps implements the titan deps command, which queries the external dependencies
+// of each workspace as titan resolves them from the lockfile
+package deps
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/khulnasoft/titanrepo/cli/internal/cmdutil"
+	"github.com/khulnasoft/titanrepo/cli/internal/context"
+	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type opts struct {
+	workspace  string
+	outputJSON bool
+}
+
+// GetCmd returns the deps command and its subcommands for use with cobra
+func GetCmd(helper *cmdutil.Helper) *cobra.Command {
+	opts := &opts{}
+	cmd := &cobra.Command{
+		Use:           "deps",
+		Short:         "Query the external dependencies resolved from your lockfile",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	cmd.PersistentFlags().StringVar(&opts.workspace, "workspace", "", "Only consider the given workspace. Use // for the root workspace.")
+	cmd.PersistentFlags().BoolVar(&opts.outputJSON, "json", false, "Output in JSON format")
+	cmd.AddCommand(&cobra.Command{
+		Use:           "list",
+		Short:         "List the external dependencies of each workspace, including transitive dependencies",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDeps(helper, cmd, func(d *deps) error {
+				return d.list(opts)
+			})
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:           "why <package name>",
+		Short:         "Show why each workspace depends on the given package",
+		Args:          cobra.ExactArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDeps(helper, cmd, func(d *deps) error {
+				return d.why(opts, args[0])
+			})
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:           "duplicates",
+		Short:         "List the packages that resolve to more than one version",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDeps(helper, cmd, func(d *deps) error {
+				return d.duplicates(opts)
+			})
+		},
+	})
+	return cmd
+}
+
+func runDeps(helper *cmdutil.Helper, cmd *cobra.Command, fn func(d *deps) error) error {
+	base, err := helper.GetCmdBase(cmd.Flags())
+	if err != nil {
+		return err
+	}
+	d := &deps{
+		base,
+	}
+	if err := fn(d); err != nil {
+		d.base.LogError("%v", err)
+		return err
+	}
+	return nil
+}
+
+type deps struct {
+	base *cmdutil.CmdBase
+}
+
+// resolve builds the package graph and resolves the external dependencies of the workspaces
+// selected by opts
+func (d *deps) resolve(opts *opts) (map[string]*workspaceGraph, error) {
+	rootPackageJSON, err := fs.ReadPackageJSON(d.base.RepoRoot.UntypedJoin("package.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read package.json: %w", err)
+	}
+	ctx, err := context.BuildPackageGraph(d.base.RepoRoot, rootPackageJSON)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not construct graph")
+	}
+	var workspaces []string
+	if opts.workspace != "" {
+		workspaces = []string{opts.workspace}
+	}
+	return resolveWorkspaces(ctx, workspaces)
+}
+
+func (d *deps) list(opts *opts) error {
+	graphs, err := d.resolve(opts)
+	if err != nil {
+		return err
+	}
+	workspaceDeps := list(graphs)
+	if opts.outputJSON {
+		return d.outputJSON(workspaceDeps)
+	}
+	for _, workspace := range sortedWorkspaces(graphs) {
+		indent := ""
+		if opts.workspace == "" {
+			d.base.UI.Output(color.New(color.Bold).Sprint(workspace))
+			indent = "  "
+		}
+		for _, dep := range workspaceDeps[workspace] {
+			d.base.UI.Output(indent + dep.String())
+		}
+	}
+	return nil
+}
+
+func (d *deps) why(opts *opts, name string) error {
+	graphs, err := d.resolve(opts)
+	if err != nil {
+		return err
+	}
+	paths, err := why(graphs, name)
+	if err != nil {
+		return err
+	}
+	if opts.outputJSON {
+		return d.outputJSON(paths)
+	}
+	for _, path := range paths {
+		chain := make([]string, len(path.Path))
+		for i, dep := range path.Path {
+			chain[i] = dep.String()
+		}
+		d.base.UI.Output(fmt.Sprintf("%v > %v", color.New(color.Bold).Sprint(path.Workspace), strings.Join(chain, " > ")))
+	}
+	return nil
+}
+
+func (d *deps) duplicates(opts *opts) error {
+	graphs, err := d.resolve(opts)
+	if err != nil {
+		return err
+	}
+	dupes := duplicates(graphs)
+	if opts.outputJSON {
+		return d.outputJSON(dupes)
+	}
+	for _, dupe := range dupes {
+		d.base.UI.Output(color.New(color.Bold).Sprint(dupe.Name))
+		versions := make([]string, 0, len(dupe.Versions))
+		for version := range dupe.Versions {
+			versions = append(versions, version)
+		}
+		sort.Strings(versions)
+		for _, version := range versions {
+			d.base.UI.Output(fmt.Sprintf("  %v: %v", version, strings.Join(dupe.Versions[version], ", ")))
+		}
+	}
+	return nil
+}
+
+func (d *deps) outputJSON(v interface{}) error {
+	rendered, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	d.base.UI.Output(string(rendered))
+	return nil
+}
@@ -0,0 +1,130 @@
+package deps
+
+import (
+	"testing"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/context"
+	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupRepo(t *testing.T) *context.Context {
+	t.Helper()
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	writeFile := func(path string, contents string) {
+		t.Helper()
+		file := repoRoot.UntypedJoin(path)
+		assert.NoError(t, file.EnsureDir())
+		assert.NoError(t, file.WriteFile([]byte(contents), 0644))
+	}
+	writeFile("package.json", `{"name": "root", "packageManager": "npm@8.19.2", "workspaces": ["apps/*", "packages/*"], "devDependencies": {"prettier": "^2.8.0"}}`)
+	writeFile("apps/web/package.json", `{"name": "web", "dependencies": {"next": "^13.0.0", "ui": "*"}}`)
+	writeFile("apps/docs/package.json", `{"name": "docs", "dependencies": {"react": "^17.0.0"}}`)
+	writeFile("packages/ui/package.json", `{"name": "ui", "dependencies": {"react": "^18.0.0"}}`)
+	writeFile("package-lock.json", `{
+  "name": "root",
+  "lockfileVersion": 3,
+  "packages": {
+    "": {"name": "root", "workspaces": ["apps/*", "packages/*"], "devDependencies": {"prettier": "^2.8.0"}},
+    "apps/web": {"name": "web", "dependencies": {"next": "^13.0.0", "ui": "*"}},
+    "apps/docs": {"name": "docs", "dependencies": {"react": "^17.0.0"}},
+    "apps/docs/node_modules/react": {"version": "17.0.2", "dependencies": {"loose-envify": "^1.1.0"}},
+    "packages/ui": {"name": "ui", "dependencies": {"react": "^18.0.0"}},
+    "node_modules/next": {"version": "13.0.0", "dependencies": {"react": "^18.0.0", "styled-jsx": "5.1.0"}},
+    "node_modules/styled-jsx": {"version": "5.1.0"},
+    "node_modules/react": {"version": "18.2.0", "dependencies": {"loose-envify": "^1.1.0"}},
+    "node_modules/loose-envify": {"version": "1.4.0"},
+    "node_modules/prettier": {"version": "2.8.0", "dev": true},
+    "node_modules/web": {"resolved": "apps/web", "link": true},
+    "node_modules/docs": {"resolved": "apps/docs", "link": true},
+    "node_modules/ui": {"resolved": "packages/ui", "link": true}
+  }
+}`)
+
+	rootPackageJSON, err := fs.ReadPackageJSON(repoRoot.UntypedJoin("package.json"))
+	assert.NoError(t, err)
+	ctx, err := context.BuildPackageGraph(repoRoot, rootPackageJSON)
+	if err != nil {
+		t.Fatalf("failed to build package graph: %v", err)
+	}
+	return ctx
+}
+
+func Test_List(t *testing.T) {
+	ctx := setupRepo(t)
+
+	graphs, err := resolveWorkspaces(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]Dependency{
+		util.RootPkgName: {{Name: "prettier", Version: "2.8.0"}},
+		"web": {
+			{Name: "loose-envify", Version: "1.4.0"},
+			{Name: "next", Version: "13.0.0"},
+			{Name: "react", Version: "18.2.0"},
+			{Name: "styled-jsx", Version: "5.1.0"},
+		},
+		"docs": {
+			{Name: "loose-envify", Version: "1.4.0"},
+			{Name: "react", Version: "17.0.2"},
+		},
+		"ui": {
+			{Name: "loose-envify", Version: "1.4.0"},
+			{Name: "react", Version: "18.2.0"},
+		},
+	}, list(graphs))
+
+	graphs, err = resolveWorkspaces(ctx, []string{"ui"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ui"}, sortedWorkspaces(graphs))
+
+	_, err = resolveWorkspaces(ctx, []string{"missing"})
+	assert.EqualError(t, err, "workspace missing not found")
+}
+
+func Test_Why(t *testing.T) {
+	ctx := setupRepo(t)
+	graphs, err := resolveWorkspaces(ctx, nil)
+	assert.NoError(t, err)
+
+	paths, err := why(graphs, "loose-envify")
+	assert.NoError(t, err)
+	assert.Equal(t, []DependencyPath{
+		{Workspace: "docs", Path: []Dependency{{Name: "react", Version: "17.0.2"}, {Name: "loose-envify", Version: "1.4.0"}}},
+		{Workspace: "ui", Path: []Dependency{{Name: "react", Version: "18.2.0"}, {Name: "loose-envify", Version: "1.4.0"}}},
+		{Workspace: "web", Path: []Dependency{{Name: "next", Version: "13.0.0"}, {Name: "react", Version: "18.2.0"}, {Name: "loose-envify", Version: "1.4.0"}}},
+	}, paths)
+
+	_, err = why(graphs, "lodash")
+	assert.EqualError(t, err, "no workspace depends on lodash")
+}
+
+func Test_Duplicates(t *testing.T) {
+	ctx := setupRepo(t)
+	graphs, err := resolveWorkspaces(ctx, nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Duplicate{
+		{Name: "react", Versions: map[string][]string{
+			"17.0.2": {"docs"},
+			"18.2.0": {"ui", "web"},
+		}},
+	}, duplicates(graphs))
+
+	graphs, err = resolveWorkspaces(ctx, []string{"web"})
+	assert.NoError(t, err)
+	assert.Equal(t, []Duplicate{}, duplicates(graphs))
+}
+
+func Test_PackageName(t *testing.T) {
+	testCases := map[string]string{
+		"react":                                  "react",
+		"@babel/core":                            "@babel/core",
+		"node_modules/react":                     "react",
+		"apps/docs/node_modules/@babel/core":     "@babel/core",
+		"node_modules/next/node_modules/postcss": "postcss",
+	}
+	for dep, expected := range testCases {
+		assert.Equal(t, expected, packageName(dep), dep)
+	}
+}
@@ -0,0 +1,229 @@
+package deps
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/context"
+	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/lockfile"
+	"github.com/khulnasoft/titanrepo/cli/internal/util"
+	"github.com/pkg/errors"
+)
+
+// Dependency is an external package as resolved in the lockfile
+type Dependency struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+func (d Dependency) String() string {
+	return d.Name + "@" + d.Version
+}
+
+// resolvedDependency is a lockfile entry along with the lockfile keys of its dependencies
+type resolvedDependency struct {
+	Dependency
+	dependencies []string
+}
+
+// workspaceGraph is the external dependency graph of a single workspace, keyed by lockfile key
+type workspaceGraph struct {
+	direct []string
+	deps   map[string]*resolvedDependency
+}
+
+// DependencyPath is a chain of dependencies leading from a workspace to a package
+type DependencyPath struct {
+	Workspace string       `json:"workspace"`
+	Path      []Dependency `json:"path"`
+}
+
+// Duplicate is a package that resolves to more than one version, along with the workspaces
+// that depend on each version
+type Duplicate struct {
+	Name     string              `json:"name"`
+	Versions map[string][]string `json:"versions"`
+}
+
+// packageName returns the name of the package for a dependency as returned by AllDependencies.
+// npm lockfiles return the path in node_modules to avoid picking the wrong nested copy, so we
+// use the part after the last node_modules/ as the name.
+func packageName(dep string) string {
+	if i := strings.LastIndex(dep, "node_modules/"); i != -1 {
+		return dep[i+len("node_modules/"):]
+	}
+	return dep
+}
+
+// resolveWorkspace resolves the external dependencies of pkg, and everything they depend on,
+// in the given lockfile
+func resolveWorkspace(lf lockfile.Lockfile, pkg *fs.PackageJSON) (*workspaceGraph, error) {
+	graph := &workspaceGraph{
+		deps: make(map[string]*resolvedDependency),
+	}
+	err := context.WalkExternalDeps(lf, pkg, func(parent string, name string, lockfilePkg lockfile.Package) {
+		if _, ok := graph.deps[lockfilePkg.Key]; !ok {
+			graph.deps[lockfilePkg.Key] = &resolvedDependency{
+				Dependency: Dependency{
+					Name:    packageName(name),
+					Version: lockfilePkg.Version,
+				},
+			}
+		}
+		if parent == "" {
+			graph.direct = append(graph.direct, lockfilePkg.Key)
+		} else {
+			graph.deps[parent].dependencies = append(graph.deps[parent].dependencies, lockfilePkg.Key)
+		}
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve the dependencies of %v", pkg.Name)
+	}
+	// Sort the edges so that why finds the same path each time
+	sort.Strings(graph.direct)
+	for _, dep := range graph.deps {
+		sort.Strings(dep.dependencies)
+	}
+	return graph, nil
+}
+
+// resolveWorkspaces resolves the external dependency graph of each of the given workspaces,
+// or of every workspace, including the root, if none are given
+func resolveWorkspaces(ctx *context.Context, workspaces []string) (map[string]*workspaceGraph, error) {
+	if ctx.Lockfile == nil {
+		return nil, errors.Errorf("unable to read %v. Run your package manager's install command to generate it", ctx.PackageManager.Lockfile)
+	}
+	if len(workspaces) == 0 {
+		workspaces = append([]string{util.RootPkgName}, ctx.PackageNames...)
+	}
+	graphs := make(map[string]*workspaceGraph, len(workspaces))
+	for _, workspace := range workspaces {
+		pkg, ok := ctx.PackageInfos[workspace]
+		if !ok {
+			return nil, errors.Errorf("workspace %v not found", workspace)
+		}
+		graph, err := resolveWorkspace(ctx.Lockfile, pkg)
+		if err != nil {
+			return nil, err
+		}
+		graphs[workspace] = graph
+	}
+	return graphs, nil
+}
+
+// list returns the external dependencies of each workspace, sorted by name and version
+func list(graphs map[string]*workspaceGraph) map[string][]Dependency {
+	deps := make(map[string][]Dependency, len(graphs))
+	for workspace, graph := range graphs {
+		seen := make(util.Set)
+		workspaceDeps := []Dependency{}
+		for _, dep := range graph.deps {
+			if seen.Includes(dep.String()) {
+				continue
+			}
+			seen.Add(dep.String())
+			workspaceDeps = append(workspaceDeps, dep.Dependency)
+		}
+		sortDependencies(workspaceDeps)
+		deps[workspace] = workspaceDeps
+	}
+	return deps
+}
+
+// why returns the shortest chain of dependencies from each workspace to each copy of the
+// package with the given name that it depends on, or an error if none of them depend on it
+func why(graphs map[string]*workspaceGraph, name string) ([]DependencyPath, error) {
+	paths := []DependencyPath{}
+	for _, workspace := range sortedWorkspaces(graphs) {
+		graph := graphs[workspace]
+		// Breadth-first, so that the first time we reach an entry is along a shortest path
+		parents := make(map[string]string)
+		visited := make(util.Set)
+		queue := []string{}
+		for _, key := range graph.direct {
+			if !visited.Includes(key) {
+				visited.Add(key)
+				queue = append(queue, key)
+			}
+		}
+		for len(queue) > 0 {
+			key := queue[0]
+			queue = queue[1:]
+			dep := graph.deps[key]
+			if dep.Name == name {
+				path := []Dependency{}
+				for current, ok := key, true; ok; current, ok = parents[current] {
+					path = append([]Dependency{graph.deps[current].Dependency}, path...)
+				}
+				paths = append(paths, DependencyPath{Workspace: workspace, Path: path})
+			}
+			for _, child := range dep.dependencies {
+				if !visited.Includes(child) {
+					visited.Add(child)
+					parents[child] = key
+					queue = append(queue, child)
+				}
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return nil, errors.Errorf("no workspace depends on %v", name)
+	}
+	return paths, nil
+}
+
+// duplicates returns the packages that resolve to more than one version across the given
+// workspaces, sorted by name
+func duplicates(graphs map[string]*workspaceGraph) []Duplicate {
+	versions := make(map[string]map[string]util.Set)
+	for workspace, graph := range graphs {
+		for _, dep := range graph.deps {
+			if versions[dep.Name] == nil {
+				versions[dep.Name] = make(map[string]util.Set)
+			}
+			if versions[dep.Name][dep.Version] == nil {
+				versions[dep.Name][dep.Version] = make(util.Set)
+			}
+			versions[dep.Name][dep.Version].Add(workspace)
+		}
+	}
+	dupes := []Duplicate{}
+	for name, workspacesByVersion := range versions {
+		if len(workspacesByVersion) < 2 {
+			continue
+		}
+		dupe := Duplicate{
+			Name:     name,
+			Versions: make(map[string][]string, len(workspacesByVersion)),
+		}
+		for version, workspaces := range workspacesByVersion {
+			sortedWorkspaces := workspaces.UnsafeListOfStrings()
+			sort.Strings(sortedWorkspaces)
+			dupe.Versions[version] = sortedWorkspaces
+		}
+		dupes = append(dupes, dupe)
+	}
+	sort.Slice(dupes, func(i, j int) bool {
+		return dupes[i].Name < dupes[j].Name
+	})
+	return dupes
+}
+
+func sortDependencies(deps []Dependency) {
+	sort.Slice(deps, func(i, j int) bool {
+		if deps[i].Name != deps[j].Name {
+			return deps[i].Name < deps[j].Name
+		}
+		return deps[i].Version < deps[j].Version
+	})
+}
+
+func sortedWorkspaces(graphs map[string]*workspaceGraph) []string {
+	workspaces := make([]string, 0, len(graphs))
+	for workspace := range graphs {
+		workspaces = append(workspaces, workspace)
+	}
+	sort.Strings(workspaces)
+	return workspaces
+}
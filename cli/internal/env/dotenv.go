@@ -0,0 +1,185 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+	"github.com/pkg/errors"
+)
+
+// ReadDotEnvFiles reads and merges the given .env files, relative to dir. Files that don't
+// exist are skipped, and variables in later files take precedence over earlier ones, so
+// that for instance ".env.local" can override ".env".
+func ReadDotEnvFiles(dir titanpath.AbsoluteSystemPath, files []string) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, file := range files {
+		contents, err := dir.UntypedJoin(file).ReadFile()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		fileVars, err := ParseDotEnv(contents)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing %v", file)
+		}
+		for k, v := range fileVars {
+			vars[k] = v
+		}
+	}
+	return vars, nil
+}
+
+// GetDotEnvPairs returns the sorted key=value pairs of variables read from .env files
+func GetDotEnvPairs(vars map[string]string) []string {
+	pairs := make([]string, 0, len(vars))
+	for k, v := range vars {
+		pairs = append(pairs, fmt.Sprintf("%v=%v", k, v))
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// ParseDotEnv parses the contents of a .env file. It supports KEY=value lines, optionally
+// prefixed with "export", and # comments. Values may be unquoted, single-quoted, or
+// double-quoted, in which case they may span multiple lines and contain escape sequences.
+// References to other variables are not expanded.
+func ParseDotEnv(contents []byte) (map[string]string, error) {
+	vars := make(map[string]string)
+	src := strings.ReplaceAll(string(contents), "\r\n", "\n")
+	lineNumber := 0
+	for len(src) > 0 {
+		var line string
+		line, src = cutLine(src)
+		lineNumber++
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if rest := strings.TrimPrefix(line, "export"); rest != line && (strings.HasPrefix(rest, " ") || strings.HasPrefix(rest, "\t")) {
+			line = strings.TrimSpace(rest)
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("line %v: expected KEY=value", lineNumber)
+		}
+		key := strings.TrimSpace(line[:i])
+		if !isValidEnvKey(key) {
+			return nil, fmt.Errorf("line %v: invalid variable name %q", lineNumber, key)
+		}
+		value := strings.TrimSpace(line[i+1:])
+		switch {
+		case strings.HasPrefix(value, `"`):
+			startLine := lineNumber
+			end := findClosingQuote(value[1:])
+			for end < 0 && len(src) > 0 {
+				var next string
+				next, src = cutLine(src)
+				lineNumber++
+				value += "\n" + next
+				end = findClosingQuote(value[1:])
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("line %v: unterminated quoted value", startLine)
+			}
+			value = unescapeDoubleQuoted(value[1 : end+1])
+		case strings.HasPrefix(value, "'"):
+			end := strings.Index(value[1:], "'")
+			if end < 0 {
+				return nil, fmt.Errorf("line %v: unterminated quoted value", lineNumber)
+			}
+			value = value[1 : end+1]
+		default:
+			if j := strings.Index(value, " #"); j >= 0 {
+				value = strings.TrimSpace(value[:j])
+			}
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+func cutLine(src string) (string, string) {
+	if i := strings.Index(src, "\n"); i >= 0 {
+		return src[:i], src[i+1:]
+	}
+	return src, ""
+}
+
+func isValidEnvKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, c := range key {
+		if c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// findClosingQuote returns the index of the first unescaped double quote in s, or -1
+func findClosingQuote(s string) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeDoubleQuoted(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '"', '\\':
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// AddDotEnv returns environ with the variables from .env files added. As is conventional,
+// variables that are already set in environ take precedence. Among the .env variables,
+// later maps take precedence over earlier ones.
+func AddDotEnv(environ []string, dotEnvs ...map[string]string) []string {
+	set := make(map[string]bool, len(environ))
+	for _, envVar := range environ {
+		if i := strings.Index(envVar, "="); i > 0 {
+			set[normalizeEnvKey(envVar[:i])] = true
+		}
+	}
+	merged := make(map[string]string)
+	for _, dotEnv := range dotEnvs {
+		for k, v := range dotEnv {
+			merged[k] = v
+		}
+	}
+	for _, pair := range GetDotEnvPairs(merged) {
+		if !set[normalizeEnvKey(pair[:strings.Index(pair, "=")])] {
+			environ = append(environ, pair)
+		}
+	}
+	return environ
+}
@@ -0,0 +1,107 @@
+package env
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+)
+
+func TestParseDotEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     map[string]string
+		wantErr  bool
+	}{
+		{
+			name:     "simple values",
+			contents: "A=1\nB=two\n\nC=\n",
+			want:     map[string]string{"A": "1", "B": "two", "C": ""},
+		},
+		{
+			name:     "comments and export",
+			contents: "# a comment\nexport A=1\n  B = 2 # trailing comment\nC=#notacomment\n",
+			want:     map[string]string{"A": "1", "B": "2", "C": "#notacomment"},
+		},
+		{
+			name:     "quoted values",
+			contents: "A='single # quoted'\nB=\"double \\\"quoted\\\"\\n\"\nC=\"a=b\"\n",
+			want:     map[string]string{"A": "single # quoted", "B": "double \"quoted\"\n", "C": "a=b"},
+		},
+		{
+			name:     "multiline values",
+			contents: "KEY=\"-----BEGIN-----\nabc\n-----END-----\"\nNEXT=1\n",
+			want:     map[string]string{"KEY": "-----BEGIN-----\nabc\n-----END-----", "NEXT": "1"},
+		},
+		{
+			name:     "windows line endings",
+			contents: "A=1\r\nB=2\r\n",
+			want:     map[string]string{"A": "1", "B": "2"},
+		},
+		{
+			name:     "variables are not expanded",
+			contents: "A=${HOME}/foo\n",
+			want:     map[string]string{"A": "${HOME}/foo"},
+		},
+		{
+			name:     "missing equals",
+			contents: "A\n",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid name",
+			contents: "1A=1\n",
+			wantErr:  true,
+		},
+		{
+			name:     "unterminated quote",
+			contents: "A=\"oops\nB=1\n",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDotEnv([]byte(tt.contents))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseDotEnv() expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDotEnv() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseDotEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadDotEnvFiles(t *testing.T) {
+	dir := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	if err := dir.UntypedJoin(".env").WriteFile([]byte("A=1\nB=1\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := dir.UntypedJoin(".env.local").WriteFile([]byte("B=2\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	got, err := ReadDotEnvFiles(dir, []string{".env", ".env.missing", ".env.local"})
+	if err != nil {
+		t.Fatalf("ReadDotEnvFiles() error = %v", err)
+	}
+	want := map[string]string{"A": "1", "B": "2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadDotEnvFiles() = %v, want %v", got, want)
+	}
+}
+
+func TestAddDotEnv(t *testing.T) {
+	environ := []string{"PATH=/bin", "A=from-env"}
+	got := AddDotEnv(environ, map[string]string{"A": "global", "B": "global", "C": "global"}, map[string]string{"C": "task"})
+	want := []string{"PATH=/bin", "A=from-env", "B=global", "C=task"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AddDotEnv() = %v, want %v", got, want)
+	}
+}
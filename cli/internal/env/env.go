@@ -3,12 +3,41 @@ package env
 import (
 	"fmt"
 	"os"
+	"regexp"
+	"runtime"
 	"sort"
 	"strings"
-
-	"github.com/khulnasoft/titanrepo/cli/internal/util"
 )
 
+// DefaultPassThroughEnv lists the variables that tasks receive in strict env mode even
+// though they are not declared. Most programs need them to run at all, and they are not
+// expected to change task outputs.
+var DefaultPassThroughEnv = []string{
+	"PATH",
+	"HOME",
+	"USER",
+	"LOGNAME",
+	"SHELL",
+	"TERM",
+	"COLORTERM",
+	"LANG",
+	"TZ",
+	"TMPDIR",
+	"TEMP",
+	"TMP",
+	// Windows
+	"APPDATA",
+	"COMSPEC",
+	"LOCALAPPDATA",
+	"PATHEXT",
+	"PROGRAMDATA",
+	"PROGRAMFILES",
+	"SYSTEMDRIVE",
+	"SYSTEMROOT",
+	"USERPROFILE",
+	"WINDIR",
+}
+
 func getEnvMap() map[string]string {
 	envMap := make(map[string]string)
 	for _, envVar := range os.Environ() {
@@ -20,57 +49,129 @@ func getEnvMap() map[string]string {
 	return envMap
 }
 
-// getEnvPairsFromKeys returns a slice of key=value pairs for all env var keys specified in envKeys
-func getEnvPairsFromKeys(envKeys []string, allEnvVars map[string]string) []string {
-	hashableConfigEnvPairs := []string{}
-	for _, envVar := range envKeys {
-		hashableConfigEnvPairs = append(hashableConfigEnvPairs, fmt.Sprintf("%v=%v", envVar, allEnvVars[envVar]))
+// envPatterns is a parsed list of environment variable names. Besides exact names, the list
+// may contain wildcards such as "MYAPP_*", and negations such as "!MYAPP_SECRET_*", which
+// exclude variables that would otherwise be matched by a wildcard or framework prefix.
+type envPatterns struct {
+	keys     []string
+	includes []*regexp.Regexp
+	excludes []*regexp.Regexp
+}
+
+func parseEnvPatterns(patterns []string) envPatterns {
+	var parsed envPatterns
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			parsed.excludes = append(parsed.excludes, wildcardToRegexp(pattern[1:]))
+		} else if strings.Contains(pattern, "*") {
+			parsed.includes = append(parsed.includes, wildcardToRegexp(pattern))
+		} else {
+			parsed.keys = append(parsed.keys, pattern)
+		}
 	}
+	return parsed
+}
 
-	return hashableConfigEnvPairs
+func wildcardToRegexp(pattern string) *regexp.Regexp {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
 }
 
-// getEnvPairsFromPrefix returns a slice of all key=value pairs that match the given prefix
-func getEnvPairsFromPrefix(includePrefix string, excludePrefix string, allEnvVars map[string]string) []string {
-	allEnvPairs := []string{}
+func matchesAny(regexps []*regexp.Regexp, key string) bool {
+	for _, re := range regexps {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// getMatchingEnvVars returns the variables from allEnvVars that are selected by envKeys
+// or one of envPrefixes. Variables that are named exactly are always included, with an
+// empty value if they are unset.
+func getMatchingEnvVars(envKeys []string, envPrefixes []string, allEnvVars map[string]string) map[string]string {
+	patterns := parseEnvPatterns(envKeys)
+	// Prefixed variables that are set by a CI vendor are not automatically included
+	excludePrefix := allEnvVars["TITAN_CI_VENDOR_ENV_KEY"]
+	matching := make(map[string]string)
 	for k, v := range allEnvVars {
+		if matchesAny(patterns.excludes, k) {
+			continue
+		}
+		if matchesAny(patterns.includes, k) {
+			matching[k] = v
+			continue
+		}
 		if excludePrefix != "" && strings.HasPrefix(k, excludePrefix) {
 			continue
 		}
-		if strings.HasPrefix(k, includePrefix) {
-			allEnvPairs = append(allEnvPairs, fmt.Sprintf("%v=%v", k, v))
+		for _, prefix := range envPrefixes {
+			if strings.HasPrefix(k, prefix) {
+				matching[k] = v
+				break
+			}
 		}
 	}
-	return allEnvPairs
-}
-
-// getEnvPairsFromPrefixes returns a slice containing key=value pairs
-func getEnvPairsFromPrefixes(includePrefixes []string, excludePrefix string, allEnvVars map[string]string) []string {
-	allEnvPairs := []string{}
-	for _, includePrefix := range includePrefixes {
-		hashableFrameworkEnvPairs := getEnvPairsFromPrefix(includePrefix, excludePrefix, allEnvVars)
-		allEnvPairs = append(allEnvPairs, hashableFrameworkEnvPairs...)
+	for _, key := range patterns.keys {
+		matching[key] = allEnvVars[key]
 	}
-	return allEnvPairs
+	return matching
 }
 
 // GetHashableEnvPairs returns all sorted key=value env var pairs for both frameworks and from envKeys
 func GetHashableEnvPairs(envKeys []string, envPrefixes []string) []string {
-	allEnvVars := getEnvMap()
-	excludePrefix := allEnvVars["TITAN_CI_VENDOR_ENV_KEY"]
-	hashableEnvFromKeys := getEnvPairsFromKeys(envKeys, allEnvVars)
-	hashableEnvFromPrefixes := getEnvPairsFromPrefixes(envPrefixes, excludePrefix, allEnvVars)
+	matching := getMatchingEnvVars(envKeys, envPrefixes, getEnvMap())
+	allHashableEnvPairs := make([]string, 0, len(matching))
+	for k, v := range matching {
+		allHashableEnvPairs = append(allHashableEnvPairs, fmt.Sprintf("%v=%v", k, v))
+	}
+	sort.Strings(allHashableEnvPairs)
+	return allHashableEnvPairs
+}
 
-	// convert to set to eliminate duplicates, then cast back to slice to sort for stable hashing
-	uniqueHashableEnvPairs := make(util.Set, len(hashableEnvFromKeys)+len(hashableEnvFromPrefixes))
-	for _, pair := range hashableEnvFromKeys {
-		uniqueHashableEnvPairs.Add(pair)
+// GetStrictEnv returns the environment for a task in strict env mode. Of the variables in
+// environ, only those selected by envKeys or matching envPrefixes are included, mirroring
+// what is included in the task's hash.
+func GetStrictEnv(environ []string, envKeys []string, envPrefixes []string) []string {
+	// Keep the original entries, since the names may be normalized
+	entries := make(map[string]string, len(environ))
+	allEnvVars := make(map[string]string, len(environ))
+	for _, envVar := range environ {
+		i := strings.Index(envVar, "=")
+		if i <= 0 {
+			// Skip malformed entries, as well as entries like "=C:=C:\\" on Windows
+			continue
+		}
+		key := normalizeEnvKey(envVar[:i])
+		entries[key] = envVar
+		allEnvVars[key] = envVar[i+1:]
 	}
-	for _, pair := range hashableEnvFromPrefixes {
-		uniqueHashableEnvPairs.Add(pair)
+	normalizedKeys := make([]string, len(envKeys))
+	for i, key := range envKeys {
+		normalizedKeys[i] = normalizeEnvKey(key)
 	}
+	matching := getMatchingEnvVars(normalizedKeys, envPrefixes, allEnvVars)
+	strictEnv := []string{}
+	for _, envVar := range environ {
+		i := strings.Index(envVar, "=")
+		if i <= 0 {
+			continue
+		}
+		key := normalizeEnvKey(envVar[:i])
+		if _, ok := matching[key]; ok && entries[key] == envVar {
+			strictEnv = append(strictEnv, envVar)
+		}
+	}
+	return strictEnv
+}
 
-	allHashableEnvPairs := uniqueHashableEnvPairs.UnsafeListOfStrings()
-	sort.Strings(allHashableEnvPairs)
-	return allHashableEnvPairs
+// normalizeEnvKey accounts for environment variable names being case-insensitive on Windows
+func normalizeEnvKey(key string) string {
+	if runtime.GOOS == "windows" {
+		return strings.ToUpper(key)
+	}
+	return key
 }
@@ -275,6 +275,51 @@ func TestGetHashableEnvPairs(t *testing.T) {
 			},
 			want: []string{"MANUAL=true", "NEXT_PUBLIC_KHULNASOFT_ENV=true"},
 		},
+		{
+			env:  []string{"MYAPP_URL=example.com", "MYAPP_PORT=80", "OTHER=nope"},
+			name: "wildcards match env vars",
+			args: args{
+				envKeys:     []string{"MYAPP_*"},
+				envPrefixes: []string{},
+			},
+			want: []string{"MYAPP_PORT=80", "MYAPP_URL=example.com"},
+		},
+		{
+			env:  []string{"MYAPP_URL=example.com", "MYAPP_SECRET_KEY=shh", "MYAPP_SECRET=shh"},
+			name: "negations exclude wildcard matches",
+			args: args{
+				envKeys:     []string{"MYAPP_*", "!MYAPP_SECRET_*"},
+				envPrefixes: []string{},
+			},
+			want: []string{"MYAPP_SECRET=shh", "MYAPP_URL=example.com"},
+		},
+		{
+			env:  []string{"NEXT_PUBLIC_URL=example.com", "NEXT_PUBLIC_ANALYTICS_ID=1"},
+			name: "negations exclude framework env vars",
+			args: args{
+				envKeys:     []string{"!NEXT_PUBLIC_ANALYTICS_*"},
+				envPrefixes: []string{"NEXT_PUBLIC_"},
+			},
+			want: []string{"NEXT_PUBLIC_URL=example.com"},
+		},
+		{
+			env:  []string{"MYAPP_SECRET_KEY=shh"},
+			name: "negations don't exclude env vars named exactly",
+			args: args{
+				envKeys:     []string{"!MYAPP_SECRET_*", "MYAPP_SECRET_KEY"},
+				envPrefixes: []string{},
+			},
+			want: []string{"MYAPP_SECRET_KEY=shh"},
+		},
+		{
+			env:  []string{"A_B_C=1", "A.B=2", "AXB=3"},
+			name: "wildcards match special characters literally",
+			args: args{
+				envKeys:     []string{"A.*", "*_C"},
+				envPrefixes: []string{},
+			},
+			want: []string{"A.B=2", "A_B_C=1"},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -289,3 +334,58 @@ func TestGetHashableEnvPairs(t *testing.T) {
 		})
 	}
 }
+
+func TestGetStrictEnv(t *testing.T) {
+	tests := []struct {
+		name        string
+		environ     []string
+		envKeys     []string
+		envPrefixes []string
+		want        []string
+	}{
+		{
+			name:    "only declared keys are included",
+			environ: []string{"PATH=/bin", "SECRET=shh", "MANUAL=true"},
+			envKeys: []string{"PATH", "MANUAL", "MISSING"},
+			want:    []string{"PATH=/bin", "MANUAL=true"},
+		},
+		{
+			name:        "framework prefixes are included",
+			environ:     []string{"NEXT_PUBLIC_URL=example.com", "NEXT_SECRET=shh"},
+			envPrefixes: []string{"NEXT_PUBLIC_"},
+			want:        []string{"NEXT_PUBLIC_URL=example.com"},
+		},
+		{
+			name:        "$TITAN_CI_VENDOR_ENV_KEY excludes prefixed env vars",
+			environ:     []string{"NEXT_PUBLIC_KHULNASOFT_URL=me.khulnasoft.com", "NEXT_PUBLIC_URL=example.com", "TITAN_CI_VENDOR_ENV_KEY=NEXT_PUBLIC_KHULNASOFT_"},
+			envPrefixes: []string{"NEXT_PUBLIC_"},
+			want:        []string{"NEXT_PUBLIC_URL=example.com"},
+		},
+		{
+			name:        "blocked env var is allowed if manually specified",
+			environ:     []string{"NEXT_PUBLIC_KHULNASOFT_URL=me.khulnasoft.com", "TITAN_CI_VENDOR_ENV_KEY=NEXT_PUBLIC_KHULNASOFT_"},
+			envKeys:     []string{"NEXT_PUBLIC_KHULNASOFT_URL"},
+			envPrefixes: []string{"NEXT_PUBLIC_"},
+			want:        []string{"NEXT_PUBLIC_KHULNASOFT_URL=me.khulnasoft.com"},
+		},
+		{
+			name:    "values containing = are preserved",
+			environ: []string{"a=1=2", "=C:=C:\\"},
+			envKeys: []string{"a"},
+			want:    []string{"a=1=2"},
+		},
+		{
+			name:    "wildcards and negations",
+			environ: []string{"MYAPP_URL=example.com", "MYAPP_SECRET_KEY=shh", "OTHER=nope"},
+			envKeys: []string{"MYAPP_*", "!MYAPP_SECRET_*"},
+			want:    []string{"MYAPP_URL=example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetStrictEnv(tt.environ, tt.envKeys, tt.envPrefixes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetStrictEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"syscall"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/hashicorp/go-hclog"
@@ -33,9 +34,15 @@ type fsNotifyBackend struct {
 	errors  chan error
 	logger  hclog.Logger
 
+	// maxWatches is the most paths we'll watch, or 0 for no limit
+	maxWatches int
+
 	mu          sync.Mutex
 	allExcludes []string
 	closed      bool
+	// watched holds the paths we've added watches for, so that we can count them without
+	// asking fsnotify for a copy of its list each time
+	watched map[string]struct{}
 }
 
 func (f *fsNotifyBackend) Events() <-chan Event {
@@ -80,18 +87,51 @@ func (f *fsNotifyBackend) onFileAdded(name titanpath.AbsoluteSystemPath) error {
 			return errors.Wrapf(err, "failed recursive watch of %v", name)
 		}
 	} else {
-		if err := f.watcher.Add(name.ToString()); err != nil {
-			return errors.Wrapf(err, "failed adding watch to %v", name)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if err := f.addWatch(name.ToString()); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// onFileRemoved forgets the watch on name, if there was one. The operating system removes
+// watches on paths that are deleted or moved away.
+func (f *fsNotifyBackend) onFileRemoved(name titanpath.AbsoluteSystemPath) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.watched, name.ToString())
+}
+
+// addWatch watches name, unless that would exceed maxWatches. Must be called while f.mu is held.
+func (f *fsNotifyBackend) addWatch(name string) error {
+	if _, ok := f.watched[name]; ok {
+		return nil
+	}
+	if f.maxWatches > 0 && len(f.watched) >= f.maxWatches {
+		return errors.Wrapf(ErrWatchLimitReached, "failed adding watch to %v: already watching the maximum of %v paths", name, f.maxWatches)
+	}
+	if err := f.watcher.Add(name); err != nil {
+		// inotify reports running out of watches as ENOSPC
+		if errors.Is(err, syscall.ENOSPC) {
+			return errors.Wrapf(ErrWatchLimitReached, "failed adding watch to %v: the operating system's limit was reached", name)
+		}
+		return errors.Wrapf(err, "failed adding watch to %v", name)
+	}
+	f.watched[name] = struct{}{}
+	return nil
+}
+
 func (f *fsNotifyBackend) watchRecursively(root titanpath.AbsoluteSystemPath, excludePatterns []string, addMode watchAddMode) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
+	// Directories added later are subject to the excludes of the roots they're in
+	allExcludes := make([]string, 0, len(excludePatterns)+len(f.allExcludes))
+	allExcludes = append(allExcludes, excludePatterns...)
+	allExcludes = append(allExcludes, f.allExcludes...)
 	err := fs.WalkMode(root.ToString(), func(name string, isDir bool, info os.FileMode) error {
-		for _, excludePattern := range excludePatterns {
+		for _, excludePattern := range allExcludes {
 			excluded, err := doublestar.Match(excludePattern, filepath.ToSlash(name))
 			if err != nil {
 				return err
@@ -101,8 +141,8 @@ func (f *fsNotifyBackend) watchRecursively(root titanpath.AbsoluteSystemPath, ex
 			}
 		}
 		if info.IsDir() && (info&os.ModeSymlink == 0) {
-			if err := f.watcher.Add(name); err != nil {
-				return errors.Wrapf(err, "failed adding watch to %v", name)
+			if err := f.addWatch(name); err != nil {
+				return err
 			}
 			f.logger.Debug(fmt.Sprintf("watching directory %v", name))
 		}
@@ -136,6 +176,8 @@ outer:
 				if err := f.onFileAdded(path); err != nil {
 					f.errors <- err
 				}
+			} else if eventType == FileDeleted || eventType == FileRenamed {
+				f.onFileRemoved(path)
 			}
 			f.events <- Event{
 				Path:      path,
@@ -181,6 +223,7 @@ func (f *fsNotifyBackend) Start() error {
 				if err := f.watcher.Remove(dir); err != nil {
 					return err
 				}
+				delete(f.watched, dir)
 			}
 		}
 	}
@@ -188,22 +231,34 @@ func (f *fsNotifyBackend) Start() error {
 	return nil
 }
 
+func (f *fsNotifyBackend) WatchCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.watched)
+}
+
 func (f *fsNotifyBackend) AddRoot(root titanpath.AbsoluteSystemPath, excludePatterns ...string) error {
 	// We don't synthesize events for the initial watch
 	return f.watchRecursively(root, excludePatterns, dontSynthesizeEvents)
 }
 
 // GetPlatformSpecificBackend returns a filewatching backend appropriate for the OS we are
-// running on.
-func GetPlatformSpecificBackend(logger hclog.Logger) (Backend, error) {
+// running on. maxWatches limits how many paths are watched, if it is non-zero.
+func GetPlatformSpecificBackend(logger hclog.Logger, maxWatches int) (Backend, error) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
+		// inotify reports running out of instances as EMFILE
+		if errors.Is(err, syscall.EMFILE) {
+			return nil, errors.Wrap(ErrWatchLimitReached, "failed to create a watcher: the operating system's limit was reached")
+		}
 		return nil, err
 	}
 	return &fsNotifyBackend{
-		watcher: watcher,
-		events:  make(chan Event),
-		errors:  make(chan error),
-		logger:  logger.Named("fsnotify"),
+		watcher:    watcher,
+		events:     make(chan Event),
+		errors:     make(chan error),
+		logger:     logger.Named("fsnotify"),
+		maxWatches: maxWatches,
+		watched:    make(map[string]struct{}),
 	}, nil
 }
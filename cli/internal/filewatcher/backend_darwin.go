@@ -51,6 +51,12 @@ func (f *fseventsBackend) Close() error {
 	return nil
 }
 
+func (f *fseventsBackend) WatchCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.streams)
+}
+
 func (f *fseventsBackend) Start() error {
 	return nil
 }
@@ -210,8 +216,9 @@ func toFileEvent(flags fsevents.EventFlags) FileEvent {
 }
 
 // GetPlatformSpecificBackend returns a filewatching backend appropriate for the OS we are
-// running on.
-func GetPlatformSpecificBackend(logger hclog.Logger) (Backend, error) {
+// running on. FSEvents watches each root recursively with a single stream, so there is
+// no per-directory limit for maxWatches to enforce.
+func GetPlatformSpecificBackend(logger hclog.Logger, maxWatches int) (Backend, error) {
 	return &fseventsBackend{
 		events: make(chan Event),
 		errors: make(chan error),
@@ -46,6 +46,9 @@ var (
 	ErrFilewatchingClosed = errors.New("Close() has already been called for filewatching")
 	// ErrFailedToStart is returned when filewatching fails to start up
 	ErrFailedToStart = errors.New("filewatching failed to start")
+	// ErrWatchLimitReached is returned when we can't watch any more paths, either because
+	// of the configured limit or because of the operating system's limits
+	ErrWatchLimitReached = errors.New("reached the limit of watched paths")
 )
 
 // Event is the backend-independent information about a file change
@@ -62,11 +65,14 @@ type Backend interface {
 	Errors() <-chan error
 	Close() error
 	Start() error
+	// WatchCount returns the number of paths being watched. Backends that watch
+	// hierarchies recursively count only their roots.
+	WatchCount() int
 }
 
 // FileWatcher handles watching all of the files in the monorepo.
-// We currently ignore .git and top-level node_modules. We can revisit
-// if necessary.
+// We currently ignore .git and top-level node_modules, along with any
+// directories the repository asks us to ignore.
 type FileWatcher struct {
 	backend Backend
 
@@ -79,11 +85,15 @@ type FileWatcher struct {
 	closed    bool
 }
 
-// New returns a new FileWatcher instance
-func New(logger hclog.Logger, repoRoot titanpath.AbsoluteSystemPath, backend Backend) *FileWatcher {
-	excludes := make([]string, len(_ignores))
-	for i, ignore := range _ignores {
-		excludes[i] = filepath.ToSlash(repoRoot.UntypedJoin(ignore).ToString() + "/**")
+// New returns a new FileWatcher instance. ignores are additional directories, relative
+// to repoRoot, to exempt from file-watching. They may be globs.
+func New(logger hclog.Logger, repoRoot titanpath.AbsoluteSystemPath, backend Backend, ignores ...string) *FileWatcher {
+	allIgnores := make([]string, 0, len(_ignores)+len(ignores))
+	allIgnores = append(allIgnores, _ignores...)
+	allIgnores = append(allIgnores, ignores...)
+	excludes := make([]string, len(allIgnores))
+	for i, ignore := range allIgnores {
+		excludes[i] = filepath.ToSlash(repoRoot.UntypedJoin(filepath.FromSlash(ignore)).ToString() + "/**")
 	}
 	excludePattern := "{" + strings.Join(excludes, ",") + "}"
 	return &FileWatcher{
@@ -156,6 +166,11 @@ outer:
 	fw.clientsMu.Unlock()
 }
 
+// WatchCount returns the number of paths being watched by the backend
+func (fw *FileWatcher) WatchCount() int {
+	return fw.backend.WatchCount()
+}
+
 // AddClient registers a client for filesystem events
 func (fw *FileWatcher) AddClient(client FileWatchClient) {
 	fw.clientsMu.Lock()
@@ -2,6 +2,7 @@ package filewatcher
 
 import (
 	"fmt"
+	"runtime"
 	"sync"
 	"testing"
 	"time"
@@ -101,7 +102,7 @@ func TestFileWatching(t *testing.T) {
 	//     child/
 	//     sibling/
 
-	watcher, err := GetPlatformSpecificBackend(logger)
+	watcher, err := GetPlatformSpecificBackend(logger, 0)
 	assert.NilError(t, err, "GetPlatformSpecificBackend")
 	fw := New(logger, repoRoot, watcher)
 	err = fw.Start()
@@ -150,3 +151,98 @@ func TestFileWatching(t *testing.T) {
 	assert.NilError(t, err, "WriteFile")
 	expectNoFilesystemEvent(t, ch)
 }
+
+func TestFileWatchingIgnores(t *testing.T) {
+	logger := hclog.Default()
+	logger.SetLevel(hclog.Debug)
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	err := repoRoot.UntypedJoin("parent", "child").MkdirAll(0775)
+	assert.NilError(t, err, "MkdirAll")
+	err = repoRoot.UntypedJoin("parent", "tmp").MkdirAll(0775)
+	assert.NilError(t, err, "MkdirAll")
+
+	watcher, err := GetPlatformSpecificBackend(logger, 0)
+	assert.NilError(t, err, "GetPlatformSpecificBackend")
+	fw := New(logger, repoRoot, watcher, "**/tmp", "generated")
+	err = fw.Start()
+	assert.NilError(t, err, "fw.Start")
+	defer func() { _ = fw.Close() }()
+
+	ch := make(chan Event, 1)
+	c := &testClient{
+		notify: ch,
+	}
+	fw.AddClient(c)
+	expectWatching(t, c, []titanpath.AbsoluteSystemPath{
+		repoRoot,
+		repoRoot.UntypedJoin("parent"),
+		repoRoot.UntypedJoin("parent", "child"),
+	})
+
+	tmpFilePath := repoRoot.UntypedJoin("parent", "tmp", "tmp-file")
+	err = tmpFilePath.WriteFile([]byte("nope"), 0644)
+	assert.NilError(t, err, "WriteFile")
+	expectNoFilesystemEvent(t, ch)
+
+	// Ignored directories created after we started are not watched either
+	generatedDir := repoRoot.UntypedJoin("generated")
+	err = generatedDir.MkdirAll(0775)
+	assert.NilError(t, err, "MkdirAll")
+	expectFilesystemEvent(t, ch, Event{
+		Path:      generatedDir,
+		EventType: FileAdded,
+	})
+	generatedFilePath := generatedDir.UntypedJoin("generated-file")
+	err = generatedFilePath.WriteFile([]byte("nope"), 0644)
+	assert.NilError(t, err, "WriteFile")
+	expectNoFilesystemEvent(t, ch)
+}
+
+func TestWatchLimit(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("FSEvents has no per-directory watches to limit")
+	}
+	logger := hclog.Default()
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	err := repoRoot.UntypedJoin("a", "b", "c").MkdirAll(0775)
+	assert.NilError(t, err, "MkdirAll")
+
+	watcher, err := GetPlatformSpecificBackend(logger, 2)
+	assert.NilError(t, err, "GetPlatformSpecificBackend")
+	fw := New(logger, repoRoot, watcher)
+	defer func() { _ = fw.Close() }()
+	err = fw.Start()
+	assert.ErrorIs(t, err, ErrWatchLimitReached)
+}
+
+func TestWatchCount(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("FSEvents has no per-directory watches to count")
+	}
+	logger := hclog.Default()
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	err := repoRoot.UntypedJoin("dir").MkdirAll(0775)
+	assert.NilError(t, err, "MkdirAll")
+
+	watcher, err := GetPlatformSpecificBackend(logger, 3)
+	assert.NilError(t, err, "GetPlatformSpecificBackend")
+	fw := New(logger, repoRoot, watcher)
+	err = fw.Start()
+	assert.NilError(t, err, "fw.Start")
+	ch := make(chan Event, 1)
+	fw.AddClient(&testClient{notify: ch})
+	assert.Equal(t, fw.WatchCount(), 2)
+
+	newDir := repoRoot.UntypedJoin("new")
+	assert.NilError(t, newDir.Mkdir(0775), "Mkdir")
+	expectFilesystemEvent(t, ch, Event{Path: newDir, EventType: FileAdded})
+	assert.Equal(t, fw.WatchCount(), 3)
+
+	// Removed paths no longer count towards the limit
+	assert.NilError(t, newDir.Remove(), "Remove")
+	deadline := time.Now().Add(time.Second)
+	for fw.WatchCount() != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, fw.WatchCount(), 2)
+}
@@ -3,16 +3,16 @@ package fs
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
 	"github.com/khulnasoft/titanrepo/cli/internal/util"
 	"github.com/pkg/errors"
-	"muzzammil.xyz/jsonc"
 )
 
 const (
@@ -24,23 +24,55 @@ const (
 var defaultOutputs = TaskOutputs{Inclusions: []string{"dist/**/*", "build/**/*"}}
 
 type rawTurboJSON struct {
+	// Schema points editors at the JSON Schema for titan.json
+	Schema string `json:"$schema,omitempty"`
 	// Global root filesystem dependencies
 	GlobalDependencies []string `json:"globalDependencies,omitempty"`
 	// Global env
 	GlobalEnv []string `json:"globalEnv,omitempty"`
+	// Env vars passed to tasks in strict env mode without affecting their hashes
+	GlobalPassThroughEnv []string `json:"globalPassThroughEnv,omitempty"`
+	// Which env vars are passed to tasks
+	EnvMode util.EnvMode `json:"envMode,omitempty"`
+	// .env files, relative to the repository root, whose variables affect all tasks
+	GlobalDotEnv []string `json:"globalDotEnv,omitempty"`
+	// Frameworks to infer in addition to the built-in ones
+	Frameworks []FrameworkDefinition `json:"frameworks,omitempty"`
 	// Pipeline is a map of Turbo pipeline entries which define the task graph
 	// and cache behavior on a per task or per package-task basis.
-	Pipeline Pipeline
+	Pipeline Pipeline `json:"pipeline"`
 	// Configuration options when interfacing with the remote cache
 	RemoteCacheOptions RemoteCacheOptions `json:"remoteCache,omitempty"`
+	// Configuration options for the daemon
+	DaemonOptions rawDaemonOptions `json:"daemon,omitempty"`
 }
 
 // TurboJSON is the root titanrepo configuration
 type TurboJSON struct {
-	GlobalDeps         []string
-	GlobalEnv          []string
-	Pipeline           Pipeline
-	RemoteCacheOptions RemoteCacheOptions
+	GlobalDeps           []string
+	GlobalEnv            []string
+	GlobalPassThroughEnv []string
+	GlobalDotEnv         []string
+	EnvMode              util.EnvMode
+	Frameworks           []FrameworkDefinition
+	Pipeline             Pipeline
+	RemoteCacheOptions   RemoteCacheOptions
+	DaemonOptions        DaemonOptions
+
+	// config is the root titan.json as it was checked, if the configuration came from one
+	config *checkedConfig
+	// workspaceConfigs holds the titan.json of each workspace read by WithWorkspaceConfigs
+	workspaceConfigs map[string]*checkedConfig
+}
+
+// FrameworkDefinition declares a framework for titan to infer, in addition to the built-in
+// ones. Packages using the framework depend on the env vars that start with EnvPrefix.
+type FrameworkDefinition struct {
+	Slug         string   `json:"slug"`
+	EnvPrefix    string   `json:"envPrefix"`
+	Dependencies []string `json:"dependencies"`
+	// DependencyMatch is either "all", requiring every dependency, or "some"
+	DependencyMatch string `json:"dependencyMatch,omitempty"`
 }
 
 // RemoteCacheOptions is a struct for deserializing .remoteCache of configFile
@@ -49,6 +81,23 @@ type RemoteCacheOptions struct {
 	Signature bool   `json:"signature,omitempty"`
 }
 
+type rawDaemonOptions struct {
+	IdleTimeout     string   `json:"idleTimeout,omitempty"`
+	MaxWatchedPaths int      `json:"maxWatchedPaths,omitempty"`
+	Ignore          []string `json:"ignore,omitempty"`
+}
+
+// DaemonOptions configures the daemon for this repository. Zero values mean the defaults.
+type DaemonOptions struct {
+	// IdleTimeout is how long the daemon waits for requests before exiting
+	IdleTimeout time.Duration
+	// MaxWatchedPaths is the most paths the daemon watches before giving up and exiting
+	MaxWatchedPaths int
+	// Ignore lists directories, relative to the repository root, that aren't watched.
+	// They may be globs, such as "**/.next".
+	Ignore []string
+}
+
 type rawTask struct {
 	Outputs    *[]string           `json:"outputs"`
 	Cache      *bool               `json:"cache,omitempty"`
@@ -56,6 +105,12 @@ type rawTask struct {
 	Inputs     []string            `json:"inputs,omitempty"`
 	OutputMode util.TaskOutputMode `json:"outputMode,omitempty"`
 	Env        []string            `json:"env,omitempty"`
+	DotEnv     []string            `json:"dotEnv,omitempty"`
+	// FrameworkInference is a pointer, since omitting it enables inference
+	FrameworkInference *bool `json:"frameworkInference,omitempty"`
+	// Command runs the task instead of a package.json script
+	Command string `json:"command,omitempty"`
+	Cwd     string `json:"cwd,omitempty"`
 }
 
 // Pipeline is a struct for deserializing .pipeline in configFile
@@ -66,10 +121,17 @@ type TaskDefinition struct {
 	Outputs                 TaskOutputs
 	ShouldCache             bool
 	EnvVarDependencies      []string
+	DotEnv                  []string
 	TopologicalDependencies []string
 	TaskDependencies        []string
 	Inputs                  []string
 	OutputMode              util.TaskOutputMode
+	// DisableFrameworkInference turns off depending on the env vars of inferred frameworks
+	DisableFrameworkInference bool
+	// Command is run for the task instead of the package.json script of the same name
+	Command string
+	// Cwd is the directory, relative to the package, in which Command runs
+	Cwd string
 }
 
 // LoadTurboConfig loads, or optionally, synthesizes a TurboJSON instance
@@ -132,7 +194,11 @@ func ReadTurboConfig(rootPath titanpath.AbsoluteSystemPath, rootPackageJSON *Pac
 	// If the configFile exists, use that
 	if titanJSONPath.FileExists() {
 		titanJSON, err := readTurboJSON(titanJSONPath)
-		if err != nil {
+		var configErr *ConfigError
+		if errors.As(err, &configErr) {
+			// The diagnostics already name the file
+			return nil, err
+		} else if err != nil {
 			return nil, fmt.Errorf("%s: %w", configFile, err)
 		}
 
@@ -157,25 +223,32 @@ func ReadTurboConfig(rootPath titanpath.AbsoluteSystemPath, rootPackageJSON *Pac
 	return nil, errors.Wrapf(os.ErrNotExist, "Could not find %s. Follow directions at https://titan.khulnasoft.com/docs/getting-started to create one", configFile)
 }
 
-// readTurboJSON reads the configFile in to a struct
+// readTurboJSON reads the configFile in to a struct. Keys that aren't part of the
+// configuration and values of the wrong type are reported as a *ConfigError.
 func readTurboJSON(path titanpath.AbsoluteSystemPath) (*TurboJSON, error) {
-	file, err := path.Open()
+	data, err := path.ReadFile()
 	if err != nil {
 		return nil, err
 	}
-	var titanJSON *TurboJSON
-	data, err := ioutil.ReadAll(file)
+	config, titanJSON, err := decodeTurboJSON(configFile, data)
 	if err != nil {
 		return nil, err
 	}
+	titanJSON.config = config
+	return titanJSON, nil
+}
 
-	err = jsonc.Unmarshal(data, &titanJSON)
-
+// decodeTurboJSON checks the contents of the root titan.json against its schema and decodes them
+func decodeTurboJSON(name string, data []byte) (*checkedConfig, *TurboJSON, error) {
+	config, err := checkConfig(name, data, _rootConfigSchema, true)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-
-	return titanJSON, nil
+	var titanJSON *TurboJSON
+	if err := json.Unmarshal(config.data, &titanJSON); err != nil {
+		return nil, nil, err
+	}
+	return config, titanJSON, nil
 }
 
 // GetTaskDefinition returns a TaskDefinition from a serialized definition in configFile
@@ -205,6 +278,220 @@ func (pc Pipeline) HasTask(task string) bool {
 	return false
 }
 
+// hashedTaskDefinition has the fields of a TaskDefinition that are always hashed, in the
+// order that they have always been hashed in
+type hashedTaskDefinition struct {
+	Outputs                 TaskOutputs
+	ShouldCache             bool
+	EnvVarDependencies      []string
+	TopologicalDependencies []string
+	TaskDependencies        []string
+	Inputs                  []string
+	OutputMode              util.TaskOutputMode
+}
+
+// hashedTaskExtensions has the fields of a TaskDefinition that are only hashed when set
+type hashedTaskExtensions struct {
+	DotEnv                    []string
+	DisableFrameworkInference bool
+	Command                   string
+	Cwd                       string
+}
+
+func (e *hashedTaskExtensions) isEmpty() bool {
+	return len(e.DotEnv) == 0 && !e.DisableFrameworkInference && e.Command == "" && e.Cwd == ""
+}
+
+// Hashable returns a representation of the pipeline for fs.HashObject. Task settings that
+// are hashed only when set are left out of tasks that don't set them, so that adding them
+// doesn't change the hashes of existing pipelines.
+func (pc Pipeline) Hashable() map[string]interface{} {
+	hashable := make(map[string]interface{}, len(pc))
+	for taskID, taskDefinition := range pc {
+		definition := hashedTaskDefinition{
+			Outputs:                 taskDefinition.Outputs,
+			ShouldCache:             taskDefinition.ShouldCache,
+			EnvVarDependencies:      taskDefinition.EnvVarDependencies,
+			TopologicalDependencies: taskDefinition.TopologicalDependencies,
+			TaskDependencies:        taskDefinition.TaskDependencies,
+			Inputs:                  taskDefinition.Inputs,
+			OutputMode:              taskDefinition.OutputMode,
+		}
+		extensions := hashedTaskExtensions{
+			DotEnv:                    taskDefinition.DotEnv,
+			DisableFrameworkInference: taskDefinition.DisableFrameworkInference,
+			Command:                   taskDefinition.Command,
+			Cwd:                       taskDefinition.Cwd,
+		}
+		if extensions.isEmpty() {
+			hashable[taskID] = definition
+		} else {
+			hashable[taskID] = struct {
+				definition hashedTaskDefinition
+				extensions hashedTaskExtensions
+			}{definition, extensions}
+		}
+	}
+	return hashable
+}
+
+// workspaceTurboJSON is a titan.json inside of a workspace, which overrides the root
+// pipeline for that workspace only
+type workspaceTurboJSON struct {
+	Schema   string                     `json:"$schema,omitempty"`
+	Extends  []string                   `json:"extends"`
+	Pipeline map[string]json.RawMessage `json:"pipeline"`
+}
+
+// WithWorkspaceConfigs returns a copy of the pipeline with the overrides from the titan.json of
+// each workspace that has one. Overrides are added as package tasks (<package>#<task>), merged
+// on top of the definition that the root pipeline has for the task. The workspace configurations
+// are kept for Validate.
+func (tj *TurboJSON) WithWorkspaceConfigs(rootPath titanpath.AbsoluteSystemPath, packageInfos map[interface{}]*PackageJSON) (Pipeline, error) {
+	pipeline, workspaceConfigs, err := tj.Pipeline.withWorkspaceConfigs(rootPath, packageInfos)
+	if err != nil {
+		return nil, err
+	}
+	tj.workspaceConfigs = workspaceConfigs
+	return pipeline, nil
+}
+
+func (pc Pipeline) withWorkspaceConfigs(rootPath titanpath.AbsoluteSystemPath, packageInfos map[interface{}]*PackageJSON) (Pipeline, map[string]*checkedConfig, error) {
+	workspaceConfigs := make(map[string]*checkedConfig)
+	pipeline := make(Pipeline, len(pc))
+	for taskID, taskDefinition := range pc {
+		pipeline[taskID] = taskDefinition
+	}
+	// Workspaces are read in order, so that the same problem is reported first each time
+	pkgNames := make([]string, 0, len(packageInfos))
+	for name := range packageInfos {
+		pkgNames = append(pkgNames, name.(string))
+	}
+	sort.Strings(pkgNames)
+	for _, pkgName := range pkgNames {
+		// The root titan.json is the one being extended
+		if pkgName == util.RootPkgName {
+			continue
+		}
+		pkg := packageInfos[pkgName]
+		configPath := rootPath.UntypedJoin(pkg.Dir.ToStringDuringMigration(), configFile)
+		if !configPath.FileExists() {
+			continue
+		}
+		name := pkg.Dir.Join(configFile).ToUnixPath().ToString()
+		workspaceConfig, workspaceJSON, err := readWorkspaceTurboJSON(configPath, name)
+		var configErr *ConfigError
+		if errors.As(err, &configErr) {
+			// The diagnostics already name the file
+			return nil, nil, err
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+		workspaceConfigs[pkgName] = workspaceConfig
+		for task, data := range workspaceJSON.Pipeline {
+			taskID := util.GetTaskId(pkgName, task)
+			taskDefinition, ok := pc.GetTaskDefinition(taskID)
+			if !ok {
+				// Tasks that only this workspace has start from the defaults
+				if err := taskDefinition.UnmarshalJSON([]byte("{}")); err != nil {
+					return nil, nil, err
+				}
+			}
+			merged, err := taskDefinition.withOverrides(data)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %v: %w", name, task, err)
+			}
+			pipeline[taskID] = merged
+		}
+	}
+	return pipeline, workspaceConfigs, nil
+}
+
+// readWorkspaceTurboJSON reads the titan.json of a workspace, which is called name in errors.
+// Global configuration can only be set in the root titan.json, so it is reported as unknown.
+func readWorkspaceTurboJSON(path titanpath.AbsoluteSystemPath, name string) (*checkedConfig, *workspaceTurboJSON, error) {
+	data, err := path.ReadFile()
+	if err != nil {
+		return nil, nil, err
+	}
+	// Workspace configurations are newer than the validation, so their keys were never case-insensitive
+	config, err := checkConfig(name, data, _workspaceConfigSchema, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	workspaceJSON := &workspaceTurboJSON{}
+	if err := json.Unmarshal(config.data, workspaceJSON); err != nil {
+		return nil, nil, err
+	}
+	if len(workspaceJSON.Extends) != 1 || workspaceJSON.Extends[0] != util.RootPkgName {
+		return nil, nil, fmt.Errorf("workspace configurations must extend the root configuration with \"extends\": [\"%s\"]", util.RootPkgName)
+	}
+	for task := range workspaceJSON.Pipeline {
+		if util.IsPackageTask(task) {
+			return nil, nil, fmt.Errorf("Package tasks (<package>#<task>) are not allowed in workspace configurations: found %v", task)
+		}
+	}
+	return config, workspaceJSON, nil
+}
+
+// withOverrides returns a copy of the task definition in which the keys that are set in
+// data replace the ones from the definition
+func (c TaskDefinition) withOverrides(data []byte) (TaskDefinition, error) {
+	keys := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return TaskDefinition{}, err
+	}
+	task := rawTask{}
+	if err := json.Unmarshal(data, &task); err != nil {
+		return TaskDefinition{}, err
+	}
+	for _, dependency := range task.DependsOn {
+		if strings.HasPrefix(dependency, envPipelineDelimiter) {
+			return TaskDefinition{}, fmt.Errorf("environment variables can't be declared in \"dependsOn\" in workspace configurations, found %s. Use the \"env\" key", dependency)
+		}
+	}
+	overrides := TaskDefinition{}
+	if err := overrides.UnmarshalJSON(data); err != nil {
+		return TaskDefinition{}, err
+	}
+	isSet := func(key string) bool {
+		_, ok := keys[key]
+		return ok
+	}
+	if isSet("outputs") {
+		c.Outputs = overrides.Outputs
+	}
+	if isSet("cache") {
+		c.ShouldCache = overrides.ShouldCache
+	}
+	if isSet("dependsOn") {
+		c.TaskDependencies = overrides.TaskDependencies
+		c.TopologicalDependencies = overrides.TopologicalDependencies
+	}
+	if isSet("inputs") {
+		c.Inputs = overrides.Inputs
+	}
+	if isSet("outputMode") {
+		c.OutputMode = overrides.OutputMode
+	}
+	if isSet("env") {
+		c.EnvVarDependencies = overrides.EnvVarDependencies
+	}
+	if isSet("dotEnv") {
+		c.DotEnv = overrides.DotEnv
+	}
+	if isSet("frameworkInference") {
+		c.DisableFrameworkInference = overrides.DisableFrameworkInference
+	}
+	if isSet("command") {
+		c.Command = overrides.Command
+	}
+	if isSet("cwd") {
+		c.Cwd = overrides.Cwd
+	}
+	return c, nil
+}
+
 // UnmarshalJSON deserializes JSON into a TaskDefinition
 func (c *TaskDefinition) UnmarshalJSON(data []byte) error {
 	task := rawTask{}
@@ -272,10 +559,29 @@ func (c *TaskDefinition) UnmarshalJSON(data []byte) error {
 
 	c.EnvVarDependencies = envVarDependencies.UnsafeListOfStrings()
 	sort.Strings(c.EnvVarDependencies)
+	// The order of .env files matters, later files take precedence
+	if err := validateDotEnv(task.DotEnv); err != nil {
+		return err
+	}
+	c.DotEnv = task.DotEnv
 	// Note that we don't require Inputs to be sorted, we're going to
 	// hash the resulting files and sort that instead
 	c.Inputs = task.Inputs
 	c.OutputMode = task.OutputMode
+	if task.FrameworkInference != nil {
+		c.DisableFrameworkInference = !*task.FrameworkInference
+	}
+	if task.Cwd != "" {
+		if task.Command == "" {
+			return fmt.Errorf("\"cwd\" can only be set for tasks with a \"command\", found \"%s\"", task.Cwd)
+		}
+		clean := filepath.Clean(filepath.FromSlash(task.Cwd))
+		if filepath.IsAbs(task.Cwd) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("\"cwd\" must be within the package, found \"%s\"", task.Cwd)
+		}
+	}
+	c.Command = task.Command
+	c.Cwd = task.Cwd
 	return nil
 }
 
@@ -313,10 +619,78 @@ func (c *TurboJSON) UnmarshalJSON(data []byte) error {
 	sort.Strings(c.GlobalEnv)
 	c.GlobalDeps = globalFileDependencies.UnsafeListOfStrings()
 	sort.Strings(c.GlobalDeps)
+	c.GlobalPassThroughEnv = raw.GlobalPassThroughEnv
+	if err := validateDotEnv(raw.GlobalDotEnv); err != nil {
+		return err
+	}
+	c.GlobalDotEnv = raw.GlobalDotEnv
+	for _, framework := range raw.Frameworks {
+		if err := framework.validate(); err != nil {
+			return err
+		}
+	}
+	c.Frameworks = raw.Frameworks
+	sort.Strings(c.GlobalPassThroughEnv)
+	c.EnvMode = raw.EnvMode
 
 	// copy these over, we don't need any changes here.
 	c.Pipeline = raw.Pipeline
 	c.RemoteCacheOptions = raw.RemoteCacheOptions
 
+	daemonOptions, err := raw.DaemonOptions.parse()
+	if err != nil {
+		return err
+	}
+	c.DaemonOptions = daemonOptions
+
+	return nil
+}
+
+func (d rawDaemonOptions) parse() (DaemonOptions, error) {
+	opts := DaemonOptions{
+		MaxWatchedPaths: d.MaxWatchedPaths,
+		Ignore:          d.Ignore,
+	}
+	if d.IdleTimeout != "" {
+		idleTimeout, err := time.ParseDuration(d.IdleTimeout)
+		if err != nil || idleTimeout <= 0 {
+			return DaemonOptions{}, fmt.Errorf("invalid daemon \"idleTimeout\" \"%s\". Use a duration such as \"30m\" or \"8h\"", d.IdleTimeout)
+		}
+		opts.IdleTimeout = idleTimeout
+	}
+	if d.MaxWatchedPaths < 0 {
+		return DaemonOptions{}, fmt.Errorf("daemon \"maxWatchedPaths\" must not be negative, found %d", d.MaxWatchedPaths)
+	}
+	for _, ignore := range d.Ignore {
+		clean := filepath.Clean(filepath.FromSlash(ignore))
+		if filepath.IsAbs(ignore) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return DaemonOptions{}, fmt.Errorf("daemon \"ignore\" entries must be within the repository, found \"%s\"", ignore)
+		}
+	}
+	return opts, nil
+}
+
+func validateDotEnv(files []string) error {
+	for _, file := range files {
+		if filepath.IsAbs(file) {
+			return fmt.Errorf(".env files must be specified with relative paths, found \"%s\"", file)
+		}
+	}
+	return nil
+}
+
+func (f FrameworkDefinition) validate() error {
+	if f.Slug == "" {
+		return fmt.Errorf("frameworks must have a \"slug\"")
+	}
+	if f.EnvPrefix == "" {
+		return fmt.Errorf("framework \"%s\" must have an \"envPrefix\"", f.Slug)
+	}
+	if len(f.Dependencies) == 0 {
+		return fmt.Errorf("framework \"%s\" must list at least one dependency", f.Slug)
+	}
+	if f.DependencyMatch != "" && f.DependencyMatch != "all" && f.DependencyMatch != "some" {
+		return fmt.Errorf("framework \"%s\" has invalid \"dependencyMatch\" %s. Use \"all\" or \"some\"", f.Slug, f.DependencyMatch)
+	}
 	return nil
 }
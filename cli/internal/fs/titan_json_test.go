@@ -6,6 +6,7 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
 	"github.com/khulnasoft/titanrepo/cli/internal/util"
@@ -234,6 +235,253 @@ func Test_ReadTurboConfig_EnvDeclarations(t *testing.T) {
 	assert.EqualValues(t, sortedArray([]string{"somefile.txt"}), sortedArray(titanJSON.GlobalDeps))
 }
 
+func Test_ReadTurboConfig_EnvMode(t *testing.T) {
+	testDir := getTestDir(t, "env-mode")
+	rootPackageJSON, err := ReadPackageJSON(testDir.UntypedJoin("package.json"))
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+
+	titanJSON, err := ReadTurboConfig(testDir, rootPackageJSON)
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+
+	assert.Equal(t, util.StrictEnvMode, titanJSON.EnvMode)
+	assert.EqualValues(t, []string{"AWS_PROFILE", "SSH_AUTH_SOCK"}, titanJSON.GlobalPassThroughEnv)
+	assert.EqualValues(t, []string{"FOO"}, titanJSON.GlobalEnv)
+}
+
+func Test_ReadTurboConfig_InvalidEnvMode(t *testing.T) {
+	testDir := getTestDir(t, "invalid-env-mode")
+	rootPackageJSON, err := ReadPackageJSON(testDir.UntypedJoin("package.json"))
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+
+	_, err = ReadTurboConfig(testDir, rootPackageJSON)
+
+	expectedErrorMsg := "titan.json: invalid env mode: lenient"
+	assert.EqualErrorf(t, err, expectedErrorMsg, "Error should be: %v, got: %v", expectedErrorMsg, err)
+}
+
+func Test_ReadTurboConfig_DotEnv(t *testing.T) {
+	testDir := getTestDir(t, "dot-env")
+	rootPackageJSON, err := ReadPackageJSON(testDir.UntypedJoin("package.json"))
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+
+	titanJSON, err := ReadTurboConfig(testDir, rootPackageJSON)
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+
+	assert.EqualValues(t, []string{".env"}, titanJSON.GlobalDotEnv)
+	// order is preserved, since later files take precedence
+	assert.EqualValues(t, []string{".env", ".env.production", ".env.local", ".env.production.local"}, titanJSON.Pipeline["build"].DotEnv)
+	assert.Nil(t, titanJSON.Pipeline["test"].DotEnv)
+}
+
+func Test_ReadTurboConfig_Frameworks(t *testing.T) {
+	testDir := getTestDir(t, "frameworks")
+	rootPackageJSON, err := ReadPackageJSON(testDir.UntypedJoin("package.json"))
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+
+	titanJSON, err := ReadTurboConfig(testDir, rootPackageJSON)
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+
+	assert.EqualValues(t, []FrameworkDefinition{
+		{Slug: "acme", EnvPrefix: "ACME_PUBLIC_", Dependencies: []string{"@acme/app"}},
+		{Slug: "acme-legacy", EnvPrefix: "ACME_LEGACY_", Dependencies: []string{"@acme/legacy", "@acme/legacy-cli"}, DependencyMatch: "some"},
+	}, titanJSON.Frameworks)
+	assert.False(t, titanJSON.Pipeline["build"].DisableFrameworkInference)
+	assert.True(t, titanJSON.Pipeline["lint"].DisableFrameworkInference)
+}
+
+func Test_ReadTurboConfig_InvalidFrameworks(t *testing.T) {
+	testDir := getTestDir(t, "invalid-frameworks")
+	rootPackageJSON, err := ReadPackageJSON(testDir.UntypedJoin("package.json"))
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+
+	_, err = ReadTurboConfig(testDir, rootPackageJSON)
+
+	expectedErrorMsg := "titan.json: framework \"acme\" has invalid \"dependencyMatch\" any. Use \"all\" or \"some\""
+	assert.EqualErrorf(t, err, expectedErrorMsg, "Error should be: %v, got: %v", expectedErrorMsg, err)
+}
+
+func Test_ReadTurboConfig_Daemon(t *testing.T) {
+	testDir := getTestDir(t, "daemon")
+	rootPackageJSON, err := ReadPackageJSON(testDir.UntypedJoin("package.json"))
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+
+	titanJSON, err := ReadTurboConfig(testDir, rootPackageJSON)
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+
+	assert.EqualValues(t, DaemonOptions{
+		IdleTimeout:     30 * time.Minute,
+		MaxWatchedPaths: 200000,
+		Ignore:          []string{"tmp", "**/.next"},
+	}, titanJSON.DaemonOptions)
+}
+
+func Test_ReadTurboConfig_InvalidDaemon(t *testing.T) {
+	testDir := getTestDir(t, "invalid-daemon")
+	rootPackageJSON, err := ReadPackageJSON(testDir.UntypedJoin("package.json"))
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+
+	_, err = ReadTurboConfig(testDir, rootPackageJSON)
+
+	expectedErrorMsg := "titan.json: invalid daemon \"idleTimeout\" \"forever\". Use a duration such as \"30m\" or \"8h\""
+	assert.EqualErrorf(t, err, expectedErrorMsg, "Error should be: %v, got: %v", expectedErrorMsg, err)
+}
+
+func Test_ReadTurboConfig_Commands(t *testing.T) {
+	testDir := getTestDir(t, "commands")
+	rootPackageJSON, err := ReadPackageJSON(testDir.UntypedJoin("package.json"))
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+
+	titanJSON, err := ReadTurboConfig(testDir, rootPackageJSON)
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+
+	assert.Equal(t, "docker build -t app .", titanJSON.Pipeline["//#docker"].Command)
+	assert.Equal(t, "", titanJSON.Pipeline["//#docker"].Cwd)
+	assert.Equal(t, "terraform plan -out=plan.tfplan", titanJSON.Pipeline["//#plan"].Command)
+	assert.Equal(t, "infra", titanJSON.Pipeline["//#plan"].Cwd)
+	assert.Equal(t, "", titanJSON.Pipeline["build"].Command)
+}
+
+func Test_ReadTurboConfig_InvalidCommands(t *testing.T) {
+	testDir := getTestDir(t, "invalid-commands")
+	rootPackageJSON, err := ReadPackageJSON(testDir.UntypedJoin("package.json"))
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+
+	_, err = ReadTurboConfig(testDir, rootPackageJSON)
+
+	expectedErrorMsg := "titan.json: \"cwd\" must be within the package, found \"../infra\""
+	assert.EqualErrorf(t, err, expectedErrorMsg, "Error should be: %v, got: %v", expectedErrorMsg, err)
+}
+
+func Test_WithWorkspaceConfigs(t *testing.T) {
+	testDir := getTestDir(t, "workspace-configs")
+	rootPackageJSON, err := ReadPackageJSON(testDir.UntypedJoin("package.json"))
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+	titanJSON, err := ReadTurboConfig(testDir, rootPackageJSON)
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+	packageInfos := map[interface{}]*PackageJSON{
+		util.RootPkgName: rootPackageJSON,
+		"web":            {Name: "web", Dir: titanpath.AnchoredUnixPath("apps/web").ToSystemPath()},
+		"docs":           {Name: "docs", Dir: titanpath.AnchoredUnixPath("apps/docs").ToSystemPath()},
+		"ui":             {Name: "ui", Dir: titanpath.AnchoredUnixPath("packages/ui").ToSystemPath()},
+	}
+
+	pipeline, err := titanJSON.WithWorkspaceConfigs(testDir, packageInfos)
+	if err != nil {
+		t.Fatalf("failed to read workspace configs: %#v", err)
+	}
+
+	// Keys that aren't overridden come from the root pipeline
+	webBuild := pipeline["web#build"]
+	assert.EqualValues(t, TaskOutputs{Inclusions: []string{".next/**"}, Exclusions: []string{".next/cache/**"}}, webBuild.Outputs)
+	assert.EqualValues(t, []string{"src/**"}, webBuild.Inputs)
+	assert.EqualValues(t, []string{"API_URL"}, webBuild.EnvVarDependencies)
+	assert.EqualValues(t, []string{"build"}, webBuild.TopologicalDependencies)
+	assert.True(t, webBuild.ShouldCache)
+
+	// Tasks that only the workspace defines start from the defaults
+	webE2E := pipeline["web#e2e"]
+	assert.EqualValues(t, []string{"build"}, webE2E.TaskDependencies)
+	assert.False(t, webE2E.ShouldCache)
+	assert.EqualValues(t, defaultOutputs, webE2E.Outputs)
+
+	// Overrides apply on top of package tasks from the root pipeline
+	docsBuild := pipeline["docs#build"]
+	assert.EqualValues(t, []string{"out/**"}, docsBuild.Outputs.Inclusions)
+	assert.EqualValues(t, []string{"DOCS_URL"}, docsBuild.EnvVarDependencies)
+
+	// The root pipeline is left untouched
+	assert.EqualValues(t, []string{"dist/**"}, pipeline["build"].Outputs.Inclusions)
+	_, ok := titanJSON.Pipeline["web#build"]
+	assert.False(t, ok)
+	_, ok = pipeline["ui#build"]
+	assert.False(t, ok)
+
+	packageInfos["invalid"] = &PackageJSON{Name: "invalid", Dir: titanpath.AnchoredUnixPath("packages/invalid").ToSystemPath()}
+	_, err = titanJSON.WithWorkspaceConfigs(testDir, packageInfos)
+	assert.EqualError(t, err, "packages/invalid/titan.json:3:3: unknown key \"globalEnv\" in the configuration")
+}
+
+func Test_ReadWorkspaceTurboJSON_Invalid(t *testing.T) {
+	dir := AbsoluteSystemPathFromUpstream(t.TempDir())
+	configPath := dir.UntypedJoin(configFile)
+	testCases := map[string]string{
+		`{"pipeline": {}}`: `workspace configurations must extend the root configuration with "extends": ["//"]`,
+		`{"extends": ["//"], "pipeline": {"web#build": {}}}`: "Package tasks (<package>#<task>) are not allowed in workspace configurations: found web#build",
+	}
+	for contents, expectedErrorMsg := range testCases {
+		assert.NoError(t, configPath.WriteFile([]byte(contents), 0644))
+		_, _, err := readWorkspaceTurboJSON(configPath, configFile)
+		assert.EqualError(t, err, expectedErrorMsg)
+	}
+}
+
+func Test_Pipeline_Hashable(t *testing.T) {
+	build := TaskDefinition{
+		Outputs:                 TaskOutputs{Inclusions: []string{"dist/**"}},
+		ShouldCache:             true,
+		EnvVarDependencies:      []string{"API_URL"},
+		TopologicalDependencies: []string{"build"},
+	}
+	pipelineHash := func(build TaskDefinition) string {
+		t.Helper()
+		hash, err := HashObject(Pipeline{"build": build}.Hashable())
+		if err != nil {
+			t.Fatalf("failed to hash pipeline: %v", err)
+		}
+		return hash
+	}
+
+	// Pipelines that don't use the settings added since are hashed as they always were
+	assert.Equal(t, "a8502748917b92a8", pipelineHash(build))
+
+	withDotEnv := build
+	withDotEnv.DotEnv = []string{".env"}
+	withoutInference := build
+	withoutInference.DisableFrameworkInference = true
+	withCommand := build
+	withCommand.Command = "make"
+	withCwd := withCommand
+	withCwd.Cwd = "src"
+	hashes := map[string]bool{pipelineHash(build): true}
+	for _, definition := range []TaskDefinition{withDotEnv, withoutInference, withCommand, withCwd} {
+		hash := pipelineHash(definition)
+		assert.Falsef(t, hashes[hash], "expected %+v to change the hash", definition)
+		hashes[hash] = true
+	}
+}
+
 // Helpers
 func validateOutput(t *testing.T, titanJSON *TurboJSON, expectedPipeline map[string]TaskDefinition) {
 	t.Helper()
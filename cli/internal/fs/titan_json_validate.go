@@ -0,0 +1,546 @@
+package fs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+	"github.com/khulnasoft/titanrepo/cli/internal/util"
+	"github.com/pkg/errors"
+)
+
+// ConfigDiagnostic is a problem found in a titan.json. Line and Column are 1-based, and
+// are 0 if the problem can't be attributed to a location in the file.
+type ConfigDiagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+	// Warning is set for problems that don't yet prevent titan.json from being used
+	Warning bool `json:"warning,omitempty"`
+}
+
+func (d ConfigDiagnostic) String() string {
+	if d.Line == 0 {
+		return fmt.Sprintf("%s: %s", d.File, d.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+}
+
+// ConfigError is returned when a titan.json doesn't match the schema of the configuration
+type ConfigError struct {
+	Diagnostics []ConfigDiagnostic
+}
+
+func (e *ConfigError) Error() string {
+	lines := make([]string, len(e.Diagnostics))
+	for i, diagnostic := range e.Diagnostics {
+		lines[i] = diagnostic.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// configSchema describes the JSON value that is allowed at some position in titan.json. It is
+// derived from the structs that titan.json is decoded into, so that the two can't drift apart.
+type configSchema struct {
+	// kind is the JSON type of the value, or "" if any type is allowed
+	kind string
+	// keys holds the schema of each key that an object may have
+	keys map[string]*configSchema
+	// values is the schema of every value of an object with arbitrary keys, such as pipeline
+	values *configSchema
+	// elements is the schema of the elements of an array
+	elements *configSchema
+}
+
+var (
+	_taskDefinitionType = reflect.TypeOf(TaskDefinition{})
+	_unmarshalerType    = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+func schemaOf(t reflect.Type) *configSchema {
+	if t.Kind() == reflect.Ptr {
+		return schemaOf(t.Elem())
+	}
+	// TaskDefinition is decoded from a rawTask
+	if t == _taskDefinitionType {
+		return schemaOf(reflect.TypeOf(rawTask{}))
+	}
+	// Types that decode themselves check their own values
+	if reflect.PtrTo(t).Implements(_unmarshalerType) {
+		return &configSchema{}
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		schema := &configSchema{kind: "object", keys: make(map[string]*configSchema)}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			schema.keys[name] = schemaOf(field.Type)
+		}
+		return schema
+	case reflect.Map:
+		return &configSchema{kind: "object", values: schemaOf(t.Elem())}
+	case reflect.Slice:
+		return &configSchema{kind: "array", elements: schemaOf(t.Elem())}
+	case reflect.String:
+		return &configSchema{kind: "string"}
+	case reflect.Bool:
+		return &configSchema{kind: "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Float64:
+		return &configSchema{kind: "number"}
+	}
+	return &configSchema{}
+}
+
+var (
+	_rootConfigSchema      = schemaOf(reflect.TypeOf(rawTurboJSON{}))
+	_workspaceConfigSchema = func() *configSchema {
+		schema := schemaOf(reflect.TypeOf(workspaceTurboJSON{}))
+		// Workspace tasks are decoded later, once they are merged with the root pipeline
+		schema.keys["pipeline"].values = _rootConfigSchema.keys["pipeline"].values
+		return schema
+	}()
+)
+
+// checkedConfig is a titan.json that has been checked against a schema
+type checkedConfig struct {
+	// name is how the file is referred to in diagnostics
+	name string
+	// data is the contents of the file with comments blanked out, leaving valid JSON with
+	// the same offsets as the file
+	data []byte
+	// offsets holds the offset of each key and array element, keyed by its path
+	offsets map[string]int
+	// warnings are the problems that were tolerated, such as keys with the wrong case
+	warnings []ConfigDiagnostic
+}
+
+// checkConfig checks the contents of a titan.json against schema, returning a *ConfigError
+// describing every place the file doesn't match it. With allowKeyCase, keys that only differ
+// from known ones in case, which titan.json accepted before it was validated, are warnings.
+func checkConfig(name string, contents []byte, schema *configSchema, allowKeyCase bool) (*checkedConfig, error) {
+	config := &checkedConfig{
+		name:    name,
+		data:    blankComments(contents),
+		offsets: make(map[string]int),
+	}
+	checker := &configChecker{
+		config:       config,
+		decoder:      json.NewDecoder(bytes.NewReader(config.data)),
+		allowKeyCase: allowKeyCase,
+	}
+	checker.decoder.UseNumber()
+	if err := checker.check(schema, nil); err != nil {
+		checker.addSyntaxError(err)
+	}
+	if len(checker.diagnostics) > 0 {
+		return nil, &ConfigError{Diagnostics: checker.diagnostics}
+	}
+	return config, nil
+}
+
+// diagnostic returns a diagnostic located at the key or array element at path, or at the
+// start of the file if path wasn't seen
+func (c *checkedConfig) diagnostic(path []string, format string, args ...interface{}) ConfigDiagnostic {
+	line, column := lineAndColumn(c.data, c.offsets[configPath(path)])
+	return ConfigDiagnostic{
+		File:    c.name,
+		Line:    line,
+		Column:  column,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+type configChecker struct {
+	config       *checkedConfig
+	decoder      *json.Decoder
+	diagnostics  []ConfigDiagnostic
+	allowKeyCase bool
+}
+
+func (c *configChecker) check(schema *configSchema, path []string) error {
+	offset := c.nextOffset()
+	token, err := c.decoder.Token()
+	if err != nil {
+		return err
+	}
+	c.config.offsets[configPath(path)] = offset
+	kind := jsonKind(token)
+	if schema.kind != "" && schema.kind != kind {
+		c.addDiagnostic(offset, "%s must be %s %s, found %s", describeConfigPath(path), article(schema.kind), schema.kind, kind)
+	}
+	switch token {
+	case json.Delim('{'):
+		for c.decoder.More() {
+			keyOffset := c.nextOffset()
+			keyToken, err := c.decoder.Token()
+			if err != nil {
+				return err
+			}
+			key := keyToken.(string)
+			keyPath := append(append([]string{}, path...), key)
+			valueSchema := &configSchema{}
+			if schema.kind == "object" {
+				if schema.keys != nil {
+					if keySchema, ok := schema.keys[key]; ok {
+						valueSchema = keySchema
+					} else if known, ok := c.knownKeyWithCase(key, keyOffset, schema.keys); ok {
+						c.addWarning(keyOffset, "key %s in %s should be %s. Keys will be case-sensitive in the next release", strconv.Quote(key), describeConfigPath(path), strconv.Quote(known))
+						keyPath[len(keyPath)-1] = known
+						valueSchema = schema.keys[known]
+					} else {
+						c.addDiagnostic(keyOffset, "unknown key %s in %s%s", strconv.Quote(key), describeConfigPath(path), suggestKey(key, schema.keys))
+					}
+				} else if schema.values != nil {
+					valueSchema = schema.values
+				}
+			}
+			if err := c.check(valueSchema, keyPath); err != nil {
+				return err
+			}
+			// Point at the key rather than its value
+			c.config.offsets[configPath(keyPath)] = keyOffset
+		}
+		_, err = c.decoder.Token()
+		return err
+	case json.Delim('['):
+		elementSchema := &configSchema{}
+		if schema.kind == "array" && schema.elements != nil {
+			elementSchema = schema.elements
+		}
+		for i := 0; c.decoder.More(); i++ {
+			if err := c.check(elementSchema, append(append([]string{}, path...), strconv.Itoa(i))); err != nil {
+				return err
+			}
+		}
+		_, err = c.decoder.Token()
+		return err
+	}
+	return nil
+}
+
+// knownKeyWithCase returns the known key that key only differs from in case, if the checker
+// allows that. The key is corrected in the checked data, so that it decodes the same way
+// everywhere and diagnostics can find it.
+func (c *configChecker) knownKeyWithCase(key string, keyOffset int, keys map[string]*configSchema) (string, bool) {
+	if !c.allowKeyCase {
+		return "", false
+	}
+	for known := range keys {
+		if !strings.EqualFold(key, known) {
+			continue
+		}
+		data := c.config.data
+		start := keyOffset + 1
+		// Keys with escape sequences are left as they are, since encoding/json decodes them
+		// case-insensitively as well
+		if start+len(key) <= len(data) && string(data[start:start+len(key)]) == key && len(key) == len(known) {
+			copy(data[start:], known)
+		}
+		return known, true
+	}
+	return "", false
+}
+
+// nextOffset returns the offset at which the next token starts
+func (c *configChecker) nextOffset() int {
+	offset := int(c.decoder.InputOffset())
+	data := c.config.data
+	for offset < len(data) && (isSpace(data[offset]) || data[offset] == ',' || data[offset] == ':') {
+		offset++
+	}
+	return offset
+}
+
+func (c *configChecker) addDiagnostic(offset int, format string, args ...interface{}) {
+	line, column := lineAndColumn(c.config.data, offset)
+	c.diagnostics = append(c.diagnostics, ConfigDiagnostic{
+		File:    c.config.name,
+		Line:    line,
+		Column:  column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *configChecker) addWarning(offset int, format string, args ...interface{}) {
+	line, column := lineAndColumn(c.config.data, offset)
+	c.config.warnings = append(c.config.warnings, ConfigDiagnostic{
+		File:    c.config.name,
+		Line:    line,
+		Column:  column,
+		Message: fmt.Sprintf(format, args...),
+		Warning: true,
+	})
+}
+
+func (c *configChecker) addSyntaxError(err error) {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		c.addDiagnostic(int(syntaxErr.Offset), "invalid JSON: %v", syntaxErr)
+		return
+	}
+	c.addDiagnostic(len(c.config.data), "invalid JSON: %v", err)
+}
+
+// ValidateTurboConfig checks the root titan.json, which titanJSON was loaded from, and the
+// titan.json of each workspace. Along with the problems that prevent them from being read, it
+// reports package tasks for packages that don't exist and dependencies on tasks that aren't in
+// the pipeline, followed by any warnings.
+func ValidateTurboConfig(rootPath titanpath.AbsoluteSystemPath, titanJSON *TurboJSON, packageInfos map[interface{}]*PackageJSON) ([]ConfigDiagnostic, error) {
+	if titanJSON.config == nil {
+		// The legacy configuration in package.json isn't validated
+		return nil, nil
+	}
+	pipeline, err := titanJSON.WithWorkspaceConfigs(rootPath, packageInfos)
+	if err != nil {
+		return configDiagnostics(configFile, err)
+	}
+	return append(titanJSON.Validate(pipeline, packageInfos), titanJSON.Warnings()...), nil
+}
+
+// Validate reports the package tasks for packages that don't exist and dependencies on tasks
+// that aren't in the pipeline, in the root titan.json and in the titan.json of each workspace
+// read by WithWorkspaceConfigs, whose result is pipeline. Configurations that didn't come from
+// a titan.json, such as the legacy one in package.json, aren't checked.
+func (tj *TurboJSON) Validate(pipeline Pipeline, packageInfos map[interface{}]*PackageJSON) []ConfigDiagnostic {
+	if tj.config == nil {
+		return nil
+	}
+	diagnostics := checkPipelineReferences(tj.config, "", pipeline, packageInfos)
+	pkgNames := make([]string, 0, len(tj.workspaceConfigs))
+	for pkgName := range tj.workspaceConfigs {
+		pkgNames = append(pkgNames, pkgName)
+	}
+	sort.Strings(pkgNames)
+	for _, pkgName := range pkgNames {
+		diagnostics = append(diagnostics, checkPipelineReferences(tj.workspaceConfigs[pkgName], pkgName, pipeline, packageInfos)...)
+	}
+	return diagnostics
+}
+
+// Warnings returns the problems in the root titan.json that didn't prevent it from being read
+func (tj *TurboJSON) Warnings() []ConfigDiagnostic {
+	if tj.config == nil {
+		return nil
+	}
+	return tj.config.warnings
+}
+
+// configDiagnostics converts an error from reading a titan.json into diagnostics
+func configDiagnostics(name string, err error) ([]ConfigDiagnostic, error) {
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		return configErr.Diagnostics, nil
+	}
+	message := err.Error()
+	if prefix := name + ": "; strings.HasPrefix(message, prefix) {
+		message = message[len(prefix):]
+	} else if i := strings.Index(message, configFile+": "); i >= 0 {
+		// Errors from workspace configurations start with their path
+		name = message[:i+len(configFile)]
+		message = message[i+len(configFile)+2:]
+	}
+	return []ConfigDiagnostic{{File: name, Message: message}}, nil
+}
+
+// checkPipelineReferences reports the tasks in the pipeline of config that refer to packages or
+// tasks that don't exist. pkgName is the workspace that config belongs to, or "" for the root.
+func checkPipelineReferences(config *checkedConfig, pkgName string, pipeline Pipeline, packageInfos map[interface{}]*PackageJSON) []ConfigDiagnostic {
+	raw := struct {
+		Pipeline map[string]struct {
+			DependsOn []string `json:"dependsOn"`
+		} `json:"pipeline"`
+	}{}
+	// The file was already checked against the schema, so this can't fail
+	_ = json.Unmarshal(config.data, &raw)
+
+	tasks := make([]string, 0, len(raw.Pipeline))
+	for task := range raw.Pipeline {
+		tasks = append(tasks, task)
+	}
+	sort.Strings(tasks)
+	diagnostics := []ConfigDiagnostic{}
+	for _, task := range tasks {
+		if util.IsPackageTask(task) {
+			pkg, _ := util.GetPackageTaskFromId(task)
+			if _, ok := packageInfos[pkg]; !ok {
+				diagnostics = append(diagnostics, config.diagnostic([]string{"pipeline", task}, "task %s refers to package %s, which doesn't exist", strconv.Quote(task), strconv.Quote(pkg)))
+			}
+		}
+		for i, dependency := range raw.Pipeline[task].DependsOn {
+			path := []string{"pipeline", task, "dependsOn", strconv.Itoa(i)}
+			if strings.HasPrefix(dependency, envPipelineDelimiter) {
+				continue
+			}
+			dependencyTask := strings.TrimPrefix(dependency, topologicalPipelineDelimiter)
+			if util.IsPackageTask(dependencyTask) {
+				pkg, _ := util.GetPackageTaskFromId(dependencyTask)
+				if _, ok := packageInfos[pkg]; !ok {
+					diagnostics = append(diagnostics, config.diagnostic(path, "task %s depends on %s in package %s, which doesn't exist", strconv.Quote(task), strconv.Quote(dependency), strconv.Quote(pkg)))
+					continue
+				}
+				_, hasTask := pipeline.GetTaskDefinition(dependencyTask)
+				if pkg == util.RootPkgName {
+					// Tasks of the root package need their own entry to be run
+					_, hasTask = pipeline[dependencyTask]
+				}
+				if hasTask {
+					continue
+				}
+			} else if pipeline.HasTask(dependencyTask) {
+				continue
+			}
+			diagnostics = append(diagnostics, config.diagnostic(path, "task %s depends on %s, which isn't in the pipeline", strconv.Quote(task), strconv.Quote(dependency)))
+		}
+	}
+	return diagnostics
+}
+
+// blankComments replaces the comments in titan.json with spaces, so that the result can be
+// decoded as JSON while offsets still point at the same lines and columns
+func blankComments(contents []byte) []byte {
+	data := append([]byte{}, contents...)
+	inString := false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if inString {
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		switch {
+		case c == '"':
+			inString = true
+		case c == '#', c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for ; i < len(data) && data[i] != '\n'; i++ {
+				data[i] = ' '
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			data[i], data[i+1] = ' ', ' '
+			for i += 2; i < len(data) && !(data[i] == '*' && i+1 < len(data) && data[i+1] == '/'); i++ {
+				if data[i] != '\n' {
+					data[i] = ' '
+				}
+			}
+			if i < len(data) {
+				data[i], data[i+1] = ' ', ' '
+				i++
+			}
+		}
+	}
+	return data
+}
+
+func lineAndColumn(data []byte, offset int) (int, int) {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	line := bytes.Count(data[:offset], []byte("\n")) + 1
+	column := offset - (bytes.LastIndexByte(data[:offset], '\n') + 1) + 1
+	return line, column
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func configPath(path []string) string {
+	return strings.Join(path, "\x00")
+}
+
+// describeConfigPath describes where in titan.json path is, for use in diagnostics
+func describeConfigPath(path []string) string {
+	if len(path) == 0 {
+		return "the configuration"
+	}
+	if len(path) >= 2 && path[0] == "pipeline" {
+		if len(path) == 2 {
+			return fmt.Sprintf("task %s", strconv.Quote(path[1]))
+		}
+		return fmt.Sprintf("%s of task %s", strconv.Quote(strings.Join(path[2:], ".")), strconv.Quote(path[1]))
+	}
+	return strconv.Quote(strings.Join(path, "."))
+}
+
+func jsonKind(token json.Token) string {
+	switch token.(type) {
+	case json.Delim:
+		if token == json.Delim('{') {
+			return "object"
+		}
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	}
+	return "null"
+}
+
+func article(kind string) string {
+	if kind == "object" || kind == "array" {
+		return "an"
+	}
+	return "a"
+}
+
+// suggestKey returns a hint naming the known key closest to key, if any is close enough
+// to be a likely typo
+func suggestKey(key string, keys map[string]*configSchema) string {
+	best := ""
+	bestDistance := 3
+	for known := range keys {
+		distance := levenshtein(strings.ToLower(key), strings.ToLower(known))
+		if distance < bestDistance || (distance == bestDistance && known < best) {
+			best = known
+			bestDistance = distance
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(". Did you mean %s?", strconv.Quote(best))
+}
+
+func levenshtein(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,147 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+	"github.com/khulnasoft/titanrepo/cli/internal/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ReadTurboJSON_Diagnostics(t *testing.T) {
+	dir := AbsoluteSystemPathFromUpstream(t.TempDir())
+	configPath := dir.UntypedJoin(configFile)
+	testCases := []struct {
+		contents    string
+		expectedErr string
+	}{
+		{
+			contents:    "{\n  \"pipeline\": {\n    \"build\": {\n      \"dependOn\": [\"^build\"]\n    }\n  }\n}",
+			expectedErr: "titan.json:4:7: unknown key \"dependOn\" in task \"build\". Did you mean \"dependsOn\"?",
+		},
+		{
+			contents:    "{\n  // comments are skipped\n  \"pipeline\": {\n    \"build\": { /* inline */ \"output\": [\"dist/**\"], \"cache\": \"false\" }\n  },\n  \"globalEnv\": \"CI\"\n}",
+			expectedErr: "titan.json:4:29: unknown key \"output\" in task \"build\". Did you mean \"outputs\"?\ntitan.json:4:61: \"cache\" of task \"build\" must be a boolean, found string\ntitan.json:6:16: \"globalEnv\" must be an array, found string",
+		},
+		{
+			contents:    "{\n  \"pipeline\": {\n    \"build\": { \"outputs\": [1] }\n  },\n  \"remoteCache\": { \"team\": \"my-team\" }\n}",
+			expectedErr: "titan.json:3:28: \"outputs.0\" of task \"build\" must be a string, found number\ntitan.json:5:20: unknown key \"team\" in \"remoteCache\". Did you mean \"teamId\"?",
+		},
+		{
+			contents:    "{\n  \"pipeline\": {\n    \"build\": {}\n  \n}",
+			expectedErr: "titan.json:5:2: invalid JSON: unexpected end of JSON input",
+		},
+	}
+	for _, testCase := range testCases {
+		assert.NoError(t, configPath.WriteFile([]byte(testCase.contents), 0644))
+		_, err := readTurboJSON(configPath)
+		assert.EqualError(t, err, testCase.expectedErr)
+		assert.IsType(t, &ConfigError{}, err)
+	}
+}
+
+func Test_ValidateTurboConfig(t *testing.T) {
+	testDir := getTestDir(t, "invalid-references")
+	rootPackageJSON, err := ReadPackageJSON(testDir.UntypedJoin("package.json"))
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+	packageInfos := map[interface{}]*PackageJSON{
+		util.RootPkgName: rootPackageJSON,
+		"web":            {Name: "web", Dir: titanpath.AnchoredUnixPath("apps/web").ToSystemPath()},
+	}
+	titanJSON, err := ReadTurboConfig(testDir, rootPackageJSON)
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+
+	diagnostics, err := ValidateTurboConfig(testDir, titanJSON, packageInfos)
+	assert.NoError(t, err)
+	messages := []string{}
+	for _, diagnostic := range diagnostics {
+		messages = append(messages, diagnostic.String())
+	}
+	assert.EqualValues(t, []string{
+		"titan.json:12:5: task \"admin#build\" refers to package \"admin\", which doesn't exist",
+		"titan.json:10:21: task \"test\" depends on \"biuld\", which isn't in the pipeline",
+		"titan.json:10:30: task \"test\" depends on \"web#lint\", which isn't in the pipeline",
+		"titan.json:10:42: task \"test\" depends on \"admin#build\" in package \"admin\", which doesn't exist",
+		"titan.json:10:57: task \"test\" depends on \"//#test\", which isn't in the pipeline",
+		"apps/web/titan.json:6:30: task \"e2e\" depends on \"serve\", which isn't in the pipeline",
+	}, messages)
+}
+
+func Test_ValidateTurboConfig_InvalidSchema(t *testing.T) {
+	testDir := getTestDir(t, "workspace-configs")
+	rootPackageJSON, err := ReadPackageJSON(testDir.UntypedJoin("package.json"))
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+	packageInfos := map[interface{}]*PackageJSON{
+		util.RootPkgName: rootPackageJSON,
+		"invalid":        {Name: "invalid", Dir: titanpath.AnchoredUnixPath("packages/invalid").ToSystemPath()},
+	}
+	titanJSON, err := ReadTurboConfig(testDir, rootPackageJSON)
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+
+	diagnostics, err := ValidateTurboConfig(testDir, titanJSON, packageInfos)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []ConfigDiagnostic{{
+		File:    "packages/invalid/titan.json",
+		Line:    3,
+		Column:  3,
+		Message: "unknown key \"globalEnv\" in the configuration",
+	}}, diagnostics)
+}
+
+func Test_ReadTurboJSON_KeyCase(t *testing.T) {
+	dir := AbsoluteSystemPathFromUpstream(t.TempDir())
+	configPath := dir.UntypedJoin(configFile)
+	contents := "{\n  \"Pipeline\": {\n    \"build\": { \"DependsOn\": [\"^build\"] }\n  }\n}"
+	assert.NoError(t, configPath.WriteFile([]byte(contents), 0644))
+
+	titanJSON, err := readTurboJSON(configPath)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"build"}, titanJSON.Pipeline["build"].TopologicalDependencies)
+	assert.EqualValues(t, []ConfigDiagnostic{
+		{File: "titan.json", Line: 2, Column: 3, Message: "key \"Pipeline\" in the configuration should be \"pipeline\". Keys will be case-sensitive in the next release", Warning: true},
+		{File: "titan.json", Line: 3, Column: 16, Message: "key \"DependsOn\" in task \"build\" should be \"dependsOn\". Keys will be case-sensitive in the next release", Warning: true},
+	}, titanJSON.Warnings())
+
+	// Keys in the titan.json of a workspace were always case-sensitive
+	workspacePath := dir.UntypedJoin("packages", "ui", configFile)
+	assert.NoError(t, workspacePath.EnsureDir())
+	assert.NoError(t, workspacePath.WriteFile([]byte("{\n  \"extends\": [\"//\"],\n  \"Pipeline\": {}\n}"), 0644))
+	_, _, err = readWorkspaceTurboJSON(workspacePath, "packages/ui/titan.json")
+	assert.EqualError(t, err, "packages/ui/titan.json:3:3: unknown key \"Pipeline\" in the configuration. Did you mean \"pipeline\"?")
+}
+
+func Test_ConfigSchemaMatchesTypes(t *testing.T) {
+	// The published JSON Schema is generated from these types, so they must list every key
+	// that titan.json accepts
+	types, err := os.ReadFile(filepath.Join("..", "..", "..", "packages", "titan-types", "src", "types", "config.ts"))
+	if err != nil {
+		t.Fatalf("failed to read the configuration types: %v", err)
+	}
+	var check func(schema *configSchema, path string)
+	check = func(schema *configSchema, path string) {
+		if schema == nil {
+			return
+		}
+		for key, keySchema := range schema.keys {
+			if !regexp.MustCompile(`(?m)^\s*` + regexp.QuoteMeta(key) + `\??:`).Match(types) {
+				t.Errorf("key %v of %v is missing from config.ts", key, path)
+			}
+			check(keySchema, path+"."+key)
+		}
+		check(schema.values, path+".*")
+		check(schema.elements, path+"[]")
+	}
+	check(_rootConfigSchema, "titan.json")
+	check(_workspaceConfigSchema, "workspace titan.json")
+}
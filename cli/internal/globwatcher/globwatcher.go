@@ -34,9 +34,14 @@ type GlobWatcher struct {
 	hashGlobs  map[string]globs
 	globStatus map[string]util.Set // glob -> hashes where this glob hasn't changed
 
-	closed bool
+	closed         bool
+	onInvalidation InvalidationHandler
 }
 
+// InvalidationHandler is called with the globs that have changed for a hash. It is called
+// while the GlobWatcher is locked, so it must not call back into the GlobWatcher.
+type InvalidationHandler func(hash string, changedGlobs []string)
+
 // New returns a new GlobWatcher instance
 func New(logger hclog.Logger, repoRoot titanpath.AbsoluteSystemPath, cookieWaiter filewatcher.CookieWaiter) *GlobWatcher {
 	return &GlobWatcher{
@@ -60,6 +65,20 @@ func (g *GlobWatcher) isClosed() bool {
 	return g.closed
 }
 
+// Counts returns the number of hashes and globs currently being tracked
+func (g *GlobWatcher) Counts() (hashes int, globs int) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return len(g.hashGlobs), len(g.globStatus)
+}
+
+// OnInvalidation registers a handler to be notified when watched globs change
+func (g *GlobWatcher) OnInvalidation(handler InvalidationHandler) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.onInvalidation = handler
+}
+
 // WatchGlobs registers the given set of globs to be watched for changes and grouped
 // under the given hash. This method pairs with GetChangedGlobs to determine which globs
 // out of a set of candidates have changed since WatchGlobs was called for the same hash.
@@ -140,6 +159,7 @@ func (g *GlobWatcher) OnFileWatchEvent(ev filewatcher.Event) {
 	}
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	invalidated := make(map[string][]string)
 	for glob, hashStatus := range g.globStatus {
 		matches, err := doublestar.Match(glob, filepath.ToSlash(repoRelativePath))
 		if err != nil {
@@ -193,9 +213,15 @@ func (g *GlobWatcher) OnFileWatchEvent(ev filewatcher.Event) {
 				if hashGlobs.Inclusions.Len() == 0 {
 					delete(g.hashGlobs, hash)
 				}
+				invalidated[hash] = append(invalidated[hash], glob)
 			}
 		}
 	}
+	if g.onInvalidation != nil {
+		for hash, globs := range invalidated {
+			g.onInvalidation(hash, globs)
+		}
+	}
 }
 
 // OnFileWatchError implements FileWatchClient.OnFileWatchError
@@ -230,3 +230,47 @@ func TestWatchSingleFile(t *testing.T) {
 	})
 	assert.Equal(t, 0, len(globWatcher.hashGlobs))
 }
+
+func TestOnInvalidation(t *testing.T) {
+	logger := hclog.Default()
+
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+
+	setup(t, repoRoot)
+
+	globWatcher := New(logger, repoRoot, _noopCookieWaiter)
+	invalidated := make(map[string][]string)
+	globWatcher.OnInvalidation(func(hash string, changedGlobs []string) {
+		invalidated[hash] = append(invalidated[hash], changedGlobs...)
+	})
+	globs := fs.TaskOutputs{
+		Inclusions: []string{"my-pkg/dist/**", "my-pkg/.next/**"},
+		Exclusions: []string{"my-pkg/.next/cache/**"},
+	}
+	err := globWatcher.WatchGlobs("the-hash", globs)
+	assert.NilError(t, err, "WatchGlobs")
+
+	// Changes to irrelevant and excluded files don't invalidate anything
+	globWatcher.OnFileWatchEvent(filewatcher.Event{
+		EventType: filewatcher.FileModified,
+		Path:      repoRoot.UntypedJoin("my-pkg", "irrelevant"),
+	})
+	globWatcher.OnFileWatchEvent(filewatcher.Event{
+		EventType: filewatcher.FileAdded,
+		Path:      repoRoot.UntypedJoin("my-pkg", ".next", "cache", "foo"),
+	})
+	assert.Equal(t, 0, len(invalidated))
+
+	globWatcher.OnFileWatchEvent(filewatcher.Event{
+		EventType: filewatcher.FileModified,
+		Path:      repoRoot.UntypedJoin("my-pkg", "dist", "dist-file"),
+	})
+	assert.DeepEqual(t, invalidated, map[string][]string{"the-hash": {"my-pkg/dist/**"}})
+
+	// Once invalidated, a glob is no longer reported
+	globWatcher.OnFileWatchEvent(filewatcher.Event{
+		EventType: filewatcher.FileModified,
+		Path:      repoRoot.UntypedJoin("my-pkg", "dist", "dist-file"),
+	})
+	assert.DeepEqual(t, invalidated, map[string][]string{"the-hash": {"my-pkg/dist/**"}})
+}
@@ -0,0 +1,382 @@
+package hashing
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+	"github.com/pkg/errors"
+)
+
+// _fileHashCacheVersion is bumped whenever the format of the cache changes,
+// discarding existing caches.
+const _fileHashCacheVersion = 2
+
+// hashKind distinguishes the ways a file can be hashed. Git's filters, such as line ending
+// conversion, can make the filtered hash of a file differ from the hash of its contents.
+type hashKind string
+
+const (
+	// _rawHash is the hash of the contents of a file, as computed by HashFiles
+	_rawHash hashKind = "raw"
+	// _filteredHash is the hash of a file after git's filters, as computed by `git hash-object`
+	_filteredHash hashKind = "filtered"
+)
+
+var _hashKinds = []hashKind{_rawHash, _filteredHash}
+
+// fileHashCacheEntry is the hash of a file, along with the stat information
+// that must still match for the hash to be valid.
+type fileHashCacheEntry struct {
+	Mtime int64  `json:"mtime"`
+	Size  int64  `json:"size"`
+	Inode uint64 `json:"inode"`
+	Hash  string `json:"hash"`
+}
+
+type fileHashCacheFile struct {
+	Version int                                        `json:"version"`
+	Entries map[hashKind]map[string]fileHashCacheEntry `json:"entries"`
+}
+
+// FileHashCache persists file hashes across runs, keyed by absolute path. An entry is
+// only used while the file's modification time, size and inode are unchanged, so a
+// stale cache costs extra hashing, never an incorrect hash.
+//
+// A nil *FileHashCache is valid, and hashes every file.
+type FileHashCache struct {
+	path titanpath.AbsoluteSystemPath
+	// createdAt bounds the modification times we trust. A file modified at or after
+	// this time could be modified again without its modification time changing.
+	createdAt time.Time
+
+	mu      sync.RWMutex
+	entries map[hashKind]*fileHashTree
+	// updated and invalidated are the changes to write back in Save
+	updated     map[hashKind]*fileHashTree
+	invalidated map[string]struct{}
+}
+
+// LoadFileHashCache reads the cache at the given path. A missing or unreadable
+// cache results in an empty one.
+func LoadFileHashCache(path titanpath.AbsoluteSystemPath) *FileHashCache {
+	entries := make(map[hashKind]*fileHashTree, len(_hashKinds))
+	updated := make(map[hashKind]*fileHashTree, len(_hashKinds))
+	for kind, kindEntries := range readFileHashCache(path) {
+		entries[kind] = newFileHashTree()
+		for entryPath, entry := range kindEntries {
+			entries[kind].set(entryPath, entry)
+		}
+	}
+	for _, kind := range _hashKinds {
+		if entries[kind] == nil {
+			entries[kind] = newFileHashTree()
+		}
+		updated[kind] = newFileHashTree()
+	}
+	return &FileHashCache{
+		path:        path,
+		createdAt:   time.Now(),
+		entries:     entries,
+		updated:     updated,
+		invalidated: make(map[string]struct{}),
+	}
+}
+
+// readFileHashCache returns the entries of each kind in the cache at the given path
+func readFileHashCache(path titanpath.AbsoluteSystemPath) map[hashKind]map[string]fileHashCacheEntry {
+	entries := make(map[hashKind]map[string]fileHashCacheEntry, len(_hashKinds))
+	contents, err := path.ReadFile()
+	if err != nil {
+		return entries
+	}
+	var cacheFile fileHashCacheFile
+	if err := json.Unmarshal(contents, &cacheFile); err != nil || cacheFile.Version != _fileHashCacheVersion {
+		return entries
+	}
+	for _, kind := range _hashKinds {
+		if kindEntries := cacheFile.Entries[kind]; kindEntries != nil {
+			entries[kind] = kindEntries
+		}
+	}
+	return entries
+}
+
+// HashFile returns the git object hash of the given file, from the cache if possible.
+func (c *FileHashCache) HashFile(file titanpath.AbsoluteSystemPath) (string, error) {
+	hash, info, ok := c.lookup(_rawHash, file)
+	if ok {
+		return hash, nil
+	}
+	hash, err := fs.GitLikeHashFile(file.ToString())
+	if err != nil {
+		return "", err
+	}
+	if info != nil {
+		c.store(_rawHash, file, info, hash)
+	}
+	return hash, nil
+}
+
+// HashFiles hashes the given files in-process, using the cache where possible.
+func (c *FileHashCache) HashFiles(anchor titanpath.AbsoluteSystemPath, files []titanpath.AnchoredSystemPath) (map[titanpath.AnchoredUnixPath]string, error) {
+	return c.cachedHashObject(_rawHash, HashFiles)(anchor, files)
+}
+
+// cachedHashObject wraps a function for hashing files so that it is only called for
+// files without a valid cache entry. kind is the kind of hash that hashObject returns.
+func (c *FileHashCache) cachedHashObject(kind hashKind, hashObject hashObjectFunc) hashObjectFunc {
+	if c == nil {
+		return hashObject
+	}
+	return func(anchor titanpath.AbsoluteSystemPath, files []titanpath.AnchoredSystemPath) (map[titanpath.AnchoredUnixPath]string, error) {
+		output := make(map[titanpath.AnchoredUnixPath]string, len(files))
+		var misses []titanpath.AnchoredSystemPath
+		infos := make(map[titanpath.AnchoredUnixPath]os.FileInfo)
+		for _, file := range files {
+			hash, info, ok := c.lookup(kind, file.RestoreAnchor(anchor))
+			if ok {
+				output[file.ToUnixPath()] = hash
+			} else {
+				misses = append(misses, file)
+				infos[file.ToUnixPath()] = info
+			}
+		}
+		hashes, err := hashObject(anchor, misses)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range misses {
+			hash, ok := hashes[file.ToUnixPath()]
+			if !ok {
+				continue
+			}
+			output[file.ToUnixPath()] = hash
+			if info := infos[file.ToUnixPath()]; info != nil {
+				c.store(kind, file.RestoreAnchor(anchor), info, hash)
+			}
+		}
+		return output, nil
+	}
+}
+
+// lookup returns the cached hash of the given kind for the file if it is still valid. It
+// also returns the file's current stat information, which must be captured before hashing
+// the file to be able to store the result.
+func (c *FileHashCache) lookup(kind hashKind, file titanpath.AbsoluteSystemPath) (string, os.FileInfo, bool) {
+	if c == nil {
+		return "", nil, false
+	}
+	// Follow symlinks, like hashing the file does
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return "", nil, false
+	}
+	c.mu.RLock()
+	entry, ok := c.entries[kind].get(file.ToString())
+	c.mu.RUnlock()
+	if ok && entry.matches(info) {
+		return entry.Hash, info, true
+	}
+	return "", info, false
+}
+
+func (c *FileHashCache) store(kind hashKind, file titanpath.AbsoluteSystemPath, info os.FileInfo, hash string) {
+	if !info.ModTime().Before(c.createdAt) {
+		return
+	}
+	entry := fileHashCacheEntry{
+		Mtime: info.ModTime().UnixNano(),
+		Size:  info.Size(),
+		Inode: fileInode(info),
+		Hash:  hash,
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[kind].set(file.ToString(), entry)
+	c.updated[kind].set(file.ToString(), entry)
+}
+
+func (e fileHashCacheEntry) matches(info os.FileInfo) bool {
+	return e.Mtime == info.ModTime().UnixNano() && e.Size == info.Size() && e.Inode == fileInode(info)
+}
+
+// Invalidate removes the entries for the given path, and everything beneath it
+// if it is a directory.
+func (c *FileHashCache) Invalidate(path titanpath.AbsoluteSystemPath) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := path.ToString()
+	c.invalidated[key] = struct{}{}
+	for _, kind := range _hashKinds {
+		c.entries[kind].remove(key)
+		c.updated[kind].remove(key)
+	}
+}
+
+// Save writes any changes back to disk. Other processes may have saved changes of
+// their own in the meantime, so we merge ours with the current contents of the cache.
+func (c *FileHashCache) Save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.updated[_rawHash].empty() && c.updated[_filteredHash].empty() && len(c.invalidated) == 0 {
+		return nil
+	}
+	entries := readFileHashCache(c.path)
+	for _, kind := range _hashKinds {
+		kindEntries := entries[kind]
+		if kindEntries == nil {
+			kindEntries = make(map[string]fileHashCacheEntry)
+			entries[kind] = kindEntries
+		}
+		for path := range kindEntries {
+			if c.isInvalidated(path) {
+				delete(kindEntries, path)
+			}
+		}
+		c.updated[kind].each(func(path string, entry fileHashCacheEntry) {
+			kindEntries[path] = entry
+		})
+	}
+	contents, err := json.Marshal(&fileHashCacheFile{
+		Version: _fileHashCacheVersion,
+		Entries: entries,
+	})
+	if err != nil {
+		return err
+	}
+	if err := c.path.EnsureDir(); err != nil {
+		return errors.Wrap(err, "failed to create file hash cache directory")
+	}
+	// Write to a temporary file and rename it into place, so that readers never
+	// see a partially written cache
+	tmp, err := os.CreateTemp(c.path.Dir().ToString(), c.path.Base())
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(contents); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path.ToString()); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	for _, kind := range _hashKinds {
+		c.updated[kind] = newFileHashTree()
+	}
+	c.invalidated = make(map[string]struct{})
+	return nil
+}
+
+// isInvalidated returns true if the path or any of its parent directories have been invalidated
+func (c *FileHashCache) isInvalidated(path string) bool {
+	for {
+		if _, ok := c.invalidated[path]; ok {
+			return true
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return false
+		}
+		path = parent
+	}
+}
+
+// fileHashTree holds cache entries by directory, so that a directory and everything beneath it
+// can be invalidated without looking at every entry
+type fileHashTree struct {
+	files    map[string]fileHashCacheEntry
+	children map[string]*fileHashTree
+}
+
+func newFileHashTree() *fileHashTree {
+	return &fileHashTree{
+		files:    make(map[string]fileHashCacheEntry),
+		children: make(map[string]*fileHashTree),
+	}
+}
+
+// parent returns the tree for the directory containing path, along with the base name of path.
+// If create is false and the directory has no entries, it returns nil.
+func (t *fileHashTree) parent(path string, create bool) (*fileHashTree, string) {
+	segments := strings.Split(path, string(filepath.Separator))
+	for _, segment := range segments[:len(segments)-1] {
+		child, ok := t.children[segment]
+		if !ok {
+			if !create {
+				return nil, ""
+			}
+			child = newFileHashTree()
+			t.children[segment] = child
+		}
+		t = child
+	}
+	return t, segments[len(segments)-1]
+}
+
+func (t *fileHashTree) get(path string) (fileHashCacheEntry, bool) {
+	dir, base := t.parent(path, false)
+	if dir == nil {
+		return fileHashCacheEntry{}, false
+	}
+	entry, ok := dir.files[base]
+	return entry, ok
+}
+
+func (t *fileHashTree) set(path string, entry fileHashCacheEntry) {
+	dir, base := t.parent(path, true)
+	dir.files[base] = entry
+}
+
+// remove deletes the entry for path, and every entry beneath it if it is a directory
+func (t *fileHashTree) remove(path string) {
+	dir, base := t.parent(path, false)
+	if dir == nil {
+		return
+	}
+	delete(dir.files, base)
+	delete(dir.children, base)
+}
+
+func (t *fileHashTree) empty() bool {
+	if len(t.files) > 0 {
+		return false
+	}
+	for _, child := range t.children {
+		if !child.empty() {
+			return false
+		}
+	}
+	return true
+}
+
+// each calls fn with every entry in the tree and its full path
+func (t *fileHashTree) each(fn func(path string, entry fileHashCacheEntry)) {
+	t.eachWithPrefix(nil, fn)
+}
+
+func (t *fileHashTree) eachWithPrefix(prefix []string, fn func(path string, entry fileHashCacheEntry)) {
+	for base, entry := range t.files {
+		fn(strings.Join(append(prefix, base), string(filepath.Separator)), entry)
+	}
+	for segment, child := range t.children {
+		child.eachWithPrefix(append(prefix[:len(prefix):len(prefix)], segment), fn)
+	}
+}
@@ -0,0 +1,200 @@
+package hashing
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+	"gotest.tools/v3/assert"
+)
+
+// writeOldFile writes a file with a modification time far enough in the past
+// for its hash to be cacheable
+func writeOldFile(t *testing.T, file titanpath.AbsoluteSystemPath, contents string) {
+	assert.NilError(t, file.EnsureDir(), "EnsureDir")
+	assert.NilError(t, file.WriteFile([]byte(contents), 0644), "WriteFile")
+	old := time.Now().Add(-time.Hour)
+	assert.NilError(t, os.Chtimes(file.ToString(), old, old), "Chtimes")
+}
+
+func TestFileHashCache_HashFile(t *testing.T) {
+	dir := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	cachePath := dir.UntypedJoin("cache", "file-hashes.json")
+	file := dir.UntypedJoin("repo", "file")
+	writeOldFile(t, file, "contents")
+	expected, err := fs.GitLikeHashFile(file.ToString())
+	assert.NilError(t, err, "GitLikeHashFile")
+
+	cache := LoadFileHashCache(cachePath)
+	hash, err := cache.HashFile(file)
+	assert.NilError(t, err, "HashFile")
+	assert.Equal(t, hash, expected)
+	assert.NilError(t, cache.Save(), "Save")
+
+	// A fresh cache returns the stored hash without reading the file, which we
+	// detect by planting a bogus hash
+	cache = LoadFileHashCache(cachePath)
+	entry, ok := cache.entries[_rawHash].get(file.ToString())
+	assert.Assert(t, ok, "expected %v to be cached", file)
+	entry.Hash = "cached"
+	cache.entries[_rawHash].set(file.ToString(), entry)
+	hash, err = cache.HashFile(file)
+	assert.NilError(t, err, "HashFile")
+	assert.Equal(t, hash, "cached")
+
+	// Changing the file invalidates the entry, even without the daemon
+	writeOldFile(t, file, "new contents")
+	expected, err = fs.GitLikeHashFile(file.ToString())
+	assert.NilError(t, err, "GitLikeHashFile")
+	hash, err = cache.HashFile(file)
+	assert.NilError(t, err, "HashFile")
+	assert.Equal(t, hash, expected)
+}
+
+func TestFileHashCache_RecentlyModified(t *testing.T) {
+	dir := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	file := dir.UntypedJoin("file")
+	assert.NilError(t, file.WriteFile([]byte("contents"), 0644), "WriteFile")
+	future := time.Now().Add(time.Hour)
+	assert.NilError(t, os.Chtimes(file.ToString(), future, future), "Chtimes")
+
+	cache := LoadFileHashCache(dir.UntypedJoin("file-hashes.json"))
+	_, err := cache.HashFile(file)
+	assert.NilError(t, err, "HashFile")
+	_, ok := cache.entries[_rawHash].get(file.ToString())
+	assert.Assert(t, !ok, "expected recently modified file not to be cached")
+}
+
+func TestFileHashCache_HashFiles(t *testing.T) {
+	dir := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	writeOldFile(t, dir.UntypedJoin("a"), "a")
+	writeOldFile(t, dir.UntypedJoin("dir", "b"), "b")
+	files := []titanpath.AnchoredSystemPath{
+		titanpath.AnchoredUnixPath("a").ToSystemPath(),
+		titanpath.AnchoredUnixPath("dir/b").ToSystemPath(),
+	}
+	expected, err := HashFiles(dir, files)
+	assert.NilError(t, err, "HashFiles")
+
+	cache := LoadFileHashCache(dir.UntypedJoin("file-hashes.json"))
+	hashes, err := cache.HashFiles(dir, files)
+	assert.NilError(t, err, "HashFiles")
+	assert.DeepEqual(t, hashes, expected)
+
+	// Only misses are passed through to the wrapped function
+	var hashed []titanpath.AnchoredSystemPath
+	countingHash := func(anchor titanpath.AbsoluteSystemPath, files []titanpath.AnchoredSystemPath) (map[titanpath.AnchoredUnixPath]string, error) {
+		hashed = append(hashed, files...)
+		return HashFiles(anchor, files)
+	}
+	writeOldFile(t, dir.UntypedJoin("a"), "changed")
+	hashes, err = cache.cachedHashObject(_rawHash, countingHash)(dir, files)
+	assert.NilError(t, err, "cachedHashObject")
+	assert.DeepEqual(t, hashed, files[:1])
+	assert.Equal(t, hashes["dir/b"], expected["dir/b"])
+	assert.Assert(t, hashes["a"] != expected["a"])
+}
+
+func TestFileHashCache_Invalidate(t *testing.T) {
+	dir := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	cachePath := dir.UntypedJoin("file-hashes.json")
+	repo := dir.UntypedJoin("repo")
+	files := []titanpath.AbsoluteSystemPath{
+		repo.UntypedJoin("a"),
+		repo.UntypedJoin("dir", "b"),
+		repo.UntypedJoin("dir", "c"),
+		repo.UntypedJoin("dir-sibling"),
+	}
+	run := LoadFileHashCache(cachePath)
+	for _, file := range files {
+		writeOldFile(t, file, file.Base())
+		_, err := run.HashFile(file)
+		assert.NilError(t, err, "HashFile")
+	}
+	assert.NilError(t, run.Save(), "Save")
+
+	// The daemon invalidates a directory, while another run adds an entry
+	daemon := LoadFileHashCache(cachePath)
+	daemon.Invalidate(repo.UntypedJoin("dir"))
+	_, ok := daemon.entries[_rawHash].get(files[1].ToString())
+	assert.Assert(t, !ok, "expected entries beneath dir to be invalidated")
+
+	newFile := repo.UntypedJoin("new")
+	writeOldFile(t, newFile, "new")
+	run = LoadFileHashCache(cachePath)
+	_, err := run.HashFile(newFile)
+	assert.NilError(t, err, "HashFile")
+	assert.NilError(t, run.Save(), "Save")
+	assert.NilError(t, daemon.Save(), "Save")
+
+	entries := readFileHashCache(cachePath)[_rawHash]
+	for _, file := range []titanpath.AbsoluteSystemPath{files[0], files[3], newFile} {
+		_, ok := entries[file.ToString()]
+		assert.Assert(t, ok, "expected %v to be cached", file)
+	}
+	for _, file := range files[1:3] {
+		_, ok := entries[file.ToString()]
+		assert.Assert(t, !ok, "expected %v to be invalidated", file)
+	}
+}
+
+func TestFileHashCache_HashKinds(t *testing.T) {
+	dir := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	cachePath := dir.UntypedJoin("file-hashes.json")
+	writeOldFile(t, dir.UntypedJoin("file"), "contents")
+	files := []titanpath.AnchoredSystemPath{titanpath.AnchoredUnixPath("file").ToSystemPath()}
+	filtered := func(anchor titanpath.AbsoluteSystemPath, files []titanpath.AnchoredSystemPath) (map[titanpath.AnchoredUnixPath]string, error) {
+		return map[titanpath.AnchoredUnixPath]string{"file": "filtered"}, nil
+	}
+
+	cache := LoadFileHashCache(cachePath)
+	raw, err := cache.HashFiles(dir, files)
+	assert.NilError(t, err, "HashFiles")
+	hashes, err := cache.cachedHashObject(_filteredHash, filtered)(dir, files)
+	assert.NilError(t, err, "cachedHashObject")
+	assert.Equal(t, hashes["file"], "filtered")
+	assert.NilError(t, cache.Save(), "Save")
+
+	// Each kind of hash is cached separately
+	cache = LoadFileHashCache(cachePath)
+	hashes, err = cache.HashFiles(dir, files)
+	assert.NilError(t, err, "HashFiles")
+	assert.DeepEqual(t, hashes, raw)
+	hashes, err = cache.cachedHashObject(_filteredHash, HashFiles)(dir, files)
+	assert.NilError(t, err, "cachedHashObject")
+	assert.Equal(t, hashes["file"], "filtered")
+
+	// Invalidating a file invalidates both
+	cache.Invalidate(dir.UntypedJoin("file"))
+	for _, kind := range _hashKinds {
+		_, ok := cache.entries[kind].get(dir.UntypedJoin("file").ToString())
+		assert.Assert(t, !ok, "expected the %v hash to be invalidated", kind)
+	}
+}
+
+func TestFileHashCache_Corrupt(t *testing.T) {
+	dir := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	cachePath := dir.UntypedJoin("file-hashes.json")
+	assert.NilError(t, cachePath.WriteFile([]byte("{not json"), 0644), "WriteFile")
+	cache := LoadFileHashCache(cachePath)
+	assert.Assert(t, cache.entries[_rawHash].empty())
+
+	file := dir.UntypedJoin("file")
+	writeOldFile(t, file, "contents")
+	_, err := cache.HashFile(file)
+	assert.NilError(t, err, "HashFile")
+	assert.NilError(t, cache.Save(), "Save")
+	assert.Equal(t, len(readFileHashCache(cachePath)[_rawHash]), 1)
+}
+
+func TestFileHashCache_Nil(t *testing.T) {
+	dir := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	file := dir.UntypedJoin("file")
+	writeOldFile(t, file, "contents")
+	var cache *FileHashCache
+	_, err := cache.HashFile(file)
+	assert.NilError(t, err, "HashFile")
+	assert.NilError(t, cache.Save(), "Save")
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package hashing
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileInode returns the inode number of the file, which changes when a file is
+// replaced rather than modified in place.
+func fileInode(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+	return 0
+}
@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package hashing
+
+import "os"
+
+// fileInode returns 0, since os.FileInfo does not expose file indexes on Windows.
+// Modification time and size are still checked.
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
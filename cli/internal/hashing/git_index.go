@@ -0,0 +1,478 @@
+package hashing
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+	"github.com/pkg/errors"
+)
+
+// ErrUnsupportedIndex is returned when a repository uses git features that we don't
+// handle in-process, such as sparse checkouts, split indexes and submodules. Callers
+// should fall back to GetPackageDeps, which shells out to git.
+var ErrUnsupportedIndex = errors.New("unsupported git index")
+
+// Mode bits from the index, see https://git-scm.com/docs/index-format
+const (
+	_modeTypeMask = 0170000
+	_modeRegular  = 0100000
+	_modeSymlink  = 0120000
+	_modeGitlink  = 0160000
+)
+
+// Flags from the index, see https://git-scm.com/docs/index-format
+const (
+	_flagAssumeValid  = 0x8000
+	_flagExtended     = 0x4000
+	_flagStageMask    = 0x3000
+	_flagSkipWorktree = 0x4000
+	_flagIntentToAdd  = 0x2000
+)
+
+// gitIndexEntry is the subset of an index entry needed to tell whether the file
+// in the working tree still matches what was staged.
+type gitIndexEntry struct {
+	path        string
+	ctime       time.Time
+	mtime       time.Time
+	ino         uint32
+	size        uint32
+	mode        uint32
+	hash        string
+	intentToAdd bool
+}
+
+// GitIndex hashes files in a git repository in-process. Files that are unchanged
+// since they were staged take their hash from the index rather than being read.
+type GitIndex struct {
+	repoRoot titanpath.AbsoluteSystemPath
+	// entries and untracked are sorted by path, relative to repoRoot
+	entries   []*gitIndexEntry
+	byPath    map[string]*gitIndexEntry
+	untracked []string
+	// indexMtime is when the index was last written. Files modified at or after this
+	// time might have changed without changing their stat information.
+	indexMtime time.Time
+	// filtersContent is true if git might transform file contents before hashing them,
+	// in which case we can't compute the hash of modified files ourselves.
+	filtersContent bool
+	// trustCtime and checkStat are git's core.trustCtime and core.checkStat settings,
+	// which control the stat information compared to tell whether a file changed
+	trustCtime bool
+	checkStat  string
+}
+
+// LoadGitIndex reads the index of the git repository at repoRoot, and lists its untracked
+// files. The result is a snapshot: files changed afterwards may hash incorrectly.
+func LoadGitIndex(repoRoot titanpath.AbsoluteSystemPath) (*GitIndex, error) {
+	dotGit := repoRoot.UntypedJoin(".git")
+	if !dotGit.DirExists() {
+		// worktrees and submodules have a .git file pointing elsewhere
+		return nil, ErrUnsupportedIndex
+	}
+	indexPath := dotGit.UntypedJoin("index")
+	info, err := indexPath.Lstat()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(indexPath.ToString())
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parseGitIndex(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Untracked files are determined by ignore rules from several sources, which
+	// we leave to git. We only need to ask once for the whole repository.
+	cmd := exec.Command("git", "ls-files", "--others", "--exclude-standard", "-z")
+	cmd.Dir = repoRoot.ToString()
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read `git ls-files`: %w", err)
+	}
+	var untracked []string
+	for _, path := range bytes.Split(out, []byte{0}) {
+		if len(path) > 0 {
+			untracked = append(untracked, string(path))
+		}
+	}
+	sort.Strings(untracked)
+
+	gi := &GitIndex{
+		repoRoot:   repoRoot,
+		entries:    entries,
+		byPath:     make(map[string]*gitIndexEntry, len(entries)),
+		untracked:  untracked,
+		indexMtime: info.ModTime(),
+	}
+	for _, entry := range entries {
+		gi.byPath[entry.path] = entry
+	}
+	config, err := readGitConfig(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	gi.filtersContent = gi.mayFilterContent(dotGit, config)
+	gi.trustCtime = !isGitFalse(config["core.trustctime"])
+	gi.checkStat = strings.ToLower(config["core.checkstat"])
+	return gi, nil
+}
+
+// _gitConfigPattern matches the canonical names of the git settings that affect hashing
+const _gitConfigPattern = `^(core\.(autocrlf|attributesfile|trustctime|checkstat)|filter\..*)$`
+
+// readGitConfig returns the settings matching _gitConfigPattern from every configuration
+// git reads for the repository, including the system, global and XDG configurations and
+// the files they include. Settings without a value, which git treats as true, are "true".
+func readGitConfig(repoRoot titanpath.AbsoluteSystemPath) (map[string]string, error) {
+	cmd := exec.Command("git", "config", "--null", "--get-regexp", _gitConfigPattern)
+	cmd.Dir = repoRoot.ToString()
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		// None of the settings are set
+		return map[string]string{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read `git config`: %w", err)
+	}
+	config := make(map[string]string)
+	for _, setting := range bytes.Split(out, []byte{0}) {
+		if len(setting) == 0 {
+			continue
+		}
+		key, value, hasValue := strings.Cut(string(setting), "\n")
+		if !hasValue {
+			value = "true"
+		}
+		// Later settings take precedence, like they do for git
+		config[key] = value
+	}
+	return config, nil
+}
+
+// isGitFalse returns true if a git boolean setting is false. Unset settings aren't false.
+func isGitFalse(value string) bool {
+	switch strings.ToLower(value) {
+	case "false", "no", "off", "0":
+		return true
+	}
+	return false
+}
+
+// mayFilterContent reports whether git could apply line ending conversion or clean
+// filters when hashing files. This errs on the side of caution, since the cost of
+// being wrong is only that modified files are hashed by `git hash-object`.
+func (gi *GitIndex) mayFilterContent(dotGit titanpath.AbsoluteSystemPath, config map[string]string) bool {
+	if runtime.GOOS == "windows" {
+		// Git for Windows enables core.autocrlf in its system configuration
+		return true
+	}
+	for _, entry := range gi.entries {
+		if entry.path == ".gitattributes" || strings.HasSuffix(entry.path, "/.gitattributes") {
+			return true
+		}
+	}
+	if dotGit.UntypedJoin("info", "attributes").FileExists() {
+		return true
+	}
+	if autocrlf, ok := config["core.autocrlf"]; ok && !isGitFalse(autocrlf) {
+		return true
+	}
+	for key := range config {
+		if strings.HasPrefix(key, "filter.") {
+			return true
+		}
+	}
+	attributesFile, ok := config["core.attributesfile"]
+	if !ok {
+		// git reads the global attributes from the XDG configuration directory by default
+		if xdgConfigHome := os.Getenv("XDG_CONFIG_HOME"); xdgConfigHome != "" {
+			attributesFile = filepath.Join(xdgConfigHome, "git", "attributes")
+		} else {
+			attributesFile = filepath.Join("~", ".config", "git", "attributes")
+		}
+	}
+	if strings.HasPrefix(attributesFile, "~/") || strings.HasPrefix(attributesFile, "~"+string(filepath.Separator)) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return true
+		}
+		attributesFile = filepath.Join(home, attributesFile[2:])
+	}
+	if attributesFile != "" && !filepath.IsAbs(attributesFile) {
+		// Relative paths are relative to where git runs, which isn't necessarily the root
+		return true
+	}
+	if attributesFile != "" && fs.FileExists(attributesFile) {
+		return true
+	}
+	return false
+}
+
+// GetPackageDeps produces the same result as the package-level GetPackageDeps, using
+// the index instead of spawning git for each package where possible.
+func (gi *GitIndex) GetPackageDeps(rootPath titanpath.AbsoluteSystemPath, p *PackageDepsOptions) (map[titanpath.AnchoredUnixPath]string, error) {
+	if len(p.InputPatterns) > 0 {
+		// `git status` matches input patterns with git's pathspec rules, which differ
+		// from our globbing. Keep asking git so the set of files stays the same.
+		return getPackageDeps(rootPath, p, func(anchor titanpath.AbsoluteSystemPath, files []titanpath.AnchoredSystemPath) (map[titanpath.AnchoredUnixPath]string, error) {
+			// `git hash-object` follows symlinks, so we can't use the hash of the link from the index
+			return gi.hashWorkingTree(anchor, files, false, p.FileHashCache)
+		})
+	}
+
+	pkgPath := rootPath.UntypedJoin(p.PackagePath.ToStringDuringMigration())
+	pkgPathFromRepo, err := pkgPath.RelativeTo(gi.repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	prefix := ""
+	if pkgPathFromRepo != "." {
+		prefix = pkgPathFromRepo.ToUnixPath().ToString() + "/"
+	}
+
+	var filesToHash []titanpath.AnchoredSystemPath
+	start := sort.Search(len(gi.entries), func(i int) bool { return gi.entries[i].path >= prefix })
+	for _, entry := range gi.entries[start:] {
+		if !strings.HasPrefix(entry.path, prefix) {
+			break
+		}
+		if entry.mode&_modeTypeMask == _modeGitlink {
+			return nil, ErrUnsupportedIndex
+		}
+		filesToHash = append(filesToHash, titanpath.AnchoredUnixPathFromUpstream(strings.TrimPrefix(entry.path, prefix)).ToSystemPath())
+	}
+	start = sort.SearchStrings(gi.untracked, prefix)
+	for _, path := range gi.untracked[start:] {
+		if !strings.HasPrefix(path, prefix) {
+			break
+		}
+		if strings.HasSuffix(path, "/") {
+			// a nested repository
+			return nil, ErrUnsupportedIndex
+		}
+		filesToHash = append(filesToHash, titanpath.AnchoredUnixPathFromUpstream(strings.TrimPrefix(path, prefix)).ToSystemPath())
+	}
+
+	// Like `git ls-tree`, unchanged symlinks are hashed as the link itself
+	return gi.hashWorkingTree(pkgPath, filesToHash, true, p.FileHashCache)
+}
+
+// hashWorkingTree returns the git object hashes of the given files, skipping files that
+// no longer exist. Files that are unchanged since they were staged use the hash from the
+// index, and the rest are hashed as `git hash-object` would.
+func (gi *GitIndex) hashWorkingTree(anchor titanpath.AbsoluteSystemPath, files []titanpath.AnchoredSystemPath, useIndexForSymlinks bool, cache *FileHashCache) (map[titanpath.AnchoredUnixPath]string, error) {
+	output := make(map[titanpath.AnchoredUnixPath]string, len(files))
+	var filesToHash []titanpath.AnchoredSystemPath
+	for _, file := range files {
+		fullPath := file.RestoreAnchor(anchor)
+		info, err := fullPath.Lstat()
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) || (err == nil && info.IsDir()) {
+			// git reports these as deleted
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		repoPath, err := fullPath.RelativeTo(gi.repoRoot)
+		if err != nil {
+			return nil, err
+		}
+		if entry, ok := gi.byPath[repoPath.ToUnixPath().ToString()]; ok && gi.isUnchanged(entry, info, useIndexForSymlinks) {
+			output[file.ToUnixPath()] = entry.hash
+		} else {
+			filesToHash = append(filesToHash, file)
+		}
+	}
+
+	kind, hashObject := _rawHash, HashFiles
+	if gi.filtersContent {
+		kind, hashObject = _filteredHash, gitHashObject
+	}
+	hashes, err := cache.cachedHashObject(kind, hashObject)(anchor, filesToHash)
+	if err != nil {
+		return nil, err
+	}
+	for path, hash := range hashes {
+		output[path] = hash
+	}
+	return output, nil
+}
+
+// isUnchanged returns true if the file in the working tree matches its index entry.
+// Like git, we consider a file unchanged if its stat information matches, unless it was
+// modified in the same instant the index was written.
+func (gi *GitIndex) isUnchanged(entry *gitIndexEntry, info os.FileInfo, useIndexForSymlinks bool) bool {
+	if entry.intentToAdd {
+		return false
+	}
+	switch entry.mode & _modeTypeMask {
+	case _modeRegular:
+		if !info.Mode().IsRegular() {
+			return false
+		}
+	case _modeSymlink:
+		if !useIndexForSymlinks || info.Mode()&os.ModeSymlink == 0 {
+			return false
+		}
+	default:
+		return false
+	}
+	if entry.size != uint32(info.Size()) || !entry.mtime.Equal(info.ModTime()) || !info.ModTime().Before(gi.indexMtime) {
+		return false
+	}
+	// Like git, with core.checkStat=minimal only whole seconds of the ctime are compared
+	minimal := gi.checkStat == "minimal"
+	if ctime, ok := fileCtime(info); ok && gi.trustCtime {
+		if minimal && ctime.Unix() != entry.ctime.Unix() || !minimal && !ctime.Equal(entry.ctime) {
+			return false
+		}
+	}
+	// The index only holds the low 32 bits of the inode. It is 0 where git doesn't record
+	// inodes, such as on Windows.
+	if ino := fileInode(info); !minimal && ino != 0 && entry.ino != 0 && uint32(ino) != entry.ino {
+		return false
+	}
+	return true
+}
+
+// parseGitIndex parses versions 2 through 4 of the git index format, returning the
+// entries sorted by path. See https://git-scm.com/docs/index-format
+func parseGitIndex(data []byte) ([]*gitIndexEntry, error) {
+	const headerSize = 12
+	const checksumSize = sha1.Size
+	if len(data) < headerSize+checksumSize || string(data[:4]) != "DIRC" {
+		return nil, errors.New("invalid git index header")
+	}
+	body := data[:len(data)-checksumSize]
+	checksum := data[len(data)-checksumSize:]
+	// index.skipHash writes a null checksum
+	if !bytes.Equal(checksum, make([]byte, checksumSize)) {
+		actual := sha1.Sum(body)
+		if !bytes.Equal(actual[:], checksum) {
+			// Either corrupt, or a repository using a hash other than SHA-1
+			return nil, ErrUnsupportedIndex
+		}
+	}
+
+	version := binary.BigEndian.Uint32(body[4:8])
+	if version < 2 || version > 4 {
+		return nil, ErrUnsupportedIndex
+	}
+	count := binary.BigEndian.Uint32(body[8:12])
+	entries := make([]*gitIndexEntry, 0, count)
+	offset := headerSize
+	previousPath := ""
+	for i := uint32(0); i < count; i++ {
+		const fixedSize = 62
+		if offset+fixedSize > len(body) {
+			return nil, errors.New("truncated git index entry")
+		}
+		entryStart := offset
+		fields := body[offset:]
+		ctimeSec := binary.BigEndian.Uint32(fields[0:4])
+		ctimeNsec := binary.BigEndian.Uint32(fields[4:8])
+		mtimeSec := binary.BigEndian.Uint32(fields[8:12])
+		mtimeNsec := binary.BigEndian.Uint32(fields[12:16])
+		ino := binary.BigEndian.Uint32(fields[20:24])
+		mode := binary.BigEndian.Uint32(fields[24:28])
+		size := binary.BigEndian.Uint32(fields[36:40])
+		hash := hex.EncodeToString(fields[40:60])
+		flags := binary.BigEndian.Uint16(fields[60:62])
+		offset += fixedSize
+
+		var extendedFlags uint16
+		if flags&_flagExtended != 0 {
+			if version < 3 || offset+2 > len(body) {
+				return nil, errors.New("invalid extended flags in git index")
+			}
+			extendedFlags = binary.BigEndian.Uint16(body[offset : offset+2])
+			offset += 2
+		}
+		if flags&_flagStageMask != 0 || flags&_flagAssumeValid != 0 || extendedFlags&_flagSkipWorktree != 0 {
+			// merge conflicts, assume-unchanged and sparse checkouts
+			return nil, ErrUnsupportedIndex
+		}
+
+		var path string
+		if version == 4 {
+			// The path is compressed relative to the previous entry's path
+			strip, n := readIndexVarint(body[offset:])
+			if n == 0 || int(strip) > len(previousPath) {
+				return nil, errors.New("invalid path in git index")
+			}
+			offset += n
+			end := bytes.IndexByte(body[offset:], 0)
+			if end < 0 {
+				return nil, errors.New("invalid path in git index")
+			}
+			path = previousPath[:len(previousPath)-int(strip)] + string(body[offset:offset+end])
+			offset += end + 1
+		} else {
+			end := bytes.IndexByte(body[offset:], 0)
+			if end < 0 {
+				return nil, errors.New("invalid path in git index")
+			}
+			path = string(body[offset : offset+end])
+			// Entries are padded with 1-8 nul bytes to a multiple of 8 bytes
+			offset = entryStart + ((offset + end - entryStart + 8) &^ 7)
+		}
+		previousPath = path
+
+		entries = append(entries, &gitIndexEntry{
+			path:        path,
+			ctime:       time.Unix(int64(ctimeSec), int64(ctimeNsec)),
+			mtime:       time.Unix(int64(mtimeSec), int64(mtimeNsec)),
+			ino:         ino,
+			size:        size,
+			mode:        mode,
+			hash:        hash,
+			intentToAdd: extendedFlags&_flagIntentToAdd != 0,
+		})
+	}
+
+	// Extensions follow the entries. Most are caches we can ignore, but some
+	// change the meaning of the entries we've read.
+	for offset+8 <= len(body) {
+		signature := string(body[offset : offset+4])
+		size := int(binary.BigEndian.Uint32(body[offset+4 : offset+8]))
+		switch signature {
+		case "link", "sdir":
+			// split index and sparse index
+			return nil, ErrUnsupportedIndex
+		}
+		offset += 8 + size
+	}
+
+	return entries, nil
+}
+
+// readIndexVarint reads the offset encoding used by version 4 of the index format,
+// returning the value and the number of bytes read, or 0 bytes if it is invalid.
+func readIndexVarint(data []byte) (uint64, int) {
+	var value uint64
+	for i, c := range data {
+		if i > 0 {
+			value++
+		}
+		value = (value << 7) | uint64(c&0x7f)
+		if c&0x80 == 0 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
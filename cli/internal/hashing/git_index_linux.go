@@ -0,0 +1,18 @@
+//go:build linux
+// +build linux
+
+package hashing
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileCtime returns the time the file's metadata last changed, which git records in the index
+func fileCtime(info os.FileInfo) (time.Time, bool) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(int64(stat.Ctim.Sec), int64(stat.Ctim.Nsec)), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package hashing
+
+import (
+	"os"
+	"time"
+)
+
+// fileCtime reports that the ctime isn't available, so only the other stat information is
+// compared. On Windows, git doesn't record a meaningful ctime in the index.
+func fileCtime(info os.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
@@ -0,0 +1,306 @@
+package hashing
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+	"gotest.tools/v3/assert"
+)
+
+// setupIndexTestRepo creates a repository with files in a variety of states:
+//
+//	<root>/
+//	  .gitignore       <- ignores *.log
+//	  untracked-root   <- new file not added to git
+//	  my-pkg/
+//	    committed-file
+//	    modified-file  <- changed since commit
+//	    deleted-file   <- removed since commit
+//	    staged-file    <- new file added to the index
+//	    restaged-file  <- changed and added to the index
+//	    untracked-file <- new file not added to git
+//	    ignored.log    <- ignored file
+//	    package.json
+//	    dir/
+//	      nested-file
+//	      link         <- symlink to nested-file
+func setupIndexTestRepo(t testing.TB) titanpath.AbsoluteSystemPath {
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	writeFile := func(path string, contents string) {
+		file := repoRoot.UntypedJoin(path)
+		assert.NilError(t, file.EnsureDir(), "EnsureDir")
+		assert.NilError(t, file.WriteFile([]byte(contents), 0644), "WriteFile")
+	}
+
+	writeFile(".gitignore", "*.log\n")
+	writeFile("my-pkg/committed-file", "committed bytes")
+	writeFile("my-pkg/modified-file", "original bytes")
+	writeFile("my-pkg/deleted-file", "delete-me")
+	writeFile("my-pkg/restaged-file", "original bytes")
+	writeFile("my-pkg/package.json", "{}")
+	writeFile("my-pkg/dir/nested-file", "nested")
+	if runtime.GOOS != "windows" {
+		assert.NilError(t, repoRoot.UntypedJoin("my-pkg", "dir", "link").Symlink("nested-file"), "Symlink")
+	}
+
+	requireGitCmd(t, repoRoot, "init", ".")
+	requireGitCmd(t, repoRoot, "config", "--local", "user.name", "test")
+	requireGitCmd(t, repoRoot, "config", "--local", "user.email", "test@example.com")
+	requireGitCmd(t, repoRoot, "add", ".")
+	requireGitCmd(t, repoRoot, "commit", "-m", "foo")
+
+	writeFile("my-pkg/modified-file", "modified bytes")
+	assert.NilError(t, repoRoot.UntypedJoin("my-pkg", "deleted-file").Remove(), "Remove")
+	writeFile("my-pkg/staged-file", "staged bytes")
+	writeFile("my-pkg/restaged-file", "restaged bytes")
+	requireGitCmd(t, repoRoot, "add", "my-pkg/staged-file", "my-pkg/restaged-file")
+	writeFile("my-pkg/untracked-file", "untracked bytes")
+	writeFile("my-pkg/ignored.log", "ignored bytes")
+	writeFile("untracked-root", "untracked bytes")
+	return repoRoot
+}
+
+func TestGitIndex_GetPackageDeps(t *testing.T) {
+	for _, indexVersion := range []string{"2", "3", "4"} {
+		t.Run(fmt.Sprintf("index version %v", indexVersion), func(t *testing.T) {
+			repoRoot := setupIndexTestRepo(t)
+			requireGitCmd(t, repoRoot, "update-index", "--index-version", indexVersion)
+
+			gi, err := LoadGitIndex(repoRoot)
+			assert.NilError(t, err, "LoadGitIndex")
+
+			testCases := []*PackageDepsOptions{
+				{PackagePath: "my-pkg"},
+				{PackagePath: ""},
+				{PackagePath: "my-pkg", InputPatterns: []string{"**/*-file"}},
+				{PackagePath: "my-pkg", InputPatterns: []string{"dir/**"}},
+			}
+			for _, opts := range testCases {
+				expected, err := GetPackageDeps(repoRoot, opts)
+				assert.NilError(t, err, "GetPackageDeps")
+				actual, err := gi.GetPackageDeps(repoRoot, opts)
+				assert.NilError(t, err, "GitIndex.GetPackageDeps")
+				assert.DeepEqual(t, actual, expected)
+			}
+		})
+	}
+}
+
+func TestGitIndex_IntentToAdd(t *testing.T) {
+	repoRoot := setupIndexTestRepo(t)
+	requireGitCmd(t, repoRoot, "add", "--intent-to-add", "my-pkg/untracked-file")
+
+	gi, err := LoadGitIndex(repoRoot)
+	assert.NilError(t, err, "LoadGitIndex")
+	opts := &PackageDepsOptions{PackagePath: "my-pkg"}
+	expected, err := GetPackageDeps(repoRoot, opts)
+	assert.NilError(t, err, "GetPackageDeps")
+	actual, err := gi.GetPackageDeps(repoRoot, opts)
+	assert.NilError(t, err, "GitIndex.GetPackageDeps")
+	assert.DeepEqual(t, actual, expected)
+}
+
+func TestGitIndex_ReplacedFile(t *testing.T) {
+	repoRoot := setupIndexTestRepo(t)
+	file := repoRoot.UntypedJoin("my-pkg", "committed-file")
+	info, err := file.Lstat()
+	assert.NilError(t, err, "Lstat")
+
+	// Replace the file with one of the same size and modification time, which only
+	// the inode and ctime can tell apart
+	replacement := repoRoot.UntypedJoin("my-pkg", "replacement")
+	assert.NilError(t, replacement.WriteFile([]byte("replaced bytes!"), 0644), "WriteFile")
+	assert.NilError(t, os.Chtimes(replacement.ToString(), info.ModTime(), info.ModTime()), "Chtimes")
+	assert.NilError(t, os.Rename(replacement.ToString(), file.ToString()), "Rename")
+
+	gi, err := LoadGitIndex(repoRoot)
+	assert.NilError(t, err, "LoadGitIndex")
+	actual, err := gi.GetPackageDeps(repoRoot, &PackageDepsOptions{PackagePath: "my-pkg"})
+	assert.NilError(t, err, "GitIndex.GetPackageDeps")
+	expected, err := fs.GitLikeHashFile(file.ToString())
+	assert.NilError(t, err, "GitLikeHashFile")
+	assert.Equal(t, actual["committed-file"], expected)
+}
+
+func TestGitIndex_MayFilterContent(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("content is always assumed to be filtered on Windows")
+	}
+	testCases := []struct {
+		name     string
+		setup    func(t *testing.T, repoRoot titanpath.AbsoluteSystemPath)
+		expected bool
+	}{
+		{
+			name:     "no filters",
+			setup:    func(t *testing.T, repoRoot titanpath.AbsoluteSystemPath) {},
+			expected: false,
+		},
+		{
+			name: "autocrlf in the global configuration",
+			setup: func(t *testing.T, repoRoot titanpath.AbsoluteSystemPath) {
+				requireGitCmd(t, repoRoot, "config", "--global", "core.autocrlf", "input")
+			},
+			expected: true,
+		},
+		{
+			name: "autocrlf disabled",
+			setup: func(t *testing.T, repoRoot titanpath.AbsoluteSystemPath) {
+				requireGitCmd(t, repoRoot, "config", "--local", "core.autocrlf", "false")
+			},
+			expected: false,
+		},
+		{
+			name: "filter in the XDG configuration",
+			setup: func(t *testing.T, repoRoot titanpath.AbsoluteSystemPath) {
+				config := fs.AbsoluteSystemPathFromUpstream(os.Getenv("XDG_CONFIG_HOME")).UntypedJoin("git", "config")
+				assert.NilError(t, config.EnsureDir(), "EnsureDir")
+				assert.NilError(t, config.WriteFile([]byte("[filter \"lfs\"]\n\tclean = git-lfs clean -- %f\n"), 0644), "WriteFile")
+			},
+			expected: true,
+		},
+		{
+			name: "core.attributesFile",
+			setup: func(t *testing.T, repoRoot titanpath.AbsoluteSystemPath) {
+				attributes := repoRoot.UntypedJoin("..", "attributes")
+				assert.NilError(t, attributes.WriteFile([]byte("* text=auto\n"), 0644), "WriteFile")
+				requireGitCmd(t, repoRoot, "config", "--local", "core.attributesFile", attributes.ToString())
+			},
+			expected: true,
+		},
+		{
+			name: "default global attributes",
+			setup: func(t *testing.T, repoRoot titanpath.AbsoluteSystemPath) {
+				attributes := fs.AbsoluteSystemPathFromUpstream(os.Getenv("XDG_CONFIG_HOME")).UntypedJoin("git", "attributes")
+				assert.NilError(t, attributes.EnsureDir(), "EnsureDir")
+				assert.NilError(t, attributes.WriteFile([]byte("* text=auto\n"), 0644), "WriteFile")
+			},
+			expected: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Isolate the test from the system and user configuration
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+			t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+			t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+			repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir()).UntypedJoin("repo")
+			assert.NilError(t, repoRoot.MkdirAll(0755), "MkdirAll")
+			assert.NilError(t, repoRoot.UntypedJoin("file").WriteFile([]byte("contents"), 0644), "WriteFile")
+			requireGitCmd(t, repoRoot, "init", ".")
+			requireGitCmd(t, repoRoot, "add", "file")
+			tc.setup(t, repoRoot)
+
+			gi, err := LoadGitIndex(repoRoot)
+			assert.NilError(t, err, "LoadGitIndex")
+			assert.Equal(t, gi.filtersContent, tc.expected)
+		})
+	}
+}
+
+func TestGitIndex_Unsupported(t *testing.T) {
+	testCases := []struct {
+		name  string
+		setup func(repoRoot titanpath.AbsoluteSystemPath)
+	}{
+		{
+			name: "skip-worktree",
+			setup: func(repoRoot titanpath.AbsoluteSystemPath) {
+				requireGitCmd(t, repoRoot, "update-index", "--skip-worktree", "my-pkg/committed-file")
+			},
+		},
+		{
+			name: "assume-unchanged",
+			setup: func(repoRoot titanpath.AbsoluteSystemPath) {
+				requireGitCmd(t, repoRoot, "update-index", "--assume-unchanged", "my-pkg/committed-file")
+			},
+		},
+		{
+			name: "split index",
+			setup: func(repoRoot titanpath.AbsoluteSystemPath) {
+				requireGitCmd(t, repoRoot, "update-index", "--split-index")
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repoRoot := setupIndexTestRepo(t)
+			tc.setup(repoRoot)
+			_, err := LoadGitIndex(repoRoot)
+			assert.ErrorIs(t, err, ErrUnsupportedIndex)
+		})
+	}
+}
+
+func Test_readIndexVarint(t *testing.T) {
+	testCases := []struct {
+		data     []byte
+		expected uint64
+		length   int
+	}{
+		{[]byte{0x00}, 0, 1},
+		{[]byte{0x7f}, 127, 1},
+		{[]byte{0x80, 0x00}, 128, 2},
+		{[]byte{0x80, 0x01, 0xff}, 129, 2},
+		{[]byte{0xff, 0x7f}, 16511, 2},
+		{[]byte{0x80}, 0, 0},
+	}
+	for _, tc := range testCases {
+		value, length := readIndexVarint(tc.data)
+		assert.Equal(t, value, tc.expected, "%x", tc.data)
+		assert.Equal(t, length, tc.length, "%x", tc.data)
+	}
+}
+
+func setupBenchmarkRepo(b *testing.B, fileCount int) titanpath.AbsoluteSystemPath {
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(b.TempDir())
+	for i := 0; i < fileCount; i++ {
+		file := repoRoot.UntypedJoin("my-pkg", fmt.Sprintf("dir-%v", i%20), fmt.Sprintf("file-%v", i))
+		assert.NilError(b, file.EnsureDir(), "EnsureDir")
+		assert.NilError(b, file.WriteFile([]byte(fmt.Sprintf("contents %v", i)), 0644), "WriteFile")
+	}
+	requireGitCmd(b, repoRoot, "init", ".")
+	requireGitCmd(b, repoRoot, "config", "--local", "user.name", "test")
+	requireGitCmd(b, repoRoot, "config", "--local", "user.email", "test@example.com")
+	requireGitCmd(b, repoRoot, "add", ".")
+	requireGitCmd(b, repoRoot, "commit", "-m", "foo")
+	// a few changes, as in a typical working copy
+	for i := 0; i < 5; i++ {
+		file := repoRoot.UntypedJoin("my-pkg", fmt.Sprintf("untracked-%v", i))
+		assert.NilError(b, os.WriteFile(file.ToString(), []byte("untracked"), 0644), "WriteFile")
+	}
+	return repoRoot
+}
+
+func BenchmarkGetPackageDeps(b *testing.B) {
+	repoRoot := setupBenchmarkRepo(b, 2000)
+	opts := &PackageDepsOptions{PackagePath: "my-pkg"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := GetPackageDeps(repoRoot, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGitIndex_GetPackageDeps(b *testing.B) {
+	repoRoot := setupBenchmarkRepo(b, 2000)
+	opts := &PackageDepsOptions{PackagePath: "my-pkg"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// include loading the index, which happens once per run
+		gi, err := LoadGitIndex(repoRoot)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := gi.GetPackageDeps(repoRoot, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 
@@ -24,10 +25,45 @@ type PackageDepsOptions struct {
 	PackagePath titanpath.AnchoredSystemPath
 
 	InputPatterns []string
+
+	// FileHashCache, if set, is used to avoid rehashing files that haven't changed since a previous run
+	FileHashCache *FileHashCache
 }
 
 // GetPackageDeps Builds an object containing git hashes for the files under the specified `packagePath` folder.
 func GetPackageDeps(rootPath titanpath.AbsoluteSystemPath, p *PackageDepsOptions) (map[titanpath.AnchoredUnixPath]string, error) {
+	return getPackageDeps(rootPath, p, p.FileHashCache.cachedHashObject(_filteredHash, gitHashObject))
+}
+
+// GetPackageFiles returns the files under the specified `packagePath` folder that GetPackageDeps would hash:
+// files checked in to git, and untracked files that aren't ignored, narrowed down to the input patterns if given.
+// The returned paths are relative to the package and sorted.
+func GetPackageFiles(rootPath titanpath.AbsoluteSystemPath, p *PackageDepsOptions) ([]titanpath.AnchoredUnixPath, error) {
+	deps, err := getPackageDeps(rootPath, p, listFiles)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]titanpath.AnchoredUnixPath, 0, len(deps))
+	for file := range deps {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i] < files[j] })
+	return files, nil
+}
+
+// listFiles is a hashObjectFunc that doesn't hash anything, for when only the file names are needed
+func listFiles(anchor titanpath.AbsoluteSystemPath, files []titanpath.AnchoredSystemPath) (map[titanpath.AnchoredUnixPath]string, error) {
+	listed := make(map[titanpath.AnchoredUnixPath]string, len(files))
+	for _, file := range files {
+		listed[file.ToUnixPath()] = ""
+	}
+	return listed, nil
+}
+
+// hashObjectFunc hashes files relative to anchor, such as gitHashObject
+type hashObjectFunc = func(anchor titanpath.AbsoluteSystemPath, filesToHash []titanpath.AnchoredSystemPath) (map[titanpath.AnchoredUnixPath]string, error)
+
+func getPackageDeps(rootPath titanpath.AbsoluteSystemPath, p *PackageDepsOptions, hashObject hashObjectFunc) (map[titanpath.AnchoredUnixPath]string, error) {
 	pkgPath := rootPath.UntypedJoin(p.PackagePath.ToStringDuringMigration())
 	// Add all the checked in hashes.
 	var result map[titanpath.AnchoredUnixPath]string
@@ -47,39 +83,14 @@ func GetPackageDeps(rootPath titanpath.AbsoluteSystemPath, p *PackageDepsOptions
 		// Add in package.json to input patterns because if the `scripts` in
 		// the package.json change (i.e. the tasks that titan executes), we want
 		// a cache miss, since any existing cache could be invalid.
-		// Note this package.json will be resolved relative to the pkgPath.
 		calculatedInputs = append(calculatedInputs, "package.json")
 
-		// The input patterns are relative to the package.
-		// However, we need to change the globbing to be relative to the repo root.
-		// Prepend the package path to each of the input patterns.
-		prefixedInputPatterns := make([]string, len(calculatedInputs))
-		for index, pattern := range calculatedInputs {
-			rerooted, err := rootPath.PathTo(pkgPath.UntypedJoin(pattern))
-			if err != nil {
-				return nil, err
-			}
-			prefixedInputPatterns[index] = rerooted
-		}
-
-		absoluteFilesToHash, err := globby.GlobFiles(rootPath.ToStringDuringMigration(), prefixedInputPatterns, nil)
-
+		filesToHash, err := GlobPackageInputs(rootPath, p.PackagePath, calculatedInputs)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to resolve input globs %v", calculatedInputs)
-		}
-
-		filesToHash := make([]titanpath.AnchoredSystemPath, len(absoluteFilesToHash))
-		for i, rawPath := range absoluteFilesToHash {
-			relativePathString, err := pkgPath.RelativePathString(rawPath)
-
-			if err != nil {
-				return nil, errors.Wrapf(err, "not relative to package: %v", rawPath)
-			}
-
-			filesToHash[i] = titanpath.AnchoredSystemPathFromUpstream(relativePathString)
+			return nil, err
 		}
 
-		hashes, err := gitHashObject(titanpath.AbsoluteSystemPathFromUpstream(pkgPath.ToStringDuringMigration()), filesToHash)
+		hashes, err := hashObject(titanpath.AbsoluteSystemPathFromUpstream(pkgPath.ToStringDuringMigration()), filesToHash)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed hashing resolved inputs globs")
 		}
@@ -102,7 +113,7 @@ func GetPackageDeps(rootPath titanpath.AbsoluteSystemPath, p *PackageDepsOptions
 		}
 	}
 
-	hashes, err := gitHashObject(titanpath.AbsoluteSystemPathFromUpstream(pkgPath.ToString()), filesToHash)
+	hashes, err := hashObject(titanpath.AbsoluteSystemPathFromUpstream(pkgPath.ToString()), filesToHash)
 	if err != nil {
 		return nil, err
 	}
@@ -115,6 +126,53 @@ func GetPackageDeps(rootPath titanpath.AbsoluteSystemPath, p *PackageDepsOptions
 	return result, nil
 }
 
+// GlobPackageInputs returns the files in the given package that match the input patterns.
+// The input patterns and the returned paths are relative to the package.
+func GlobPackageInputs(rootPath titanpath.AbsoluteSystemPath, packagePath titanpath.AnchoredSystemPath, inputPatterns []string) ([]titanpath.AnchoredSystemPath, error) {
+	pkgPath := rootPath.UntypedJoin(packagePath.ToStringDuringMigration())
+
+	// The input patterns are relative to the package.
+	// However, we need to change the globbing to be relative to the repo root.
+	// Prepend the package path to each of the input patterns.
+	prefixedInputPatterns := make([]string, len(inputPatterns))
+	for index, pattern := range inputPatterns {
+		rerooted, err := rootPath.PathTo(pkgPath.UntypedJoin(pattern))
+		if err != nil {
+			return nil, err
+		}
+		prefixedInputPatterns[index] = rerooted
+	}
+
+	absoluteFilesToHash, err := globby.GlobFiles(rootPath.ToStringDuringMigration(), prefixedInputPatterns, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve input globs %v", inputPatterns)
+	}
+
+	filesToHash := make([]titanpath.AnchoredSystemPath, len(absoluteFilesToHash))
+	for i, rawPath := range absoluteFilesToHash {
+		relativePathString, err := pkgPath.RelativePathString(rawPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "not relative to package: %v", rawPath)
+		}
+		filesToHash[i] = titanpath.AnchoredSystemPathFromUpstream(relativePathString)
+	}
+	return filesToHash, nil
+}
+
+// HashFiles hashes the given files in-process, producing the same hashes as `git hash-object`.
+// It can be used when git is not available. See also FileHashCache.HashFiles.
+func HashFiles(anchor titanpath.AbsoluteSystemPath, files []titanpath.AnchoredSystemPath) (map[titanpath.AnchoredUnixPath]string, error) {
+	hashObject := make(map[titanpath.AnchoredUnixPath]string, len(files))
+	for _, file := range files {
+		hash, err := fs.GitLikeHashFile(file.RestoreAnchor(anchor).ToString())
+		if err != nil {
+			return nil, fmt.Errorf("could not hash file %v. \n%w", file.ToString(), err)
+		}
+		hashObject[file.ToUnixPath()] = hash
+	}
+	return hashObject, nil
+}
+
 func manuallyHashFiles(rootPath titanpath.AbsoluteSystemPath, files []titanpath.AnchoredSystemPath) (map[titanpath.AnchoredUnixPath]string, error) {
 	hashObject := make(map[titanpath.AnchoredUnixPath]string)
 	for _, file := range files {
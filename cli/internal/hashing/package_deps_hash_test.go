@@ -217,7 +217,7 @@ func Test_getTraversePath(t *testing.T) {
 	}
 }
 
-func requireGitCmd(t *testing.T, repoRoot titanpath.AbsoluteSystemPath, args ...string) {
+func requireGitCmd(t testing.TB, repoRoot titanpath.AbsoluteSystemPath, args ...string) {
 	t.Helper()
 	cmd := exec.Command("git", args...)
 	cmd.Dir = repoRoot.ToString()
@@ -376,6 +376,44 @@ func TestGetPackageDeps(t *testing.T) {
 	}
 }
 
+func TestGetPackageFiles(t *testing.T) {
+	// Directory structure:
+	// <root>/
+	//   .gitignore <- ignores dist
+	//   my-pkg/
+	//     committed-file
+	//     uncommitted-file <- new file not added to git
+	//     dist/
+	//       ignored-file
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	writeFile := func(path string, contents string) {
+		t.Helper()
+		file := repoRoot.UntypedJoin(filepath.FromSlash(path))
+		assert.NilError(t, file.EnsureDir(), "EnsureDir")
+		assert.NilError(t, file.WriteFile([]byte(contents), 0644), "WriteFile")
+	}
+	writeFile(".gitignore", "dist\n")
+	writeFile("my-pkg/committed-file", "committed bytes")
+	writeFile("my-pkg/package.json", "{}")
+
+	requireGitCmd(t, repoRoot, "init", ".")
+	requireGitCmd(t, repoRoot, "config", "--local", "user.name", "test")
+	requireGitCmd(t, repoRoot, "config", "--local", "user.email", "test@example.com")
+	requireGitCmd(t, repoRoot, "add", ".")
+	requireGitCmd(t, repoRoot, "commit", "-m", "foo")
+
+	writeFile("my-pkg/uncommitted-file", "uncommitted bytes")
+	writeFile("my-pkg/dist/ignored-file", "ignored bytes")
+
+	files, err := GetPackageFiles(repoRoot, &PackageDepsOptions{PackagePath: "my-pkg"})
+	assert.NilError(t, err, "GetPackageFiles")
+	assert.DeepEqual(t, files, []titanpath.AnchoredUnixPath{"committed-file", "package.json", "uncommitted-file"})
+
+	files, err = GetPackageFiles(repoRoot, &PackageDepsOptions{PackagePath: "my-pkg", InputPatterns: []string{"committed-file"}})
+	assert.NilError(t, err, "GetPackageFiles")
+	assert.DeepEqual(t, files, []titanpath.AnchoredUnixPath{"committed-file", "package.json"})
+}
+
 func Test_memoizedGetTraversePath(t *testing.T) {
 	fixturePath := getFixture(1)
 
@@ -145,12 +145,39 @@ func (f Framework) match(pkg *fs.PackageJSON) bool {
 	return f.DependencyMatch.match(pkg)
 }
 
-// InferFramework returns a reference to a matched framework
-func InferFramework(pkg *fs.PackageJSON) *Framework {
+// FrameworksFromConfig converts the frameworks declared in titan.json
+func FrameworksFromConfig(definitions []fs.FrameworkDefinition) []Framework {
+	frameworks := make([]Framework, len(definitions))
+	for i, definition := range definitions {
+		strategy := all
+		if definition.DependencyMatch == "some" {
+			strategy = some
+		}
+		frameworks[i] = Framework{
+			Slug:      definition.Slug,
+			EnvPrefix: definition.EnvPrefix,
+			DependencyMatch: matcher{
+				strategy:     strategy,
+				dependencies: definition.Dependencies,
+			},
+		}
+	}
+	return frameworks
+}
+
+// InferFramework returns a reference to a matched framework. Additional frameworks, such
+// as those declared in titan.json, are checked before the built-in ones.
+func InferFramework(pkg *fs.PackageJSON, additionalFrameworks ...Framework) *Framework {
 	if pkg == nil {
 		return nil
 	}
 
+	for _, candidateFramework := range additionalFrameworks {
+		if candidateFramework.match(pkg) {
+			return &candidateFramework
+		}
+	}
+
 	for _, candidateFramework := range _frameworks {
 		if candidateFramework.match(pkg) {
 			return &candidateFramework
@@ -85,3 +85,66 @@ func TestInferFramework(t *testing.T) {
 		})
 	}
 }
+
+func TestInferFramework_FromConfig(t *testing.T) {
+	frameworks := FrameworksFromConfig([]fs.FrameworkDefinition{
+		{
+			Slug:         "acme",
+			EnvPrefix:    "ACME_PUBLIC_",
+			Dependencies: []string{"@acme/app", "next"},
+		},
+		{
+			Slug:            "acme-legacy",
+			EnvPrefix:       "ACME_LEGACY_",
+			Dependencies:    []string{"@acme/legacy", "@acme/legacy-cli"},
+			DependencyMatch: "some",
+		},
+	})
+	tests := []struct {
+		name string
+		pkg  *fs.PackageJSON
+		want string
+	}{
+		{
+			name: "Configured frameworks take precedence",
+			pkg: &fs.PackageJSON{UnresolvedExternalDeps: map[string]string{
+				"@acme/app": "*",
+				"next":      "*",
+			}},
+			want: "acme",
+		},
+		{
+			name: "All dependencies are required by default",
+			pkg: &fs.PackageJSON{UnresolvedExternalDeps: map[string]string{
+				"next": "*",
+			}},
+			want: "nextjs",
+		},
+		{
+			name: "Some dependencies",
+			pkg: &fs.PackageJSON{UnresolvedExternalDeps: map[string]string{
+				"@acme/legacy-cli": "*",
+			}},
+			want: "acme-legacy",
+		},
+		{
+			name: "No match",
+			pkg: &fs.PackageJSON{UnresolvedExternalDeps: map[string]string{
+				"@acme/app": "*",
+			}},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := InferFramework(tt.pkg, frameworks...)
+			slug := ""
+			if got != nil {
+				slug = got.Slug
+			}
+			if slug != tt.want {
+				t.Errorf("InferFramework() = %v, want %v", slug, tt.want)
+			}
+		})
+	}
+}
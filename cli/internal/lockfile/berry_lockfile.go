@@ -128,6 +128,19 @@ func (l *BerryLockfile) AllDependencies(key string) (map[string]string, bool) {
 	return deps, true
 }
 
+// PackageEntry returns the entry for the given lockfile key
+func (l *BerryLockfile) PackageEntry(key string) (interface{}, bool) {
+	var locator _Locator
+	if err := locator.parseLocator(key); err != nil {
+		return nil, false
+	}
+	entry, ok := l.packages[locator]
+	if !ok {
+		return nil, false
+	}
+	return *entry, true
+}
+
 // Subgraph Given a list of lockfile keys returns a Lockfile based off the original one that only contains the packages given
 func (l *BerryLockfile) Subgraph(workspacePackages []titanpath.AnchoredSystemPath, packages []string) (Lockfile, error) {
 	prunedPackages := make(map[_Locator]*BerryLockfileEntry, len(packages))
@@ -239,6 +252,48 @@ func (l *BerryLockfile) Subgraph(workspacePackages []titanpath.AnchoredSystemPat
 	}, nil
 }
 
+var _ DevDependencyPruner = (*BerryLockfile)(nil)
+
+// WithoutDevDependencies returns a copy of the lockfile without the given devDependencies of each workspace
+func (l *BerryLockfile) WithoutDevDependencies(devDependencies map[titanpath.AnchoredUnixPath][]string) (Lockfile, error) {
+	packages := make(map[_Locator]*BerryLockfileEntry, len(l.packages))
+	for locator, entry := range l.packages {
+		packages[locator] = entry
+	}
+	for workspace, deps := range devDependencies {
+		reference := "workspace:."
+		if workspace != "" {
+			reference = fmt.Sprintf("workspace:%s", workspace.ToString())
+		}
+		found := false
+		for locator, entry := range packages {
+			if locator.reference != reference {
+				continue
+			}
+			found = true
+			// Copy the entry, since it's shared with this lockfile
+			pruned := *entry
+			pruned.Dependencies = withoutDeps(entry.Dependencies, deps)
+			if entry.DependenciesMeta != nil {
+				pruned.DependenciesMeta = make(map[string]BerryDependencyMetaEntry, len(entry.DependenciesMeta))
+				for dep, meta := range entry.DependenciesMeta {
+					pruned.DependenciesMeta[dep] = meta
+				}
+				for _, dep := range deps {
+					delete(pruned.DependenciesMeta, dep)
+				}
+			}
+			packages[locator] = &pruned
+		}
+		if !found {
+			return nil, fmt.Errorf("Unable to find lockfile entry for workspace %s", workspace)
+		}
+	}
+	pruned := *l
+	pruned.packages = packages
+	return &pruned, nil
+}
+
 // Encode encode the lockfile representation and write it to the given writer
 func (l *BerryLockfile) Encode(w io.Writer) error {
 	// Map all resolved packages to the descriptors that match them
@@ -299,6 +354,25 @@ func (l *BerryLockfile) locatorToDescriptors() map[_Locator]map[_Descriptor]_voi
 	return reverseLookup
 }
 
+// CacheChecksums returns the checksums of the packages in the lockfile, which yarn uses as
+// the suffix of their archives in the cache folder. The cache key prefix is left off.
+func (l *BerryLockfile) CacheChecksums() []string {
+	checksums := make([]string, 0, len(l.packages))
+	for _, entry := range l.packages {
+		if entry.Checksum == "" {
+			continue
+		}
+		checksum := entry.Checksum
+		// Newer versions of yarn include the cache key in the checksum e.g. 10c0/eb835a2e51...
+		if index := strings.LastIndex(checksum, "/"); index != -1 {
+			checksum = checksum[index+1:]
+		}
+		checksums = append(checksums, checksum)
+	}
+	sort.Strings(checksums)
+	return checksums
+}
+
 // Patches return a list of patches used in the lockfile
 func (l *BerryLockfile) Patches() []titanpath.AnchoredUnixPath {
 	patches := []titanpath.AnchoredUnixPath{}
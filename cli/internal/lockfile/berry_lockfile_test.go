@@ -6,6 +6,7 @@ import (
 
 	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
 	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
 )
 
 func getBerryLockfile(t *testing.T, filename string) *BerryLockfile {
@@ -271,3 +272,35 @@ func Test_BerryPruneDescriptors(t *testing.T) {
 	assert.Assert(t, !lockfileAHasB, "Expected lockfile a not to have descriptor used by b")
 	assert.Assert(t, !lockfileBHasA, "Expected lockfile b not to have descriptor used by a")
 }
+
+func Test_BerryWithoutDevDependencies(t *testing.T) {
+	lockfile := getBerryLockfile(t, "berry.lock")
+	pruned, err := lockfile.WithoutDevDependencies(map[titanpath.AnchoredUnixPath][]string{
+		"apps/docs": {"eslint", "typescript"},
+	})
+	assert.NilError(t, err, "WithoutDevDependencies")
+
+	docs := _Locator{_Ident{name: "docs"}, "workspace:apps/docs"}
+	deps := pruned.(*BerryLockfile).packages[docs].Dependencies
+	_, hasEslint := deps["eslint"]
+	assert.Assert(t, !hasEslint)
+	_, hasTypescript := deps["typescript"]
+	assert.Assert(t, !hasTypescript)
+	_, hasNext := deps["next"]
+	assert.Assert(t, hasNext)
+	_, originalHasEslint := lockfile.packages[docs].Dependencies["eslint"]
+	assert.Assert(t, originalHasEslint, "original lockfile was modified")
+
+	_, err = lockfile.WithoutDevDependencies(map[titanpath.AnchoredUnixPath][]string{"apps/missing": {"eslint"}})
+	assert.ErrorContains(t, err, "apps/missing")
+}
+
+func Test_BerryCacheChecksums(t *testing.T) {
+	lockfile := getBerryLockfile(t, "minimal-berry.lock")
+	checksums := lockfile.CacheChecksums()
+	assert.Assert(t, len(checksums) > 0)
+	assert.Assert(t, cmp.Contains(checksums, "eb835a2e51d381e561e508ce932ea50a8e5a68f4ebdd771ea240d3048244a8d13658acbd502cd4829768c56f2e16bdd4340b9ea141297d472517b83868e677f7"))
+
+	lockfile.packages[_Locator{_Ident{name: "prefixed"}, "npm:1.0.0"}] = &BerryLockfileEntry{Checksum: "10c0/abc123"}
+	assert.Assert(t, cmp.Contains(lockfile.CacheChecksums(), "abc123"))
+}
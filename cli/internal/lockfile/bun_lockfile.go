@@ -0,0 +1,673 @@
+package lockfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+	"github.com/pkg/errors"
+)
+
+// BunLockfile representation of bun.lock, the text lockfile used by bun 1.2 and later.
+//
+// Packages are keyed by their position in node_modules: a package installed at the top level is
+// keyed by its name, and one nested under a workspace or another package is keyed by the parent's
+// key followed by its name, e.g. "docs/react" or "next/postcss". Workspaces nest packages under
+// their name rather than their path.
+type BunLockfile struct {
+	// contents holds the top-level fields in the order bun wrote them
+	contents *bunObject
+	// workspaces are keyed by path, with "" for the root
+	workspaces map[string]bunWorkspace
+	packages   map[string]bunPackage
+}
+
+// bunWorkspace is an entry in the workspaces section of bun.lock
+type bunWorkspace struct {
+	Name                 string            `json:"name"`
+	Dependencies         map[string]string `json:"dependencies,omitempty"`
+	DevDependencies      map[string]string `json:"devDependencies,omitempty"`
+	OptionalDependencies map[string]string `json:"optionalDependencies,omitempty"`
+	PeerDependencies     map[string]string `json:"peerDependencies,omitempty"`
+}
+
+// bunPackage is an entry in the packages section of bun.lock. Entries are arrays that start
+// with the package's identifier, name@version, and have an object with its dependencies
+// after the registry url, unless the package is a workspace.
+type bunPackage struct {
+	ident   string
+	name    string
+	version string
+	info    bunPackageInfo
+	// fields holds the compacted entry, which includes the registry url and integrity
+	fields string
+}
+
+type bunPackageInfo struct {
+	Dependencies         map[string]string `json:"dependencies,omitempty"`
+	OptionalDependencies map[string]string `json:"optionalDependencies,omitempty"`
+	PeerDependencies     map[string]string `json:"peerDependencies,omitempty"`
+}
+
+var _ Lockfile = (*BunLockfile)(nil)
+
+// dependency returns the version specifier with which the workspace depends on name, if it does
+func (w bunWorkspace) dependency(name string) (string, bool) {
+	for _, deps := range []map[string]string{w.Dependencies, w.DevDependencies, w.OptionalDependencies, w.PeerDependencies} {
+		if version, ok := deps[name]; ok {
+			return version, true
+		}
+	}
+	return "", false
+}
+
+// ResolvePackage Given a workspace, a package it imports and version returns the key, resolved version, and if it was found
+func (l *BunLockfile) ResolvePackage(workspacePath titanpath.AnchoredUnixPath, name string, version string) (Package, error) {
+	workspace, ok := l.workspaces[workspacePath.ToString()]
+	if !ok {
+		return Package{}, fmt.Errorf("No workspace found in lockfile for '%s'", workspacePath)
+	}
+
+	// AllDependencies returns keys rather than names, which for hoisted packages are the same.
+	// We only look for a copy nested under the workspace for the workspace's own dependencies.
+	possibleKeys := []string{name}
+	if specifier, ok := workspace.dependency(name); ok && specifier == version {
+		possibleKeys = []string{fmt.Sprintf("%s/%s", workspace.Name, name), name}
+	}
+	for _, key := range possibleKeys {
+		if entry, ok := l.packages[key]; ok {
+			return Package{
+				Key:     key,
+				Version: entry.version,
+				Found:   true,
+			}, nil
+		}
+	}
+
+	return Package{}, nil
+}
+
+// AllDependencies Given a lockfile key return all (dev/optional/peer) dependencies of that package
+func (l *BunLockfile) AllDependencies(key string) (map[string]string, bool) {
+	entry, ok := l.packages[key]
+	if !ok {
+		return nil, false
+	}
+	deps := make(map[string]string, len(entry.info.Dependencies)+len(entry.info.OptionalDependencies)+len(entry.info.PeerDependencies))
+	addDep := func(d map[string]string) {
+		for name := range d {
+			for _, possibleKey := range possibleBunDeps(key, name) {
+				if entry, ok := l.packages[possibleKey]; ok {
+					deps[possibleKey] = entry.version
+					break
+				}
+			}
+		}
+	}
+
+	addDep(entry.info.Dependencies)
+	addDep(entry.info.OptionalDependencies)
+	addDep(entry.info.PeerDependencies)
+
+	return deps, true
+}
+
+// PackageEntry returns the entry for the given lockfile key
+func (l *BunLockfile) PackageEntry(key string) (interface{}, bool) {
+	entry, ok := l.packages[key]
+	return entry, ok
+}
+
+// Subgraph Given a list of lockfile keys returns a Lockfile based off the original one that only contains the packages given
+func (l *BunLockfile) Subgraph(workspacePackages []titanpath.AnchoredSystemPath, packages []string) (Lockfile, error) {
+	workspaces := map[string]bool{"": true}
+	workspaceIdents := make(map[string]bool, len(workspacePackages))
+	for _, workspacePackage := range workspacePackages {
+		workspacePath := workspacePackage.ToUnixPath().ToString()
+		workspace, ok := l.workspaces[workspacePath]
+		if !ok {
+			return nil, fmt.Errorf("No lockfile entry found for %s", workspacePath)
+		}
+		workspaces[workspacePath] = true
+		// Each workspace has an entry in packages that links back to it
+		workspaceIdents[fmt.Sprintf("%s@workspace:%s", workspace.Name, workspacePath)] = true
+	}
+	keys := make(map[string]bool, len(packages))
+	idents := make(map[string]bool, len(packages))
+	for _, key := range packages {
+		entry, ok := l.packages[key]
+		if !ok {
+			return nil, fmt.Errorf("No lockfile entry found for %s", key)
+		}
+		keys[key] = true
+		idents[entry.ident] = true
+	}
+	for key, entry := range l.packages {
+		if workspaceIdents[entry.ident] {
+			keys[key] = true
+		}
+	}
+
+	contents, err := l.contents.filter("workspaces", func(key string) bool { return workspaces[key] })
+	if err != nil {
+		return nil, err
+	}
+	contents, err = contents.filter("packages", func(key string) bool { return keys[key] })
+	if err != nil {
+		return nil, err
+	}
+	// Patches for packages that are no longer installed fail the install
+	contents, err = contents.filter("patchedDependencies", func(key string) bool { return idents[key] })
+	if err != nil {
+		return nil, err
+	}
+	if patchedDependencies, err := contents.object("patchedDependencies"); err != nil {
+		return nil, err
+	} else if patchedDependencies != nil && len(patchedDependencies.keys) == 0 {
+		contents.remove("patchedDependencies")
+	}
+	return newBunLockfile(contents)
+}
+
+var _ DevDependencyPruner = (*BunLockfile)(nil)
+
+// WithoutDevDependencies returns a copy of the lockfile without the given devDependencies of each workspace
+func (l *BunLockfile) WithoutDevDependencies(devDependencies map[titanpath.AnchoredUnixPath][]string) (Lockfile, error) {
+	workspaces, err := l.contents.object("workspaces")
+	if err != nil {
+		return nil, err
+	} else if workspaces == nil {
+		return nil, errors.New("No workspaces found in bun.lock")
+	}
+	workspaces = workspaces.copy()
+	for workspacePath, deps := range devDependencies {
+		key := workspacePath.ToString()
+		workspace, err := workspaces.object(key)
+		if err != nil {
+			return nil, err
+		} else if workspace == nil {
+			return nil, fmt.Errorf("No lockfile entry found for %s", key)
+		}
+		workspace, err = workspace.filter("devDependencies", func(name string) bool {
+			for _, dep := range deps {
+				if name == dep {
+					return false
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		// bun leaves out the field rather than writing an empty object
+		if remaining, err := workspace.object("devDependencies"); err != nil {
+			return nil, err
+		} else if remaining != nil && len(remaining.keys) == 0 {
+			workspace.remove("devDependencies")
+		}
+		if err := workspaces.setObject(key, workspace); err != nil {
+			return nil, err
+		}
+	}
+	contents := l.contents.copy()
+	if err := contents.setObject("workspaces", workspaces); err != nil {
+		return nil, err
+	}
+	return newBunLockfile(contents)
+}
+
+// Encode encode the lockfile representation and write it to the given writer
+func (l *BunLockfile) Encode(w io.Writer) error {
+	var buf bytes.Buffer
+	if err := writeBunLockfile(&buf, l.contents); err != nil {
+		return errors.Wrap(err, "Unable to encode bun.lock")
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Patches return a list of patches used in the lockfile
+func (l *BunLockfile) Patches() []titanpath.AnchoredUnixPath {
+	patchedDependencies, err := l.contents.object("patchedDependencies")
+	if err != nil || patchedDependencies == nil || len(patchedDependencies.keys) == 0 {
+		return nil
+	}
+	patches := make([]titanpath.AnchoredUnixPath, 0, len(patchedDependencies.keys))
+	for _, key := range patchedDependencies.keys {
+		var patch string
+		if err := json.Unmarshal(patchedDependencies.values[key], &patch); err == nil {
+			patches = append(patches, titanpath.AnchoredUnixPath(patch))
+		}
+	}
+	sort.Slice(patches, func(i, j int) bool {
+		return patches[i] < patches[j]
+	})
+	return patches
+}
+
+// DecodeBunLockfile Takes the contents of a bun.lock and returns a struct representation
+func DecodeBunLockfile(contents []byte) (*BunLockfile, error) {
+	// bun.lock allows trailing commas, which encoding/json doesn't
+	object, err := decodeBunObject(stripTrailingCommas(contents))
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to decode bun.lock")
+	}
+	return newBunLockfile(object)
+}
+
+func newBunLockfile(contents *bunObject) (*BunLockfile, error) {
+	lockfile := &BunLockfile{
+		contents:   contents,
+		workspaces: make(map[string]bunWorkspace),
+		packages:   make(map[string]bunPackage),
+	}
+	if raw, ok := contents.values["workspaces"]; ok {
+		if err := json.Unmarshal(raw, &lockfile.workspaces); err != nil {
+			return nil, errors.Wrap(err, "Unable to decode workspaces in bun.lock")
+		}
+	}
+	if raw, ok := contents.values["packages"]; ok {
+		var entries map[string][]json.RawMessage
+		if err := json.Unmarshal(raw, &entries); err != nil {
+			return nil, errors.Wrap(err, "Unable to decode packages in bun.lock")
+		}
+		for key, entry := range entries {
+			pkg, err := decodeBunPackage(entry)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Unable to decode %s in bun.lock", key)
+			}
+			lockfile.packages[key] = pkg
+		}
+	}
+	return lockfile, nil
+}
+
+func decodeBunPackage(entry []json.RawMessage) (bunPackage, error) {
+	var pkg bunPackage
+	if len(entry) == 0 {
+		return pkg, errors.New("empty package entry")
+	}
+	if err := json.Unmarshal(entry[0], &pkg.ident); err != nil {
+		return pkg, err
+	}
+	// Scoped package names start with an @, so the version follows the last one after that
+	separator := strings.Index(pkg.ident[1:], "@") + 1
+	if separator == 0 {
+		return pkg, fmt.Errorf("invalid package identifier %s", pkg.ident)
+	}
+	var compacted bytes.Buffer
+	for _, field := range entry {
+		if err := json.Compact(&compacted, field); err != nil {
+			return pkg, err
+		}
+		compacted.WriteByte(',')
+	}
+	pkg.fields = compacted.String()
+	pkg.name = pkg.ident[:separator]
+	pkg.version = pkg.ident[separator+1:]
+	for _, field := range entry[1:] {
+		if bytes.HasPrefix(bytes.TrimSpace(field), []byte("{")) {
+			if err := json.Unmarshal(field, &pkg.info); err != nil {
+				return pkg, err
+			}
+			break
+		}
+	}
+	return pkg, nil
+}
+
+// possibleBunDeps returns the keys that a dependency of the package at key could be found at,
+// from the most to the least nested, mirroring how node resolves packages in node_modules
+func possibleBunDeps(key string, dep string) []string {
+	segments := bunKeySegments(key)
+	possibleDeps := make([]string, 0, len(segments)+1)
+	for i := len(segments); i > 0; i-- {
+		possibleDeps = append(possibleDeps, fmt.Sprintf("%s/%s", strings.Join(segments[:i], "/"), dep))
+	}
+	return append(possibleDeps, dep)
+}
+
+// bunKeySegments splits a key into the package names it is made up of
+func bunKeySegments(key string) []string {
+	parts := strings.Split(key, "/")
+	segments := make([]string, 0, len(parts))
+	for i := 0; i < len(parts); i++ {
+		if strings.HasPrefix(parts[i], "@") && i+1 < len(parts) {
+			segments = append(segments, parts[i]+"/"+parts[i+1])
+			i++
+		} else {
+			segments = append(segments, parts[i])
+		}
+	}
+	return segments
+}
+
+// stripTrailingCommas removes commas that directly precede a closing brace or bracket
+func stripTrailingCommas(contents []byte) []byte {
+	stripped := make([]byte, 0, len(contents))
+	inString := false
+	for i := 0; i < len(contents); i++ {
+		c := contents[i]
+		if inString {
+			stripped = append(stripped, c)
+			if c == '\\' && i+1 < len(contents) {
+				i++
+				stripped = append(stripped, contents[i])
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		if c == '"' {
+			inString = true
+		} else if c == ',' {
+			next := i + 1
+			for next < len(contents) && isJSONWhitespace(contents[next]) {
+				next++
+			}
+			if next < len(contents) && (contents[next] == '}' || contents[next] == ']') {
+				continue
+			}
+		}
+		stripped = append(stripped, c)
+	}
+	return stripped
+}
+
+func isJSONWhitespace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// bunObject is a JSON object that keeps the order of its keys, so that we can write bun.lock
+// back out the way bun does
+type bunObject struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+func decodeBunObject(data []byte) (*bunObject, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, errors.New("expected an object")
+	}
+	object := &bunObject{values: make(map[string]json.RawMessage)}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a key, got %v", token)
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		if _, ok := object.values[key]; !ok {
+			object.keys = append(object.keys, key)
+		}
+		object.values[key] = value
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// MarshalJSON writes out the object with its keys in order
+func (o *bunObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := writeBunString(&buf, key); err != nil {
+			return nil, err
+		}
+		buf.WriteByte(':')
+		buf.Write(o.values[key])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (o *bunObject) copy() *bunObject {
+	copied := &bunObject{
+		keys:   append([]string{}, o.keys...),
+		values: make(map[string]json.RawMessage, len(o.values)),
+	}
+	for key, value := range o.values {
+		copied.values[key] = value
+	}
+	return copied
+}
+
+// object returns the object at key, or nil if there isn't one
+func (o *bunObject) object(key string) (*bunObject, error) {
+	raw, ok := o.values[key]
+	if !ok {
+		return nil, nil
+	}
+	return decodeBunObject(raw)
+}
+
+func (o *bunObject) setObject(key string, value *bunObject) error {
+	raw, err := value.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = raw
+	return nil
+}
+
+func (o *bunObject) remove(key string) {
+	if _, ok := o.values[key]; !ok {
+		return
+	}
+	delete(o.values, key)
+	for i, existing := range o.keys {
+		if existing == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// filter returns a copy of the object in which the object at key only has the keys that keep
+// returns true for. It returns the object as is if there is nothing at key.
+func (o *bunObject) filter(key string, keep func(string) bool) (*bunObject, error) {
+	nested, err := o.object(key)
+	if err != nil || nested == nil {
+		return o, err
+	}
+	filtered := &bunObject{values: make(map[string]json.RawMessage)}
+	for _, nestedKey := range nested.keys {
+		if keep(nestedKey) {
+			filtered.keys = append(filtered.keys, nestedKey)
+			filtered.values[nestedKey] = nested.values[nestedKey]
+		}
+	}
+	copied := o.copy()
+	if err := copied.setObject(key, filtered); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// writeBunLockfile writes contents in the format bun uses: every object spans multiple lines
+// and has trailing commas, except for the entries in packages, which are written on a single
+// line and separated by blank lines.
+func writeBunLockfile(buf *bytes.Buffer, contents *bunObject) error {
+	buf.WriteString("{\n")
+	for i, key := range contents.keys {
+		buf.WriteString("  ")
+		if err := writeBunString(buf, key); err != nil {
+			return err
+		}
+		buf.WriteString(": ")
+		if key == "packages" {
+			if err := writeBunPackages(buf, contents.values[key]); err != nil {
+				return err
+			}
+		} else if err := writeBunValue(buf, contents.values[key], "  "); err != nil {
+			return err
+		}
+		if i < len(contents.keys)-1 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("}\n")
+	return nil
+}
+
+func writeBunPackages(buf *bytes.Buffer, raw json.RawMessage) error {
+	packages, err := decodeBunObject(raw)
+	if err != nil {
+		return err
+	}
+	if len(packages.keys) == 0 {
+		buf.WriteString("{}")
+		return nil
+	}
+	buf.WriteString("{\n")
+	for i, key := range packages.keys {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString("    ")
+		if err := writeBunString(buf, key); err != nil {
+			return err
+		}
+		buf.WriteString(": ")
+		if err := writeInlineBunValue(buf, packages.values[key]); err != nil {
+			return err
+		}
+		buf.WriteString(",\n")
+	}
+	buf.WriteString("  }")
+	return nil
+}
+
+// writeBunValue writes a value over multiple lines, indenting nested values past indent
+func writeBunValue(buf *bytes.Buffer, raw json.RawMessage, indent string) error {
+	trimmed := bytes.TrimSpace(raw)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		object, err := decodeBunObject(trimmed)
+		if err != nil {
+			return err
+		}
+		if len(object.keys) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteString("{\n")
+		for _, key := range object.keys {
+			buf.WriteString(indent + "  ")
+			if err := writeBunString(buf, key); err != nil {
+				return err
+			}
+			buf.WriteString(": ")
+			if err := writeBunValue(buf, object.values[key], indent+"  "); err != nil {
+				return err
+			}
+			buf.WriteString(",\n")
+		}
+		buf.WriteString(indent + "}")
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		var elements []json.RawMessage
+		if err := json.Unmarshal(trimmed, &elements); err != nil {
+			return err
+		}
+		if len(elements) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteString("[\n")
+		for _, element := range elements {
+			buf.WriteString(indent + "  ")
+			if err := writeBunValue(buf, element, indent+"  "); err != nil {
+				return err
+			}
+			buf.WriteString(",\n")
+		}
+		buf.WriteString(indent + "]")
+	default:
+		buf.Write(trimmed)
+	}
+	return nil
+}
+
+// writeInlineBunValue writes a value on a single line, with spaces inside of braces
+func writeInlineBunValue(buf *bytes.Buffer, raw json.RawMessage) error {
+	trimmed := bytes.TrimSpace(raw)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		object, err := decodeBunObject(trimmed)
+		if err != nil {
+			return err
+		}
+		if len(object.keys) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteString("{ ")
+		for i, key := range object.keys {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			if err := writeBunString(buf, key); err != nil {
+				return err
+			}
+			buf.WriteString(": ")
+			if err := writeInlineBunValue(buf, object.values[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteString(" }")
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		var elements []json.RawMessage
+		if err := json.Unmarshal(trimmed, &elements); err != nil {
+			return err
+		}
+		buf.WriteByte('[')
+		for i, element := range elements {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			if err := writeInlineBunValue(buf, element); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		buf.Write(trimmed)
+	}
+	return nil
+}
+
+func writeBunString(buf *bytes.Buffer, s string) error {
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(s); err != nil {
+		return err
+	}
+	// Encode always adds a newline
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
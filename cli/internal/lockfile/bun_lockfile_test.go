@@ -0,0 +1,198 @@
+package lockfile
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+	"gotest.tools/v3/assert"
+)
+
+func getBunLockfile(t *testing.T) *BunLockfile {
+	content, err := getFixture(t, "bun.lock")
+	assert.NilError(t, err, "reading bun.lock")
+	lockfile, err := DecodeBunLockfile(content)
+	assert.NilError(t, err, "parsing bun.lock")
+	return lockfile
+}
+
+func Test_BunRoundtrip(t *testing.T) {
+	content, err := getFixture(t, "bun.lock")
+	assert.NilError(t, err, "reading bun.lock")
+	lockfile := getBunLockfile(t)
+
+	var b bytes.Buffer
+	assert.NilError(t, lockfile.Encode(&b), "encoding bun.lock")
+	assert.Equal(t, b.String(), string(content))
+}
+
+func Test_BunResolvePackage(t *testing.T) {
+	type TestCase struct {
+		testName  string
+		workspace string
+		name      string
+		version   string
+		key       string
+		resolved  string
+	}
+	testCases := []TestCase{
+		{
+			testName:  "finds deps of root package",
+			workspace: "",
+			name:      "prettier",
+			version:   "^3.0.0",
+			key:       "prettier",
+			resolved:  "3.0.3",
+		},
+		{
+			testName:  "selects dep nested under the workspace if present",
+			workspace: "apps/docs",
+			name:      "react",
+			version:   "^17.0.2",
+			key:       "docs/react",
+			resolved:  "17.0.2",
+		},
+		{
+			testName:  "selects top level package if no nested package",
+			workspace: "packages/ui",
+			name:      "react",
+			version:   "^18.2.0",
+			key:       "react",
+			resolved:  "18.2.0",
+		},
+		{
+			testName:  "finds scoped packages",
+			workspace: "apps/web",
+			name:      "@babel/runtime",
+			version:   "^7.23.0",
+			key:       "@babel/runtime",
+			resolved:  "7.23.1",
+		},
+		{
+			testName:  "finds package if given resolved key",
+			workspace: "apps/docs",
+			name:      "react",
+			version:   "18.2.0",
+			key:       "react",
+			resolved:  "18.2.0",
+		},
+	}
+
+	lockfile := getBunLockfile(t)
+	for _, tc := range testCases {
+		pkg, err := lockfile.ResolvePackage(titanpath.AnchoredUnixPath(tc.workspace), tc.name, tc.version)
+		assert.NilError(t, err, tc.testName)
+		assert.DeepEqual(t, pkg, Package{Key: tc.key, Version: tc.resolved, Found: true})
+	}
+
+	_, err := lockfile.ResolvePackage("apps/missing", "react", "^18.2.0")
+	assert.ErrorContains(t, err, "apps/missing")
+}
+
+func Test_BunAllDependencies(t *testing.T) {
+	type TestCase struct {
+		name     string
+		key      string
+		expected map[string]string
+	}
+	testCases := []TestCase{
+		{
+			name: "mixed nested and hoisted, including peers",
+			key:  "next",
+			expected: map[string]string{
+				"next/postcss": "8.4.14",
+				"react":        "18.2.0",
+				"styled-jsx":   "5.1.1",
+			},
+		},
+		{
+			name: "deps of nested package fall back to hoisted packages",
+			key:  "next/postcss",
+			expected: map[string]string{
+				"nanoid": "3.3.6",
+			},
+		},
+		{
+			name: "deps of a package nested under a workspace",
+			key:  "docs/react",
+			expected: map[string]string{
+				"docs/object-assign": "4.1.1",
+				"loose-envify":       "1.4.0",
+			},
+		},
+	}
+
+	lockfile := getBunLockfile(t)
+	for _, tc := range testCases {
+		deps, ok := lockfile.AllDependencies(tc.key)
+		assert.Assert(t, ok, tc.name)
+		assert.DeepEqual(t, deps, tc.expected)
+	}
+}
+
+func Test_BunKeySegments(t *testing.T) {
+	assert.DeepEqual(t, bunKeySegments("react"), []string{"react"})
+	assert.DeepEqual(t, bunKeySegments("@babel/runtime"), []string{"@babel/runtime"})
+	assert.DeepEqual(t, bunKeySegments("@repo/web/@babel/runtime/regenerator-runtime"), []string{"@repo/web", "@babel/runtime", "regenerator-runtime"})
+	assert.DeepEqual(t, possibleBunDeps("docs/react", "object-assign"), []string{"docs/react/object-assign", "docs/object-assign", "object-assign"})
+}
+
+func Test_BunSubgraph(t *testing.T) {
+	lockfile := getBunLockfile(t)
+	pruned, err := lockfile.Subgraph(
+		[]titanpath.AnchoredSystemPath{titanpath.AnchoredUnixPath("packages/ui").ToSystemPath()},
+		[]string{"react", "loose-envify", "js-tokens"},
+	)
+	assert.NilError(t, err, "Subgraph")
+	bunLockfile := pruned.(*BunLockfile)
+
+	workspaces := make([]string, 0, len(bunLockfile.workspaces))
+	for workspace := range bunLockfile.workspaces {
+		workspaces = append(workspaces, workspace)
+	}
+	sort.Strings(workspaces)
+	assert.DeepEqual(t, workspaces, []string{"", "packages/ui"})
+
+	packages := make([]string, 0, len(bunLockfile.packages))
+	for key := range bunLockfile.packages {
+		packages = append(packages, key)
+	}
+	sort.Strings(packages)
+	assert.DeepEqual(t, packages, []string{"js-tokens", "loose-envify", "react", "ui"})
+	// next isn't installed anymore, so its patch is dropped
+	assert.Assert(t, bunLockfile.Patches() == nil)
+	assert.DeepEqual(t, lockfile.Patches(), []titanpath.AnchoredUnixPath{"patches/next@13.5.4.patch"})
+
+	var b bytes.Buffer
+	assert.NilError(t, pruned.Encode(&b), "encoding pruned bun.lock")
+	assert.Assert(t, strings.Contains(b.String(), `    "react": ["react@18.2.0", "", { "dependencies": { "loose-envify": "^1.1.0" } }, "sha512-`))
+	assert.Assert(t, !strings.Contains(b.String(), "apps/web"))
+	assert.Assert(t, !strings.Contains(b.String(), "patchedDependencies"))
+
+	_, err = lockfile.Subgraph(nil, []string{"missing"})
+	assert.ErrorContains(t, err, "missing")
+}
+
+func Test_BunWithoutDevDependencies(t *testing.T) {
+	lockfile := getBunLockfile(t)
+	pruned, err := lockfile.WithoutDevDependencies(map[titanpath.AnchoredUnixPath][]string{
+		"":         {"prettier"},
+		"apps/web": {"eslint"},
+	})
+	assert.NilError(t, err, "WithoutDevDependencies")
+	bunLockfile := pruned.(*BunLockfile)
+
+	assert.DeepEqual(t, bunLockfile.workspaces[""].DevDependencies, map[string]string{"typescript": "^5.2.0"})
+	assert.Assert(t, bunLockfile.workspaces["apps/web"].DevDependencies == nil)
+	// The original lockfile is left untouched
+	assert.Equal(t, len(lockfile.workspaces[""].DevDependencies), 2)
+
+	var b bytes.Buffer
+	assert.NilError(t, pruned.Encode(&b), "encoding bun.lock")
+	assert.Assert(t, !strings.Contains(b.String(), `"eslint": "^8.50.0"`))
+
+	_, err = lockfile.WithoutDevDependencies(map[titanpath.AnchoredUnixPath][]string{"apps/missing": {"typescript"}})
+	assert.ErrorContains(t, err, "apps/missing")
+}
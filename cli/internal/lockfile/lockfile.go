@@ -21,6 +21,37 @@ type Lockfile interface {
 	Patches() []titanpath.AnchoredUnixPath
 }
 
+// DevDependencyPruner is implemented by lockfiles that record the dependencies of each workspace,
+// which must match the workspaces' package.json files
+type DevDependencyPruner interface {
+	// WithoutDevDependencies returns a copy of the lockfile in which each of the given workspaces
+	// no longer has the given devDependencies. Workspaces are keyed by path, with "" for the root.
+	WithoutDevDependencies(devDependencies map[titanpath.AnchoredUnixPath][]string) (Lockfile, error)
+}
+
+// EntryLockfile is implemented by lockfiles that can return the whole entry of a package, including
+// fields such as its resolved url or integrity, which the Lockfile interface doesn't expose
+type EntryLockfile interface {
+	// PackageEntry returns the entry for the given lockfile key, which can be compared with
+	// reflect.DeepEqual against entries from another lockfile of the same type
+	PackageEntry(key string) (interface{}, bool)
+}
+
+// withoutDeps returns a copy of deps without the given names, or nil if none remain
+func withoutDeps(deps map[string]string, names []string) map[string]string {
+	pruned := make(map[string]string, len(deps))
+	for name, version := range deps {
+		pruned[name] = version
+	}
+	for _, name := range names {
+		delete(pruned, name)
+	}
+	if len(pruned) == 0 {
+		return nil
+	}
+	return pruned
+}
+
 // Package Structure representing a possible Pack
 type Package struct {
 	// Key used to lookup a package in the lockfile
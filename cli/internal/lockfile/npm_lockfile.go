@@ -19,6 +19,10 @@ type NpmLockfile struct {
 	Packages map[string]NpmPackage `json:"packages,omitempty"`
 	// Legacy info for npm version 5 & 6
 	Dependencies map[string]NpmDependency `json:"dependencies,omitempty"`
+
+	// legacy is set for lockfiles that only have the legacy dependencies tree. Packages is
+	// derived from it, and doesn't have entries for workspaces other than the root.
+	legacy bool
 }
 
 // NpmPackage Representation of dependencies used in LockfileVersion 2+
@@ -78,7 +82,7 @@ var _ Lockfile = (*NpmLockfile)(nil)
 // ResolvePackage Given a workspace, a package it imports and version returns the key, resolved version, and if it was found
 func (l *NpmLockfile) ResolvePackage(workspacePath titanpath.AnchoredUnixPath, name string, version string) (Package, error) {
 	_, ok := l.Packages[workspacePath.ToString()]
-	if !ok {
+	if !ok && !l.legacy {
 		return Package{}, fmt.Errorf("No package found in lockfile for '%s'", workspacePath)
 	}
 
@@ -142,6 +146,12 @@ func (l *NpmLockfile) AllDependencies(key string) (map[string]string, bool) {
 	return deps, true
 }
 
+// PackageEntry returns the entry for the given lockfile key
+func (l *NpmLockfile) PackageEntry(key string) (interface{}, bool) {
+	entry, ok := l.Packages[key]
+	return entry, ok
+}
+
 // Subgraph Given a list of lockfile keys returns a Lockfile based off the original one that only contains the packages given
 func (l *NpmLockfile) Subgraph(workspacePackages []titanpath.AnchoredSystemPath, packages []string) (Lockfile, error) {
 	prunedPackages := make(map[string]NpmPackage, len(packages))
@@ -159,7 +169,7 @@ func (l *NpmLockfile) Subgraph(workspacePackages []titanpath.AnchoredSystemPath,
 		workspacePkg := workspacePackages.ToUnixPath().ToString()
 		if workspaceEntry, ok := l.Packages[workspacePkg]; ok {
 			prunedPackages[workspacePkg] = workspaceEntry
-		} else {
+		} else if !l.legacy {
 			return nil, fmt.Errorf("No lockfile entry found for %s", workspacePkg)
 		}
 		// Each workspace package has a fake version of the package that links back to the original
@@ -172,6 +182,19 @@ func (l *NpmLockfile) Subgraph(workspacePackages []titanpath.AnchoredSystemPath,
 		}
 	}
 
+	if l.legacy {
+		// npm upgrades legacy lockfiles on install, so we keep the pruned lockfile in the same format
+		return &NpmLockfile{
+			Name:            l.Name,
+			Version:         l.Version,
+			LockfileVersion: l.LockfileVersion,
+			Requires:        l.Requires,
+			Packages:        prunedPackages,
+			Dependencies:    pruneLegacyDependencies(l.Dependencies, "", prunedPackages),
+			legacy:          true,
+		}, nil
+	}
+
 	return &NpmLockfile{
 		Name:    l.Name,
 		Version: l.Version,
@@ -183,11 +206,42 @@ func (l *NpmLockfile) Subgraph(workspacePackages []titanpath.AnchoredSystemPath,
 	}, nil
 }
 
+var _ DevDependencyPruner = (*NpmLockfile)(nil)
+
+// WithoutDevDependencies returns a copy of the lockfile without the given devDependencies of each workspace
+func (l *NpmLockfile) WithoutDevDependencies(devDependencies map[titanpath.AnchoredUnixPath][]string) (Lockfile, error) {
+	packages := make(map[string]NpmPackage, len(l.Packages))
+	for key, entry := range l.Packages {
+		packages[key] = entry
+	}
+	for workspace, deps := range devDependencies {
+		key := workspace.ToString()
+		entry, ok := packages[key]
+		if !ok && l.legacy {
+			// Legacy lockfiles don't record the dependencies of workspaces
+			continue
+		} else if !ok {
+			return nil, fmt.Errorf("No lockfile entry found for %s", key)
+		}
+		entry.DevDependencies = withoutDeps(entry.DevDependencies, deps)
+		packages[key] = entry
+	}
+	pruned := *l
+	pruned.Packages = packages
+	return &pruned, nil
+}
+
 // Encode the lockfile representation and write it to the given writer
 func (l *NpmLockfile) Encode(w io.Writer) error {
 	encoder := json.NewEncoder(w)
 	encoder.SetIndent("", "  ")
 	encoder.SetEscapeHTML(false)
+	if l.legacy {
+		// Packages is derived from the legacy dependencies, so we don't write it out
+		legacyLockfile := *l
+		legacyLockfile.Packages = nil
+		return encoder.Encode(&legacyLockfile)
+	}
 	return encoder.Encode(l)
 }
 
@@ -207,15 +261,61 @@ func DecodeNpmLockfile(content []byte) (*NpmLockfile, error) {
 	ancientLockfile := lockfile.LockfileVersion <= 1 || (len(lockfile.Dependencies) > 0 && len(lockfile.Packages) == 0)
 
 	if ancientLockfile {
-		// TODO: Older versions of package-lock.json required crawling through node_modules and other
-		// various fixups to make it a deterministic lockfile.
+		// Older versions of package-lock.json only have a tree of dependencies that mirrors node_modules.
+		// We flatten it into the same keys that the packages field uses so resolution works the same way.
 		// See https://github.com/npm/cli/blob/9609e9eed87c735f0319ac0af265f4d406cbf800/workspaces/arborist/lib/shrinkwrap.js#L674
-		return nil, fmt.Errorf("Support for lockfiles without a 'packages' field isn't implemented yet")
+		lockfile.legacy = true
+		lockfile.Packages = map[string]NpmPackage{
+			"": {Name: lockfile.Name, Version: lockfile.Version},
+		}
+		addLegacyPackages(lockfile.Packages, lockfile.Dependencies, "")
 	}
 
 	return &lockfile, nil
 }
 
+// addLegacyPackages adds an entry to packages for each dependency in the legacy tree,
+// keyed by its path in node_modules
+func addLegacyPackages(packages map[string]NpmPackage, dependencies map[string]NpmDependency, prefix string) {
+	for name, dep := range dependencies {
+		key := fmt.Sprintf("%snode_modules/%s", prefix, name)
+		entry := NpmPackage{
+			Version:      dep.Version,
+			Resolved:     dep.Resolved,
+			Integrity:    dep.Integrity,
+			Dev:          dep.Dev,
+			Optional:     dep.Optional,
+			InBundle:     dep.Bundled,
+			Dependencies: dep.Requires,
+		}
+		// Workspaces and other local packages are recorded as a file: version
+		if strings.HasPrefix(dep.Version, "file:") {
+			entry.Version = ""
+			entry.Resolved = strings.TrimPrefix(dep.Version, "file:")
+			entry.Link = true
+		}
+		packages[key] = entry
+		addLegacyPackages(packages, dep.Dependencies, key+"/")
+	}
+}
+
+// pruneLegacyDependencies returns the legacy dependency tree with only the dependencies that are in packages
+func pruneLegacyDependencies(dependencies map[string]NpmDependency, prefix string, packages map[string]NpmPackage) map[string]NpmDependency {
+	pruned := make(map[string]NpmDependency)
+	for name, dep := range dependencies {
+		key := fmt.Sprintf("%snode_modules/%s", prefix, name)
+		if _, ok := packages[key]; !ok {
+			continue
+		}
+		dep.Dependencies = pruneLegacyDependencies(dep.Dependencies, key+"/", packages)
+		pruned[name] = dep
+	}
+	if len(pruned) == 0 {
+		return nil
+	}
+	return pruned
+}
+
 // returns a list of possible keys for a dependency of package key
 func possibleNpmDeps(key string, dep string) []string {
 	possibleDeps := []string{fmt.Sprintf("%s/node_modules/%s", key, dep)}
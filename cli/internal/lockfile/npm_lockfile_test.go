@@ -1,7 +1,9 @@
 package lockfile
 
 import (
+	"bytes"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
@@ -203,3 +205,67 @@ func Test_NpmAllDependencies(t *testing.T) {
 	}
 
 }
+
+func Test_NpmWithoutDevDependencies(t *testing.T) {
+	lockfile := getNpmLockfile(t)
+	pruned, err := lockfile.WithoutDevDependencies(map[titanpath.AnchoredUnixPath][]string{
+		"":                              {"eslint-config-custom", "prettier", "titan"},
+		"packages/eslint-config-custom": {"typescript"},
+	})
+	assert.NilError(t, err, "WithoutDevDependencies")
+	npmLockfile := pruned.(*NpmLockfile)
+
+	assert.Assert(t, npmLockfile.Packages[""].DevDependencies == nil)
+	assert.Assert(t, npmLockfile.Packages["packages/eslint-config-custom"].DevDependencies == nil)
+	assert.Equal(t, len(npmLockfile.Packages["apps/docs"].DevDependencies), 8)
+	// The original lockfile is left untouched
+	assert.Equal(t, len(lockfile.Packages[""].DevDependencies), 3)
+
+	_, err = lockfile.WithoutDevDependencies(map[titanpath.AnchoredUnixPath][]string{"apps/missing": {"typescript"}})
+	assert.ErrorContains(t, err, "apps/missing")
+}
+
+func Test_NpmLegacyLockfile(t *testing.T) {
+	content, err := getFixture(t, "npm-lock-v1.json")
+	assert.NilError(t, err, "reading npm-lock-v1.json")
+	lockfile, err := DecodeNpmLockfile(content)
+	assert.NilError(t, err, "parsing npm-lock-v1.json")
+
+	// Workspaces aren't recorded in legacy lockfiles, so resolution falls back to hoisted packages
+	pkg, err := lockfile.ResolvePackage("apps/web", "chalk", "^2.4.2")
+	assert.NilError(t, err, "ResolvePackage")
+	assert.DeepEqual(t, pkg, Package{Key: "node_modules/chalk", Version: "2.4.2", Found: true})
+
+	deps, ok := lockfile.AllDependencies("node_modules/chalk")
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, deps, map[string]string{"node_modules/ansi-styles": "3.2.1"})
+
+	link := lockfile.Packages["node_modules/ui"]
+	assert.Assert(t, link.Link)
+	assert.Equal(t, link.Resolved, "packages/ui")
+	_, hasNested := lockfile.Packages["node_modules/ui/node_modules/left-pad"]
+	assert.Assert(t, hasNested, "nested dependency is missing")
+
+	pruned, err := lockfile.Subgraph(
+		[]titanpath.AnchoredSystemPath{
+			titanpath.AnchoredUnixPath("apps/web").ToSystemPath(),
+			titanpath.AnchoredUnixPath("packages/ui").ToSystemPath(),
+		},
+		[]string{"node_modules/chalk", "node_modules/ansi-styles", "node_modules/ui/node_modules/left-pad"},
+	)
+	assert.NilError(t, err, "Subgraph")
+	prunedLockfile := pruned.(*NpmLockfile)
+	assert.Equal(t, prunedLockfile.LockfileVersion, 1)
+	dependencies := []string{}
+	for name := range prunedLockfile.Dependencies {
+		dependencies = append(dependencies, name)
+	}
+	sort.Strings(dependencies)
+	assert.DeepEqual(t, dependencies, []string{"ansi-styles", "chalk", "ui"})
+	assert.Equal(t, prunedLockfile.Dependencies["ui"].Dependencies["left-pad"].Version, "1.3.0")
+
+	var b bytes.Buffer
+	assert.NilError(t, pruned.Encode(&b), "Encode")
+	assert.Assert(t, cmp.Contains(b.String(), `"dependencies"`))
+	assert.Assert(t, !strings.Contains(b.String(), `"packages"`), "legacy lockfile was written with packages")
+}
@@ -181,6 +181,12 @@ func (p *PnpmLockfile) AllDependencies(key string) (map[string]string, bool) {
 	return deps, true
 }
 
+// PackageEntry returns the entry for the given lockfile key
+func (p *PnpmLockfile) PackageEntry(key string) (interface{}, bool) {
+	entry, ok := p.Packages[key]
+	return entry, ok
+}
+
 // Subgraph Given a list of lockfile keys returns a Lockfile based off the original one that only contains the packages given
 func (p *PnpmLockfile) Subgraph(workspacePackages []titanpath.AnchoredSystemPath, packages []string) (Lockfile, error) {
 	lockfilePackages := make(map[string]PackageSnapshot, len(packages))
@@ -229,6 +235,42 @@ func (p *PnpmLockfile) Subgraph(workspacePackages []titanpath.AnchoredSystemPath
 	return &lockfile, nil
 }
 
+var _ DevDependencyPruner = (*PnpmLockfile)(nil)
+
+// WithoutDevDependencies returns a copy of the lockfile without the given devDependencies of each workspace
+func (p *PnpmLockfile) WithoutDevDependencies(devDependencies map[titanpath.AnchoredUnixPath][]string) (Lockfile, error) {
+	importers := make(map[string]ProjectSnapshot, len(p.Importers))
+	for key, importer := range p.Importers {
+		importers[key] = importer
+	}
+	for workspace, deps := range devDependencies {
+		key := workspace.ToString()
+		if key == "" {
+			key = "."
+		}
+		importer, ok := importers[key]
+		if !ok {
+			return nil, fmt.Errorf("Unable to find import entry for workspace package %s", key)
+		}
+		importer.Specifiers = withoutDeps(importer.Specifiers, deps)
+		importer.DevDependencies = withoutDeps(importer.DevDependencies, deps)
+		if importer.DependenciesMeta != nil {
+			dependenciesMeta := make(map[string]DependenciesMeta, len(importer.DependenciesMeta))
+			for dep, meta := range importer.DependenciesMeta {
+				dependenciesMeta[dep] = meta
+			}
+			for _, dep := range deps {
+				delete(dependenciesMeta, dep)
+			}
+			importer.DependenciesMeta = dependenciesMeta
+		}
+		importers[key] = importer
+	}
+	pruned := *p
+	pruned.Importers = importers
+	return &pruned, nil
+}
+
 // Prune imports to only those have all of their dependencies in the packages list
 func pruneImporters(importers map[string]ProjectSnapshot, workspacePackages []titanpath.AnchoredSystemPath) (map[string]ProjectSnapshot, error) {
 	prunedImporters := map[string]ProjectSnapshot{}
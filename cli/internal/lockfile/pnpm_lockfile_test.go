@@ -122,3 +122,27 @@ func Test_DecodePnpmUnquotedURL(t *testing.T) {
 	assert.NilError(t, err, "valid package entry should be able to be decoded")
 	assert.Equal(t, resolution["tarball"], "path/to/tarball?foo=bar")
 }
+
+func Test_PnpmWithoutDevDependencies(t *testing.T) {
+	contents, err := getFixture(t, "pnpm7-workspace.yaml")
+	assert.NilError(t, err, "read fixture")
+	lockfile, err := DecodePnpmLockfile(contents)
+	assert.NilError(t, err, "decode lockfile")
+
+	pruned, err := lockfile.WithoutDevDependencies(map[titanpath.AnchoredUnixPath][]string{
+		"apps/docs": {"eslint", "typescript"},
+	})
+	assert.NilError(t, err, "WithoutDevDependencies")
+	docs := pruned.(*PnpmLockfile).Importers["apps/docs"]
+
+	for _, dep := range []string{"eslint", "typescript"} {
+		_, hasSpecifier := docs.Specifiers[dep]
+		assert.Assert(t, !hasSpecifier, "specifier for %v", dep)
+		_, hasDevDependency := docs.DevDependencies[dep]
+		assert.Assert(t, !hasDevDependency, "devDependency %v", dep)
+	}
+	_, hasNext := docs.Specifiers["next"]
+	assert.Assert(t, hasNext, "dependencies are kept")
+	_, originalHasEslint := lockfile.Importers["apps/docs"].DevDependencies["eslint"]
+	assert.Assert(t, originalHasEslint, "original lockfile was modified")
+}
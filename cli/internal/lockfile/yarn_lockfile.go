@@ -54,6 +54,12 @@ func (l *YarnLockfile) AllDependencies(key string) (map[string]string, bool) {
 	return deps, true
 }
 
+// PackageEntry returns the entry for the given lockfile key
+func (l *YarnLockfile) PackageEntry(key string) (interface{}, bool) {
+	entry, ok := l.inner[key]
+	return entry, ok
+}
+
 // Subgraph Given a list of lockfile keys returns a Lockfile based off the original one that only contains the packages given
 func (l *YarnLockfile) Subgraph(_ []titanpath.AnchoredSystemPath, packages []string) (Lockfile, error) {
 	lockfile := make(map[string]yarnlock.LockFileEntry, len(packages))
@@ -19,13 +19,25 @@ type PackageTask struct {
 	TaskDefinition *fs.TaskDefinition
 }
 
-// Command returns the script for this task from package.json and a boolean indicating
-// whether or not it exists
+// Command returns the command for this task, either from titan.json or the script from
+// package.json, and a boolean indicating whether or not it exists
 func (pt *PackageTask) Command() (string, bool) {
+	if pt.TaskDefinition != nil && pt.TaskDefinition.Command != "" {
+		return pt.TaskDefinition.Command, true
+	}
 	cmd, ok := pt.Pkg.Scripts[pt.Task]
 	return cmd, ok
 }
 
+// CommandDir returns the path, relative to the root of the monorepo, in which the
+// command for this task runs
+func (pt *PackageTask) CommandDir() string {
+	if pt.TaskDefinition != nil && pt.TaskDefinition.Command != "" && pt.TaskDefinition.Cwd != "" {
+		return filepath.Join(pt.Pkg.Dir.ToStringDuringMigration(), filepath.FromSlash(pt.TaskDefinition.Cwd))
+	}
+	return pt.Pkg.Dir.ToStringDuringMigration()
+}
+
 // OutputPrefix returns the prefix to be used for logging and ui for this task
 func (pt *PackageTask) OutputPrefix(isSinglePackage bool) string {
 	if isSinglePackage {
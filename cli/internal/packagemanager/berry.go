@@ -2,11 +2,13 @@ package packagemanager
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
 	"strings"
 
 	"github.com/Masterminds/semver"
 	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/globby"
 	"github.com/khulnasoft/titanrepo/cli/internal/lockfile"
 	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
 	"github.com/khulnasoft/titanrepo/cli/internal/util"
@@ -43,11 +45,6 @@ var nodejsBerry = PackageManager{
 	},
 
 	canPrune: func(cwd titanpath.AbsoluteSystemPath) (bool, error) {
-		if isNMLinker, err := util.IsNMLinker(cwd.ToStringDuringMigration()); err != nil {
-			return false, errors.Wrap(err, "could not determine if yarn is using `nodeLinker: node-modules`")
-		} else if !isNMLinker {
-			return false, errors.New("only yarn v2/v3 with `nodeLinker: node-modules` is supported at this time")
-		}
 		return true, nil
 	},
 
@@ -153,4 +150,69 @@ var nodejsBerry = PackageManager{
 
 		return nil
 	},
+
+	getPruneFiles: func(rootpath titanpath.AbsoluteSystemPath, prunedLockfile lockfile.Lockfile) ([]titanpath.AnchoredUnixPath, error) {
+		files := []titanpath.AnchoredUnixPath{}
+		// The yarn config points at the checked in yarn release and plugins, so they all go together
+		if rootpath.UntypedJoin(".yarnrc.yml").FileExists() {
+			files = append(files, ".yarnrc.yml")
+		}
+		yarnFiles, err := globby.GlobFiles(rootpath.ToString(), []string{".yarn/releases/**", ".yarn/plugins/**"}, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to find yarn releases and plugins")
+		}
+		for _, file := range yarnFiles {
+			relativePath, err := rootpath.RelativePathString(file)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, titanpath.AnchoredSystemPath(relativePath).ToUnixPath())
+		}
+
+		// With a checked in cache (e.g. zero-installs or PnP), only copy the archives of the pruned packages
+		berryLockfile, ok := prunedLockfile.(*lockfile.BerryLockfile)
+		cacheDir := rootpath.UntypedJoin(".yarn", "cache")
+		if !ok || !cacheDir.DirExists() {
+			return files, nil
+		}
+		cacheFiles, err := berryCacheFiles(cacheDir, berryLockfile.CacheChecksums())
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range cacheFiles {
+			files = append(files, titanpath.AnchoredUnixPath(".yarn/cache").Join(titanpath.RelativeUnixPath(file)))
+		}
+		return files, nil
+	},
+}
+
+// berryCacheFiles returns the archives in the cache directory that belong to the given checksums.
+// Yarn names each archive <locator slug>-<first 10 characters of the checksum>.zip
+// See https://github.com/yarnpkg/berry/blob/8e0c4b897b0881878a1f901230ea49b7c8113fbe/packages/yarnpkg-core/sources/Cache.ts#L96
+func berryCacheFiles(cacheDir titanpath.AbsoluteSystemPath, checksums []string) ([]string, error) {
+	significantChecksums := make(map[string]bool, len(checksums))
+	for _, checksum := range checksums {
+		if len(checksum) > 10 {
+			checksum = checksum[:10]
+		}
+		significantChecksums[checksum] = true
+	}
+
+	entries, err := os.ReadDir(cacheDir.ToString())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read yarn cache")
+	}
+	files := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".zip") {
+			continue
+		}
+		slugAndChecksum := strings.TrimSuffix(name, ".zip")
+		checksum := slugAndChecksum[strings.LastIndex(slugAndChecksum, "-")+1:]
+		if significantChecksums[checksum] {
+			files = append(files, name)
+		}
+	}
+	return files, nil
 }
@@ -0,0 +1,164 @@
+package packagemanager
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Masterminds/semver"
+	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/lockfile"
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+)
+
+var nodejsBun = PackageManager{
+	Name:       "nodejs-bun",
+	Slug:       "bun",
+	Command:    "bun",
+	Specfile:   "package.json",
+	Lockfile:   "bun.lock",
+	PackageDir: "node_modules",
+	// bun run passes everything after the script name through to the script, including '--'
+	ArgSeparator:       nil,
+	RunsPrePostScripts: true,
+
+	getWorkspaceGlobs: getBunWorkspaceGlobs,
+
+	getWorkspaceIgnores: getBunWorkspaceIgnores,
+
+	// bun.lock became the default lockfile in 1.2
+	Matches: func(manager string, version string) (bool, error) {
+		return matchesBunVersion(manager, version, ">=1.2.0-0")
+	},
+
+	detect: func(projectDirectory titanpath.AbsoluteSystemPath, packageManager *PackageManager) (bool, error) {
+		specfileExists := projectDirectory.UntypedJoin(packageManager.Specfile).FileExists()
+		lockfileExists := projectDirectory.UntypedJoin(packageManager.Lockfile).FileExists()
+
+		return (specfileExists && lockfileExists), nil
+	},
+
+	canPrune: func(cwd titanpath.AbsoluteSystemPath) (bool, error) {
+		return true, nil
+	},
+
+	readLockfile: func(contents []byte) (lockfile.Lockfile, error) {
+		return lockfile.DecodeBunLockfile(contents)
+	},
+
+	prunePatches: func(pkgJSON *fs.PackageJSON, patches []titanpath.AnchoredUnixPath) error {
+		return bunPrunePatches(pkgJSON, patches)
+	},
+}
+
+// nodejsBunLockb is bun before 1.2, which only writes the binary bun.lockb
+var nodejsBunLockb = PackageManager{
+	Name:               "nodejs-bun-lockb",
+	Slug:               "bun",
+	Command:            "bun",
+	Specfile:           "package.json",
+	Lockfile:           "bun.lockb",
+	PackageDir:         "node_modules",
+	ArgSeparator:       nil,
+	RunsPrePostScripts: true,
+
+	getWorkspaceGlobs: getBunWorkspaceGlobs,
+
+	getWorkspaceIgnores: getBunWorkspaceIgnores,
+
+	Matches: func(manager string, version string) (bool, error) {
+		return matchesBunVersion(manager, version, "<1.2.0-0")
+	},
+
+	detect: func(projectDirectory titanpath.AbsoluteSystemPath, packageManager *PackageManager) (bool, error) {
+		specfileExists := projectDirectory.UntypedJoin(packageManager.Specfile).FileExists()
+		lockfileExists := projectDirectory.UntypedJoin(packageManager.Lockfile).FileExists()
+
+		return (specfileExists && lockfileExists), nil
+	},
+
+	// We can't read or write bun.lockb. Running bun install --save-text-lockfile switches to
+	// bun.lock, which we can prune.
+	canPrune: func(cwd titanpath.AbsoluteSystemPath) (bool, error) {
+		return false, nil
+	},
+
+	readLockfile: readBunLockb,
+}
+
+func getBunWorkspaceGlobs(rootpath titanpath.AbsoluteSystemPath) ([]string, error) {
+	pkg, err := fs.ReadPackageJSON(rootpath.UntypedJoin("package.json"))
+	if err != nil {
+		return nil, fmt.Errorf("package.json: %w", err)
+	}
+	if len(pkg.Workspaces) == 0 {
+		return nil, fmt.Errorf("package.json: no workspaces found. Titanrepo requires bun workspaces to be defined in the root package.json")
+	}
+	return pkg.Workspaces, nil
+}
+
+func getBunWorkspaceIgnores(pm PackageManager, rootpath titanpath.AbsoluteSystemPath) ([]string, error) {
+	return []string{
+		"**/node_modules/**",
+	}, nil
+}
+
+func matchesBunVersion(manager string, version string, constraint string) (bool, error) {
+	if manager != "bun" {
+		return false, nil
+	}
+
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false, fmt.Errorf("could not parse bun version: %w", err)
+	}
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return false, fmt.Errorf("could not create constraint: %w", err)
+	}
+
+	return c.Check(v), nil
+}
+
+// readBunLockb reports that a binary bun.lockb can't be read. Only bun itself can decode it,
+// and starting a bun process for every lockfile we parse, including previous versions of it
+// for --filter, would make reading the package graph slow and depend on bun being installed.
+// Without a lockfile, titan falls back to treating every workspace as affected.
+func readBunLockb(contents []byte) (lockfile.Lockfile, error) {
+	return nil, errors.New("bun.lockb is a binary lockfile that titan can't read. Run bun install --save-text-lockfile to switch to bun.lock")
+}
+
+func bunPrunePatches(pkgJSON *fs.PackageJSON, patches []titanpath.AnchoredUnixPath) error {
+	pkgJSON.Mu.Lock()
+	defer pkgJSON.Mu.Unlock()
+
+	patchedDependencies, ok := pkgJSON.RawJSON["patchedDependencies"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("Invalid structure for patchedDependencies field in package.json")
+	}
+
+	keysToDelete := []string{}
+	for dependency, untypedPatch := range patchedDependencies {
+		patch, ok := untypedPatch.(string)
+		if !ok {
+			return fmt.Errorf("Expected only strings in patchedDependencies. Got %v", untypedPatch)
+		}
+
+		inPatches := false
+		for _, wantedPatch := range patches {
+			if wantedPatch.ToString() == patch {
+				inPatches = true
+				break
+			}
+		}
+
+		if !inPatches {
+			keysToDelete = append(keysToDelete, dependency)
+		}
+	}
+
+	for _, key := range keysToDelete {
+		delete(patchedDependencies, key)
+	}
+
+	return nil
+}
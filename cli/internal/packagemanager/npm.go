@@ -9,13 +9,14 @@ import (
 )
 
 var nodejsNpm = PackageManager{
-	Name:         "nodejs-npm",
-	Slug:         "npm",
-	Command:      "npm",
-	Specfile:     "package.json",
-	Lockfile:     "package-lock.json",
-	PackageDir:   "node_modules",
-	ArgSeparator: []string{"--"},
+	Name:               "nodejs-npm",
+	Slug:               "npm",
+	Command:            "npm",
+	Specfile:           "package.json",
+	Lockfile:           "package-lock.json",
+	PackageDir:         "node_modules",
+	ArgSeparator:       []string{"--"},
+	RunsPrePostScripts: true,
 
 	getWorkspaceGlobs: func(rootpath titanpath.AbsoluteSystemPath) ([]string, error) {
 		pkg, err := fs.ReadPackageJSON(rootpath.UntypedJoin("package.json"))
@@ -0,0 +1,38 @@
+package packagemanager
+
+import (
+	"strings"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+)
+
+// readNpmrc reads the top-level settings of an .npmrc file, which is in ini format. Settings in
+// sections and references to environment variables are not supported.
+func readNpmrc(path titanpath.AbsoluteSystemPath) (map[string]string, error) {
+	contents, err := path.ReadFile()
+	if err != nil {
+		return nil, err
+	}
+	config := make(map[string]string)
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			break
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			// A key on its own is true
+			config[line] = "true"
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		config[strings.TrimSpace(key)] = value
+	}
+	return config, nil
+}
@@ -45,6 +45,13 @@ type PackageManager struct {
 	// should be passed through to the underlying script.
 	ArgSeparator []string
 
+	// Whether the Package Manager runs the pre and post scripts of a script it is asked to run,
+	// unless its configuration in the repository says otherwise.
+	RunsPrePostScripts bool
+
+	// Read whether the Package Manager's configuration in the repository overrides RunsPrePostScripts
+	readPrePostScriptsConfig func(rootpath titanpath.AbsoluteSystemPath) (runs bool, ok bool)
+
 	// Return the list of workspace glob
 	getWorkspaceGlobs func(rootpath titanpath.AbsoluteSystemPath) ([]string, error)
 
@@ -65,18 +72,25 @@ type PackageManager struct {
 
 	// Prune the given pkgJSON to only include references to the given patches
 	prunePatches func(pkgJSON *fs.PackageJSON, patches []titanpath.AnchoredUnixPath) error
+
+	// Return the files outside of workspaces that are needed to install from the given pruned lockfile
+	getPruneFiles func(rootpath titanpath.AbsoluteSystemPath, prunedLockfile lockfile.Lockfile) ([]titanpath.AnchoredUnixPath, error)
 }
 
+// Deno isn't supported: its workspaces are declared in deno.json and resolved through deno.lock,
+// neither of which we read
 var packageManagers = []PackageManager{
 	nodejsYarn,
 	nodejsBerry,
 	nodejsNpm,
 	nodejsPnpm,
 	nodejsPnpm6,
+	nodejsBun,
+	nodejsBunLockb,
 }
 
 var (
-	packageManagerPattern = `(npm|pnpm|yarn)@(\d+)\.\d+\.\d+(-.+)?`
+	packageManagerPattern = `(npm|pnpm|yarn|bun)@(\d+)\.\d+\.\d+(-.+)?`
 	packageManagerRegex   = regexp.MustCompile(packageManagerPattern)
 )
 
@@ -185,6 +199,14 @@ func (pm PackageManager) ReadLockfile(projectDirectory titanpath.AbsoluteSystemP
 	return pm.readLockfile(contents)
 }
 
+// ParseLockfile parses the contents of a lockfile, such as a version of it from a previous commit
+func (pm PackageManager) ParseLockfile(contents []byte) (lockfile.Lockfile, error) {
+	if pm.readLockfile == nil {
+		return nil, nil
+	}
+	return pm.readLockfile(contents)
+}
+
 // PrunePatchedPackages will alter the provided pkgJSON to only reference the provided patches
 func (pm PackageManager) PrunePatchedPackages(pkgJSON *fs.PackageJSON, patches []titanpath.AnchoredUnixPath) error {
 	if pm.prunePatches != nil {
@@ -192,3 +214,12 @@ func (pm PackageManager) PrunePatchedPackages(pkgJSON *fs.PackageJSON, patches [
 	}
 	return nil
 }
+
+// GetPruneFiles returns the files outside of workspaces that a pruned monorepo needs in order to
+// install from the given pruned lockfile, such as package manager configuration and caches
+func (pm PackageManager) GetPruneFiles(rootpath titanpath.AbsoluteSystemPath, prunedLockfile lockfile.Lockfile) ([]titanpath.AnchoredUnixPath, error) {
+	if pm.getPruneFiles != nil {
+		return pm.getPruneFiles(rootpath, prunedLockfile)
+	}
+	return nil, nil
+}
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/lockfile"
 	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
 	"gotest.tools/v3/assert"
 )
@@ -83,6 +84,13 @@ func TestParsePackageManagerString(t *testing.T) {
 			wantVersion:    "111.0.1",
 			wantErr:        false,
 		},
+		{
+			name:           "supports bun",
+			packageManager: "bun@1.2.0",
+			wantManager:    "bun",
+			wantVersion:    "1.2.0",
+			wantErr:        false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -198,6 +206,18 @@ func Test_readPackageManager(t *testing.T) {
 			want:    "nodejs-berry",
 			wantErr: false,
 		},
+		{
+			name:    "finds bun from a package manager string",
+			pkg:     &fs.PackageJSON{PackageManager: "bun@1.2.4"},
+			want:    "nodejs-bun",
+			wantErr: false,
+		},
+		{
+			name:    "finds bun with bun.lockb from a package manager string",
+			pkg:     &fs.PackageJSON{PackageManager: "bun@1.1.30"},
+			want:    "nodejs-bun-lockb",
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -227,11 +247,13 @@ func Test_GetWorkspaces(t *testing.T) {
 	repoRoot, err := fs.GetCwd()
 	assert.NilError(t, err, "GetCwd")
 	rootPath := map[string]titanpath.AbsoluteSystemPath{
-		"nodejs-npm":   repoRoot.UntypedJoin("../../../examples/basic"),
-		"nodejs-berry": repoRoot.UntypedJoin("../../../examples/basic"),
-		"nodejs-yarn":  repoRoot.UntypedJoin("../../../examples/basic"),
-		"nodejs-pnpm":  repoRoot.UntypedJoin("../../../examples/with-pnpm"),
-		"nodejs-pnpm6": repoRoot.UntypedJoin("../../../examples/with-pnpm"),
+		"nodejs-npm":       repoRoot.UntypedJoin("../../../examples/basic"),
+		"nodejs-berry":     repoRoot.UntypedJoin("../../../examples/basic"),
+		"nodejs-yarn":      repoRoot.UntypedJoin("../../../examples/basic"),
+		"nodejs-pnpm":      repoRoot.UntypedJoin("../../../examples/with-pnpm"),
+		"nodejs-pnpm6":     repoRoot.UntypedJoin("../../../examples/with-pnpm"),
+		"nodejs-bun":       repoRoot.UntypedJoin("../../../examples/basic"),
+		"nodejs-bun-lockb": repoRoot.UntypedJoin("../../../examples/basic"),
 	}
 
 	want := map[string][]string{
@@ -270,6 +292,20 @@ func Test_GetWorkspaces(t *testing.T) {
 			filepath.ToSlash(filepath.Join(cwd, "../../../examples/with-pnpm/packages/tsconfig/package.json")),
 			filepath.ToSlash(filepath.Join(cwd, "../../../examples/with-pnpm/packages/ui/package.json")),
 		},
+		"nodejs-bun": {
+			filepath.ToSlash(filepath.Join(cwd, "../../../examples/basic/apps/docs/package.json")),
+			filepath.ToSlash(filepath.Join(cwd, "../../../examples/basic/apps/web/package.json")),
+			filepath.ToSlash(filepath.Join(cwd, "../../../examples/basic/packages/eslint-config-custom/package.json")),
+			filepath.ToSlash(filepath.Join(cwd, "../../../examples/basic/packages/tsconfig/package.json")),
+			filepath.ToSlash(filepath.Join(cwd, "../../../examples/basic/packages/ui/package.json")),
+		},
+		"nodejs-bun-lockb": {
+			filepath.ToSlash(filepath.Join(cwd, "../../../examples/basic/apps/docs/package.json")),
+			filepath.ToSlash(filepath.Join(cwd, "../../../examples/basic/apps/web/package.json")),
+			filepath.ToSlash(filepath.Join(cwd, "../../../examples/basic/packages/eslint-config-custom/package.json")),
+			filepath.ToSlash(filepath.Join(cwd, "../../../examples/basic/packages/tsconfig/package.json")),
+			filepath.ToSlash(filepath.Join(cwd, "../../../examples/basic/packages/ui/package.json")),
+		},
 	}
 
 	tests := make([]test, len(packageManagers))
@@ -316,11 +352,13 @@ func Test_GetWorkspaceIgnores(t *testing.T) {
 	cwd, err := fs.GetCwd()
 	assert.NilError(t, err, "GetCwd")
 	want := map[string][]string{
-		"nodejs-npm":   {"**/node_modules/**"},
-		"nodejs-berry": {"**/node_modules", "**/.git", "**/.yarn"},
-		"nodejs-yarn":  {"apps/*/node_modules/**", "packages/*/node_modules/**"},
-		"nodejs-pnpm":  {"**/node_modules/**", "**/bower_components/**", "packages/skip"},
-		"nodejs-pnpm6": {"**/node_modules/**", "**/bower_components/**", "packages/skip"},
+		"nodejs-npm":       {"**/node_modules/**"},
+		"nodejs-berry":     {"**/node_modules", "**/.git", "**/.yarn"},
+		"nodejs-yarn":      {"apps/*/node_modules/**", "packages/*/node_modules/**"},
+		"nodejs-pnpm":      {"**/node_modules/**", "**/bower_components/**", "packages/skip"},
+		"nodejs-pnpm6":     {"**/node_modules/**", "**/bower_components/**", "packages/skip"},
+		"nodejs-bun":       {"**/node_modules/**"},
+		"nodejs-bun-lockb": {"**/node_modules/**"},
 	}
 
 	tests := make([]test, len(packageManagers))
@@ -371,11 +409,13 @@ func Test_CanPrune(t *testing.T) {
 	cwd, err := fs.GetCwd()
 	assert.NilError(t, err, "GetCwd")
 	wants := map[string]want{
-		"nodejs-npm":   {true, false},
-		"nodejs-berry": {false, true},
-		"nodejs-yarn":  {true, false},
-		"nodejs-pnpm":  {true, false},
-		"nodejs-pnpm6": {true, false},
+		"nodejs-npm":       {true, false},
+		"nodejs-berry":     {true, false},
+		"nodejs-yarn":      {true, false},
+		"nodejs-pnpm":      {true, false},
+		"nodejs-pnpm6":     {true, false},
+		"nodejs-bun":       {true, false},
+		"nodejs-bun-lockb": {false, false},
 	}
 
 	tests := make([]test, len(packageManagers))
@@ -403,3 +443,84 @@ func Test_CanPrune(t *testing.T) {
 		})
 	}
 }
+
+func Test_BerryGetPruneFiles(t *testing.T) {
+	root := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	for _, file := range []string{
+		".yarnrc.yml",
+		".yarn/releases/yarn-3.2.4.cjs",
+		".yarn/plugins/@yarnpkg/plugin-workspace-tools.cjs",
+		".yarn/cache/lodash-npm-4.17.21-6382451519-eb835a2e51.zip",
+		".yarn/cache/left-pad-npm-1.3.0-7da9ec5d59-13fa96e17b.zip",
+		".yarn/cache/.gitignore",
+		".pnp.cjs",
+	} {
+		path := root.UntypedJoin(filepath.FromSlash(file))
+		assert.NilError(t, path.EnsureDir(), "EnsureDir")
+		assert.NilError(t, path.WriteFile([]byte{}, 0644), "WriteFile")
+	}
+	prunedLockfile, err := lockfile.DecodeBerryLockfile([]byte(`__metadata:
+  version: 6
+  cacheKey: 8c0
+
+"lodash@npm:^4.17.21":
+  version: 4.17.21
+  resolution: "lodash@npm:4.17.21"
+  checksum: eb835a2e51d381e561e508ce932ea50a8e5a68f4ebdd771ea240d3048244a8d13658acbd502cd4829768c56f2e16bdd4340b9ea141297d472517b83868e677f7
+  languageName: node
+  linkType: hard
+`))
+	assert.NilError(t, err, "DecodeBerryLockfile")
+
+	files, err := nodejsBerry.GetPruneFiles(root, prunedLockfile)
+	assert.NilError(t, err, "GetPruneFiles")
+	sort.Slice(files, func(i, j int) bool { return files[i] < files[j] })
+	assert.DeepEqual(t, files, []titanpath.AnchoredUnixPath{
+		".yarn/cache/lodash-npm-4.17.21-6382451519-eb835a2e51.zip",
+		".yarn/plugins/@yarnpkg/plugin-workspace-tools.cjs",
+		".yarn/releases/yarn-3.2.4.cjs",
+		".yarnrc.yml",
+	})
+
+	files, err = nodejsNpm.GetPruneFiles(root, prunedLockfile)
+	assert.NilError(t, err, "GetPruneFiles")
+	assert.Equal(t, len(files), 0)
+}
+
+func Test_DetectBun(t *testing.T) {
+	for lockfileName, want := range map[string]string{
+		"bun.lock":  "nodejs-bun",
+		"bun.lockb": "nodejs-bun-lockb",
+	} {
+		root := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+		assert.NilError(t, root.UntypedJoin("package.json").WriteFile([]byte(`{"workspaces": ["apps/*"]}`), 0644), "WriteFile")
+		assert.NilError(t, root.UntypedJoin(lockfileName).WriteFile([]byte{}, 0644), "WriteFile")
+
+		packageManager, err := GetPackageManager(root, &fs.PackageJSON{})
+		assert.NilError(t, err, "GetPackageManager")
+		assert.Equal(t, packageManager.Name, want)
+	}
+}
+
+func Test_BunPrunePatches(t *testing.T) {
+	pkgJSON := &fs.PackageJSON{
+		RawJSON: map[string]interface{}{
+			"patchedDependencies": map[string]interface{}{
+				"next@13.5.4":  "patches/next@13.5.4.patch",
+				"react@18.2.0": "patches/react@18.2.0.patch",
+			},
+		},
+	}
+	assert.NilError(t, nodejsBun.PrunePatchedPackages(pkgJSON, []titanpath.AnchoredUnixPath{"patches/react@18.2.0.patch"}), "PrunePatchedPackages")
+	assert.DeepEqual(t, pkgJSON.RawJSON["patchedDependencies"], map[string]interface{}{
+		"react@18.2.0": "patches/react@18.2.0.patch",
+	})
+}
+
+func Test_ReadBunLockb(t *testing.T) {
+	root := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	assert.NilError(t, root.UntypedJoin("bun.lockb").WriteFile([]byte("#!/usr/bin/env bun\nbun-lockfile-format-v0\n"), 0644), "WriteFile")
+
+	_, err := nodejsBunLockb.ReadLockfile(root)
+	assert.ErrorContains(t, err, "bun install --save-text-lockfile")
+}
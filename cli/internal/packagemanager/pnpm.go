@@ -69,6 +69,22 @@ func getPnpmWorkspaceIgnores(pm PackageManager, rootpath titanpath.AbsoluteSyste
 	return ignores, nil
 }
 
+// readPnpmPrePostScriptsConfig reads whether the .npmrc of the repository turns pre and post scripts
+// on or off. ignore-scripts turns them off, and since pnpm 7, enable-pre-post-scripts turns them on.
+func readPnpmPrePostScriptsConfig(rootpath titanpath.AbsoluteSystemPath, hasEnableSetting bool) (bool, bool) {
+	config, err := readNpmrc(rootpath.UntypedJoin(".npmrc"))
+	if err != nil {
+		return false, false
+	}
+	if config["ignore-scripts"] == "true" {
+		return false, true
+	}
+	if enabled, ok := config["enable-pre-post-scripts"]; ok && hasEnableSetting {
+		return enabled == "true", true
+	}
+	return false, false
+}
+
 var nodejsPnpm = PackageManager{
 	Name:       "nodejs-pnpm",
 	Slug:       "pnpm",
@@ -82,9 +98,15 @@ var nodejsPnpm = PackageManager{
 	// We are allowed to use nil here because ArgSeparator already has a type, so it's a typed nil,
 	// This could just as easily be []string{}, but the style guide says to prefer
 	// nil for empty slices.
-	ArgSeparator:               nil,
+	ArgSeparator: nil,
+	// pnpm 7+ only runs pre and post scripts with enable-pre-post-scripts set in .npmrc
+	RunsPrePostScripts:         false,
 	WorkspaceConfigurationPath: "pnpm-workspace.yaml",
 
+	readPrePostScriptsConfig: func(rootpath titanpath.AbsoluteSystemPath) (bool, bool) {
+		return readPnpmPrePostScriptsConfig(rootpath, true)
+	},
+
 	getWorkspaceGlobs: getPnpmWorkspaceGlobs,
 
 	getWorkspaceIgnores: getPnpmWorkspaceIgnores,
@@ -22,8 +22,13 @@ var nodejsPnpm6 = PackageManager{
 	Lockfile:                   "pnpm-lock.yaml",
 	PackageDir:                 "node_modules",
 	ArgSeparator:               []string{"--"},
+	RunsPrePostScripts:         true,
 	WorkspaceConfigurationPath: "pnpm-workspace.yaml",
 
+	readPrePostScriptsConfig: func(rootpath titanpath.AbsoluteSystemPath) (bool, bool) {
+		return readPnpmPrePostScriptsConfig(rootpath, false)
+	},
+
 	getWorkspaceGlobs: getPnpmWorkspaceGlobs,
 
 	getWorkspaceIgnores: getPnpmWorkspaceIgnores,
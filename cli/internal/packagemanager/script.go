@@ -0,0 +1,127 @@
+package packagemanager
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+)
+
+// ScriptCommands returns the commands that the Package Manager runs for the given script of pkg,
+// so that they can be executed without starting the Package Manager. Each command runs the script
+// through a shell in the package's directory, with node_modules/.bin on the PATH and the lifecycle
+// variables that npm sets added to environ. Pre and post scripts are included if the Package
+// Manager runs them, and only the script itself receives args. Returns nil if pkg doesn't have
+// the script.
+func (pm PackageManager) ScriptCommands(repoRoot titanpath.AbsoluteSystemPath, pkg *fs.PackageJSON, script string, args []string, environ []string) []*exec.Cmd {
+	if _, ok := pkg.Scripts[script]; !ok {
+		return nil
+	}
+	pkgDir := repoRoot.UntypedJoin(pkg.Dir.ToStringDuringMigration())
+	path := []string{}
+	for dir := pkgDir; ; dir = dir.Dir() {
+		path = append(path, dir.UntypedJoin(pm.PackageDir, ".bin").ToString())
+		if dir == repoRoot || dir.Dir() == dir {
+			break
+		}
+	}
+	if existingPath, ok := getEnv(environ, "PATH"); ok {
+		path = append(path, existingPath)
+	}
+	environ = setEnv(environ, "PATH", strings.Join(path, string(os.PathListSeparator)))
+	environ = setEnv(environ, "INIT_CWD", pkgDir.ToString())
+	environ = setEnv(environ, "npm_command", "run-script")
+	environ = setEnv(environ, "npm_package_name", pkg.Name)
+	environ = setEnv(environ, "npm_package_version", pkg.Version)
+	environ = setEnv(environ, "npm_package_json", pkgDir.UntypedJoin("package.json").ToString())
+
+	events := []string{script}
+	if pm.runsPrePostScripts(repoRoot) {
+		events = []string{"pre" + script, script, "post" + script}
+	}
+	cmds := []*exec.Cmd{}
+	for _, event := range events {
+		command, ok := pkg.Scripts[event]
+		if !ok {
+			continue
+		}
+		var cmd *exec.Cmd
+		if event == script {
+			cmd = ShellCommand(command, args)
+		} else {
+			cmd = ShellCommand(command, nil)
+		}
+		cmd.Dir = pkgDir.ToString()
+		cmd.Env = setEnv(setEnv(environ, "npm_lifecycle_event", event), "npm_lifecycle_script", pkg.Scripts[event])
+		cmds = append(cmds, cmd)
+	}
+	return cmds
+}
+
+// runsPrePostScripts returns whether the Package Manager runs pre and post scripts in the given repository
+func (pm PackageManager) runsPrePostScripts(repoRoot titanpath.AbsoluteSystemPath) bool {
+	if pm.readPrePostScriptsConfig != nil {
+		if runs, ok := pm.readPrePostScriptsConfig(repoRoot); ok {
+			return runs
+		}
+	}
+	return pm.RunsPrePostScripts
+}
+
+// ShellCommand returns a command that runs command through the shell that package managers
+// run scripts with, passing args to it.
+func ShellCommand(command string, args []string) *exec.Cmd {
+	for _, arg := range args {
+		command += " " + quoteShellArg(arg)
+	}
+	return shellCommand(command)
+}
+
+// getEnv returns the value of key in environ, if it is set
+func getEnv(environ []string, key string) (string, bool) {
+	for _, envVar := range environ {
+		i := strings.Index(envVar, "=")
+		if i > 0 && envKeysEqual(envVar[:i], key) {
+			return envVar[i+1:], true
+		}
+	}
+	return "", false
+}
+
+// setEnv returns a copy of environ in which key is set to value
+func setEnv(environ []string, key string, value string) []string {
+	updated := make([]string, 0, len(environ)+1)
+	for _, envVar := range environ {
+		i := strings.Index(envVar, "=")
+		if i > 0 && envKeysEqual(envVar[:i], key) {
+			continue
+		}
+		updated = append(updated, envVar)
+	}
+	return append(updated, key+"="+value)
+}
+
+// envKeysEqual accounts for environment variable names being case-insensitive on Windows
+func envKeysEqual(a string, b string) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// isSafeShellArg reports whether arg can be passed to a shell without quoting
+func isSafeShellArg(arg string) bool {
+	if arg == "" {
+		return false
+	}
+	for _, c := range arg {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_./:@=,+%"+string(filepath.Separator), c)) {
+			return false
+		}
+	}
+	return true
+}
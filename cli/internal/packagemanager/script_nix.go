@@ -0,0 +1,21 @@
+//go:build !windows
+// +build !windows
+
+package packagemanager
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// shellCommand runs script with sh, as npm does by default
+func shellCommand(script string) *exec.Cmd {
+	return exec.Command("sh", "-c", script)
+}
+
+func quoteShellArg(arg string) string {
+	if isSafeShellArg(arg) {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
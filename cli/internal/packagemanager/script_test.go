@@ -0,0 +1,100 @@
+package packagemanager
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+	"gotest.tools/v3/assert"
+)
+
+func Test_ScriptCommands(t *testing.T) {
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	pkg := &fs.PackageJSON{
+		Name:    "web",
+		Version: "1.0.0",
+		Dir:     titanpath.AnchoredUnixPath("apps/web").ToSystemPath(),
+		Scripts: map[string]string{
+			"prebuild":  "echo pre",
+			"build":     "next build",
+			"postbuild": "echo post",
+		},
+	}
+	environ := []string{"PATH=/usr/bin", "npm_package_name=other"}
+
+	cmds := nodejsNpm.ScriptCommands(repoRoot, pkg, "build", []string{"--debug"}, environ)
+	assert.Equal(t, len(cmds), 3)
+	wantDir := repoRoot.UntypedJoin("apps", "web").ToString()
+	for i, event := range []string{"prebuild", "build", "postbuild"} {
+		cmd := cmds[i]
+		assert.Equal(t, cmd.Dir, wantDir)
+		env := make(map[string]string)
+		for _, envVar := range cmd.Env {
+			parts := strings.SplitN(envVar, "=", 2)
+			env[parts[0]] = parts[1]
+		}
+		assert.Equal(t, env["npm_lifecycle_event"], event)
+		assert.Equal(t, env["npm_lifecycle_script"], pkg.Scripts[event])
+		assert.Equal(t, env["npm_package_name"], "web")
+		assert.Equal(t, env["npm_package_version"], "1.0.0")
+		assert.Equal(t, env["PATH"], strings.Join([]string{
+			filepath.Join(wantDir, "node_modules", ".bin"),
+			repoRoot.UntypedJoin("apps", "node_modules", ".bin").ToString(),
+			repoRoot.UntypedJoin("node_modules", ".bin").ToString(),
+			"/usr/bin",
+		}, string(os.PathListSeparator)))
+	}
+
+	// Package managers that don't run pre and post scripts only run the script itself
+	cmds = nodejsBerry.ScriptCommands(repoRoot, pkg, "build", nil, environ)
+	assert.Equal(t, len(cmds), 1)
+
+	assert.Assert(t, nodejsNpm.ScriptCommands(repoRoot, pkg, "missing", nil, environ) == nil)
+}
+
+func Test_ScriptCommandsPnpmPrePostScripts(t *testing.T) {
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	pkg := &fs.PackageJSON{
+		Name: "web",
+		Dir:  titanpath.AnchoredUnixPath("apps/web").ToSystemPath(),
+		Scripts: map[string]string{
+			"prebuild":  "echo pre",
+			"build":     "next build",
+			"postbuild": "echo post",
+		},
+	}
+	npmrc := repoRoot.UntypedJoin(".npmrc")
+	testCases := []struct {
+		name    string
+		npmrc   string
+		pnpm    int
+		pnpm6   int
+		noNpmrc bool
+	}{
+		{name: "no .npmrc", noNpmrc: true, pnpm: 1, pnpm6: 3},
+		{name: "unrelated settings", npmrc: "auto-install-peers=true\n", pnpm: 1, pnpm6: 3},
+		{name: "enable-pre-post-scripts", npmrc: "# run lifecycle scripts\nenable-pre-post-scripts = true\n", pnpm: 3, pnpm6: 3},
+		{name: "enable-pre-post-scripts is false", npmrc: "enable-pre-post-scripts=false\n", pnpm: 1, pnpm6: 3},
+		{name: "ignore-scripts", npmrc: "enable-pre-post-scripts=true\nignore-scripts=true\n", pnpm: 1, pnpm6: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.noNpmrc {
+				assert.NilError(t, npmrc.RemoveAll(), "RemoveAll")
+			} else {
+				assert.NilError(t, npmrc.WriteFile([]byte(tc.npmrc), 0644), "WriteFile")
+			}
+			assert.Equal(t, len(nodejsPnpm.ScriptCommands(repoRoot, pkg, "build", nil, nil)), tc.pnpm)
+			assert.Equal(t, len(nodejsPnpm6.ScriptCommands(repoRoot, pkg, "build", nil, nil)), tc.pnpm6)
+		})
+	}
+}
+
+func Test_QuoteShellArg(t *testing.T) {
+	assert.Equal(t, quoteShellArg("--filter=web"), "--filter=web")
+	assert.Assert(t, quoteShellArg("hello world") != "hello world")
+	assert.Assert(t, quoteShellArg("") != "")
+}
@@ -0,0 +1,33 @@
+//go:build windows
+// +build windows
+
+package packagemanager
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// shellCommand runs script with cmd.exe, as npm does by default. The script is passed
+// verbatim, since cmd.exe doesn't understand the escaping that exec.Command applies.
+func shellCommand(script string) *exec.Cmd {
+	comSpec := os.Getenv("ComSpec")
+	if comSpec == "" {
+		comSpec = "cmd.exe"
+	}
+	cmd := exec.Command(comSpec)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CmdLine: fmt.Sprintf(`%s /d /s /c "%s"`, syscall.EscapeArg(comSpec), script),
+	}
+	return cmd
+}
+
+func quoteShellArg(arg string) string {
+	if isSafeShellArg(arg) {
+		return arg
+	}
+	return `"` + strings.ReplaceAll(arg, `"`, `""`) + `"`
+}
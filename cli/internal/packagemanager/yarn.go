@@ -13,13 +13,14 @@ import (
 )
 
 var nodejsYarn = PackageManager{
-	Name:         "nodejs-yarn",
-	Slug:         "yarn",
-	Command:      "yarn",
-	Specfile:     "package.json",
-	Lockfile:     "yarn.lock",
-	PackageDir:   "node_modules",
-	ArgSeparator: []string{"--"},
+	Name:               "nodejs-yarn",
+	Slug:               "yarn",
+	Command:            "yarn",
+	Specfile:           "package.json",
+	Lockfile:           "yarn.lock",
+	PackageDir:         "node_modules",
+	ArgSeparator:       []string{"--"},
+	RunsPrePostScripts: true,
 
 	getWorkspaceGlobs: func(rootpath titanpath.AbsoluteSystemPath) ([]string, error) {
 		pkg, err := fs.ReadPackageJSON(rootpath.UntypedJoin("package.json"))
@@ -3,30 +3,42 @@ package prune
 import (
 	"bufio"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/khulnasoft/titanrepo/cli/internal/cmdutil"
 	"github.com/khulnasoft/titanrepo/cli/internal/context"
+	"github.com/khulnasoft/titanrepo/cli/internal/core"
 	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/hashing"
+	"github.com/khulnasoft/titanrepo/cli/internal/lockfile"
+	"github.com/khulnasoft/titanrepo/cli/internal/scm"
+	"github.com/khulnasoft/titanrepo/cli/internal/scope"
 	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
 	"github.com/khulnasoft/titanrepo/cli/internal/ui"
+	"github.com/khulnasoft/titanrepo/cli/internal/util"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 
-	"github.com/fatih/color"
 	"github.com/hashicorp/go-hclog"
 	"github.com/mitchellh/cli"
 	"github.com/pkg/errors"
+	"github.com/pyr-sh/dag"
 )
 
 type opts struct {
-	scope     string
-	docker    bool
-	outputDir string
+	scope      []string
+	docker     bool
+	production bool
+	tasks      []string
+	outputDir  string
 }
 
 func addPruneFlags(opts *opts, flags *pflag.FlagSet) {
-	flags.StringVar(&opts.scope, "scope", "", "Specify package to act as entry point for pruned monorepo (required).")
+	flags.StringArrayVar(&opts.scope, "scope", nil, "Specify package(s) to act as entry points for pruned monorepo (required). Supports filter syntax and can be specified multiple times.")
 	flags.BoolVar(&opts.docker, "docker", false, "Output pruned workspace into 'full' and 'json' directories optimized for Docker layer caching.")
+	flags.BoolVar(&opts.production, "production", false, "Leave out devDependencies, and the workspaces and packages only needed by them.")
+	flags.StringArrayVar(&opts.tasks, "task", nil, "Only copy the files matching the inputs of the given task(s), and the tasks they depend on, for the selected packages. Can be specified multiple times.")
 	flags.StringVar(&opts.outputDir, "out-dir", "out", "Set the root directory for files output by this command")
 	// No-op the cwd flag while the root level command is not yet cobra
 	_ = flags.String("cwd", "", "")
@@ -50,7 +62,7 @@ func GetCmd(helper *cmdutil.Helper) *cobra.Command {
 			if err != nil {
 				return err
 			}
-			if opts.scope == "" {
+			if len(opts.scope) == 0 {
 				err := errors.New("at least one target must be specified")
 				base.LogError(err.Error())
 				return err
@@ -59,7 +71,7 @@ func GetCmd(helper *cmdutil.Helper) *cobra.Command {
 				base,
 			}
 			if err := p.prune(opts); err != nil {
-				logError(p.base.Logger, p.base.UI, err)
+				p.base.LogError("%v", err)
 				return err
 			}
 			return nil
@@ -69,10 +81,222 @@ func GetCmd(helper *cmdutil.Helper) *cobra.Command {
 	return cmd
 }
 
-func logError(logger hclog.Logger, ui cli.Ui, err error) {
-	logger.Error(fmt.Sprintf("error: %v", err))
-	pref := color.New(color.Bold, color.FgRed, color.ReverseVideo).Sprint(" ERROR ")
-	ui.Error(fmt.Sprintf("%s%s", pref, color.RedString(" %v", err)))
+// resolveScopes returns the packages selected by the given --scope patterns, which use
+// filter syntax. Each pattern that selects packages must match at least one of them.
+func resolveScopes(patterns []string, repoRoot titanpath.AbsoluteSystemPath, ctx *context.Context, tui cli.Ui, logger hclog.Logger) (util.Set, error) {
+	scmInstance, err := scm.FromInRepo(repoRoot)
+	if err != nil && !errors.Is(err, scm.ErrFallback) {
+		return nil, errors.Wrap(err, "failed to create SCM")
+	}
+	resolve := func(patterns []string) (util.Set, error) {
+		selected, _, err := scope.ResolvePackages(&scope.Opts{FilterPatterns: patterns}, repoRoot.ToStringDuringMigration(), scmInstance, ctx, tui, logger)
+		if err != nil {
+			return nil, err
+		}
+		// Patterns such as * also match the root, which is always part of the pruned
+		// monorepo rather than a workspace in it
+		selected.Delete(util.RootPkgName)
+		return selected, nil
+	}
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			continue
+		}
+		matched, err := resolve([]string{pattern})
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid scope %v", pattern)
+		}
+		if matched.Len() == 0 {
+			return nil, errors.Errorf("invalid scope: no packages matched %v", pattern)
+		}
+	}
+	selected, err := resolve(patterns)
+	if err != nil {
+		return nil, err
+	}
+	if selected.Len() == 0 {
+		return nil, errors.Errorf("invalid scope: no packages matched %v", strings.Join(patterns, " "))
+	}
+	return selected, nil
+}
+
+// getTargets returns the workspaces to include in the pruned monorepo: the selected
+// packages, followed by the internal dependencies of any of them. For production, we
+// only follow dependencies and optionalDependencies.
+func getTargets(ctx *context.Context, selected util.Set, production bool) ([]string, error) {
+	targets := selected.UnsafeListOfStrings()
+	sort.Strings(targets)
+	internalDeps := make(util.Set)
+	if production {
+		queue := append([]string{}, targets...)
+		for len(queue) > 0 {
+			pkg := queue[0]
+			queue = queue[1:]
+			for _, dep := range context.ProductionInternalDeps(ctx.PackageInfos[pkg]) {
+				if !selected.Includes(dep) && !internalDeps.Includes(dep) {
+					internalDeps.Add(dep)
+					queue = append(queue, dep)
+				}
+			}
+		}
+	} else {
+		for _, pkg := range targets {
+			ancestors, err := ctx.TopologicalGraph.Ancestors(pkg)
+			if err != nil {
+				return nil, errors.Wrap(err, "could not traverse the dependency graph to find topological dependencies")
+			}
+			for _, dep := range ancestors.List() {
+				if dep != ctx.RootNode && !selected.Includes(dep) {
+					internalDeps.Add(dep)
+				}
+			}
+		}
+	}
+	deps := internalDeps.UnsafeListOfStrings()
+	sort.Strings(deps)
+	return append(targets, deps...), nil
+}
+
+// lockfileKeys returns the lockfile keys of the external dependencies of pkg, along
+// with everything they depend on
+func (p *prune) lockfileKeys(ctx *context.Context, pkg *fs.PackageJSON, production bool) ([]string, error) {
+	if !production {
+		return append([]string{}, pkg.TransitiveDeps...), nil
+	}
+	keys, err := ctx.ProductionTransitiveDeps(pkg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve production dependencies of %v", pkg.Name)
+	}
+	return keys, nil
+}
+
+// devOnlyDependencies returns the devDependencies of pkg that it doesn't also need in production
+func devOnlyDependencies(pkg *fs.PackageJSON) []string {
+	deps := []string{}
+	for dep := range pkg.DevDependencies {
+		_, isDependency := pkg.Dependencies[dep]
+		_, isOptionalDependency := pkg.OptionalDependencies[dep]
+		if !isDependency && !isOptionalDependency {
+			deps = append(deps, dep)
+		}
+	}
+	sort.Strings(deps)
+	return deps
+}
+
+// removeDevDependencies removes the devDependencies from pkg, so they aren't written out
+func removeDevDependencies(pkg *fs.PackageJSON) {
+	pkg.DevDependencies = nil
+	delete(pkg.RawJSON, "devDependencies")
+}
+
+// writeProductionPackageJSON writes the package.json at src to dest, without its devDependencies
+func writeProductionPackageJSON(src titanpath.AbsoluteSystemPath, dest titanpath.AbsoluteSystemPath) error {
+	pkg, err := fs.ReadPackageJSON(src)
+	if err != nil {
+		return err
+	}
+	removeDevDependencies(pkg)
+	contents, err := fs.MarshalPackageJSON(pkg)
+	if err != nil {
+		return err
+	}
+	info, err := src.Lstat()
+	if err != nil {
+		return err
+	}
+	return dest.WriteFile(contents, info.Mode())
+}
+
+// getTaskInputs returns the input globs of the tasks needed to run the given tasks in the selected
+// packages, keyed by workspace. Workspaces without any of those tasks are left out, and workspaces
+// with a task that doesn't specify inputs have a nil entry, since the task can read any file.
+func getTaskInputs(ctx *context.Context, pipeline fs.Pipeline, selected []string, tasks []string) (map[string][]string, error) {
+	for _, task := range tasks {
+		if !pipeline.HasTask(task) {
+			return nil, errors.Errorf("task %v is not defined in the pipeline in titan.json", task)
+		}
+	}
+	engine := core.NewEngine(&ctx.TopologicalGraph)
+	if err := engine.AddPipeline(pipeline); err != nil {
+		return nil, err
+	}
+	if err := engine.Prepare(&core.EngineExecutionOptions{
+		Packages:  selected,
+		TaskNames: tasks,
+	}); err != nil {
+		return nil, err
+	}
+
+	taskInputs := make(map[string][]string)
+	allFiles := make(util.Set)
+	for _, vertex := range engine.TaskGraph.Vertices() {
+		taskID := dag.VertexName(vertex)
+		if taskID == core.ROOT_NODE_NAME {
+			continue
+		}
+		pkg, task := util.GetPackageTaskFromId(taskID)
+		pkgJSON, ok := ctx.PackageInfos[pkg]
+		if !ok || pkg == util.RootPkgName {
+			continue
+		}
+		taskDefinition, ok := pipeline[taskID]
+		if !ok {
+			taskDefinition = pipeline[task]
+		}
+		// Tasks without a script or command don't run, so they don't need any files
+		if _, ok := pkgJSON.Scripts[task]; !ok && taskDefinition.Command == "" {
+			continue
+		}
+		if len(taskDefinition.Inputs) == 0 {
+			allFiles.Add(pkg)
+		}
+		taskInputs[pkg] = append(taskInputs[pkg], taskDefinition.Inputs...)
+	}
+	for _, inputs := range taskInputs {
+		sort.Strings(inputs)
+	}
+	for _, pkg := range allFiles.UnsafeListOfStrings() {
+		taskInputs[pkg] = nil
+	}
+	return taskInputs, nil
+}
+
+// copyInputs returns the input globs of the files to copy from the given workspace, or nil to
+// copy all of them. Only workspaces that run one of the tasks are narrowed down to the inputs of
+// those tasks. The others are copied in full, since dependents may use their source directly.
+func copyInputs(taskInputs map[string][]string, pkg string) []string {
+	inputs := taskInputs[pkg]
+	if len(inputs) > 0 {
+		// The workspace's titan.json configures its tasks
+		inputs = append(inputs, "titan.json")
+	}
+	return inputs
+}
+
+// workspaceFiles returns the files in the given workspace that git doesn't ignore, narrowed
+// down to the given input globs if any. If git is unavailable, it globs the filesystem instead.
+func (p *prune) workspaceFiles(dir titanpath.AnchoredSystemPath, inputs []string) ([]titanpath.AnchoredUnixPath, error) {
+	files, err := hashing.GetPackageFiles(p.base.RepoRoot, &hashing.PackageDepsOptions{
+		PackagePath:   dir,
+		InputPatterns: inputs,
+	})
+	if err == nil {
+		return files, nil
+	}
+	p.base.Logger.Warn(fmt.Sprintf("failed to list files in %v with git, copying every file instead: %v", dir, err))
+	if len(inputs) == 0 {
+		inputs = []string{"**"}
+	}
+	globbed, err := hashing.GlobPackageInputs(p.base.RepoRoot, dir, append(inputs, "package.json"))
+	if err != nil {
+		return nil, err
+	}
+	files = make([]titanpath.AnchoredUnixPath, len(globbed))
+	for i, file := range globbed {
+		files[i] = file.ToUnixPath()
+	}
+	return files, nil
 }
 
 type prune struct {
@@ -91,9 +315,13 @@ func (p *prune) prune(opts *opts) error {
 		return errors.Wrap(err, "could not construct graph")
 	}
 	p.base.Logger.Trace("scope", "value", opts.scope)
-	target, scopeIsValid := ctx.PackageInfos[opts.scope]
-	if !scopeIsValid {
-		return errors.Errorf("invalid scope: package %v not found", opts.scope)
+	selected, err := resolveScopes(opts.scope, p.base.RepoRoot, ctx, p.base.UI, p.base.Logger)
+	if err != nil {
+		return err
+	}
+	targets, err := getTargets(ctx, selected, opts.production)
+	if err != nil {
+		return err
 	}
 	outDir := p.base.RepoRoot.UntypedJoin(opts.outputDir)
 	fullDir := outDir
@@ -101,11 +329,10 @@ func (p *prune) prune(opts *opts) error {
 		fullDir = fullDir.UntypedJoin("full")
 	}
 
-	p.base.Logger.Trace("target", "value", target.Name)
-	p.base.Logger.Trace("directory", "value", target.Dir)
-	p.base.Logger.Trace("external deps", "value", target.UnresolvedExternalDeps)
-	p.base.Logger.Trace("internal deps", "value", target.InternalDeps)
+	p.base.Logger.Trace("selected", "value", selected.UnsafeListOfStrings())
+	p.base.Logger.Trace("targets", "value", targets)
 	p.base.Logger.Trace("docker", "value", opts.docker)
+	p.base.Logger.Trace("production", "value", opts.production)
 	p.base.Logger.Trace("out dir", "value", outDir.ToString())
 
 	canPrune, err := ctx.PackageManager.CanPrune(p.base.RepoRoot)
@@ -119,7 +346,9 @@ func (p *prune) prune(opts *opts) error {
 		return errors.New("Cannot prune without parsed lockfile")
 	}
 
-	p.base.UI.Output(fmt.Sprintf("Generating pruned monorepo for %v in %v", ui.Bold(opts.scope), ui.Bold(outDir.ToString())))
+	selectedNames := selected.UnsafeListOfStrings()
+	sort.Strings(selectedNames)
+	p.base.UI.Output(fmt.Sprintf("Generating pruned monorepo for %v in %v", ui.Bold(strings.Join(selectedNames, ", ")), ui.Bold(outDir.ToString())))
 
 	packageJSONPath := outDir.UntypedJoin("package.json")
 	if err := packageJSONPath.EnsureDir(); err != nil {
@@ -140,20 +369,34 @@ func (p *prune) prune(opts *opts) error {
 		}
 	}
 	workspaces := []titanpath.AnchoredSystemPath{}
-	targets := []interface{}{opts.scope}
-	internalDeps, err := ctx.TopologicalGraph.Ancestors(opts.scope)
-	if err != nil {
-		return errors.Wrap(err, "could find traverse the dependency graph to find topological dependencies")
+
+	var taskInputs map[string][]string
+	if len(opts.tasks) > 0 {
+		titanJSON, err := fs.LoadTurboConfig(p.base.RepoRoot, rootPackageJSON, false)
+		if err != nil {
+			return errors.Wrap(err, "failed to read titan.json")
+		}
+		pipeline, err := titanJSON.WithWorkspaceConfigs(p.base.RepoRoot, ctx.PackageInfos)
+		if err != nil {
+			return errors.Wrap(err, "failed to read workspace titan.json")
+		}
+		taskInputs, err = getTaskInputs(ctx, pipeline, selectedNames, opts.tasks)
+		if err != nil {
+			return err
+		}
 	}
-	targets = append(targets, internalDeps.List()...)
 
-	lockfileKeys := make([]string, 0, len(rootPackageJSON.TransitiveDeps))
-	lockfileKeys = append(lockfileKeys, rootPackageJSON.TransitiveDeps...)
+	lockfileKeys, err := p.lockfileKeys(ctx, rootPackageJSON, opts.production)
+	if err != nil {
+		return err
+	}
+	// devDependencies is the devDependencies we leave out of each workspace, keyed by path
+	devDependencies := make(map[titanpath.AnchoredUnixPath][]string)
+	if opts.production {
+		devDependencies[""] = devOnlyDependencies(rootPackageJSON)
+	}
 
 	for _, internalDep := range targets {
-		if internalDep == ctx.RootNode {
-			continue
-		}
 		workspaces = append(workspaces, ctx.PackageInfos[internalDep].Dir)
 		originalDir := ctx.PackageInfos[internalDep].Dir.RestoreAnchor(p.base.RepoRoot)
 		info, err := originalDir.Lstat()
@@ -165,26 +408,57 @@ func (p *prune) prune(opts *opts) error {
 			return errors.Wrapf(err, "failed to create folder %s for %v", targetDir, internalDep)
 		}
 
-		if err := fs.RecursiveCopy(ctx.PackageInfos[internalDep].Dir.ToStringDuringMigration(), targetDir.ToStringDuringMigration()); err != nil {
-			return errors.Wrapf(err, "failed to copy %v into %v", internalDep, targetDir)
+		files, err := p.workspaceFiles(ctx.PackageInfos[internalDep].Dir, copyInputs(taskInputs, internalDep))
+		if err != nil {
+			return errors.Wrapf(err, "failed to find files to copy for %v", internalDep)
+		}
+		for _, file := range files {
+			// Inputs can reach outside of the workspace, but we only copy the workspace itself
+			if strings.HasPrefix(file.ToString(), "../") {
+				continue
+			}
+			src := fs.LstatCachedFile{Path: originalDir.UntypedJoin(file.ToSystemPath().ToString())}
+			if err := fs.CopyFile(&src, targetDir.UntypedJoin(file.ToSystemPath().ToString()).ToStringDuringMigration()); err != nil {
+				return errors.Wrapf(err, "failed to copy %v into %v", file, targetDir)
+			}
+		}
+		// The package.json in the full directory is the one to use from here on, since we may rewrite it
+		packageJSONPath := ctx.PackageInfos[internalDep].PackageJSONPath.RestoreAnchor(fullDir)
+		if opts.production {
+			if err := writeProductionPackageJSON(ctx.PackageInfos[internalDep].PackageJSONPath.RestoreAnchor(p.base.RepoRoot), packageJSONPath); err != nil {
+				return errors.Wrapf(err, "failed to remove devDependencies from %v", packageJSONPath)
+			}
+			devDependencies[ctx.PackageInfos[internalDep].Dir.ToUnixPath()] = devOnlyDependencies(ctx.PackageInfos[internalDep])
 		}
 		if opts.docker {
 			jsonDir := outDir.UntypedJoin("json", ctx.PackageInfos[internalDep].PackageJSONPath.ToStringDuringMigration())
 			if err := jsonDir.EnsureDir(); err != nil {
 				return errors.Wrapf(err, "failed to create folder %v for %v", jsonDir, internalDep)
 			}
-			if err := fs.RecursiveCopy(ctx.PackageInfos[internalDep].PackageJSONPath.ToStringDuringMigration(), jsonDir.ToStringDuringMigration()); err != nil {
+			if err := fs.RecursiveCopy(packageJSONPath.ToStringDuringMigration(), jsonDir.ToStringDuringMigration()); err != nil {
 				return errors.Wrapf(err, "failed to copy %v into %v", internalDep, jsonDir)
 			}
 		}
 
-		lockfileKeys = append(lockfileKeys, ctx.PackageInfos[internalDep].TransitiveDeps...)
+		keys, err := p.lockfileKeys(ctx, ctx.PackageInfos[internalDep], opts.production)
+		if err != nil {
+			return err
+		}
+		lockfileKeys = append(lockfileKeys, keys...)
 
 		p.base.UI.Output(fmt.Sprintf(" - Added %v", ctx.PackageInfos[internalDep].Name))
 	}
 	p.base.Logger.Trace("new workspaces", "value", workspaces)
 
-	lockfile, err := ctx.Lockfile.Subgraph(workspaces, lockfileKeys)
+	fullLockfile := ctx.Lockfile
+	if pruner, ok := fullLockfile.(lockfile.DevDependencyPruner); ok && opts.production {
+		// The lockfile must agree with the package.json files we wrote without devDependencies
+		fullLockfile, err = pruner.WithoutDevDependencies(devDependencies)
+		if err != nil {
+			return errors.Wrap(err, "Failed removing devDependencies from lockfile")
+		}
+	}
+	lockfile, err := fullLockfile.Subgraph(workspaces, lockfileKeys)
 	if err != nil {
 		return errors.Wrap(err, "Failed creating pruned lockfile")
 	}
@@ -204,6 +478,26 @@ func (p *prune) prune(opts *opts) error {
 		return errors.Wrap(err, "Failed to flush pruned lockfile")
 	}
 
+	pruneFiles, err := ctx.PackageManager.GetPruneFiles(p.base.RepoRoot, lockfile)
+	if err != nil {
+		return errors.Wrap(err, "Failed finding package manager files")
+	}
+	for _, file := range pruneFiles {
+		originalFile := fs.LstatCachedFile{Path: p.base.RepoRoot.UntypedJoin(file.ToString())}
+		if err := fs.CopyFile(&originalFile, fullDir.UntypedJoin(file.ToString()).ToStringDuringMigration()); err != nil {
+			return errors.Wrapf(err, "Failed copying %v", file)
+		}
+		if opts.docker {
+			if err := fs.CopyFile(&originalFile, outDir.UntypedJoin("json", file.ToString()).ToStringDuringMigration()); err != nil {
+				return errors.Wrapf(err, "Failed copying %v", file)
+			}
+		}
+	}
+	// The Plug'n'Play loader describes every package in the original monorepo, so it has to be regenerated
+	if p.base.RepoRoot.UntypedJoin(".pnp.cjs").FileExists() {
+		p.base.UI.Output(fmt.Sprintf("Run %v in %v to generate .pnp.cjs for the pruned monorepo", ui.Bold(ctx.PackageManager.Command+" install"), ui.Bold(fullDir.ToString())))
+	}
+
 	if fs.FileExists(".gitignore") {
 		if err := fs.CopyFile(&fs.LstatCachedFile{Path: p.base.RepoRoot.UntypedJoin(".gitignore")}, fullDir.UntypedJoin(".gitignore").ToStringDuringMigration()); err != nil {
 			return errors.Wrap(err, "failed to copy root .gitignore")
@@ -219,11 +513,18 @@ func (p *prune) prune(opts *opts) error {
 	originalPackageJSON := fs.LstatCachedFile{Path: p.base.RepoRoot.UntypedJoin("package.json")}
 	newPackageJSONPath := fullDir.UntypedJoin("package.json")
 	// If the original lockfile uses any patches we rewrite the package.json to make sure it doesn't
-	// include any patches that might have been pruned.
-	if originalPatches := ctx.Lockfile.Patches(); originalPatches != nil {
-		patches := lockfile.Patches()
-		if err := ctx.PackageManager.PrunePatchedPackages(rootPackageJSON, patches); err != nil {
-			return errors.Wrapf(err, "Unable to prune patches section of %s", rootPackageJSONPath)
+	// include any patches that might have been pruned. For production, we also drop devDependencies.
+	originalPatches := ctx.Lockfile.Patches()
+	if originalPatches != nil || opts.production {
+		var patches []titanpath.AnchoredUnixPath
+		if originalPatches != nil {
+			patches = lockfile.Patches()
+			if err := ctx.PackageManager.PrunePatchedPackages(rootPackageJSON, patches); err != nil {
+				return errors.Wrapf(err, "Unable to prune patches section of %s", rootPackageJSONPath)
+			}
+		}
+		if opts.production {
+			removeDevDependencies(rootPackageJSON)
 		}
 		packageJSONContent, err := fs.MarshalPackageJSON(rootPackageJSON)
 		if err != nil {
@@ -0,0 +1,177 @@
+package prune
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/khulnasoft/titanrepo/cli/internal/cmdutil"
+	"github.com/khulnasoft/titanrepo/cli/internal/context"
+	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupRepo(t *testing.T) (titanpath.AbsoluteSystemPath, *context.Context) {
+	t.Helper()
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	writeFile := func(path string, contents string) {
+		t.Helper()
+		file := repoRoot.UntypedJoin(path)
+		assert.NoError(t, file.EnsureDir())
+		assert.NoError(t, file.WriteFile([]byte(contents), 0644))
+	}
+	writeFile("package.json", `{"name": "root", "packageManager": "npm@8.19.2", "workspaces": ["apps/*", "packages/*"]}`)
+	writeFile("apps/api/package.json", `{"name": "api", "scripts": {"build": "tsc", "test": "jest"}, "dependencies": {"db": "*", "logger": "*"}}`)
+	writeFile("apps/worker/package.json", `{"name": "worker", "dependencies": {"db": "*"}, "devDependencies": {"test-utils": "*"}}`)
+	writeFile("apps/web/package.json", `{"name": "web", "dependencies": {"ui": "*"}}`)
+	writeFile("packages/db/package.json", `{"name": "db", "scripts": {"build": "tsc"}, "dependencies": {"logger": "*"}}`)
+	writeFile("packages/logger/package.json", `{"name": "logger", "scripts": {"build": "tsc"}}`)
+	writeFile("packages/ui/package.json", `{"name": "ui"}`)
+	writeFile("packages/test-utils/package.json", `{"name": "test-utils", "dependencies": {"ui": "*"}}`)
+
+	rootPackageJSON, err := fs.ReadPackageJSON(repoRoot.UntypedJoin("package.json"))
+	assert.NoError(t, err)
+	ctx, err := context.BuildPackageGraph(repoRoot, rootPackageJSON)
+	if ctx == nil {
+		t.Fatalf("failed to build package graph: %v", err)
+	}
+	return repoRoot, ctx
+}
+
+func Test_MultipleScopes(t *testing.T) {
+	repoRoot, ctx := setupRepo(t)
+
+	testCases := []struct {
+		name       string
+		scopes     []string
+		production bool
+		expected   []string
+	}{
+		{
+			name:     "single package",
+			scopes:   []string{"web"},
+			expected: []string{"web", "ui"},
+		},
+		{
+			name:     "multiple packages share dependencies",
+			scopes:   []string{"api", "worker"},
+			expected: []string{"api", "worker", "db", "logger", "test-utils", "ui"},
+		},
+		{
+			name:       "production leaves out devDependencies",
+			scopes:     []string{"api", "worker"},
+			production: true,
+			expected:   []string{"api", "worker", "db", "logger"},
+		},
+		{
+			name:     "selected dependencies are listed once",
+			scopes:   []string{"api", "db"},
+			expected: []string{"api", "db", "logger"},
+		},
+		{
+			name:     "wildcard leaves out the root",
+			scopes:   []string{"*"},
+			expected: []string{"api", "db", "logger", "test-utils", "ui", "web", "worker"},
+		},
+		{
+			name:     "filter syntax",
+			scopes:   []string{"./apps/*", "!web"},
+			expected: []string{"api", "worker", "db", "logger", "test-utils", "ui"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			selected, err := resolveScopes(tc.scopes, repoRoot, ctx, cli.NewMockUi(), hclog.NewNullLogger())
+			assert.NoError(t, err)
+			targets, err := getTargets(ctx, selected, tc.production)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, targets)
+		})
+	}
+}
+
+func Test_InvalidScope(t *testing.T) {
+	repoRoot, ctx := setupRepo(t)
+
+	_, err := resolveScopes([]string{"api", "not-a-package"}, repoRoot, ctx, cli.NewMockUi(), hclog.NewNullLogger())
+	assert.EqualError(t, err, "invalid scope: no packages matched not-a-package")
+
+	_, err = resolveScopes([]string{"//"}, repoRoot, ctx, cli.NewMockUi(), hclog.NewNullLogger())
+	assert.EqualError(t, err, "invalid scope: no packages matched //")
+}
+
+func Test_TaskInputs(t *testing.T) {
+	_, ctx := setupRepo(t)
+	pipeline := fs.Pipeline{
+		"build": fs.TaskDefinition{
+			TopologicalDependencies: []string{"build"},
+			Inputs:                  []string{"src/**"},
+		},
+		"logger#build": fs.TaskDefinition{},
+		"test": fs.TaskDefinition{
+			TaskDependencies: []string{"build"},
+			Inputs:           []string{"test/**", "jest.config.js"},
+		},
+	}
+
+	taskInputs, err := getTaskInputs(ctx, pipeline, []string{"api"}, []string{"test"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"api":    {"jest.config.js", "src/**", "test/**"},
+		"db":     {"src/**"},
+		"logger": nil,
+	}, taskInputs)
+
+	// worker has no build script, and ui isn't needed to build web
+	taskInputs, err = getTaskInputs(ctx, pipeline, []string{"worker", "web"}, []string{"build"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"db":     {"src/**"},
+		"logger": nil,
+	}, taskInputs)
+
+	// worker's build command comes from titan.json
+	pipeline["worker#build"] = fs.TaskDefinition{
+		TopologicalDependencies: []string{"build"},
+		Inputs:                  []string{"build.js"},
+		Command:                 "node build.js",
+	}
+	taskInputs, err = getTaskInputs(ctx, pipeline, []string{"worker"}, []string{"build"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"worker": {"build.js"},
+		"db":     {"src/**"},
+		"logger": nil,
+	}, taskInputs)
+
+	_, err = getTaskInputs(ctx, pipeline, []string{"api"}, []string{"lint"})
+	assert.EqualError(t, err, "task lint is not defined in the pipeline in titan.json")
+}
+
+func Test_TaskInputsSourceOnlyDependency(t *testing.T) {
+	repoRoot, ctx := setupRepo(t)
+	for _, file := range []string{"packages/ui/src/button.tsx", "packages/db/src/client.ts", "packages/db/README.md"} {
+		path := repoRoot.UntypedJoin(file)
+		assert.NoError(t, path.EnsureDir())
+		assert.NoError(t, path.WriteFile([]byte(""), 0644))
+	}
+	pipeline := fs.Pipeline{
+		"build": fs.TaskDefinition{
+			TopologicalDependencies: []string{"build"},
+			Inputs:                  []string{"src/**"},
+		},
+	}
+	taskInputs, err := getTaskInputs(ctx, pipeline, []string{"web", "db"}, []string{"build"})
+	assert.NoError(t, err)
+
+	p := &prune{base: &cmdutil.CmdBase{RepoRoot: repoRoot, Logger: hclog.NewNullLogger()}}
+	// ui doesn't build, but web bundles its source
+	files, err := p.workspaceFiles(ctx.PackageInfos["ui"].Dir, copyInputs(taskInputs, "ui"))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []titanpath.AnchoredUnixPath{"package.json", "src/button.tsx"}, files)
+
+	files, err = p.workspaceFiles(ctx.PackageInfos["db"].Dir, copyInputs(taskInputs, "db"))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []titanpath.AnchoredUnixPath{"package.json", "src/client.ts"}, files)
+}
@@ -0,0 +1,80 @@
+package run
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/core"
+	"github.com/khulnasoft/titanrepo/cli/internal/doublestar"
+	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+	"github.com/khulnasoft/titanrepo/cli/internal/util"
+	"github.com/pkg/errors"
+	"github.com/pyr-sh/dag"
+)
+
+// getAffectedTasks returns the tasks in the task graph that have at least one changed file
+// among their inputs. changedFiles are anchored at the repository root.
+func getAffectedTasks(taskGraph *dag.AcyclicGraph, pipeline fs.Pipeline, packageInfos map[interface{}]*fs.PackageJSON, changedFiles []titanpath.AnchoredUnixPath) (util.Set, error) {
+	affected := make(util.Set)
+	if len(changedFiles) == 0 {
+		return affected, nil
+	}
+	for _, v := range taskGraph.Vertices() {
+		taskID := dag.VertexName(v)
+		if strings.Contains(taskID, core.ROOT_NODE_NAME) {
+			continue
+		}
+		pkgName, _ := util.GetPackageTaskFromId(taskID)
+		pkg, ok := packageInfos[pkgName]
+		if !ok {
+			return nil, fmt.Errorf("missing package %v for task %v", pkgName, taskID)
+		}
+		pkgDir := titanpath.AnchoredUnixPath("")
+		if pkgName != util.RootPkgName {
+			pkgDir = pkg.Dir.ToUnixPath()
+		}
+		taskDefinition, ok := pipeline.GetTaskDefinition(taskID)
+		if !ok {
+			return nil, fmt.Errorf("missing pipeline entry %v", taskID)
+		}
+		isAffected, err := inputsIncludeChanges(pkgDir, taskDefinition.Inputs, changedFiles)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to match changed files against inputs of %v", taskID)
+		}
+		if isAffected {
+			affected.Add(taskID)
+		}
+	}
+	return affected, nil
+}
+
+// inputsIncludeChanges returns true if any of the changed files would be hashed as an input of
+// a task in the package at pkgDir. No inputs means every file in the package is an input.
+// Otherwise, package.json is always an input, since it contains the scripts that we execute, as
+// is the package's titan.json, which configures its tasks. As with GlobPackageInputs, inputs
+// are relative to the package, and may reach outside of it.
+func inputsIncludeChanges(pkgDir titanpath.AnchoredUnixPath, inputs []string, changedFiles []titanpath.AnchoredUnixPath) (bool, error) {
+	if len(inputs) == 0 {
+		inputs = []string{"**"}
+	} else {
+		inputs = append([]string{"package.json", "titan.json"}, inputs...)
+	}
+	patterns := make([]string, len(inputs))
+	for i, input := range inputs {
+		patterns[i] = path.Join(pkgDir.ToString(), input)
+	}
+	for _, file := range changedFiles {
+		for _, pattern := range patterns {
+			matches, err := doublestar.Match(pattern, file.ToString())
+			if err != nil {
+				return false, err
+			}
+			if matches {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,145 @@
+package run
+
+import (
+	"testing"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+	"github.com/khulnasoft/titanrepo/cli/internal/util"
+	"github.com/pyr-sh/dag"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_getAffectedTasks(t *testing.T) {
+	taskGraph := &dag.AcyclicGraph{}
+	taskGraph.Add("___ROOT___")
+	taskGraph.Add("web#build")
+	taskGraph.Add("web#lint")
+	taskGraph.Add("docs#build")
+	taskGraph.Add("ui#build")
+	taskGraph.Add("ui#typecheck")
+	taskGraph.Add("//#format")
+	pipeline := fs.Pipeline{
+		"build": fs.TaskDefinition{
+			Inputs: []string{"src/**"},
+		},
+		"lint": fs.TaskDefinition{},
+		"docs#build": fs.TaskDefinition{
+			Inputs: []string{"content/**/*.md"},
+		},
+		"typecheck": fs.TaskDefinition{
+			Inputs: []string{"src/**", "../../tsconfig.base.json"},
+		},
+		"//#format": fs.TaskDefinition{
+			Inputs: []string{"scripts/**"},
+		},
+	}
+	packageInfos := map[interface{}]*fs.PackageJSON{
+		util.RootPkgName: {},
+		"web":            {Dir: titanpath.AnchoredUnixPath("apps/web").ToSystemPath()},
+		"docs":           {Dir: titanpath.AnchoredUnixPath("apps/docs").ToSystemPath()},
+		"ui":             {Dir: titanpath.AnchoredUnixPath("packages/ui").ToSystemPath()},
+	}
+
+	testCases := []struct {
+		name     string
+		changed  []titanpath.AnchoredUnixPath
+		expected []string
+	}{
+		{
+			// web#build does not include README.md in its inputs, but web#lint hashes everything
+			name:     "changes within packages",
+			changed:  []titanpath.AnchoredUnixPath{"apps/web/README.md", "apps/docs/content/intro.md", "packages/ui/package.json"},
+			expected: []string{"web#lint", "docs#build", "ui#build", "ui#typecheck"},
+		},
+		{
+			name:     "inputs outside of the package",
+			changed:  []titanpath.AnchoredUnixPath{"tsconfig.base.json"},
+			expected: []string{"ui#typecheck"},
+		},
+		{
+			name:     "root package inputs",
+			changed:  []titanpath.AnchoredUnixPath{"scripts/release.sh"},
+			expected: []string{"//#format"},
+		},
+		{
+			name:     "nothing changed",
+			changed:  []titanpath.AnchoredUnixPath{},
+			expected: []string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			affected, err := getAffectedTasks(taskGraph, pipeline, packageInfos, tc.changed)
+			assert.NoError(t, err, "getAffectedTasks")
+			assert.Equal(t, util.SetFromStrings(tc.expected), affected)
+		})
+	}
+}
+
+func Test_inputsIncludeChanges(t *testing.T) {
+	testCases := []struct {
+		name     string
+		pkgDir   titanpath.AnchoredUnixPath
+		inputs   []string
+		changed  []titanpath.AnchoredUnixPath
+		expected bool
+	}{
+		{
+			name:     "no inputs includes every file in the package",
+			pkgDir:   "packages/ui",
+			inputs:   nil,
+			changed:  []titanpath.AnchoredUnixPath{"packages/ui/README.md"},
+			expected: true,
+		},
+		{
+			name:     "no inputs excludes files outside of the package",
+			pkgDir:   "packages/ui",
+			inputs:   nil,
+			changed:  []titanpath.AnchoredUnixPath{"packages/ui-kit/README.md", "README.md"},
+			expected: false,
+		},
+		{
+			name:     "no inputs in the root package includes every file",
+			pkgDir:   "",
+			inputs:   nil,
+			changed:  []titanpath.AnchoredUnixPath{"packages/ui/README.md"},
+			expected: true,
+		},
+		{
+			name:     "changed file outside of inputs",
+			pkgDir:   "packages/ui",
+			inputs:   []string{"src/**/*.ts"},
+			changed:  []titanpath.AnchoredUnixPath{"packages/ui/README.md", "packages/ui/test/index.test.ts", "src/index.ts"},
+			expected: false,
+		},
+		{
+			name:     "changed file inside of inputs",
+			pkgDir:   "packages/ui",
+			inputs:   []string{"src/**/*.ts"},
+			changed:  []titanpath.AnchoredUnixPath{"packages/ui/README.md", "packages/ui/src/lib/index.ts"},
+			expected: true,
+		},
+		{
+			name:     "package.json is always an input",
+			pkgDir:   "packages/ui",
+			inputs:   []string{"src/**/*.ts"},
+			changed:  []titanpath.AnchoredUnixPath{"packages/ui/package.json"},
+			expected: true,
+		},
+		{
+			name:     "inputs in a sibling package",
+			pkgDir:   "packages/ui",
+			inputs:   []string{"src/**", "../shared/**"},
+			changed:  []titanpath.AnchoredUnixPath{"packages/shared/index.ts"},
+			expected: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := inputsIncludeChanges(tc.pkgDir, tc.inputs, tc.changed)
+			assert.NoError(t, err, "inputsIncludeChanges")
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/khulnasoft/titanrepo/cli/internal/env"
 	"github.com/khulnasoft/titanrepo/cli/internal/fs"
 	"github.com/khulnasoft/titanrepo/cli/internal/globby"
 	"github.com/khulnasoft/titanrepo/cli/internal/hashing"
@@ -24,7 +25,15 @@ var _defaultEnvVars = []string{
 	"KHULNASOFT_ANALYTICS_ID",
 }
 
-func calculateGlobalHash(rootpath titanpath.AbsoluteSystemPath, rootPackageJSON *fs.PackageJSON, pipeline fs.Pipeline, envVarDependencies []string, globalFileDependencies []string, packageManager *packagemanager.PackageManager, lockFile lockfile.Lockfile, logger hclog.Logger, env []string) (string, error) {
+type globalHashInputs struct {
+	globalFileHashMap    map[titanpath.AnchoredUnixPath]string
+	rootExternalDepsHash string
+	hashedSortedEnvPairs []string
+	globalCacheKey       string
+	pipeline             map[string]interface{}
+}
+
+func calculateGlobalHash(rootpath titanpath.AbsoluteSystemPath, rootPackageJSON *fs.PackageJSON, pipeline fs.Pipeline, envVarDependencies []string, dotEnvVars map[string]string, globalFileDependencies []string, packageManager *packagemanager.PackageManager, lockFile lockfile.Lockfile, logger hclog.Logger, environ []string) (string, error) {
 	// Calculate env var dependencies
 	globalHashableEnvNames := []string{}
 	globalHashableEnvPairs := []string{}
@@ -34,9 +43,9 @@ func calculateGlobalHash(rootpath titanpath.AbsoluteSystemPath, rootPackageJSON
 	}
 
 	// Calculate global env var dependencies
-	for _, v := range envVarDependencies {
-		globalHashableEnvNames = append(globalHashableEnvNames, v)
-		globalHashableEnvPairs = append(globalHashableEnvPairs, fmt.Sprintf("%v=%v", v, os.Getenv(v)))
+	for _, pair := range env.GetHashableEnvPairs(envVarDependencies, nil) {
+		globalHashableEnvNames = append(globalHashableEnvNames, strings.SplitN(pair, "=", 2)[0])
+		globalHashableEnvPairs = append(globalHashableEnvPairs, pair)
 	}
 
 	// Calculate global file dependencies
@@ -59,7 +68,7 @@ func calculateGlobalHash(rootpath titanpath.AbsoluteSystemPath, rootPackageJSON
 
 	// get system env vars for hashing purposes, these include any variable that includes "TITAN"
 	// that is NOT TITAN_TOKEN or TITAN_TEAM or TITAN_BINARY_PATH.
-	names, pairs := getHashableTurboEnvVarsFromOs(env)
+	names, pairs := getHashableTurboEnvVarsFromOs(environ)
 	globalHashableEnvNames = append(globalHashableEnvNames, names...)
 	globalHashableEnvPairs = append(globalHashableEnvPairs, pairs...)
 	// sort them for consistent hashing
@@ -84,20 +93,22 @@ func calculateGlobalHash(rootpath titanpath.AbsoluteSystemPath, rootPackageJSON
 	if err != nil {
 		return "", fmt.Errorf("error hashing files: %w", err)
 	}
-	globalHashable := struct {
-		globalFileHashMap    map[titanpath.AnchoredUnixPath]string
-		rootExternalDepsHash string
-		hashedSortedEnvPairs []string
-		globalCacheKey       string
-		pipeline             fs.Pipeline
-	}{
+	globalHashable := globalHashInputs{
 		globalFileHashMap:    globalFileHashMap,
 		rootExternalDepsHash: rootPackageJSON.ExternalDepsHash,
 		hashedSortedEnvPairs: globalHashableEnvPairs,
 		globalCacheKey:       _globalCacheKey,
-		pipeline:             pipeline,
+		pipeline:             pipeline.Hashable(),
+	}
+	var hashable interface{} = globalHashable
+	// Only hashed when there are any, so that repositories without globalDotEnv keep their hashes
+	if dotEnvPairs := env.GetDotEnvPairs(dotEnvVars); len(dotEnvPairs) > 0 {
+		hashable = struct {
+			inputs      globalHashInputs
+			dotEnvPairs []string
+		}{globalHashable, dotEnvPairs}
 	}
-	globalHash, err := fs.HashObject(globalHashable)
+	globalHash, err := fs.HashObject(hashable)
 	if err != nil {
 		return "", fmt.Errorf("error hashing global dependencies %w", err)
 	}
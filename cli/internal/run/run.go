@@ -24,8 +24,11 @@ import (
 	"github.com/khulnasoft/titanrepo/cli/internal/core"
 	"github.com/khulnasoft/titanrepo/cli/internal/daemon"
 	"github.com/khulnasoft/titanrepo/cli/internal/daemonclient"
+	"github.com/khulnasoft/titanrepo/cli/internal/env"
 	"github.com/khulnasoft/titanrepo/cli/internal/fs"
 	"github.com/khulnasoft/titanrepo/cli/internal/graphvisualizer"
+	"github.com/khulnasoft/titanrepo/cli/internal/hashing"
+	"github.com/khulnasoft/titanrepo/cli/internal/inference"
 	"github.com/khulnasoft/titanrepo/cli/internal/logstreamer"
 	"github.com/khulnasoft/titanrepo/cli/internal/nodes"
 	"github.com/khulnasoft/titanrepo/cli/internal/packagemanager"
@@ -44,6 +47,7 @@ import (
 	"github.com/spf13/pflag"
 
 	"github.com/fatih/color"
+	"github.com/google/uuid"
 	"github.com/hashicorp/go-hclog"
 	"github.com/mitchellh/cli"
 	"github.com/pkg/errors"
@@ -53,10 +57,21 @@ import (
 // It is not intended to include information specific to a particular run.
 type completeGraph struct {
 	TopologicalGraph dag.AcyclicGraph
-	Pipeline         fs.Pipeline
-	PackageInfos     map[interface{}]*fs.PackageJSON
-	GlobalHash       string
-	RootNode         string
+	// Pipeline includes the overrides from the titan.json of each workspace, which
+	// RootPipeline, from the root titan.json, does not
+	Pipeline     fs.Pipeline
+	RootPipeline fs.Pipeline
+	PackageInfos map[interface{}]*fs.PackageJSON
+	GlobalHash   string
+	RootNode     string
+	SCM          scm.SCM
+	// GlobalEnv and GlobalPassThroughEnv are passed to every task in strict env mode
+	GlobalEnv            []string
+	GlobalPassThroughEnv []string
+	// GlobalDotEnv holds the variables read from the global .env files
+	GlobalDotEnv map[string]string
+	// Frameworks holds the frameworks declared in titan.json
+	Frameworks []inference.Framework
 }
 
 // runSpec contains the run-specific configuration elements that come from a particular
@@ -65,6 +80,11 @@ type runSpec struct {
 	Targets      []string
 	FilteredPkgs util.Set
 	Opts         *Opts
+	// AffectedFiles holds the changed files, anchored at the repository root, when running
+	// with --affected. If nil, every task in scope runs.
+	AffectedFiles []titanpath.AnchoredUnixPath
+	// EnvMode determines which environment variables are passed to tasks
+	EnvMode util.EnvMode
 }
 
 func (rs *runSpec) ArgsForTask(task string) []string {
@@ -191,11 +211,26 @@ func (r *run) run(ctx gocontext.Context, targets []string) error {
 	// TODO: these values come from a config file, hopefully viper can help us merge these
 	r.opts.cacheOpts.RemoteCacheOpts = titanJSON.RemoteCacheOptions
 
+	var daemonClient *daemonclient.DaemonClient
+	if ui.IsCI && !r.opts.runOpts.noDaemon {
+		r.base.Logger.Info("skipping titand since we appear to be in a non-interactive context")
+	} else if !r.opts.runOpts.noDaemon {
+		titandClient, err := daemon.GetClient(ctx, r.base.RepoRoot, r.base.Logger, r.base.TurboVersion, daemon.ClientOpts{})
+		if err != nil {
+			r.base.LogWarning("", errors.Wrap(err, "failed to contact titand. Continuing in standalone mode"))
+		} else {
+			defer func() { _ = titandClient.Close() }()
+			r.base.Logger.Debug("running in daemon mode")
+			daemonClient = daemonclient.New(titandClient)
+			r.opts.runcacheOpts.OutputWatcher = daemonClient
+		}
+	}
+
 	var pkgDepGraph *context.Context
 	if r.opts.runOpts.singlePackage {
 		pkgDepGraph, err = context.SinglePackageGraph(r.base.RepoRoot, rootPackageJSON)
 	} else {
-		pkgDepGraph, err = context.BuildPackageGraph(r.base.RepoRoot, rootPackageJSON)
+		pkgDepGraph, err = r.buildPackageGraph(ctx, daemonClient, rootPackageJSON)
 	}
 	if err != nil {
 		var warnings *context.Warnings
@@ -205,25 +240,24 @@ func (r *run) run(ctx gocontext.Context, targets []string) error {
 			return err
 		}
 	}
-	if ui.IsCI && !r.opts.runOpts.noDaemon {
-		r.base.Logger.Info("skipping titand since we appear to be in a non-interactive context")
-	} else if !r.opts.runOpts.noDaemon {
-		titandClient, err := daemon.GetClient(ctx, r.base.RepoRoot, r.base.Logger, r.base.TurboVersion, daemon.ClientOpts{})
-		if err != nil {
-			r.base.LogWarning("", errors.Wrap(err, "failed to contact titand. Continuing in standalone mode"))
-		} else {
-			defer func() { _ = titandClient.Close() }()
-			r.base.Logger.Debug("running in daemon mode")
-			daemonClient := daemonclient.New(titandClient)
-			r.opts.runcacheOpts.OutputWatcher = daemonClient
-		}
-	}
 
 	if err := util.ValidateGraph(&pkgDepGraph.TopologicalGraph); err != nil {
 		return errors.Wrap(err, "Invalid package dependency graph")
 	}
 
+	for _, warning := range titanJSON.Warnings() {
+		r.base.LogWarning("", errors.New(warning.String()))
+	}
 	pipeline := titanJSON.Pipeline
+	if !r.opts.runOpts.singlePackage {
+		pipeline, err = titanJSON.WithWorkspaceConfigs(r.base.RepoRoot, pkgDepGraph.PackageInfos)
+		if err != nil {
+			return err
+		}
+		if diagnostics := titanJSON.Validate(pipeline, pkgDepGraph.PackageInfos); len(diagnostics) > 0 {
+			return &fs.ConfigError{Diagnostics: diagnostics}
+		}
+	}
 	if err := validateTasks(pipeline, targets); err != nil {
 		return err
 	}
@@ -236,10 +270,24 @@ func (r *run) run(ctx gocontext.Context, targets []string) error {
 			return errors.Wrap(err, "failed to create SCM")
 		}
 	}
+	if daemonClient != nil {
+		// The daemon keeps file hashes up to date, saving us from hashing packages ourselves
+		scmInstance = daemonClient.SCM(ctx, scmInstance)
+	}
 	filteredPkgs, isAllPackages, err := scope.ResolvePackages(&r.opts.scopeOpts, r.base.RepoRoot.ToStringDuringMigration(), scmInstance, pkgDepGraph, r.base.UI, r.base.Logger)
 	if err != nil {
 		return errors.Wrap(err, "failed to resolve packages to run")
 	}
+	var affectedFiles []titanpath.AnchoredUnixPath
+	if r.opts.scopeOpts.AffectedBase != "" {
+		affectedFiles, err = scope.AffectedFiles(&r.opts.scopeOpts, r.base.RepoRoot.ToStringDuringMigration(), scmInstance, pkgDepGraph, r.base.Logger)
+		if err != nil {
+			return errors.Wrap(err, "failed to resolve affected tasks")
+		}
+		if affectedFiles == nil {
+			r.base.Logger.Debug("global dependency changed, all tasks are affected", "base", r.opts.scopeOpts.AffectedBase)
+		}
+	}
 	if isAllPackages {
 		// if there is a root task for any of our targets, we need to add it
 		for _, target := range targets {
@@ -251,11 +299,18 @@ func (r *run) run(ctx gocontext.Context, targets []string) error {
 			}
 		}
 	}
+	globalDotEnv, err := env.ReadDotEnvFiles(r.base.RepoRoot, titanJSON.GlobalDotEnv)
+	if err != nil {
+		return errors.Wrap(err, "failed to read global .env files")
+	}
+	// Workspace configurations are hashed with the tasks they affect, so that changing one
+	// doesn't invalidate the cache of every package
 	globalHash, err := calculateGlobalHash(
 		r.base.RepoRoot,
 		rootPackageJSON,
-		pipeline,
+		titanJSON.Pipeline,
 		titanJSON.GlobalEnv,
+		globalDotEnv,
 		titanJSON.GlobalDeps,
 		pkgDepGraph.PackageManager,
 		pkgDepGraph.Lockfile,
@@ -270,19 +325,67 @@ func (r *run) run(ctx gocontext.Context, targets []string) error {
 
 	// TODO: consolidate some of these arguments
 	g := &completeGraph{
-		TopologicalGraph: pkgDepGraph.TopologicalGraph,
-		Pipeline:         pipeline,
-		PackageInfos:     pkgDepGraph.PackageInfos,
-		GlobalHash:       globalHash,
-		RootNode:         pkgDepGraph.RootNode,
+		TopologicalGraph:     pkgDepGraph.TopologicalGraph,
+		Pipeline:             pipeline,
+		RootPipeline:         titanJSON.Pipeline,
+		PackageInfos:         pkgDepGraph.PackageInfos,
+		GlobalHash:           globalHash,
+		RootNode:             pkgDepGraph.RootNode,
+		SCM:                  scmInstance,
+		GlobalEnv:            titanJSON.GlobalEnv,
+		GlobalPassThroughEnv: append(append([]string{}, env.DefaultPassThroughEnv...), titanJSON.GlobalPassThroughEnv...),
+		GlobalDotEnv:         globalDotEnv,
+		Frameworks:           inference.FrameworksFromConfig(titanJSON.Frameworks),
+	}
+	envMode := titanJSON.EnvMode
+	if r.opts.runOpts.envModeOverride != nil {
+		envMode = *r.opts.runOpts.envModeOverride
 	}
 	rs := &runSpec{
-		Targets:      targets,
-		FilteredPkgs: filteredPkgs,
-		Opts:         r.opts,
+		Targets:       targets,
+		FilteredPkgs:  filteredPkgs,
+		Opts:          r.opts,
+		AffectedFiles: affectedFiles,
+		EnvMode:       envMode,
 	}
 	packageManager := pkgDepGraph.PackageManager
-	return r.runOperation(ctx, g, rs, packageManager, startAt)
+	if daemonClient == nil || rs.Opts.runOpts.dryRun {
+		return r.runOperation(ctx, g, rs, packageManager, startAt)
+	}
+	// Let the daemon tell anyone who is interested, such as editors, about this run
+	runID := uuid.New().String()
+	r.notifyRunStatus(ctx, daemonClient, runID, daemonclient.RunStarted, targets)
+	err = r.runOperation(ctx, g, rs, packageManager, startAt)
+	if err != nil {
+		r.notifyRunStatus(ctx, daemonClient, runID, daemonclient.RunFailed, targets)
+	} else {
+		r.notifyRunStatus(ctx, daemonClient, runID, daemonclient.RunSucceeded, targets)
+	}
+	return err
+}
+
+// buildPackageGraph uses the package graph that the daemon keeps, if there is a daemon, and
+// builds the graph from scratch otherwise or if the daemon can't provide it.
+func (r *run) buildPackageGraph(ctx gocontext.Context, daemonClient *daemonclient.DaemonClient, rootPackageJSON *fs.PackageJSON) (*context.Context, error) {
+	if daemonClient != nil {
+		packages, err := daemonClient.GetPackageGraph(ctx)
+		if err == nil {
+			var pkgDepGraph *context.Context
+			pkgDepGraph, err = context.PackageGraphFromResolvedPackages(r.base.RepoRoot, rootPackageJSON, packages)
+			var warnings *context.Warnings
+			if err == nil || errors.As(err, &warnings) {
+				return pkgDepGraph, err
+			}
+		}
+		r.base.Logger.Warn("failed to get the package graph from titand, building it locally", "error", err)
+	}
+	return context.BuildPackageGraph(r.base.RepoRoot, rootPackageJSON)
+}
+
+func (r *run) notifyRunStatus(ctx gocontext.Context, daemonClient *daemonclient.DaemonClient, runID string, status daemonclient.RunStatus, targets []string) {
+	if err := daemonClient.NotifyRunStatus(ctx, runID, status, targets); err != nil {
+		r.base.Logger.Debug("failed to notify daemon of run status", "status", status, "error", err)
+	}
 }
 
 func (r *run) runOperation(ctx gocontext.Context, g *completeGraph, rs *runSpec, packageManager *packagemanager.PackageManager, startAt time.Time) error {
@@ -291,15 +394,19 @@ func (r *run) runOperation(ctx gocontext.Context, g *completeGraph, rs *runSpec,
 		vertexSet.Add(v)
 	}
 
-	engine, err := buildTaskGraphEngine(&g.TopologicalGraph, g.Pipeline, rs)
+	engine, err := buildTaskGraphEngine(&g.TopologicalGraph, g.Pipeline, g.PackageInfos, rs)
 	if err != nil {
 		return errors.Wrap(err, "error preparing engine")
 	}
-	tracker := taskhash.NewTracker(g.RootNode, g.GlobalHash, g.Pipeline, g.PackageInfos)
-	err = tracker.CalculateFileHashes(engine.TaskGraph.Vertices(), rs.Opts.runOpts.concurrency, r.base.RepoRoot)
+	tracker := taskhash.NewTracker(r.base.RepoRoot, g.RootNode, g.GlobalHash, g.Pipeline, g.RootPipeline, g.PackageInfos, g.Frameworks, rs.EnvMode, g.GlobalPassThroughEnv)
+	fileHashCache := hashing.LoadFileHashCache(daemon.GetFileHashCachePath(r.base.RepoRoot))
+	err = tracker.CalculateFileHashes(engine.TaskGraph.Vertices(), rs.Opts.runOpts.concurrency, r.base.RepoRoot, g.SCM, fileHashCache)
 	if err != nil {
 		return errors.Wrap(err, "error hashing package files")
 	}
+	if err := fileHashCache.Save(); err != nil {
+		r.base.Logger.Warn("failed to save file hash cache", "error", err)
+	}
 
 	// If we are running in parallel, then we remove all the edges in the graph
 	// except for the root. Rebuild the task graph for backwards compatibility.
@@ -310,7 +417,7 @@ func (r *run) runOperation(ctx gocontext.Context, g *completeGraph, rs *runSpec,
 				g.TopologicalGraph.RemoveEdge(edge)
 			}
 		}
-		engine, err = buildTaskGraphEngine(&g.TopologicalGraph, g.Pipeline, rs)
+		engine, err = buildTaskGraphEngine(&g.TopologicalGraph, g.Pipeline, g.PackageInfos, rs)
 		if err != nil {
 			return errors.Wrap(err, "error preparing engine")
 		}
@@ -450,6 +557,7 @@ func displayDryTextRun(ui cli.Ui, tasksRun []hashedTask, packagesInScope []strin
 		fmt.Fprintln(w, util.Sprintf("  ${GREY}Log File\t=\t%s\t${RESET}", task.LogFile))
 		fmt.Fprintln(w, util.Sprintf("  ${GREY}Dependencies\t=\t%s\t${RESET}", strings.Join(dependencies, ", ")))
 		fmt.Fprintln(w, util.Sprintf("  ${GREY}Dependendents\t=\t%s\t${RESET}", strings.Join(dependents, ", ")))
+		fmt.Fprintln(w, util.Sprintf("  ${GREY}Environment Variables\t=\t%s\t${RESET}", strings.Join(task.EnvVars, ", ")))
 		if err := w.Flush(); err != nil {
 			return err
 		}
@@ -473,31 +581,10 @@ func filterSinglePackageGraphForDisplay(originalGraph *dag.AcyclicGraph) *dag.Ac
 	return graph
 }
 
-func buildTaskGraphEngine(topoGraph *dag.AcyclicGraph, pipeline fs.Pipeline, rs *runSpec) (*core.Engine, error) {
+func buildTaskGraphEngine(topoGraph *dag.AcyclicGraph, pipeline fs.Pipeline, packageInfos map[interface{}]*fs.PackageJSON, rs *runSpec) (*core.Engine, error) {
 	engine := core.NewEngine(topoGraph)
-
-	for taskName, taskDefinition := range pipeline {
-		topoDeps := make(util.Set)
-		deps := make(util.Set)
-		isPackageTask := util.IsPackageTask(taskName)
-		for _, dependency := range taskDefinition.TaskDependencies {
-			if isPackageTask && util.IsPackageTask(dependency) {
-				err := engine.AddDep(dependency, taskName)
-				if err != nil {
-					return nil, err
-				}
-			} else {
-				deps.Add(dependency)
-			}
-		}
-		for _, dependency := range taskDefinition.TopologicalDependencies {
-			topoDeps.Add(dependency)
-		}
-		engine.AddTask(&core.Task{
-			Name:     taskName,
-			TopoDeps: topoDeps,
-			Deps:     deps,
-		})
+	if err := engine.AddPipeline(pipeline); err != nil {
+		return nil, err
 	}
 
 	if err := engine.Prepare(&core.EngineExecutionOptions{
@@ -508,6 +595,16 @@ func buildTaskGraphEngine(topoGraph *dag.AcyclicGraph, pipeline fs.Pipeline, rs
 		return nil, err
 	}
 
+	if rs.AffectedFiles != nil {
+		affectedTasks, err := getAffectedTasks(engine.TaskGraph, pipeline, packageInfos, rs.AffectedFiles)
+		if err != nil {
+			return nil, err
+		}
+		if err := engine.RetainTasks(affectedTasks); err != nil {
+			return nil, err
+		}
+	}
+
 	if err := util.ValidateGraph(engine.TaskGraph); err != nil {
 		return nil, fmt.Errorf("Invalid task dependency graph:\n%v", err)
 	}
@@ -546,6 +643,10 @@ type runOpts struct {
 	graphFile     string
 	noDaemon      bool
 	singlePackage bool
+	// If set, overrides the envMode configured in titan.json
+	envModeOverride *util.EnvMode
+	// Whether to execute scripts directly rather than through the package manager
+	directScripts bool
 }
 
 var (
@@ -562,6 +663,15 @@ Outputs dot graph to stdout when if no filename is provided`
 	_concurrencyHelp = `Limit the concurrency of task execution. Use 1 for serial (i.e. one-at-a-time) execution.`
 	_parallelHelp    = `Execute all tasks in parallel.`
 	_onlyHelp        = `Run only the specified tasks, not their dependencies.`
+	_envModeHelp     = `Set which environment variables are passed to tasks. Use
+"loose" to pass the entire environment. Use "strict" to
+pass only the variables declared in titan.json, along with
+those needed to run programs, such as PATH and HOME.
+Defaults to the "envMode" set in titan.json, or "loose".`
+	_directScriptsHelp = `Execute package.json scripts directly through a shell
+rather than through the package manager, saving its startup
+time for each task. Scripts are run the way the package
+manager runs them, including pre and post scripts.`
 )
 
 func addRunOpts(opts *runOpts, flags *pflag.FlagSet, aliases map[string]string) {
@@ -579,6 +689,7 @@ func addRunOpts(opts *runOpts, flags *pflag.FlagSet, aliases map[string]string)
 	flags.BoolVar(&opts.only, "only", false, _onlyHelp)
 	flags.BoolVar(&opts.noDaemon, "no-daemon", false, "Run without using titan's daemon process")
 	flags.BoolVar(&opts.singlePackage, "single-package", false, "Run titan in single-package mode")
+	flags.BoolVar(&opts.directScripts, "direct-scripts", false, _directScriptsHelp)
 	// This is a no-op flag, we don't need it anymore
 	flags.Bool("experimental-use-daemon", false, "Use the experimental titan daemon")
 	if err := flags.MarkHidden("experimental-use-daemon"); err != nil {
@@ -606,6 +717,43 @@ func addRunOpts(opts *runOpts, flags *pflag.FlagSet, aliases map[string]string)
 		NoOptDefVal: _graphNoValue,
 		Value:       &graphValue{opts: opts},
 	})
+	flags.AddFlag(&pflag.Flag{
+		Name:     "env-mode",
+		Usage:    _envModeHelp,
+		DefValue: "",
+		Value:    &envModeValue{opts: opts},
+	})
+}
+
+// envModeValue implements a flag that overrides the env mode set in titan.json
+type envModeValue struct {
+	opts *runOpts
+}
+
+var _ pflag.Value = &envModeValue{}
+
+func (e *envModeValue) String() string {
+	if e.opts.envModeOverride == nil {
+		return ""
+	}
+	envMode, err := util.ToEnvModeString(*e.opts.envModeOverride)
+	if err != nil {
+		panic(err)
+	}
+	return envMode
+}
+
+func (e *envModeValue) Set(value string) error {
+	envMode, err := util.FromEnvModeString(value)
+	if err != nil {
+		return fmt.Errorf("must be one of \"%v\"", e.Type())
+	}
+	e.opts.envModeOverride = &envMode
+	return nil
+}
+
+func (e *envModeValue) Type() string {
+	return strings.Join(util.EnvModeStrings, "|")
 }
 
 const (
@@ -762,17 +910,20 @@ func (r *run) executeTasks(ctx gocontext.Context, g *completeGraph, rs *runSpec,
 	runCache := runcache.New(titanCache, r.base.RepoRoot, rs.Opts.runcacheOpts, colorCache)
 
 	ec := &execContext{
-		colorCache:      colorCache,
-		runState:        runState,
-		rs:              rs,
-		ui:              &cli.ConcurrentUi{Ui: r.base.UI},
-		runCache:        runCache,
-		logger:          r.base.Logger,
-		packageManager:  packageManager,
-		processes:       r.processes,
-		taskHashes:      hashes,
-		repoRoot:        r.base.RepoRoot,
-		isSinglePackage: r.opts.runOpts.singlePackage,
+		colorCache:           colorCache,
+		runState:             runState,
+		rs:                   rs,
+		ui:                   &cli.ConcurrentUi{Ui: r.base.UI},
+		runCache:             runCache,
+		logger:               r.base.Logger,
+		packageManager:       packageManager,
+		processes:            r.processes,
+		taskHashes:           hashes,
+		repoRoot:             r.base.RepoRoot,
+		isSinglePackage:      r.opts.runOpts.singlePackage,
+		globalEnv:            g.GlobalEnv,
+		globalPassThroughEnv: g.GlobalPassThroughEnv,
+		globalDotEnv:         g.GlobalDotEnv,
 	}
 
 	// run the thing
@@ -825,6 +976,7 @@ type hashedTask struct {
 	Dir             string           `json:"directory"`
 	Dependencies    []string         `json:"dependencies"`
 	Dependents      []string         `json:"dependents"`
+	EnvVars         []string         `json:"environmentVariables"`
 }
 
 func (ht *hashedTask) toSinglePackageTask() hashedSinglePackageTask {
@@ -844,6 +996,7 @@ func (ht *hashedTask) toSinglePackageTask() hashedSinglePackageTask {
 		LogFile:      ht.LogFile,
 		Dependencies: dependencies,
 		Dependents:   dependents,
+		EnvVars:      ht.EnvVars,
 	}
 }
 
@@ -856,6 +1009,7 @@ type hashedSinglePackageTask struct {
 	LogFile         string   `json:"logFile"`
 	Dependencies    []string `json:"dependencies"`
 	Dependents      []string `json:"dependents"`
+	EnvVars         []string `json:"environmentVariables"`
 }
 
 func (r *run) executeDryRun(ctx gocontext.Context, engine *core.Engine, g *completeGraph, taskHashes *taskhash.Tracker, rs *runSpec) ([]hashedTask, error) {
@@ -925,12 +1079,13 @@ func (r *run) executeDryRun(ctx gocontext.Context, engine *core.Engine, g *compl
 			Hash:            hash,
 			CacheState:      itemStatus,
 			Command:         command,
-			Dir:             packageTask.Pkg.Dir.ToString(),
+			Dir:             packageTask.CommandDir(),
 			Outputs:         packageTask.TaskDefinition.Outputs.Inclusions,
 			ExcludedOutputs: packageTask.TaskDefinition.Outputs.Exclusions,
 			LogFile:         packageTask.RepoRelativeLogFile(),
 			Dependencies:    stringAncestors,
 			Dependents:      stringDescendents,
+			EnvVars:         taskHashes.GetEnvVars(packageTask.TaskID),
 		})
 
 		return nil
@@ -974,6 +1129,10 @@ type execContext struct {
 	taskHashes      *taskhash.Tracker
 	repoRoot        titanpath.AbsoluteSystemPath
 	isSinglePackage bool
+	// globalEnv, globalPassThroughEnv and globalDotEnv are only used in strict env mode
+	globalEnv            []string
+	globalPassThroughEnv []string
+	globalDotEnv         map[string]string
 }
 
 func (ec *execContext) logError(log hclog.Logger, prefix string, err error) {
@@ -986,6 +1145,19 @@ func (ec *execContext) logError(log hclog.Logger, prefix string, err error) {
 	ec.ui.Error(fmt.Sprintf("%s%s%s", ui.ERROR_PREFIX, prefix, color.RedString(" %v", err)))
 }
 
+// strictEnv returns the environment for a task in strict env mode: the variables that
+// contribute to its hash, including those from .env files, along with the passthrough
+// allowlist.
+func (ec *execContext) strictEnv(packageTask *nodes.PackageTask) []string {
+	envKeys := make([]string, 0, len(ec.globalEnv)+len(ec.globalPassThroughEnv)+len(packageTask.TaskDefinition.EnvVarDependencies))
+	envKeys = append(envKeys, ec.globalEnv...)
+	envKeys = append(envKeys, ec.globalPassThroughEnv...)
+	envKeys = append(envKeys, packageTask.TaskDefinition.EnvVarDependencies...)
+	envPrefixes := ec.taskHashes.GetEnvPrefixes(packageTask.TaskID)
+	strictEnv := env.GetStrictEnv(os.Environ(), envKeys, envPrefixes)
+	return env.AddDotEnv(strictEnv, ec.globalDotEnv, ec.taskHashes.GetDotEnv(packageTask.TaskID))
+}
+
 func (ec *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTask, deps dag.Set) error {
 	cmdTime := time.Now()
 
@@ -1034,20 +1206,38 @@ func (ec *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTas
 	}
 
 	// Setup command execution
-	argsactual := append([]string{"run"}, packageTask.Task)
-	if len(passThroughArgs) > 0 {
-		// This will be either '--' or a typed nil
-		argsactual = append(argsactual, ec.packageManager.ArgSeparator...)
-		argsactual = append(argsactual, passThroughArgs...)
-	}
-
-	cmd := exec.Command(ec.packageManager.Command, argsactual...)
-	// TODO: repoRoot probably should be AbsoluteSystemPath, but it's Join method
-	// takes a RelativeSystemPath. Resolve during migration from titanpath.AbsoluteSystemPath to
-	// AbsoluteSystemPath
-	cmd.Dir = ec.repoRoot.UntypedJoin(packageTask.Pkg.Dir.ToStringDuringMigration()).ToString()
 	envs := fmt.Sprintf("TITAN_HASH=%v", hash)
-	cmd.Env = append(os.Environ(), envs)
+	var environ []string
+	if ec.rs.EnvMode == util.StrictEnvMode {
+		environ = append(ec.strictEnv(packageTask), envs)
+	} else {
+		environ = append(os.Environ(), envs)
+	}
+	var cmds []*exec.Cmd
+	if packageTask.TaskDefinition.Command != "" {
+		// Commands from titan.json don't go through the package manager
+		cmd := packagemanager.ShellCommand(packageTask.TaskDefinition.Command, passThroughArgs)
+		cmd.Dir = ec.repoRoot.UntypedJoin(packageTask.CommandDir()).ToString()
+		cmd.Env = environ
+		cmds = []*exec.Cmd{cmd}
+	} else if ec.rs.Opts.runOpts.directScripts {
+		cmds = ec.packageManager.ScriptCommands(ec.repoRoot, packageTask.Pkg, packageTask.Task, passThroughArgs, environ)
+	} else {
+		argsactual := append([]string{"run"}, packageTask.Task)
+		if len(passThroughArgs) > 0 {
+			// This will be either '--' or a typed nil
+			argsactual = append(argsactual, ec.packageManager.ArgSeparator...)
+			argsactual = append(argsactual, passThroughArgs...)
+		}
+
+		cmd := exec.Command(ec.packageManager.Command, argsactual...)
+		// TODO: repoRoot probably should be AbsoluteSystemPath, but it's Join method
+		// takes a RelativeSystemPath. Resolve during migration from titanpath.AbsoluteSystemPath to
+		// AbsoluteSystemPath
+		cmd.Dir = ec.repoRoot.UntypedJoin(packageTask.Pkg.Dir.ToStringDuringMigration()).ToString()
+		cmd.Env = environ
+		cmds = []*exec.Cmd{cmd}
+	}
 
 	// Setup stdout/stderr
 	// If we are not caching anything, then we don't need to write logs to disk
@@ -1067,8 +1257,10 @@ func (ec *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTas
 	logStreamerOut := logstreamer.NewLogstreamer(logger, prettyPrefix, false)
 	// Setup a streamer that we'll pipe cmd.Stderr to.
 	logStreamerErr := logstreamer.NewLogstreamer(logger, prettyPrefix, false)
-	cmd.Stderr = logStreamerErr
-	cmd.Stdout = logStreamerOut
+	for _, cmd := range cmds {
+		cmd.Stderr = logStreamerErr
+		cmd.Stdout = logStreamerOut
+	}
 	// Flush/Reset any error we recorded
 	logStreamerErr.FlushRecord()
 	logStreamerOut.FlushRecord()
@@ -1096,8 +1288,8 @@ func (ec *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTas
 		return nil
 	}
 
-	// Run the command
-	if err := ec.processes.Exec(cmd); err != nil {
+	// Run the commands, stopping at the first one that fails
+	if err := ec.execCommands(cmds); err != nil {
 		// close off our outputs. We errored, so we mostly don't care if we fail to close
 		_ = closeOutputs()
 		// if we already know we're in the process of exiting,
@@ -1132,6 +1324,16 @@ func (ec *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTas
 	return nil
 }
 
+// execCommands runs cmds one after the other until one of them fails
+func (ec *execContext) execCommands(cmds []*exec.Cmd) error {
+	for _, cmd := range cmds {
+		if err := ec.processes.Exec(cmd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (g *completeGraph) getPackageTaskVisitor(ctx gocontext.Context, visitor func(ctx gocontext.Context, packageTask *nodes.PackageTask) error) func(taskID string) error {
 	return func(taskID string) error {
 
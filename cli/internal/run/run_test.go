@@ -22,6 +22,7 @@ func TestParseConfig(t *testing.T) {
 	if err != nil {
 		t.Errorf("failed to get cwd: %v", err)
 	}
+	strictEnvMode := util.StrictEnvMode
 	cases := []struct {
 		Name          string
 		Args          []string
@@ -279,6 +280,22 @@ func TestParseConfig(t *testing.T) {
 			},
 			[]string{"foo"},
 		},
+		{
+			"env mode",
+			[]string{"foo", "--env-mode=strict"},
+			&Opts{
+				runOpts: runOpts{
+					concurrency:     10,
+					envModeOverride: &strictEnvMode,
+				},
+				cacheOpts: cache.Opts{
+					Workers: 10,
+				},
+				runcacheOpts: runcache.Opts{},
+				scopeOpts:    scope.Opts{},
+			},
+			[]string{"foo"},
+		},
 	}
 
 	for i, tc := range cases {
@@ -324,7 +341,7 @@ func Test_dontSquashTasks(t *testing.T) {
 		Targets:      []string{"build"},
 		Opts:         &Opts{},
 	}
-	engine, err := buildTaskGraphEngine(topoGraph, pipeline, rs)
+	engine, err := buildTaskGraphEngine(topoGraph, pipeline, nil, rs)
 	if err != nil {
 		t.Fatalf("failed to build task graph: %v", err)
 	}
@@ -357,7 +374,7 @@ func Test_taskSelfRef(t *testing.T) {
 		Targets:      []string{"build"},
 		Opts:         &Opts{},
 	}
-	_, err := buildTaskGraphEngine(topoGraph, pipeline, rs)
+	_, err := buildTaskGraphEngine(topoGraph, pipeline, nil, rs)
 	if err == nil {
 		t.Fatalf("expected to failed to build task graph: %v", err)
 	}
@@ -1,5 +1,4 @@
 // Package scm abstracts operations on various tools like git
-// Currently, only git is supported.
 //
 // Adapted from https://github.com/thought-machine/please/tree/master/src/scm
 // Copyright Thought Machine, Inc. or its affiliates. All Rights Reserved.
@@ -8,18 +7,41 @@ package scm
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/khulnasoft/titanrepo/cli/internal/hashing"
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
 	"github.com/pkg/errors"
 )
 
 // git implements operations on a git repository.
 type git struct {
 	repoRoot string
+	// deepen fetches the given number of additional commits of history
+	// for a shallow clone. It is called when a merge-base cannot be found.
+	deepen func(depth int) error
+
+	indexMu sync.Mutex
+	// index is a snapshot of the git index and untracked files, loaded on first use. It is
+	// reloaded when .git/index changes or after Invalidate, such as when files are added.
+	index      *hashing.GitIndex
+	indexErr   error
+	indexStale atomic.Bool
+	indexMtime time.Time
+	indexSize  int64
 }
 
+// _deepenSteps are the successive depths we fetch when looking for a merge-base in a
+// shallow clone. CI checkouts are commonly only one commit deep, so we start small and
+// back off quickly rather than fetching the entire history up front.
+var _deepenSteps = []int{50, 200, 1000, 5000}
+
 // ChangedFiles returns a list of modified files since the given commit, optionally including untracked files.
 func (g *git) ChangedFiles(fromCommit string, toCommit string, includeUntracked bool, relativeTo string) ([]string, error) {
 	if relativeTo == "" {
@@ -43,7 +65,7 @@ func (g *git) ChangedFiles(fromCommit string, toCommit string, includeUntracked
 			// Check if we can provide a better error message for non-existent commits.
 			// If we error on the check or can't find it, fall back to whatever error git
 			// reported.
-			if exists, err := commitExists(fromCommit); err == nil && !exists {
+			if exists, err := g.commitExists(fromCommit); err == nil && !exists {
 				return nil, fmt.Errorf("commit %v does not exist", fromCommit)
 			}
 			return nil, errors.Wrapf(err, "git comparing with %v", fromCommit)
@@ -75,8 +97,90 @@ func (g *git) ChangedFiles(fromCommit string, toCommit string, includeUntracked
 	return normalized, nil
 }
 
-func commitExists(commit string) (bool, error) {
-	err := exec.Command("git", "cat-file", "-t", commit).Run()
+// PreviousContent returns the contents of filePath as of fromCommit.
+func (g *git) PreviousContent(fromCommit string, filePath string) ([]byte, error) {
+	// A ./ prefix makes the path relative to the working directory rather than the repository root
+	cmd := exec.Command("git", "show", fmt.Sprintf("%v:./%v", fromCommit, filepath.Base(filePath)))
+	cmd.Dir = filepath.Dir(filePath)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %v at %v", filePath, fromCommit)
+	}
+	return out, nil
+}
+
+// MergeBase returns the best common ancestor of ref1 and ref2. If the repository is a shallow
+// clone that does not contain the merge-base, it deepens the clone until it is found.
+func (g *git) MergeBase(ref1 string, ref2 string) (string, error) {
+	for _, ref := range []string{ref1, ref2} {
+		if exists, err := g.commitExists(ref); err == nil && !exists {
+			return "", fmt.Errorf("commit %v does not exist. If this is a shallow or single-branch clone, fetch it first, for example with \"git fetch origin %v\"", ref, ref)
+		}
+	}
+	fetched := 0
+	for i := 0; ; i++ {
+		mergeBase, found, err := g.findMergeBase(ref1, ref2)
+		if err != nil {
+			return "", err
+		} else if found {
+			return mergeBase, nil
+		}
+		isShallow, err := g.isShallow()
+		if err != nil {
+			return "", err
+		}
+		if !isShallow {
+			return "", fmt.Errorf("%v and %v do not have a common ancestor", ref1, ref2)
+		}
+		if i == len(_deepenSteps) || g.deepen == nil {
+			return "", fmt.Errorf("unable to find a common ancestor of %v and %v after fetching %v additional commits. Fetch more history, for example with \"git fetch --unshallow\"", ref1, ref2, fetched)
+		}
+		if err := g.deepen(_deepenSteps[i]); err != nil {
+			return "", errors.Wrapf(err, "deepening shallow clone to find the merge-base of %v and %v", ref1, ref2)
+		}
+		fetched += _deepenSteps[i]
+	}
+}
+
+// findMergeBase runs git merge-base, returning false if the refs have no common ancestor
+// in the history that is available locally.
+func (g *git) findMergeBase(ref1 string, ref2 string) (string, bool, error) {
+	cmd := exec.Command("git", "merge-base", ref1, ref2)
+	cmd.Dir = g.repoRoot
+	out, err := cmd.Output()
+	if err != nil {
+		exitErr := &exec.ExitError{}
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return "", false, nil
+		}
+		return "", false, errors.Wrapf(err, "finding merge-base of %v and %v", ref1, ref2)
+	}
+	return strings.TrimSpace(string(out)), true, nil
+}
+
+func (g *git) isShallow() (bool, error) {
+	cmd := exec.Command("git", "rev-parse", "--is-shallow-repository")
+	cmd.Dir = g.repoRoot
+	out, err := cmd.Output()
+	if err != nil {
+		return false, errors.Wrap(err, "checking for a shallow clone")
+	}
+	return strings.TrimSpace(string(out)) == "true", nil
+}
+
+func (g *git) fetchDeepen(depth int) error {
+	cmd := exec.Command("git", "fetch", fmt.Sprintf("--deepen=%v", depth))
+	cmd.Dir = g.repoRoot
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git fetch --deepen=%v: %v: %v", depth, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (g *git) commitExists(commit string) (bool, error) {
+	cmd := exec.Command("git", "cat-file", "-t", commit)
+	cmd.Dir = g.repoRoot
+	err := cmd.Run()
 	if err != nil {
 		exitErr := &exec.ExitError{}
 		if errors.As(err, &exitErr) && exitErr.ExitCode() == 128 {
@@ -87,6 +191,44 @@ func commitExists(commit string) (bool, error) {
 	return true, nil
 }
 
+// GetPackageFileHashes returns the git object hashes of the files in the given package.
+// It reads the git index in-process where it can, and otherwise asks git.
+func (g *git) GetPackageFileHashes(rootPath titanpath.AbsoluteSystemPath, opts *hashing.PackageDepsOptions) (map[titanpath.AnchoredUnixPath]string, error) {
+	index, err := g.getIndex()
+	if err == nil {
+		if hashes, err := index.GetPackageDeps(rootPath, opts); err == nil {
+			return hashes, nil
+		}
+	}
+	return hashing.GetPackageDeps(rootPath, opts)
+}
+
+// Invalidate implements CachingSCM.Invalidate. It doesn't wait for an index being loaded,
+// so that file watching isn't held up.
+func (g *git) Invalidate() {
+	g.indexStale.Store(true)
+}
+
+// getIndex returns the snapshot of the git index, loading it again if it may be out of date
+func (g *git) getIndex() (*hashing.GitIndex, error) {
+	g.indexMu.Lock()
+	defer g.indexMu.Unlock()
+	var mtime time.Time
+	var size int64
+	if info, err := os.Stat(filepath.Join(g.repoRoot, ".git", "index")); err == nil {
+		mtime = info.ModTime()
+		size = info.Size()
+	}
+	// The flag is cleared before loading, so that changes made during the load aren't lost
+	stale := g.indexStale.Swap(false)
+	if g.index == nil && g.indexErr == nil || stale || !mtime.Equal(g.indexMtime) || size != g.indexSize {
+		g.index, g.indexErr = hashing.LoadGitIndex(titanpath.AbsoluteSystemPathFromUpstream(g.repoRoot))
+		g.indexMtime = mtime
+		g.indexSize = size
+	}
+	return g.index, g.indexErr
+}
+
 func (g *git) fixGitRelativePath(worktreePath, relativeTo string) (string, error) {
 	p, err := filepath.Rel(relativeTo, filepath.Join(g.repoRoot, worktreePath))
 	if err != nil {
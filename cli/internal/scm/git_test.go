@@ -0,0 +1,103 @@
+package scm
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func requireGitCmd(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v %v", strings.Join(args, " "), err, string(out))
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// setupShallowClone creates a repository where "feature" branches off of "main",
+// and both branches have moved on since. It returns the merge-base of the two
+// branches and a depth 1 clone of "feature" that does not contain it.
+func setupShallowClone(t *testing.T) (string, string) {
+	origin := t.TempDir()
+	requireGitCmd(t, origin, "init", "--initial-branch=main", ".")
+	requireGitCmd(t, origin, "commit", "--allow-empty", "-m", "base")
+	mergeBase := requireGitCmd(t, origin, "rev-parse", "HEAD")
+	requireGitCmd(t, origin, "checkout", "-b", "feature")
+	for i := 0; i < 3; i++ {
+		requireGitCmd(t, origin, "commit", "--allow-empty", "-m", "feature")
+	}
+	requireGitCmd(t, origin, "checkout", "main")
+	requireGitCmd(t, origin, "commit", "--allow-empty", "-m", "main")
+
+	clone := filepath.Join(t.TempDir(), "clone")
+	requireGitCmd(t, origin, "clone", "--depth=1", "--no-single-branch", "--branch=feature", "file://"+origin, clone)
+	return mergeBase, clone
+}
+
+func TestMergeBase(t *testing.T) {
+	mergeBase, clone := setupShallowClone(t)
+
+	g := &git{repoRoot: clone}
+	var depths []int
+	g.deepen = func(depth int) error {
+		depths = append(depths, depth)
+		return g.fetchDeepen(depth)
+	}
+	result, err := g.MergeBase("origin/main", "HEAD")
+	assert.NilError(t, err, "MergeBase")
+	assert.Equal(t, result, mergeBase)
+	assert.DeepEqual(t, depths, []int{_deepenSteps[0]})
+
+	// Now that the history is available, we shouldn't need to fetch again
+	depths = nil
+	result, err = g.MergeBase("origin/main", "HEAD")
+	assert.NilError(t, err, "MergeBase")
+	assert.Equal(t, result, mergeBase)
+	assert.Equal(t, len(depths), 0)
+}
+
+func TestMergeBase_DeepenFails(t *testing.T) {
+	_, clone := setupShallowClone(t)
+
+	g := &git{repoRoot: clone}
+	g.deepen = func(depth int) error {
+		return nil
+	}
+	_, err := g.MergeBase("origin/main", "HEAD")
+	assert.ErrorContains(t, err, "unable to find a common ancestor of origin/main and HEAD")
+}
+
+func TestMergeBase_MissingRef(t *testing.T) {
+	_, clone := setupShallowClone(t)
+
+	g := &git{repoRoot: clone}
+	_, err := g.MergeBase("origin/does-not-exist", "HEAD")
+	assert.ErrorContains(t, err, "commit origin/does-not-exist does not exist")
+}
+
+func TestPreviousContent(t *testing.T) {
+	repoRoot := t.TempDir()
+	lockfilePath := filepath.Join(repoRoot, "packages", "a", "yarn.lock")
+	assert.NilError(t, os.MkdirAll(filepath.Dir(lockfilePath), 0755))
+	requireGitCmd(t, repoRoot, "init", "--initial-branch=main", ".")
+	assert.NilError(t, os.WriteFile(lockfilePath, []byte("before"), 0644))
+	requireGitCmd(t, repoRoot, "add", ".")
+	requireGitCmd(t, repoRoot, "commit", "-m", "base")
+	assert.NilError(t, os.WriteFile(lockfilePath, []byte("after"), 0644))
+
+	g := &git{repoRoot: repoRoot}
+	previous, err := g.PreviousContent("HEAD", lockfilePath)
+	assert.NilError(t, err, "PreviousContent")
+	assert.Equal(t, string(previous), "before")
+
+	_, err = g.PreviousContent("HEAD", filepath.Join(repoRoot, "missing.lock"))
+	assert.ErrorContains(t, err, "missing.lock")
+}
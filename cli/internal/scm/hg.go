@@ -0,0 +1,169 @@
+package scm
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/hashing"
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+	"github.com/pkg/errors"
+)
+
+// hg implements operations on a Mercurial or Sapling repository. Sapling's
+// command line interface is compatible with Mercurial's for everything we use,
+// so the two differ only by the binary we invoke.
+type hg struct {
+	repoRoot string
+	bin      string
+}
+
+// ChangedFiles returns a list of modified files since the given commit, optionally including untracked files.
+func (h *hg) ChangedFiles(fromCommit string, toCommit string, includeUntracked bool, relativeTo string) ([]string, error) {
+	if relativeTo == "" {
+		relativeTo = h.repoRoot
+	}
+	toRev := toRevset(toCommit)
+
+	// Changes in the working copy relative to toCommit
+	files, err := h.status("--modified", "--added", "--removed", "--deleted", "--rev", toRev)
+	if err != nil {
+		return nil, errors.Wrapf(err, "finding changes relative to %v", relativeTo)
+	}
+
+	if fromCommit != "" {
+		// Compare against the common ancestor, matching git's ... syntax. This ensures we have
+		// just the changes that have occurred on the current branch.
+		ancestor := fmt.Sprintf("ancestor(%v, %v)", toRevset(fromCommit), toRev)
+		committedChanges, err := h.status("--modified", "--added", "--removed", "--rev", ancestor, "--rev", toRev)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%v comparing with %v", h.bin, fromCommit)
+		}
+		files = append(files, committedChanges...)
+	}
+	if includeUntracked {
+		untracked, err := h.status("--unknown")
+		if err != nil {
+			return nil, errors.Wrap(err, "finding untracked files")
+		}
+		files = append(files, untracked...)
+	}
+
+	// Unlike git, we can't scope status to relativeTo without changing how the paths are
+	// reported, so we filter here instead.
+	normalized := make([]string, 0, len(files))
+	for _, f := range files {
+		p, err := filepath.Rel(relativeTo, filepath.Join(h.repoRoot, filepath.FromSlash(f)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to determine relative path for %s and %s", h.repoRoot, relativeTo)
+		}
+		if p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator)) {
+			continue
+		}
+		normalized = append(normalized, p)
+	}
+	return normalized, nil
+}
+
+// MergeBase returns the best common ancestor of ref1 and ref2.
+func (h *hg) MergeBase(ref1 string, ref2 string) (string, error) {
+	revset := fmt.Sprintf("ancestor(%v, %v)", toRevset(ref1), toRevset(ref2))
+	out, err := h.run("log", "--rev", revset, "--template", "{node}")
+	if err != nil {
+		return "", errors.Wrapf(err, "finding merge-base of %v and %v", ref1, ref2)
+	}
+	mergeBase := strings.TrimSpace(string(out))
+	if mergeBase == "" {
+		return "", fmt.Errorf("%v and %v do not have a common ancestor", ref1, ref2)
+	}
+	return mergeBase, nil
+}
+
+// PreviousContent returns the contents of filePath as of fromCommit.
+func (h *hg) PreviousContent(fromCommit string, filePath string) ([]byte, error) {
+	out, err := h.run("cat", "--rev", toRevset(fromCommit), filePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %v at %v", filePath, fromCommit)
+	}
+	return out, nil
+}
+
+// GetPackageFileHashes returns git-compatible hashes of the files in the given package.
+// Without inputs, that is every file in the package that is not ignored. With inputs,
+// the same glob semantics as the git implementation apply.
+func (h *hg) GetPackageFileHashes(rootPath titanpath.AbsoluteSystemPath, opts *hashing.PackageDepsOptions) (map[titanpath.AnchoredUnixPath]string, error) {
+	packagePath := opts.PackagePath
+	pkgPath := packagePath.RestoreAnchor(rootPath)
+	if len(opts.InputPatterns) > 0 {
+		calculatedInputs := append([]string{"package.json"}, opts.InputPatterns...)
+		files, err := hashing.GlobPackageInputs(rootPath, packagePath, calculatedInputs)
+		if err != nil {
+			return nil, err
+		}
+		return opts.FileHashCache.HashFiles(pkgPath, files)
+	}
+
+	// Everything in the working copy other than ignored, removed or missing files
+	args := []string{"--modified", "--added", "--clean", "--unknown"}
+	if packagePath != "" && packagePath != "." {
+		args = append(args, "--", "path:"+packagePath.ToUnixPath().ToString())
+	}
+	repoFiles, err := h.status(args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing files in package %v", packagePath)
+	}
+	repoRoot := titanpath.AbsoluteSystemPathFromUpstream(h.repoRoot)
+	files := make([]titanpath.AnchoredSystemPath, 0, len(repoFiles))
+	for _, f := range repoFiles {
+		file := titanpath.AnchoredUnixPathFromUpstream(f).ToSystemPath().RestoreAnchor(repoRoot)
+		relativePath, err := file.RelativeTo(pkgPath)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, relativePath)
+	}
+	return opts.FileHashCache.HashFiles(pkgPath, files)
+}
+
+// status runs `status` with the given arguments, returning the repository-relative
+// paths of the files it reports.
+func (h *hg) status(args ...string) ([]string, error) {
+	out, err := h.run(append([]string{"status", "--no-status", "--print0"}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, f := range bytes.Split(out, []byte{0}) {
+		if len(f) > 0 {
+			files = append(files, string(f))
+		}
+	}
+	return files, nil
+}
+
+func (h *hg) run(args ...string) ([]byte, error) {
+	cmd := exec.Command(h.bin, args...)
+	cmd.Dir = h.repoRoot
+	// Ignore user configuration that changes the output format, such as relative paths.
+	cmd.Env = append(os.Environ(), "HGPLAIN=1")
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v %v: %v: %v", h.bin, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// toRevset translates git-style references to HEAD into the equivalent revset,
+// so that defaults like --since=HEAD^1 work unchanged. Mercurial calls the
+// working copy parent ".".
+func toRevset(ref string) string {
+	if ref == "HEAD" || strings.HasPrefix(ref, "HEAD^") || strings.HasPrefix(ref, "HEAD~") {
+		return "." + strings.TrimPrefix(ref, "HEAD")
+	}
+	return ref
+}
@@ -0,0 +1,120 @@
+package scm
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/hashing"
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+	"gotest.tools/v3/assert"
+)
+
+func Test_toRevset(t *testing.T) {
+	testCases := []struct {
+		ref  string
+		want string
+	}{
+		{"HEAD", "."},
+		{"HEAD^1", ".^1"},
+		{"HEAD~2", ".~2"},
+		{"main", "main"},
+		{"remote/main", "remote/main"},
+		{"HEADLESS", "HEADLESS"},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, toRevset(tc.ref), tc.want, tc.ref)
+	}
+}
+
+func TestFromInRepo(t *testing.T) {
+	testCases := []struct {
+		name   string
+		marker string
+		want   SCM
+	}{
+		{"git", ".git", &git{}},
+		{"sapling", ".sl", &hg{bin: "sl"}},
+		{"mercurial", ".hg", &hg{bin: "hg"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repoRoot := t.TempDir()
+			assert.NilError(t, os.Mkdir(filepath.Join(repoRoot, tc.marker), 0755))
+			pkgDir := filepath.Join(repoRoot, "packages", "a")
+			assert.NilError(t, os.MkdirAll(pkgDir, 0755))
+
+			result, err := FromInRepo(titanpath.AbsoluteSystemPathFromUpstream(pkgDir))
+			assert.NilError(t, err, "FromInRepo")
+			switch want := tc.want.(type) {
+			case *git:
+				g, ok := result.(*git)
+				assert.Assert(t, ok, "expected git, got %T", result)
+				assert.Equal(t, g.repoRoot, repoRoot)
+			case *hg:
+				h, ok := result.(*hg)
+				assert.Assert(t, ok, "expected hg, got %T", result)
+				assert.Equal(t, h.repoRoot, repoRoot)
+				assert.Equal(t, h.bin, want.bin)
+			}
+		})
+	}
+}
+
+func requireHgCmd(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("hg", append([]string{"--config", "ui.username=test"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "HGPLAIN=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("hg %v failed: %v %v", args, err, string(out))
+	}
+}
+
+func TestHg(t *testing.T) {
+	if _, err := exec.LookPath("hg"); err != nil {
+		t.Skip("hg is not installed")
+	}
+	repoRoot := t.TempDir()
+	writeFile := func(path string, contents string) {
+		t.Helper()
+		fullPath := filepath.Join(repoRoot, path)
+		assert.NilError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		assert.NilError(t, os.WriteFile(fullPath, []byte(contents), 0644))
+	}
+	requireHgCmd(t, repoRoot, "init")
+	writeFile(".hgignore", "syntax: glob\ndist/**\n")
+	writeFile("packages/a/package.json", "{}")
+	writeFile("packages/a/src/index.js", "a")
+	writeFile("packages/b/package.json", "{}")
+	requireHgCmd(t, repoRoot, "commit", "--addremove", "-m", "base")
+	requireHgCmd(t, repoRoot, "bookmark", "main")
+
+	writeFile("packages/a/src/index.js", "changed")
+	writeFile("packages/a/src/new.js", "new")
+	writeFile("packages/a/dist/out.js", "ignored")
+
+	h := &hg{repoRoot: repoRoot, bin: "hg"}
+	changed, err := h.ChangedFiles("HEAD", "HEAD", true, filepath.Join(repoRoot, "packages", "a"))
+	assert.NilError(t, err, "ChangedFiles")
+	assert.DeepEqual(t, changed, []string{filepath.Join("src", "index.js"), filepath.Join("src", "new.js")})
+
+	mergeBase, err := h.MergeBase("main", "HEAD")
+	assert.NilError(t, err, "MergeBase")
+	assert.Equal(t, len(mergeBase), 40)
+
+	previous, err := h.PreviousContent(mergeBase, filepath.Join(repoRoot, "packages", "a", "src", "index.js"))
+	assert.NilError(t, err, "PreviousContent")
+	assert.Equal(t, string(previous), "a")
+
+	hashes, err := h.GetPackageFileHashes(titanpath.AbsoluteSystemPathFromUpstream(repoRoot), &hashing.PackageDepsOptions{
+		PackagePath: titanpath.AnchoredSystemPath(filepath.Join("packages", "a")),
+	})
+	assert.NilError(t, err, "GetPackageFileHashes")
+	assert.DeepEqual(t, hashes, map[titanpath.AnchoredUnixPath]string{
+		"package.json": "9e26dfeeb6e641a33dae4961196235bdb965b21b",
+		"src/index.js": "21fb1eca31e64cd3914025058b21992ab76edcf9",
+		"src/new.js":   "3e5126c4e761fd09582fc517918a1601b218dff0",
+	})
+}
@@ -1,5 +1,5 @@
 // Package scm abstracts operations on various tools like git
-// Currently, only git is supported.
+// Currently, git, Mercurial and Sapling are supported.
 //
 // Adapted from https://github.com/thought-machine/please/tree/master/src/scm
 // Copyright Thought Machine, Inc. or its affiliates. All Rights Reserved.
@@ -12,43 +12,63 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/hashing"
 	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
 )
 
-var ErrFallback = errors.New("cannot find a .git folder. Falling back to manual file hashing (which may be slower). If you are running this build in a pruned directory, you can ignore this message. Otherwise, please initialize a git repository in the root of your monorepo")
+var ErrFallback = errors.New("cannot find a .git, .sl or .hg folder. Falling back to manual file hashing (which may be slower). If you are running this build in a pruned directory, you can ignore this message. Otherwise, please initialize a repository in the root of your monorepo")
 
 // An SCM represents an SCM implementation that we can ask for various things.
 type SCM interface {
 	// ChangedFiles returns a list of modified files since the given commit, optionally including untracked files.*/
 	ChangedFiles(fromCommit string, toCommit string, includeUntracked bool, relativeTo string) ([]string, error)
+	// MergeBase returns the best common ancestor of the two given refs.
+	MergeBase(ref1 string, ref2 string) (string, error)
+	// GetPackageFileHashes returns the hashes of the files in the given package, keyed by
+	// their path within the package. If input patterns are given, only matching files are hashed.
+	GetPackageFileHashes(rootPath titanpath.AbsoluteSystemPath, opts *hashing.PackageDepsOptions) (map[titanpath.AnchoredUnixPath]string, error)
+	// PreviousContent returns the contents of the file at the given absolute path as of the given commit.
+	PreviousContent(fromCommit string, filePath string) ([]byte, error)
 }
 
-// newGitSCM returns a new SCM instance for this repo root.
+// CachingSCM is implemented by SCMs that keep a snapshot of the repository between calls.
+// Long-lived processes, such as the daemon, call Invalidate when files change.
+type CachingSCM interface {
+	SCM
+	// Invalidate drops the snapshot, so that it is read again when it is next needed
+	Invalidate()
+}
+
+// newSCM returns a new SCM instance for this repo root.
 // It returns nil if there is no known implementation there.
-func newGitSCM(repoRoot string) SCM {
+func newSCM(repoRoot string) SCM {
 	if fs.PathExists(filepath.Join(repoRoot, ".git")) {
-		return &git{repoRoot: repoRoot}
+		g := &git{repoRoot: repoRoot}
+		g.deepen = g.fetchDeepen
+		return g
 	}
-	return nil
-}
-
-// newFallback returns a new SCM instance for this repo root.
-// If there is no known implementation it returns a stub.
-func newFallback(repoRoot string) (SCM, error) {
-	if scm := newGitSCM(repoRoot); scm != nil {
-		return scm, nil
+	if fs.PathExists(filepath.Join(repoRoot, ".sl")) {
+		return &hg{repoRoot: repoRoot, bin: "sl"}
 	}
-
-	return &stub{}, ErrFallback
+	if fs.PathExists(filepath.Join(repoRoot, ".hg")) {
+		return &hg{repoRoot: repoRoot, bin: "hg"}
+	}
+	return nil
 }
 
 // FromInRepo produces an SCM instance, given a path within a
-// repository. It does not need to be a git repository, and if
-// it is not, the given path is assumed to be the root.
+// repository. If no supported repository contains the given path,
+// it returns a stub along with ErrFallback.
 func FromInRepo(repoRoot titanpath.AbsoluteSystemPath) (SCM, error) {
-	dotGitDir, err := repoRoot.Findup(".git")
-	if err != nil {
-		return nil, err
+	dir := repoRoot
+	for {
+		if scm := newSCM(dir.ToString()); scm != nil {
+			return scm, nil
+		}
+		parent := dir.Dir()
+		if parent == dir {
+			return &stub{}, ErrFallback
+		}
+		dir = parent
 	}
-	return newFallback(dotGitDir.Dir().ToStringDuringMigration())
 }
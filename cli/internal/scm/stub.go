@@ -3,8 +3,25 @@
 // SPDX-License-Identifier: Apache-2.0
 package scm
 
+import (
+	"github.com/khulnasoft/titanrepo/cli/internal/hashing"
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+)
+
 type stub struct{}
 
 func (s *stub) ChangedFiles(fromCommit string, toCommit string, includeUntracked bool, relativeTo string) ([]string, error) {
 	return nil, nil
 }
+
+func (s *stub) MergeBase(ref1 string, ref2 string) (string, error) {
+	return ref1, nil
+}
+
+func (s *stub) GetPackageFileHashes(rootPath titanpath.AbsoluteSystemPath, opts *hashing.PackageDepsOptions) (map[titanpath.AnchoredUnixPath]string, error) {
+	return nil, ErrFallback
+}
+
+func (s *stub) PreviousContent(fromCommit string, filePath string) ([]byte, error) {
+	return nil, ErrFallback
+}
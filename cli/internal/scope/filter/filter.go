@@ -21,11 +21,16 @@ type SelectedPackages struct {
 // packages that have changed in a particular range of git refs.
 type PackagesChangedInRange = func(fromRef string, toRef string) (util.Set, error)
 
+// MergeBase is the signature of a function to provide the best common ancestor
+// of two git refs.
+type MergeBase = func(ref1 string, ref2 string) (string, error)
+
 type Resolver struct {
 	Graph                  *dag.AcyclicGraph
 	PackageInfos           map[interface{}]*fs.PackageJSON
 	Cwd                    string
 	PackagesChangedInRange PackagesChangedInRange
+	MergeBase              MergeBase
 }
 
 // GetPackagesFromPatterns compiles filter patterns and applies them, returning
@@ -188,6 +193,24 @@ func (r *Resolver) filterGraphWithSelector(selector *TargetSelector) (util.Set,
 	return r.filterNodesWithSelector(selector)
 }
 
+// packagesChangedForSelector returns the packages that have changed in the selector's range
+// of git refs, resolving the merge-base first if the selector asks for it.
+func (r *Resolver) packagesChangedForSelector(selector *TargetSelector) (util.Set, error) {
+	fromRef := selector.fromRef
+	toRef := selector.getToRef()
+	if selector.fromMergeBase {
+		if r.MergeBase == nil {
+			return nil, fmt.Errorf("cannot resolve merge-base for %v", selector.raw)
+		}
+		mergeBase, err := r.MergeBase(fromRef, toRef)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to resolve %v", selector.raw)
+		}
+		fromRef = mergeBase
+	}
+	return r.PackagesChangedInRange(fromRef, toRef)
+}
+
 // filterNodesWithSelector returns the set of nodes that match a given selector
 func (r *Resolver) filterNodesWithSelector(selector *TargetSelector) (util.Set, error) {
 	entryPackages := make(util.Set)
@@ -195,7 +218,7 @@ func (r *Resolver) filterNodesWithSelector(selector *TargetSelector) (util.Set,
 	if selector.fromRef != "" {
 		// get changed packaged
 		selectorWasUsed = true
-		changedPkgs, err := r.PackagesChangedInRange(selector.fromRef, selector.getToRef())
+		changedPkgs, err := r.packagesChangedForSelector(selector)
 		if err != nil {
 			return nil, err
 		}
@@ -266,7 +289,7 @@ func (r *Resolver) filterNodesWithSelector(selector *TargetSelector) (util.Set,
 // match a selector
 func (r *Resolver) filterSubtreesWithSelector(selector *TargetSelector) (util.Set, error) {
 	// foreach package that matches parentDir && namePattern, check if any dependency is in changed packages
-	changedPkgs, err := r.PackagesChangedInRange(selector.fromRef, selector.getToRef())
+	changedPkgs, err := r.packagesChangedForSelector(selector)
 	if err != nil {
 		return nil, err
 	}
@@ -429,6 +429,12 @@ func Test_SCM(t *testing.T) {
 			}
 			panic(fmt.Sprintf("unsupported commit range %v...%v", fromRef, toRef))
 		},
+		MergeBase: func(ref1 string, ref2 string) (string, error) {
+			if ref1 == "main" && ref2 == "HEAD" {
+				return "HEAD~2", nil
+			}
+			return "", fmt.Errorf("no merge-base for %v and %v", ref1, ref2)
+		},
 	}
 
 	testCases := []struct {
@@ -519,6 +525,16 @@ func Test_SCM(t *testing.T) {
 			},
 			[]string{"package-3"},
 		},
+		{
+			"merge-base",
+			[]*TargetSelector{
+				{
+					fromRef:       "main",
+					fromMergeBase: true,
+				},
+			},
+			[]string{"package-1", "package-2", "package-3", util.RootPkgName},
+		},
 	}
 
 	for _, tc := range testCases {
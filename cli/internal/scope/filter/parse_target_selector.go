@@ -18,6 +18,7 @@ type TargetSelector struct {
 	namePattern         string
 	fromRef             string
 	toRefOverride       string
+	fromMergeBase       bool
 	raw                 string
 }
 
@@ -89,6 +90,7 @@ func ParseTargetSelector(rawSelector string, prefix string) (TargetSelector, err
 
 	fromRef := ""
 	toRefOverride := ""
+	fromMergeBase := false
 	parentDir := ""
 	namePattern := ""
 	preAddDepdencies := false
@@ -115,6 +117,8 @@ func ParseTargetSelector(rawSelector string, prefix string) (TargetSelector, err
 			if len(refs) == 2 {
 				fromRef = refs[0]
 				toRefOverride = refs[1]
+				// [origin/main...] compares against the merge-base of the given ref and HEAD
+				fromMergeBase = toRefOverride == ""
 			}
 		}
 	}
@@ -122,6 +126,7 @@ func ParseTargetSelector(rawSelector string, prefix string) (TargetSelector, err
 	return TargetSelector{
 		fromRef:             fromRef,
 		toRefOverride:       toRefOverride,
+		fromMergeBase:       fromMergeBase,
 		exclude:             exclude,
 		excludeSelf:         excludeSelf,
 		includeDependencies: includeDependencies,
@@ -194,6 +194,16 @@ func TestParseTargetSelector(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"...[origin/main...]",
+			args{"...[origin/main...]", "."},
+			TargetSelector{
+				fromRef:           "origin/main",
+				fromMergeBase:     true,
+				includeDependents: true,
+			},
+			false,
+		},
 		{
 			"{foo}[master]",
 			args{"{foo}[master]", "."},
@@ -4,14 +4,17 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/khulnasoft/titanrepo/cli/internal/context"
 	"github.com/khulnasoft/titanrepo/cli/internal/fs"
-	"github.com/khulnasoft/titanrepo/cli/internal/packagemanager"
+	"github.com/khulnasoft/titanrepo/cli/internal/lockfile"
 	"github.com/khulnasoft/titanrepo/cli/internal/scm"
 	scope_filter "github.com/khulnasoft/titanrepo/cli/internal/scope/filter"
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
 	"github.com/khulnasoft/titanrepo/cli/internal/util"
 	"github.com/khulnasoft/titanrepo/cli/internal/util/filter"
 	"github.com/mitchellh/cli"
@@ -52,6 +55,8 @@ type Opts struct {
 	GlobalDepPatterns []string
 	// Patterns are the filter patterns supplied to --filter on the commandline
 	FilterPatterns []string
+	// AffectedBase is the git ref used to select tasks whose inputs have changed
+	AffectedBase string
 }
 
 var (
@@ -64,6 +69,11 @@ match any filter will be included.`
 	_ignoreHelp    = `Files to ignore when calculating changed files (i.e. --since). Supports globs.`
 	_globalDepHelp = `Specify glob of global filesystem dependencies to be hashed. Useful for .env and files
 in the root directory. Includes titan.json, root package.json, and the root lockfile by default.`
+	_affectedHelp = `Run only the tasks whose inputs changed since the given
+git ref, along with the tasks that depend on them. Changed
+files are matched against each task's "inputs" globs.
+Append "..." to compare against the merge-base with HEAD,
+for example --affected=origin/main...`
 )
 
 // AddFlags adds the flags relevant to this package to the given FlagSet
@@ -71,6 +81,7 @@ func AddFlags(opts *Opts, flags *pflag.FlagSet) {
 	flags.StringArrayVar(&opts.FilterPatterns, "filter", nil, _filterHelp)
 	flags.StringArrayVar(&opts.IgnorePatterns, "ignore", nil, _ignoreHelp)
 	flags.StringArrayVar(&opts.GlobalDepPatterns, "global-deps", nil, _globalDepHelp)
+	flags.StringVar(&opts.AffectedBase, "affected", "", _affectedHelp)
 	addLegacyFlags(&opts.LegacyFilter, flags)
 }
 
@@ -118,11 +129,14 @@ func ResolvePackages(opts *Opts, cwd string, scm scm.SCM, ctx *context.Context,
 		Graph:                  &ctx.TopologicalGraph,
 		PackageInfos:           ctx.PackageInfos,
 		Cwd:                    cwd,
-		PackagesChangedInRange: opts.getPackageChangeFunc(scm, cwd, ctx.PackageInfos, ctx.PackageManager),
+		PackagesChangedInRange: opts.getPackageChangeFunc(scm, cwd, ctx, logger),
+		MergeBase:              scm.MergeBase,
 	}
 	filterPatterns := opts.FilterPatterns
 	legacyFilterPatterns := opts.LegacyFilter.asFilterPatterns()
 	filterPatterns = append(filterPatterns, legacyFilterPatterns...)
+	// --affected doesn't select packages. Its tasks are selected by their inputs once the task
+	// graph is built, since inputs can reach outside of their package.
 	isAllPackages := len(filterPatterns) == 0
 	filteredPkgs, err := filterResolver.GetPackagesFromPatterns(filterPatterns)
 	if err != nil {
@@ -139,50 +153,223 @@ func ResolvePackages(opts *Opts, cwd string, scm scm.SCM, ctx *context.Context,
 	return filteredPkgs, isAllPackages, nil
 }
 
-func (o *Opts) getPackageChangeFunc(scm scm.SCM, cwd string, packageInfos map[interface{}]*fs.PackageJSON, packageManager *packagemanager.PackageManager) scope_filter.PackagesChangedInRange {
+// changedPackagesSource is implemented by SCMs that can say which packages have changed
+// without being asked for the changed files, such as one backed by the daemon
+type changedPackagesSource interface {
+	ChangedPackages(fromRef string, toRef string, globalDepPatterns []string, ignorePatterns []string) ([]string, error)
+}
+
+func (o *Opts) getPackageChangeFunc(scm scm.SCM, cwd string, ctx *context.Context, logger hclog.Logger) scope_filter.PackagesChangedInRange {
 	return func(fromRef string, toRef string) (util.Set, error) {
+		if source, ok := scm.(changedPackagesSource); ok {
+			if pkgs, err := source.ChangedPackages(fromRef, toRef, o.GlobalDepPatterns, o.IgnorePatterns); err == nil {
+				changedPkgs := make(util.Set)
+				for _, pkg := range pkgs {
+					// The source's package graph may be briefly out of date
+					if _, ok := ctx.PackageInfos[pkg]; ok {
+						changedPkgs.Add(pkg)
+					}
+				}
+				return changedPkgs, nil
+			}
+		}
 		// We could filter changed files at the git level, since it's possible
 		// that the changes we're interested in are scoped, but we need to handle
 		// global dependencies changing as well. A future optimization might be to
 		// scope changed files more deeply if we know there are no global dependencies.
-		var changedFiles []string
-		if fromRef != "" {
-			scmChangedFiles, err := scm.ChangedFiles(fromRef, toRef, true, cwd)
-			if err != nil {
-				return nil, err
-			}
-			changedFiles = scmChangedFiles
-		}
-		if hasRepoGlobalFileChanged, err := repoGlobalFileHasChanged(o, getDefaultGlobalDeps(packageManager), changedFiles); err != nil {
+		changedFiles, hasRepoGlobalFileChanged, err := o.getChangedFiles(scm, cwd, fromRef, toRef)
+		if err != nil {
 			return nil, err
 		} else if hasRepoGlobalFileChanged {
 			allPkgs := make(util.Set)
-			for pkg := range packageInfos {
+			for pkg := range ctx.PackageInfos {
 				allPkgs.Add(pkg)
 			}
 			return allPkgs, nil
 		}
-		filteredChangedFiles, err := filterIgnoredFiles(o, changedFiles)
+		changedFiles, lockfileChangedPkgs := getLockfileChangedPackages(scm, cwd, fromRef, toRef, ctx, changedFiles, logger)
+		changedPkgs := getChangedPackages(changedFiles, ctx.PackageInfos)
+		return changedPkgs.Union(lockfileChangedPkgs), nil
+	}
+}
+
+// ChangedPackages returns the packages that contain files changed between fromRef and toRef.
+// If any of the repo's global dependencies have changed, every package is returned.
+func ChangedPackages(opts *Opts, cwd string, scm scm.SCM, ctx *context.Context, fromRef string, toRef string, logger hclog.Logger) (util.Set, error) {
+	return opts.getPackageChangeFunc(scm, cwd, ctx, logger)(fromRef, toRef)
+}
+
+// getLockfileChangedPackages removes the root lockfile from changedFiles and returns the
+// packages whose resolved external dependencies differ from those in the lockfile at the
+// merge-base of fromRef and toRef. If the previous lockfile can't be read or compared,
+// every package is considered changed.
+func getLockfileChangedPackages(scm scm.SCM, cwd string, fromRef string, toRef string, ctx *context.Context, changedFiles []string, logger hclog.Logger) ([]string, util.Set) {
+	changedPkgs := make(util.Set)
+	if ctx.PackageManager == nil || ctx.PackageManager.Lockfile == "" {
+		return changedFiles, changedPkgs
+	}
+	otherChangedFiles := make([]string, 0, len(changedFiles))
+	lockfileChanged := false
+	for _, file := range changedFiles {
+		if filepath.ToSlash(file) == ctx.PackageManager.Lockfile {
+			lockfileChanged = true
+		} else {
+			otherChangedFiles = append(otherChangedFiles, file)
+		}
+	}
+	if !lockfileChanged {
+		return changedFiles, changedPkgs
+	}
+	pkgs, err := lockfileDepsChanged(scm, cwd, fromRef, toRef, ctx, logger)
+	if err != nil {
+		// We can't tell which packages are affected, so be conservative
+		logger.Warn(fmt.Sprintf("unable to compare %v with the version at %v, considering every package changed", ctx.PackageManager.Lockfile, fromRef), "error", err)
+		for pkg := range ctx.PackageInfos {
+			changedPkgs.Add(pkg)
+		}
+		return otherChangedFiles, changedPkgs
+	}
+	return otherChangedFiles, pkgs
+}
+
+// lockfileDepsChanged compares each package's resolved external dependencies in the current
+// lockfile against those in the lockfile at the merge-base of fromRef and toRef. A package
+// that can't be resolved in the previous lockfile, e.g. because it was added since, is changed.
+func lockfileDepsChanged(scm scm.SCM, cwd string, fromRef string, toRef string, ctx *context.Context, logger hclog.Logger) (util.Set, error) {
+	if ctx.Lockfile == nil {
+		return nil, errors.New("no lockfile to compare against")
+	}
+	base := toRef
+	if fromRef != "" {
+		mergeBase, err := scm.MergeBase(fromRef, toRef)
+		if err != nil {
+			return nil, err
+		}
+		base = mergeBase
+	}
+	contents, err := scm.PreviousContent(base, filepath.Join(cwd, ctx.PackageManager.Lockfile))
+	if err != nil {
+		return nil, err
+	}
+	previousLockfile, err := ctx.PackageManager.ParseLockfile(contents)
+	if err != nil {
+		return nil, err
+	} else if previousLockfile == nil {
+		return nil, errors.New("unable to parse previous lockfile")
+	}
+	changedPkgs := make(util.Set)
+	for pkgName, pkg := range ctx.PackageInfos {
+		currentDeps, err := context.ResolveExternalDeps(ctx.Lockfile, pkg)
 		if err != nil {
 			return nil, err
 		}
-		changedPkgs := getChangedPackages(filteredChangedFiles, packageInfos)
-		return changedPkgs, nil
+		previousDeps, err := context.ResolveExternalDeps(previousLockfile, pkg)
+		if err != nil {
+			logger.Debug(fmt.Sprintf("unable to resolve %v in the previous lockfile, considering it changed", pkgName), "error", err)
+			changedPkgs.Add(pkgName)
+			continue
+		}
+		if !lockfileEntriesEqual(previousLockfile, previousDeps, ctx.Lockfile, currentDeps) {
+			changedPkgs.Add(pkgName)
+		}
 	}
+	return changedPkgs, nil
 }
 
-func getDefaultGlobalDeps(packageManager *packagemanager.PackageManager) []string {
-	// include titan.json, root package.json, and root lockfile as implicit global dependencies
-	defaultGlobalDeps := []string{
-		"titan.json",
-		"package.json",
+// lockfileEntriesEqual returns whether the resolved dependencies are the same in both lockfiles,
+// including the parts of their entries that aren't versions, such as their integrity
+func lockfileEntriesEqual(previousLockfile lockfile.Lockfile, previousDeps map[string]string, currentLockfile lockfile.Lockfile, currentDeps map[string]string) bool {
+	if !reflect.DeepEqual(previousDeps, currentDeps) {
+		return false
 	}
-	if packageManager != nil {
-		// TODO: we should be smarter here and determine if the lockfile changes actually impact the given scope
-		defaultGlobalDeps = append(defaultGlobalDeps, packageManager.Lockfile)
+	previousEntries, ok := previousLockfile.(lockfile.EntryLockfile)
+	if !ok {
+		return true
 	}
+	currentEntries, ok := currentLockfile.(lockfile.EntryLockfile)
+	if !ok {
+		return true
+	}
+	for key := range currentDeps {
+		previousEntry, _ := previousEntries.PackageEntry(key)
+		currentEntry, _ := currentEntries.PackageEntry(key)
+		if !reflect.DeepEqual(previousEntry, currentEntry) {
+			return false
+		}
+	}
+	return true
+}
+
+// getChangedFiles returns the non-ignored files that have changed between fromRef and toRef,
+// and whether or not any of the repo's global dependencies are among them.
+func (o *Opts) getChangedFiles(scm scm.SCM, cwd string, fromRef string, toRef string) ([]string, bool, error) {
+	var changedFiles []string
+	if fromRef != "" {
+		scmChangedFiles, err := scm.ChangedFiles(fromRef, toRef, true, cwd)
+		if err != nil {
+			return nil, false, err
+		}
+		changedFiles = scmChangedFiles
+	}
+	if hasRepoGlobalFileChanged, err := repoGlobalFileHasChanged(o, getDefaultGlobalDeps(), changedFiles); err != nil {
+		return nil, false, err
+	} else if hasRepoGlobalFileChanged {
+		return changedFiles, true, nil
+	}
+	filteredChangedFiles, err := filterIgnoredFiles(o, changedFiles)
+	if err != nil {
+		return nil, false, err
+	}
+	return filteredChangedFiles, false, nil
+}
+
+// AffectedFiles returns the files that have changed since opts.AffectedBase, anchored at the
+// repository root. A package whose resolved dependencies changed in the lockfile is treated as
+// if its package.json had changed. If a global dependency has changed, every task is affected,
+// and this returns nil.
+func AffectedFiles(opts *Opts, cwd string, scm scm.SCM, ctx *context.Context, logger hclog.Logger) ([]titanpath.AnchoredUnixPath, error) {
+	fromRef := opts.AffectedBase
+	if strings.HasSuffix(fromRef, "...") {
+		// As with filters, a trailing ... compares against the merge-base with HEAD
+		mergeBase, err := scm.MergeBase(strings.TrimSuffix(fromRef, "..."), "HEAD")
+		if err != nil {
+			return nil, err
+		}
+		fromRef = mergeBase
+	}
+	changedFiles, hasRepoGlobalFileChanged, err := opts.getChangedFiles(scm, cwd, fromRef, "HEAD")
+	if err != nil {
+		return nil, err
+	} else if hasRepoGlobalFileChanged {
+		return nil, nil
+	}
+	changedFiles, lockfileChangedPkgs := getLockfileChangedPackages(scm, cwd, fromRef, "HEAD", ctx, changedFiles, logger)
+	affectedFiles := []titanpath.AnchoredUnixPath{}
+	pkgNames := lockfileChangedPkgs.UnsafeListOfStrings()
+	sort.Strings(pkgNames)
+	for _, pkgName := range pkgNames {
+		// package.json is an input to every task, so a change to a package's resolved
+		// dependencies marks all of its tasks as affected
+		pkgDir := titanpath.AnchoredUnixPath("")
+		if pkg, ok := ctx.PackageInfos[pkgName]; ok && pkgName != util.RootPkgName {
+			pkgDir = pkg.Dir.ToUnixPath()
+		}
+		affectedFiles = append(affectedFiles, pkgDir.Join("package.json"))
+	}
+	for _, changedFile := range changedFiles {
+		affectedFiles = append(affectedFiles, titanpath.AnchoredSystemPathFromUpstream(changedFile).ToUnixPath())
+	}
+	return affectedFiles, nil
+}
 
-	return defaultGlobalDeps
+func getDefaultGlobalDeps() []string {
+	// include titan.json and root package.json as implicit global dependencies. The root
+	// lockfile is handled separately by getLockfileChangedPackages, since a change to it
+	// usually only affects some packages.
+	return []string{
+		"titan.json",
+		"package.json",
+	}
 }
 
 func repoGlobalFileHasChanged(opts *Opts, defaultGlobalDeps []string, changedFiles []string) (bool, error) {
@@ -249,18 +436,19 @@ func fileInPackage(changedFile string, packagePath string) bool {
 func getChangedPackages(changedFiles []string, packageInfos map[interface{}]*fs.PackageJSON) util.Set {
 	changedPackages := make(util.Set)
 	for _, changedFile := range changedFiles {
-		found := false
-		for pkgName, pkgInfo := range packageInfos {
-			if pkgName != util.RootPkgName && fileInPackage(changedFile, pkgInfo.Dir.ToStringDuringMigration()) {
-				changedPackages.Add(pkgName)
-				found = true
-				break
-			}
-		}
-		if !found {
-			// Consider the root package to have changed
-			changedPackages.Add(util.RootPkgName)
-		}
+		changedPackages.Add(getPackageForFile(changedFile, packageInfos))
 	}
 	return changedPackages
 }
+
+// getPackageForFile returns the name of the package containing the given file. Files that
+// are not within any workspace belong to the root package.
+func getPackageForFile(changedFile string, packageInfos map[interface{}]*fs.PackageJSON) string {
+	for pkgName, pkgInfo := range packageInfos {
+		if pkgName != util.RootPkgName && fileInPackage(changedFile, pkgInfo.Dir.ToStringDuringMigration()) {
+			return pkgName.(string)
+		}
+	}
+	// Consider the root package to have changed
+	return util.RootPkgName
+}
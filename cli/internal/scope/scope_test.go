@@ -1,14 +1,18 @@
 package scope
 
 import (
+	"errors"
 	"fmt"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/khulnasoft/titanrepo/cli/internal/context"
 	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/hashing"
+	"github.com/khulnasoft/titanrepo/cli/internal/lockfile"
 	"github.com/khulnasoft/titanrepo/cli/internal/packagemanager"
 	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
 	"github.com/khulnasoft/titanrepo/cli/internal/ui"
@@ -17,13 +21,29 @@ import (
 )
 
 type mockSCM struct {
-	changed []string
+	changed  []string
+	previous []byte
 }
 
 func (m *mockSCM) ChangedFiles(_fromCommit string, _toCommit string, _includeUntracked bool, _relativeTo string) ([]string, error) {
 	return m.changed, nil
 }
 
+func (m *mockSCM) MergeBase(ref1 string, _ref2 string) (string, error) {
+	return ref1, nil
+}
+
+func (m *mockSCM) GetPackageFileHashes(_rootPath titanpath.AbsoluteSystemPath, _opts *hashing.PackageDepsOptions) (map[titanpath.AnchoredUnixPath]string, error) {
+	return nil, nil
+}
+
+func (m *mockSCM) PreviousContent(_fromCommit string, _filePath string) ([]byte, error) {
+	if m.previous == nil {
+		return nil, errors.New("no previous content")
+	}
+	return m.previous, nil
+}
+
 func TestResolvePackages(t *testing.T) {
 	tui := ui.Default()
 	logger := hclog.Default()
@@ -296,3 +316,215 @@ func TestResolvePackages(t *testing.T) {
 		})
 	}
 }
+
+func TestAffectedFiles(t *testing.T) {
+	packageInfos := map[interface{}]*fs.PackageJSON{
+		util.RootPkgName: {},
+		"web": {
+			Dir: titanpath.AnchoredUnixPath("apps/web").ToSystemPath(),
+		},
+		"ui": {
+			Dir: titanpath.AnchoredUnixPath("packages/ui").ToSystemPath(),
+		},
+	}
+	testCases := []struct {
+		name       string
+		changed    []string
+		ignore     []string
+		globalDeps []string
+		expected   []titanpath.AnchoredUnixPath
+	}{
+		{
+			name:     "files are anchored at the repository root",
+			changed:  []string{"apps/web/src/index.ts", "apps/web/README.md", "packages/ui/package.json", "scripts/release.sh"},
+			expected: []titanpath.AnchoredUnixPath{"apps/web/src/index.ts", "apps/web/README.md", "packages/ui/package.json", "scripts/release.sh"},
+		},
+		{
+			name:     "ignored files are dropped",
+			changed:  []string{"apps/web/src/index.ts", "apps/web/README.md"},
+			ignore:   []string{"**/*.md"},
+			expected: []titanpath.AnchoredUnixPath{"apps/web/src/index.ts"},
+		},
+		{
+			name:     "lockfile changed and cannot be compared",
+			changed:  []string{"yarn.lock", "apps/web/src/index.ts"},
+			expected: []titanpath.AnchoredUnixPath{"package.json", "packages/ui/package.json", "apps/web/package.json", "apps/web/src/index.ts"},
+		},
+		{
+			name:     "nothing changed",
+			changed:  []string{},
+			expected: []titanpath.AnchoredUnixPath{},
+		},
+		{
+			name:       "global dependency changed",
+			changed:    []string{"apps/web/src/index.ts", ".env"},
+			globalDeps: []string{".env"},
+			expected:   nil,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			systemSeparatorChanged := make([]string, len(tc.changed))
+			for index, path := range tc.changed {
+				systemSeparatorChanged[index] = filepath.FromSlash(path)
+			}
+			affectedFiles, err := AffectedFiles(&Opts{
+				AffectedBase:      "main",
+				IgnorePatterns:    tc.ignore,
+				GlobalDepPatterns: tc.globalDeps,
+			}, filepath.FromSlash("/dummy/repo/root"), &mockSCM{changed: systemSeparatorChanged}, &context.Context{
+				PackageInfos:   packageInfos,
+				PackageManager: &packagemanager.PackageManager{Lockfile: "yarn.lock"},
+			}, hclog.NewNullLogger())
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(affectedFiles, tc.expected) {
+				t.Errorf("AffectedFiles got %v, want %v", affectedFiles, tc.expected)
+			}
+		})
+	}
+}
+
+const _previousNpmLockfile = `{
+  "name": "monorepo",
+  "lockfileVersion": 3,
+  "packages": {
+    "": {"name": "monorepo", "workspaces": ["apps/*", "packages/*"]},
+    "apps/web": {"name": "web", "dependencies": {"react": "^18.0.0", "ui": "*"}},
+    "packages/ui": {"name": "ui", "dependencies": {"lodash": "^4.17.0"}},
+    "node_modules/react": {"version": "18.1.0", "dependencies": {"loose-envify": "^1.1.0"}},
+    "node_modules/loose-envify": {"version": "1.4.0"},
+    "node_modules/lodash": {"version": "4.17.20"},
+    "node_modules/web": {"resolved": "apps/web", "link": true},
+    "node_modules/ui": {"resolved": "packages/ui", "link": true}
+  }
+}`
+
+func TestLockfileChangedPackages(t *testing.T) {
+	currentLockfile, err := lockfile.DecodeNpmLockfile([]byte(strings.Replace(_previousNpmLockfile, `"version": "4.17.20"`, `"version": "4.17.21"`, 1)))
+	if err != nil {
+		t.Fatalf("failed to decode lockfile: %v", err)
+	}
+	packageManager, err := packagemanager.GetPackageManager("", &fs.PackageJSON{PackageManager: "npm@8.19.2"})
+	if err != nil {
+		t.Fatalf("failed to get package manager: %v", err)
+	}
+	packageInfos := map[interface{}]*fs.PackageJSON{
+		util.RootPkgName: {
+			UnresolvedExternalDeps: map[string]string{},
+		},
+		"web": {
+			Dir:                    titanpath.AnchoredUnixPath("apps/web").ToSystemPath(),
+			UnresolvedExternalDeps: map[string]string{"react": "^18.0.0"},
+		},
+		"ui": {
+			Dir:                    titanpath.AnchoredUnixPath("packages/ui").ToSystemPath(),
+			UnresolvedExternalDeps: map[string]string{"lodash": "^4.17.0"},
+		},
+	}
+	ctx := &context.Context{
+		PackageInfos:   packageInfos,
+		PackageManager: packageManager,
+		Lockfile:       currentLockfile,
+	}
+	testCases := []struct {
+		name     string
+		changed  []string
+		previous []byte
+		expected []string
+	}{
+		{
+			name:     "only packages with changed dependencies are affected",
+			changed:  []string{"package-lock.json"},
+			previous: []byte(_previousNpmLockfile),
+			expected: []string{"ui"},
+		},
+		{
+			name:     "lockfile changes are combined with changed files",
+			changed:  []string{"package-lock.json", "apps/web/src/index.ts"},
+			previous: []byte(_previousNpmLockfile),
+			expected: []string{"ui", "web"},
+		},
+		{
+			name:     "workspace missing from the previous lockfile",
+			changed:  []string{"package-lock.json"},
+			previous: []byte(strings.Replace(_previousNpmLockfile, `"apps/web": {"name": "web", "dependencies": {"react": "^18.0.0", "ui": "*"}},`, "", 1)),
+			expected: []string{"ui", "web"},
+		},
+		{
+			name:     "resolved url changed without the version",
+			changed:  []string{"package-lock.json"},
+			previous: []byte(strings.NewReplacer(`"version": "4.17.20"`, `"version": "4.17.21"`, `"version": "18.1.0"`, `"version": "18.1.0", "resolved": "https://registry.example.com/react-18.1.0.tgz"`).Replace(_previousNpmLockfile)),
+			expected: []string{"web"},
+		},
+		{
+			name:     "previous lockfile is unavailable",
+			changed:  []string{"package-lock.json"},
+			expected: []string{util.RootPkgName, "ui", "web"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			systemSeparatorChanged := make([]string, len(tc.changed))
+			for index, path := range tc.changed {
+				systemSeparatorChanged[index] = filepath.FromSlash(path)
+			}
+			changedPkgs, err := ChangedPackages(&Opts{}, filepath.FromSlash("/dummy/repo/root"), &mockSCM{
+				changed:  systemSeparatorChanged,
+				previous: tc.previous,
+			}, ctx, "main", "HEAD", hclog.NewNullLogger())
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			expected := make(util.Set)
+			for _, pkg := range tc.expected {
+				expected.Add(pkg)
+			}
+			if !reflect.DeepEqual(changedPkgs, expected) {
+				t.Errorf("ChangedPackages got %v, want %v", changedPkgs, expected)
+			}
+		})
+	}
+}
+
+// daemonMockSCM reports changed packages itself, as the daemon does
+type daemonMockSCM struct {
+	mockSCM
+	changedPkgs []string
+	err         error
+}
+
+func (m *daemonMockSCM) ChangedPackages(_fromRef string, _toRef string, _globalDepPatterns []string, _ignorePatterns []string) ([]string, error) {
+	return m.changedPkgs, m.err
+}
+
+func TestChangedPackagesFromSource(t *testing.T) {
+	ctx := &context.Context{
+		PackageInfos: map[interface{}]*fs.PackageJSON{
+			"web": {Dir: titanpath.AnchoredUnixPath("apps/web").ToSystemPath()},
+			"ui":  {Dir: titanpath.AnchoredUnixPath("packages/ui").ToSystemPath()},
+		},
+	}
+	scm := &daemonMockSCM{
+		mockSCM:     mockSCM{changed: []string{filepath.FromSlash("apps/web/index.ts")}},
+		changedPkgs: []string{"ui", "deleted"},
+	}
+	changedPkgs, err := ChangedPackages(&Opts{}, filepath.FromSlash("/dummy/repo/root"), scm, ctx, "main", "HEAD", hclog.NewNullLogger())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(changedPkgs, util.SetFromStrings([]string{"ui"})) {
+		t.Errorf("ChangedPackages got %v, want the packages from the source", changedPkgs)
+	}
+
+	// Changed files are used if the source fails
+	scm.err = errors.New("daemon unavailable")
+	changedPkgs, err = ChangedPackages(&Opts{}, filepath.FromSlash("/dummy/repo/root"), scm, ctx, "main", "HEAD", hclog.NewNullLogger())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(changedPkgs, util.SetFromStrings([]string{"web"})) {
+		t.Errorf("ChangedPackages got %v, want the packages with changed files", changedPkgs)
+	}
+}
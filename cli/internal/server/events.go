@@ -0,0 +1,176 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/titandprotocol"
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+	"github.com/khulnasoft/titanrepo/cli/internal/util"
+)
+
+// _subscriberBufferSize is how many events a subscriber can fall behind by before
+// it is disconnected
+const _subscriberBufferSize = 256
+
+// _packageChangeDelay is how long we collect file changes for before reporting the
+// packages they belong to, so that a burst of changes produces a single event
+var _packageChangeDelay = 100 * time.Millisecond
+
+var (
+	errSubscriberBehind = errors.New("subscriber fell too far behind")
+	errEventsClosed     = errors.New("the daemon is shutting down")
+)
+
+// subscription is a single subscriber's view of the event stream
+type subscription struct {
+	events chan *titandprotocol.Event
+	// err is set before events is closed
+	err error
+}
+
+// eventBroker fans events out to subscribers. Publishing never blocks: subscribers
+// that can't keep up are disconnected.
+type eventBroker struct {
+	mu            sync.Mutex
+	subscriptions map[*subscription]struct{}
+	closed        bool
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{
+		subscriptions: make(map[*subscription]struct{}),
+	}
+}
+
+// subscribe returns a new subscription, along with a function to end it
+func (b *eventBroker) subscribe() (*subscription, func()) {
+	sub := &subscription{
+		events: make(chan *titandprotocol.Event, _subscriberBufferSize),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		b.end(sub, errEventsClosed)
+	} else {
+		b.subscriptions[sub] = struct{}{}
+	}
+	return sub, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscriptions, sub)
+	}
+}
+
+// end closes a subscription. Must be called while b.mu is held.
+func (b *eventBroker) end(sub *subscription, err error) {
+	sub.err = err
+	close(sub.events)
+	delete(b.subscriptions, sub)
+}
+
+func (b *eventBroker) hasSubscribers() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscriptions) > 0
+}
+
+func (b *eventBroker) publish(ev *titandprotocol.Event) {
+	ev.TimestampMsec = uint64(time.Now().UnixMilli())
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscriptions {
+		select {
+		case sub.events <- ev:
+		default:
+			b.end(sub, errSubscriberBehind)
+		}
+	}
+}
+
+// close ends every subscription, and any made afterwards
+func (b *eventBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subscriptions {
+		b.end(sub, errEventsClosed)
+	}
+}
+
+// packageChangeReporter collects changed files and periodically reports the
+// packages that contain them
+type packageChangeReporter struct {
+	logger    hclog.Logger
+	repoRoot  titanpath.AbsoluteSystemPath
+	repoState *repoState
+	events    *eventBroker
+
+	mu      sync.Mutex
+	pending map[titanpath.AbsoluteSystemPath]struct{}
+	timer   *time.Timer
+}
+
+func (p *packageChangeReporter) onFileChanged(path titanpath.AbsoluteSystemPath) {
+	if !path.HasPrefix(p.repoRoot) || !p.events.hasSubscribers() {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending == nil {
+		p.pending = make(map[titanpath.AbsoluteSystemPath]struct{})
+	}
+	p.pending[path] = struct{}{}
+	if p.timer == nil {
+		p.timer = time.AfterFunc(_packageChangeDelay, p.report)
+	}
+}
+
+func (p *packageChangeReporter) report() {
+	p.mu.Lock()
+	pending := p.pending
+	p.pending = nil
+	p.timer = nil
+	p.mu.Unlock()
+	graph, err := p.repoState.getPackageGraph()
+	if err != nil {
+		p.logger.Error(fmt.Sprintf("failed to build package graph to report changed packages: %v", err))
+		return
+	}
+	changedPackages := make(util.Set)
+	for path := range pending {
+		changedPackages.Add(packageForPath(path, p.repoRoot, graph.PackageInfos))
+	}
+	packages := changedPackages.UnsafeListOfStrings()
+	sort.Strings(packages)
+	p.events.publish(&titandprotocol.Event{
+		Event: &titandprotocol.Event_PackagesChanged{
+			PackagesChanged: &titandprotocol.PackagesChanged{
+				Packages: packages,
+			},
+		},
+	})
+}
+
+// packageForPath returns the name of the innermost package containing path. Paths
+// outside of any workspace belong to the root package.
+func packageForPath(path titanpath.AbsoluteSystemPath, repoRoot titanpath.AbsoluteSystemPath, packageInfos map[interface{}]*fs.PackageJSON) string {
+	name := util.RootPkgName
+	var longest titanpath.AbsoluteSystemPath
+	for pkgName, pkg := range packageInfos {
+		if pkgName == util.RootPkgName {
+			continue
+		}
+		pkgDir := pkg.Dir.RestoreAnchor(repoRoot)
+		if path.HasPrefix(pkgDir) && len(pkgDir) > len(longest) {
+			name = pkgName.(string)
+			longest = pkgDir
+		}
+	}
+	return name
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"gotest.tools/v3/assert"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/titandprotocol"
+)
+
+func runStatusEvent(runID string) *titandprotocol.Event {
+	return &titandprotocol.Event{
+		Event: &titandprotocol.Event_RunStatusChanged{
+			RunStatusChanged: &titandprotocol.RunStatusChanged{
+				RunId:  runID,
+				Status: titandprotocol.RunStatus_RUN_STATUS_STARTED,
+			},
+		},
+	}
+}
+
+func TestEventBroker(t *testing.T) {
+	broker := newEventBroker()
+	assert.Assert(t, !broker.hasSubscribers())
+
+	first, unsubscribeFirst := broker.subscribe()
+	second, unsubscribeSecond := broker.subscribe()
+	defer unsubscribeSecond()
+	assert.Assert(t, broker.hasSubscribers())
+
+	broker.publish(runStatusEvent("1"))
+	assert.Equal(t, (<-first.events).GetRunStatusChanged().RunId, "1")
+	assert.Equal(t, (<-second.events).GetRunStatusChanged().RunId, "1")
+
+	// Unsubscribed clients no longer get events
+	unsubscribeFirst()
+	broker.publish(runStatusEvent("2"))
+	assert.Equal(t, len(first.events), 0)
+	assert.Equal(t, (<-second.events).GetRunStatusChanged().RunId, "2")
+
+	// A subscriber that falls behind is disconnected, without holding up publishing
+	for i := 0; i <= _subscriberBufferSize; i++ {
+		broker.publish(runStatusEvent("3"))
+	}
+	for range second.events {
+	}
+	assert.ErrorIs(t, second.err, errSubscriberBehind)
+	assert.Assert(t, !broker.hasSubscribers())
+
+	// Closing ends current and future subscriptions
+	third, unsubscribeThird := broker.subscribe()
+	defer unsubscribeThird()
+	broker.close()
+	_, ok := <-third.events
+	assert.Assert(t, !ok, "expected subscription to end")
+	assert.ErrorIs(t, third.err, errEventsClosed)
+	fourth, unsubscribeFourth := broker.subscribe()
+	defer unsubscribeFourth()
+	_, ok = <-fourth.events
+	assert.Assert(t, !ok, "expected subscription to end")
+}
+
+func TestPackageChangeReporter(t *testing.T) {
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	writeFile := func(path string, contents string) {
+		t.Helper()
+		file := repoRoot.UntypedJoin(path)
+		assert.NilError(t, file.EnsureDir(), "EnsureDir")
+		assert.NilError(t, file.WriteFile([]byte(contents), 0644), "WriteFile")
+	}
+	writeFile("package.json", `{"name": "root", "packageManager": "npm@8.19.2", "workspaces": ["packages/*", "packages/a/nested"]}`)
+	writeFile("packages/a/package.json", `{"name": "a"}`)
+	writeFile("packages/a/nested/package.json", `{"name": "nested"}`)
+	writeFile("packages/b/package.json", `{"name": "b"}`)
+
+	broker := newEventBroker()
+	reporter := &packageChangeReporter{
+		logger:    hclog.NewNullLogger(),
+		repoRoot:  repoRoot,
+		repoState: newRepoState(repoRoot, nil),
+		events:    broker,
+	}
+
+	// Without subscribers, changes aren't tracked
+	reporter.onFileChanged(repoRoot.UntypedJoin("packages", "b", "index.js"))
+	assert.Equal(t, len(reporter.pending), 0)
+
+	sub, unsubscribe := broker.subscribe()
+	defer unsubscribe()
+	reporter.onFileChanged(repoRoot.UntypedJoin("packages", "a", "index.js"))
+	reporter.onFileChanged(repoRoot.UntypedJoin("packages", "a", "nested", "index.js"))
+	reporter.onFileChanged(repoRoot.UntypedJoin("README.md"))
+	// Files outside of the repository, such as the daemon's cookies, are ignored
+	reporter.onFileChanged(repoRoot.Dir().UntypedJoin("elsewhere"))
+
+	select {
+	case ev := <-sub.events:
+		assert.DeepEqual(t, ev.GetPackagesChanged().Packages, []string{"//", "a", "nested"})
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for changed packages")
+	}
+}
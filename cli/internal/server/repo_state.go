@@ -0,0 +1,196 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/context"
+	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/hashing"
+	"github.com/khulnasoft/titanrepo/cli/internal/scm"
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+)
+
+// _packageGraphFiles are the files that determine the shape of the package graph.
+// Changing any of them, wherever they are in the repo, invalidates the graph.
+var _packageGraphFiles = map[string]bool{
+	"package.json":        true,
+	"titan.json":          true,
+	"pnpm-workspace.yaml": true,
+	"package-lock.json":   true,
+	"npm-shrinkwrap.json": true,
+	"yarn.lock":           true,
+	".yarnrc.yml":         true,
+	"pnpm-lock.yaml":      true,
+	"bun.lock":            true,
+	"bun.lockb":           true,
+}
+
+// packageFileHashes are the hashes of the files in a package matching a set of inputs
+type packageFileHashes struct {
+	packageDir titanpath.AbsoluteSystemPath
+	hashes     map[titanpath.AnchoredUnixPath]string
+	// stale is set when a file changes while the hashes are being calculated
+	stale bool
+}
+
+// repoState keeps a warm copy of the package graph and of the hashes of package files,
+// which are computed on first use and dropped when the files they depend on change.
+type repoState struct {
+	repoRoot      titanpath.AbsoluteSystemPath
+	scm           scm.SCM
+	fileHashCache *hashing.FileHashCache
+
+	mu sync.Mutex
+	// graphGeneration is bumped whenever the graph is invalidated, so that a graph that
+	// was being built at the time is not kept
+	graphGeneration uint64
+	graph           *context.Context
+	fileHashes      map[string]*packageFileHashes
+	pendingHashes   map[*packageFileHashes]struct{}
+}
+
+func newRepoState(repoRoot titanpath.AbsoluteSystemPath, fileHashCache *hashing.FileHashCache) *repoState {
+	// Without a supported SCM we get a stub, and hashing requests fail so that
+	// clients fall back to hashing files themselves
+	scmInstance, _ := scm.FromInRepo(repoRoot)
+	return &repoState{
+		repoRoot:      repoRoot,
+		scm:           scmInstance,
+		fileHashCache: fileHashCache,
+		fileHashes:    make(map[string]*packageFileHashes),
+		pendingHashes: make(map[*packageFileHashes]struct{}),
+	}
+}
+
+// getPackageGraph returns the package graph, building it if necessary
+func (r *repoState) getPackageGraph() (*context.Context, error) {
+	r.mu.Lock()
+	graph := r.graph
+	generation := r.graphGeneration
+	r.mu.Unlock()
+	if graph != nil {
+		return graph, nil
+	}
+	rootPackageJSON, err := fs.ReadPackageJSON(r.repoRoot.UntypedJoin("package.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read package.json: %w", err)
+	}
+	graph, err = context.BuildPackageGraph(r.repoRoot, rootPackageJSON)
+	if err != nil {
+		var warnings *context.Warnings
+		if !errors.As(err, &warnings) {
+			return nil, err
+		}
+	}
+	r.mu.Lock()
+	if r.graphGeneration == generation {
+		r.graph = graph
+	}
+	r.mu.Unlock()
+	return graph, nil
+}
+
+// getFileHashes returns the hashes of the files within the given package that match
+// inputPatterns, or of all of its files if there are no patterns.
+func (r *repoState) getFileHashes(packagePath titanpath.AnchoredSystemPath, inputPatterns []string) (map[titanpath.AnchoredUnixPath]string, error) {
+	cleanPath := filepath.Clean(packagePath.ToString())
+	if filepath.IsAbs(cleanPath) || cleanPath == ".." || strings.HasPrefix(cleanPath, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("package path %v is not within the repository", packagePath)
+	}
+	inputs := make([]string, len(inputPatterns))
+	copy(inputs, inputPatterns)
+	sort.Strings(inputs)
+	key := fmt.Sprintf("%v#%v", packagePath.ToUnixPath(), strings.Join(inputs, "!"))
+
+	r.mu.Lock()
+	if entry, ok := r.fileHashes[key]; ok {
+		r.mu.Unlock()
+		return entry.hashes, nil
+	}
+	pending := &packageFileHashes{packageDir: packagePath.RestoreAnchor(r.repoRoot)}
+	r.pendingHashes[pending] = struct{}{}
+	r.mu.Unlock()
+
+	hashes, err := r.scm.GetPackageFileHashes(r.repoRoot, &hashing.PackageDepsOptions{
+		PackagePath:   packagePath,
+		InputPatterns: inputs,
+		FileHashCache: r.fileHashCache,
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pendingHashes, pending)
+	if err != nil {
+		return nil, err
+	}
+	pending.hashes = hashes
+	if !pending.stale {
+		r.fileHashes[key] = pending
+	}
+	return hashes, nil
+}
+
+// onFileChanged drops any state that may depend on the given path
+func (r *repoState) onFileChanged(path titanpath.AbsoluteSystemPath) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _packageGraphFiles[path.Base()] || r.containsPackage(path) {
+		r.graph = nil
+		r.graphGeneration++
+	}
+	// New and deleted files change which files git knows about
+	if cachingSCM, ok := r.scm.(scm.CachingSCM); ok {
+		cachingSCM.Invalidate()
+	}
+	// .gitignore files can affect which files are hashed in any package below them
+	ignoreFileChanged := path.Base() == ".gitignore"
+	for key, entry := range r.fileHashes {
+		if ignoreFileChanged || affectsPackage(path, entry.packageDir) {
+			delete(r.fileHashes, key)
+		}
+	}
+	for pending := range r.pendingHashes {
+		if ignoreFileChanged || affectsPackage(path, pending.packageDir) {
+			pending.stale = true
+		}
+	}
+}
+
+// reset drops all state, such as when we may have missed file changes
+func (r *repoState) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cachingSCM, ok := r.scm.(scm.CachingSCM); ok {
+		cachingSCM.Invalidate()
+	}
+	r.graph = nil
+	r.graphGeneration++
+	r.fileHashes = make(map[string]*packageFileHashes)
+	for pending := range r.pendingHashes {
+		pending.stale = true
+	}
+}
+
+// containsPackage returns true if path is a directory containing one of the packages in the
+// graph, such as when a package is deleted or moved. Must be called while r.mu is held.
+func (r *repoState) containsPackage(path titanpath.AbsoluteSystemPath) bool {
+	if r.graph == nil {
+		return false
+	}
+	for _, pkg := range r.graph.PackageInfos {
+		if pkg.Dir.RestoreAnchor(r.repoRoot).HasPrefix(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// affectsPackage returns true if a change to path may change the files in packageDir
+func affectsPackage(path titanpath.AbsoluteSystemPath, packageDir titanpath.AbsoluteSystemPath) bool {
+	return path.HasPrefix(packageDir) || packageDir.HasPrefix(path)
+}
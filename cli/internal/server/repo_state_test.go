@@ -0,0 +1,164 @@
+package server
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/hashing"
+	"github.com/khulnasoft/titanrepo/cli/internal/scm"
+	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+)
+
+// countingSCM returns a fixed set of hashes, counting how often it is asked for them
+type countingSCM struct {
+	scm.SCM
+	calls  int
+	during func()
+}
+
+func (c *countingSCM) GetPackageFileHashes(rootPath titanpath.AbsoluteSystemPath, opts *hashing.PackageDepsOptions) (map[titanpath.AnchoredUnixPath]string, error) {
+	c.calls++
+	if c.during != nil {
+		c.during()
+	}
+	return map[titanpath.AnchoredUnixPath]string{"file": "hash"}, nil
+}
+
+func TestRepoState_FileHashes(t *testing.T) {
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	state := newRepoState(repoRoot, nil)
+	counter := &countingSCM{}
+	state.scm = counter
+	pkgA := titanpath.AnchoredUnixPath("packages/a").ToSystemPath()
+	pkgB := titanpath.AnchoredUnixPath("packages/b").ToSystemPath()
+
+	assertCalls := func(pkg titanpath.AnchoredSystemPath, inputs []string, expected int) {
+		t.Helper()
+		hashes, err := state.getFileHashes(pkg, inputs)
+		assert.NilError(t, err, "getFileHashes")
+		assert.Equal(t, hashes["file"], "hash")
+		assert.Equal(t, counter.calls, expected)
+	}
+	assertCalls(pkgA, nil, 1)
+	assertCalls(pkgA, nil, 1)
+	// Inputs are part of the key, regardless of their order
+	assertCalls(pkgA, []string{"src/**", "*.json"}, 2)
+	assertCalls(pkgA, []string{"*.json", "src/**"}, 2)
+	assertCalls(pkgB, nil, 3)
+
+	// Changing a file only drops the hashes for its package
+	state.onFileChanged(repoRoot.UntypedJoin("packages", "a", "src", "index.js"))
+	assertCalls(pkgB, nil, 3)
+	assertCalls(pkgA, nil, 4)
+	assertCalls(pkgA, []string{"src/**", "*.json"}, 5)
+
+	// Deleting a directory above a package drops its hashes
+	state.onFileChanged(repoRoot.UntypedJoin("packages"))
+	assertCalls(pkgB, nil, 6)
+
+	// A .gitignore can affect any package
+	state.onFileChanged(repoRoot.UntypedJoin(".gitignore"))
+	assertCalls(pkgA, nil, 7)
+	assertCalls(pkgB, nil, 8)
+
+	// Hashes for a package that changed while they were calculated are not kept
+	counter.during = func() {
+		state.onFileChanged(repoRoot.UntypedJoin("packages", "b", "file"))
+	}
+	state.reset()
+	assertCalls(pkgB, nil, 9)
+	counter.during = nil
+	assertCalls(pkgB, nil, 10)
+	assertCalls(pkgB, nil, 10)
+
+	_, err := state.getFileHashes(titanpath.AnchoredUnixPath("../outside").ToSystemPath(), nil)
+	assert.ErrorContains(t, err, "not within the repository")
+}
+
+func TestRepoState_PackageGraph(t *testing.T) {
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	writeFile := func(path string, contents string) {
+		t.Helper()
+		file := repoRoot.UntypedJoin(path)
+		assert.NilError(t, file.EnsureDir(), "EnsureDir")
+		assert.NilError(t, file.WriteFile([]byte(contents), 0644), "WriteFile")
+	}
+	writeFile("package.json", `{"name": "root", "packageManager": "npm@8.19.2", "workspaces": ["packages/*"]}`)
+	writeFile("packages/a/package.json", `{"name": "a", "dependencies": {"b": "*"}}`)
+	writeFile("packages/b/package.json", `{"name": "b"}`)
+
+	state := newRepoState(repoRoot, nil)
+	graph, err := state.getPackageGraph()
+	assert.NilError(t, err, "getPackageGraph")
+	assert.DeepEqual(t, graph.PackageInfos["a"].InternalDeps, []string{"b"})
+
+	// Unrelated changes keep the graph
+	state.onFileChanged(repoRoot.UntypedJoin("packages", "a", "index.js"))
+	again, err := state.getPackageGraph()
+	assert.NilError(t, err, "getPackageGraph")
+	assert.Assert(t, again == graph, "expected the graph to be reused")
+
+	// Adding a package rebuilds it
+	writeFile("packages/c/package.json", `{"name": "c"}`)
+	state.onFileChanged(repoRoot.UntypedJoin("packages", "c", "package.json"))
+	graph, err = state.getPackageGraph()
+	assert.NilError(t, err, "getPackageGraph")
+	_, ok := graph.PackageInfos["c"]
+	assert.Assert(t, ok, "expected package c to be in the rebuilt graph")
+
+	// So does removing one
+	assert.NilError(t, repoRoot.UntypedJoin("packages", "c").RemoveAll(), "RemoveAll")
+	state.onFileChanged(repoRoot.UntypedJoin("packages", "c"))
+	graph, err = state.getPackageGraph()
+	assert.NilError(t, err, "getPackageGraph")
+	_, ok = graph.PackageInfos["c"]
+	assert.Assert(t, !ok, "expected package c to be removed from the graph")
+}
+
+func TestRepoState_FileAddedAfterStart(t *testing.T) {
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repoRoot.ToString()
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		out, err := cmd.CombinedOutput()
+		assert.NilError(t, err, string(out))
+	}
+	writeFile := func(path string, contents string) {
+		t.Helper()
+		file := repoRoot.UntypedJoin(path)
+		assert.NilError(t, file.EnsureDir(), "EnsureDir")
+		assert.NilError(t, file.WriteFile([]byte(contents), 0644), "WriteFile")
+	}
+	git("init", ".")
+	writeFile("packages/a/index.js", "index")
+	git("add", ".")
+	git("commit", "-m", "initial")
+
+	state := newRepoState(repoRoot, nil)
+	pkgA := titanpath.AnchoredUnixPath("packages/a").ToSystemPath()
+	hashes, err := state.getFileHashes(pkgA, nil)
+	assert.NilError(t, err, "getFileHashes")
+	assert.Equal(t, len(hashes), 1)
+
+	// A file created after the snapshot of the git index was taken is hashed
+	writeFile("packages/a/new.js", "new")
+	state.onFileChanged(repoRoot.UntypedJoin("packages", "a", "new.js"))
+	hashes, err = state.getFileHashes(pkgA, nil)
+	assert.NilError(t, err, "getFileHashes")
+	_, ok := hashes["new.js"]
+	assert.Assert(t, ok, "expected new.js to be hashed")
+
+	// Staging it only changes .git/index, which isn't watched
+	git("add", "packages/a/new.js")
+	writeFile("packages/b/other.js", "other")
+	hashes, err = state.scm.GetPackageFileHashes(repoRoot, &hashing.PackageDepsOptions{PackagePath: titanpath.AnchoredUnixPath("packages/b").ToSystemPath()})
+	assert.NilError(t, err, "GetPackageFileHashes")
+	_, ok = hashes["other.js"]
+	assert.Assert(t, ok, "expected other.js to be hashed after the index changed")
+}
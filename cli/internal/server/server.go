@@ -2,6 +2,9 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"runtime"
+	"sort"
 	"sync"
 	"time"
 
@@ -9,8 +12,11 @@ import (
 	"github.com/khulnasoft/titanrepo/cli/internal/filewatcher"
 	"github.com/khulnasoft/titanrepo/cli/internal/fs"
 	"github.com/khulnasoft/titanrepo/cli/internal/globwatcher"
+	"github.com/khulnasoft/titanrepo/cli/internal/hashing"
+	"github.com/khulnasoft/titanrepo/cli/internal/scope"
 	"github.com/khulnasoft/titanrepo/cli/internal/titandprotocol"
 	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+	"github.com/khulnasoft/titanrepo/cli/internal/util"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
@@ -18,21 +24,33 @@ import (
 )
 
 // Server implements the GRPC serverside of TurbodServer
-// Note for the future: we don't yet make use of titan.json
-// or the package graph in the server. Once we do, we may need a
-// layer of indirection between "the thing that responds to grpc requests"
-// and "the thing that holds our persistent data structures" to handle
-// changes in the underlying configuration.
+// The package graph and file hashes that it serves are held by repoState,
+// which drops them as the underlying files change.
 type Server struct {
 	titandprotocol.UnimplementedTurbodServer
-	watcher      *filewatcher.FileWatcher
-	globWatcher  *globwatcher.GlobWatcher
-	titanVersion string
-	started      time.Time
-	logFilePath  titanpath.AbsoluteSystemPath
-	repoRoot     titanpath.AbsoluteSystemPath
-	closerMu     sync.Mutex
-	closer       *closer
+	watcher     *filewatcher.FileWatcher
+	globWatcher *globwatcher.GlobWatcher
+	cookieJar   *filewatcher.CookieJar
+	repoState   *repoState
+	events      *eventBroker
+	// packageChanges reports changed packages to subscribers
+	packageChanges *packageChangeReporter
+	titanVersion   string
+	started        time.Time
+	logFilePath    titanpath.AbsoluteSystemPath
+	repoRoot       titanpath.AbsoluteSystemPath
+	closerMu       sync.Mutex
+	closer         *closer
+	logger         hclog.Logger
+	// fileHashCache is shared with runs through the filesystem. We invalidate
+	// entries as files change, and periodically write the invalidations back.
+	fileHashCache *hashing.FileHashCache
+	done          chan struct{}
+
+	// watchMu protects the file watching health fields below
+	watchMu           sync.Mutex
+	watchClosed       bool
+	recentWatchErrors []*titandprotocol.FileWatchError
 }
 
 // GRPCServer is the interface that the titan server needs to the underlying
@@ -62,44 +80,101 @@ func (c *closer) close() {
 
 var _defaultCookieTimeout = 500 * time.Millisecond
 
+var _fileHashCacheFlushInterval = 5 * time.Second
+
+// _maxRecentWatchErrors is how many file watching errors we keep around to report in status
+const _maxRecentWatchErrors = 10
+
+// _watchLimitHint explains how to recover from running out of file watches
+const _watchLimitHint = "Raise the limit, such as with the fs.inotify.max_user_watches sysctl or daemon.maxWatchedPaths in titan.json, or watch fewer directories with daemon.ignore in titan.json"
+
 // New returns a new instance of Server
-func New(serverName string, logger hclog.Logger, repoRoot titanpath.AbsoluteSystemPath, titanVersion string, logFilePath titanpath.AbsoluteSystemPath) (*Server, error) {
+func New(serverName string, logger hclog.Logger, repoRoot titanpath.AbsoluteSystemPath, titanVersion string, logFilePath titanpath.AbsoluteSystemPath, fileHashCachePath titanpath.AbsoluteSystemPath, opts fs.DaemonOptions) (*Server, error) {
 	cookieDir := fs.GetTurboDataDir().UntypedJoin("cookies", serverName)
 	cookieJar, err := filewatcher.NewCookieJar(cookieDir, _defaultCookieTimeout)
 	if err != nil {
 		return nil, err
 	}
-	watcher, err := filewatcher.GetPlatformSpecificBackend(logger)
+	watcher, err := filewatcher.GetPlatformSpecificBackend(logger, opts.MaxWatchedPaths)
 	if err != nil {
+		if errors.Is(err, filewatcher.ErrWatchLimitReached) {
+			return nil, errors.Wrap(err, _watchLimitHint)
+		}
 		return nil, err
 	}
-	fileWatcher := filewatcher.New(logger.Named("FileWatcher"), repoRoot, watcher)
+	fileWatcher := filewatcher.New(logger.Named("FileWatcher"), repoRoot, watcher, opts.Ignore...)
 	globWatcher := globwatcher.New(logger.Named("GlobWatcher"), repoRoot, cookieJar)
+	fileHashCache := hashing.LoadFileHashCache(fileHashCachePath)
+	repoState := newRepoState(repoRoot, fileHashCache)
+	events := newEventBroker()
 	server := &Server{
-		watcher:      fileWatcher,
-		globWatcher:  globWatcher,
-		titanVersion: titanVersion,
-		started:      time.Now(),
-		logFilePath:  logFilePath,
-		repoRoot:     repoRoot,
+		watcher:     fileWatcher,
+		globWatcher: globWatcher,
+		cookieJar:   cookieJar,
+		repoState:   repoState,
+		events:      events,
+		packageChanges: &packageChangeReporter{
+			logger:    logger.Named("PackageChanges"),
+			repoRoot:  repoRoot,
+			repoState: repoState,
+			events:    events,
+		},
+		titanVersion:  titanVersion,
+		started:       time.Now(),
+		logFilePath:   logFilePath,
+		repoRoot:      repoRoot,
+		logger:        logger,
+		fileHashCache: fileHashCache,
+		done:          make(chan struct{}),
 	}
+	globWatcher.OnInvalidation(func(hash string, changedGlobs []string) {
+		events.publish(&titandprotocol.Event{
+			Event: &titandprotocol.Event_OutputsInvalidated{
+				OutputsInvalidated: &titandprotocol.OutputsInvalidated{
+					Hash:        hash,
+					OutputGlobs: changedGlobs,
+				},
+			},
+		})
+	})
 	server.watcher.AddClient(cookieJar)
 	server.watcher.AddClient(globWatcher)
 	server.watcher.AddClient(server)
 	if err := server.watcher.Start(); err != nil {
+		if errors.Is(err, filewatcher.ErrWatchLimitReached) {
+			err = errors.Wrap(err, _watchLimitHint)
+		}
 		return nil, errors.Wrapf(err, "watching %v", repoRoot)
 	}
 	if err := server.watcher.AddRoot(cookieDir); err != nil {
 		_ = server.watcher.Close()
 		return nil, errors.Wrapf(err, "failed to watch cookie directory: %v", cookieDir)
 	}
+	go server.flushFileHashCache()
 	return server, nil
 }
 
+func (s *Server) flushFileHashCache() {
+	ticker := time.NewTicker(_fileHashCacheFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+		if err := s.fileHashCache.Save(); err != nil {
+			s.logger.Error(fmt.Sprintf("failed to save file hash cache: %v", err))
+		}
+	}
+}
+
 func (s *Server) tryClose() bool {
 	s.closerMu.Lock()
 	defer s.closerMu.Unlock()
 	if s.closer != nil {
+		// Subscriptions would otherwise keep the server from stopping
+		s.events.close()
 		s.closer.close()
 		return true
 	}
@@ -112,16 +187,45 @@ func (s *Server) OnFileWatchEvent(ev filewatcher.Event) {
 	if ev.EventType == filewatcher.FileDeleted && ev.Path == s.repoRoot {
 		_ = s.tryClose()
 	}
+	s.fileHashCache.Invalidate(ev.Path)
+	s.repoState.onFileChanged(ev.Path)
+	s.packageChanges.onFileChanged(ev.Path)
 }
 
 // OnFileWatchError implements filewatcher.FileWatchClient.OnFileWatchError
-func (s *Server) OnFileWatchError(err error) {}
+// We may have missed changes, so we drop everything we've computed. If we've
+// run out of watches, we'd keep missing changes, so we shut down instead.
+func (s *Server) OnFileWatchError(err error) {
+	s.repoState.reset()
+	if errors.Is(err, filewatcher.ErrWatchLimitReached) {
+		s.logger.Error(fmt.Sprintf("Shutting down, since we can no longer watch every file: %v. %v", err, _watchLimitHint))
+		_ = s.tryClose()
+	}
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	s.recentWatchErrors = append(s.recentWatchErrors, &titandprotocol.FileWatchError{
+		Message:       err.Error(),
+		TimestampMsec: uint64(time.Now().UnixMilli()),
+	})
+	if len(s.recentWatchErrors) > _maxRecentWatchErrors {
+		s.recentWatchErrors = s.recentWatchErrors[len(s.recentWatchErrors)-_maxRecentWatchErrors:]
+	}
+}
 
 // OnFileWatchClosed implements filewatcher.FileWatchClient.OnFileWatchClosed
-func (s *Server) OnFileWatchClosed() {}
+func (s *Server) OnFileWatchClosed() {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	s.watchClosed = true
+}
 
 // Close is used for shutting down this copy of the server
 func (s *Server) Close() error {
+	close(s.done)
+	s.events.close()
+	if err := s.fileHashCache.Save(); err != nil {
+		s.logger.Error(fmt.Sprintf("failed to save file hash cache: %v", err))
+	}
 	return s.watcher.Close()
 }
 
@@ -146,6 +250,14 @@ func (s *Server) NotifyOutputsWritten(ctx context.Context, req *titandprotocol.N
 	if err != nil {
 		return nil, err
 	}
+	s.events.publish(&titandprotocol.Event{
+		Event: &titandprotocol.Event_OutputsWritten{
+			OutputsWritten: &titandprotocol.OutputsWritten{
+				Hash:        req.Hash,
+				OutputGlobs: req.OutputGlobs,
+			},
+		},
+	})
 	return &titandprotocol.NotifyOutputsWrittenResponse{}, nil
 }
 
@@ -183,10 +295,135 @@ func (s *Server) Shutdown(ctx context.Context, req *titandprotocol.ShutdownReque
 // Status implements the Status rpc from titan.proto
 func (s *Server) Status(ctx context.Context, req *titandprotocol.StatusRequest) (*titandprotocol.StatusResponse, error) {
 	uptime := uint64(time.Since(s.started).Milliseconds())
+	trackedHashes, trackedGlobs := s.globWatcher.Counts()
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	s.watchMu.Lock()
+	watching := !s.watchClosed
+	recentErrors := append([]*titandprotocol.FileWatchError{}, s.recentWatchErrors...)
+	s.watchMu.Unlock()
 	return &titandprotocol.StatusResponse{
 		DaemonStatus: &titandprotocol.DaemonStatus{
-			LogFile:    s.logFilePath.ToString(),
-			UptimeMsec: uptime,
+			LogFile:       s.logFilePath.ToString(),
+			UptimeMsec:    uptime,
+			Version:       s.titanVersion,
+			RepoRoot:      s.repoRoot.ToString(),
+			Watching:      watching,
+			WatchedPaths:  uint64(s.watcher.WatchCount()),
+			TrackedHashes: uint64(trackedHashes),
+			TrackedGlobs:  uint64(trackedGlobs),
+			RecentErrors:  recentErrors,
+			HeapBytes:     memStats.HeapAlloc,
+			MemoryBytes:   memStats.Sys,
 		},
 	}, nil
 }
+
+// GetPackageGraph implements the GetPackageGraph rpc from titan.proto
+func (s *Server) GetPackageGraph(ctx context.Context, req *titandprotocol.GetPackageGraphRequest) (*titandprotocol.GetPackageGraphResponse, error) {
+	if err := s.cookieJar.WaitForCookie(); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "waiting for file changes: %v", err)
+	}
+	graph, err := s.repoState.getPackageGraph()
+	if err != nil {
+		return nil, err
+	}
+	packages := make([]*titandprotocol.Package, 0, len(graph.PackageNames)+1)
+	for _, name := range append([]string{util.RootPkgName}, graph.PackageNames...) {
+		pkg, ok := graph.PackageInfos[name]
+		if !ok {
+			continue
+		}
+		packages = append(packages, &titandprotocol.Package{
+			Name:             name,
+			Path:             pkg.Dir.ToUnixPath().ToString(),
+			Dependencies:     pkg.InternalDeps,
+			ExternalDepsHash: pkg.ExternalDepsHash,
+		})
+	}
+	return &titandprotocol.GetPackageGraphResponse{
+		Packages: packages,
+	}, nil
+}
+
+// GetFileHashes implements the GetFileHashes rpc from titan.proto
+func (s *Server) GetFileHashes(ctx context.Context, req *titandprotocol.GetFileHashesRequest) (*titandprotocol.GetFileHashesResponse, error) {
+	if err := s.cookieJar.WaitForCookie(); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "waiting for file changes: %v", err)
+	}
+	packagePath := titanpath.AnchoredUnixPath(req.PackagePath).ToSystemPath()
+	hashes, err := s.repoState.getFileHashes(packagePath, req.InputPatterns)
+	if err != nil {
+		return nil, err
+	}
+	fileHashes := make([]*titandprotocol.FileHash, 0, len(hashes))
+	for path, hash := range hashes {
+		fileHashes = append(fileHashes, &titandprotocol.FileHash{
+			Path: path.ToString(),
+			Hash: hash,
+		})
+	}
+	return &titandprotocol.GetFileHashesResponse{
+		FileHashes: fileHashes,
+	}, nil
+}
+
+// GetChangedPackages implements the GetChangedPackages rpc from titan.proto
+func (s *Server) GetChangedPackages(ctx context.Context, req *titandprotocol.GetChangedPackagesRequest) (*titandprotocol.GetChangedPackagesResponse, error) {
+	if err := s.cookieJar.WaitForCookie(); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "waiting for file changes: %v", err)
+	}
+	graph, err := s.repoState.getPackageGraph()
+	if err != nil {
+		return nil, err
+	}
+	opts := &scope.Opts{
+		GlobalDepPatterns: req.GlobalDepPatterns,
+		IgnorePatterns:    req.IgnorePatterns,
+	}
+	changedPackages, err := scope.ChangedPackages(opts, s.repoRoot.ToString(), s.repoState.scm, graph, req.FromRef, req.ToRef, s.logger)
+	if err != nil {
+		return nil, err
+	}
+	packages := changedPackages.UnsafeListOfStrings()
+	sort.Strings(packages)
+	return &titandprotocol.GetChangedPackagesResponse{
+		Packages: packages,
+	}, nil
+}
+
+// Subscribe implements the Subscribe rpc from titan.proto
+func (s *Server) Subscribe(req *titandprotocol.SubscribeRequest, stream titandprotocol.Turbod_SubscribeServer) error {
+	sub, unsubscribe := s.events.subscribe()
+	defer unsubscribe()
+	for {
+		select {
+		case ev, ok := <-sub.events:
+			if !ok {
+				if errors.Is(sub.err, errSubscriberBehind) {
+					return status.Error(codes.ResourceExhausted, sub.err.Error())
+				}
+				return nil
+			}
+			if err := stream.Send(ev); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// NotifyRunStatus implements the NotifyRunStatus rpc from titan.proto
+func (s *Server) NotifyRunStatus(ctx context.Context, req *titandprotocol.NotifyRunStatusRequest) (*titandprotocol.NotifyRunStatusResponse, error) {
+	s.events.publish(&titandprotocol.Event{
+		Event: &titandprotocol.Event_RunStatusChanged{
+			RunStatusChanged: &titandprotocol.RunStatusChanged{
+				RunId:   req.RunId,
+				Status:  req.Status,
+				Targets: req.Targets,
+			},
+		},
+	})
+	return &titandprotocol.NotifyRunStatusResponse{}, nil
+}
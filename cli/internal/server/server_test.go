@@ -2,13 +2,17 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"runtime"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
 	"google.golang.org/grpc"
 	"gotest.tools/v3/assert"
 
+	"github.com/khulnasoft/titanrepo/cli/internal/filewatcher"
 	titanfs "github.com/khulnasoft/titanrepo/cli/internal/fs"
 	"github.com/khulnasoft/titanrepo/cli/internal/titandprotocol"
 )
@@ -33,7 +37,7 @@ func TestDeleteRepoRoot(t *testing.T) {
 		stopped: make(chan struct{}),
 	}
 
-	s, err := New("testServer", logger, repoRoot, "some-version", "/log/file/path")
+	s, err := New("testServer", logger, repoRoot, "some-version", "/log/file/path", titanfs.AbsoluteSystemPathFromUpstream(t.TempDir()).UntypedJoin("file-hashes.json"), titanfs.DaemonOptions{})
 	assert.NilError(t, err, "New")
 	s.Register(grpcServer)
 
@@ -57,7 +61,7 @@ func TestShutdown(t *testing.T) {
 		stopped: make(chan struct{}),
 	}
 
-	s, err := New("testServer", logger, repoRoot, "some-version", "/log/file/path")
+	s, err := New("testServer", logger, repoRoot, "some-version", "/log/file/path", titanfs.AbsoluteSystemPathFromUpstream(t.TempDir()).UntypedJoin("file-hashes.json"), titanfs.DaemonOptions{})
 	assert.NilError(t, err, "New")
 	s.Register(grpcServer)
 
@@ -71,3 +75,91 @@ func TestShutdown(t *testing.T) {
 		t.Error("timed out waiting for graceful stop to be called")
 	}
 }
+
+func TestShutdownOnWatchLimit(t *testing.T) {
+	logger := hclog.Default()
+	repoRoot := titanfs.AbsoluteSystemPathFromUpstream(t.TempDir())
+
+	grpcServer := &mockGrpc{
+		stopped: make(chan struct{}),
+	}
+
+	s, err := New("testServer", logger, repoRoot, "some-version", "/log/file/path", titanfs.AbsoluteSystemPathFromUpstream(t.TempDir()).UntypedJoin("file-hashes.json"), titanfs.DaemonOptions{})
+	assert.NilError(t, err, "New")
+	s.Register(grpcServer)
+
+	// Other errors don't stop the server
+	s.OnFileWatchError(errors.New("some error"))
+	select {
+	case <-grpcServer.stopped:
+		t.Fatal("expected server to keep running")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	s.OnFileWatchError(errors.Wrap(filewatcher.ErrWatchLimitReached, "failed adding watch"))
+	select {
+	case <-grpcServer.stopped:
+	case <-time.After(2 * time.Second):
+		t.Error("timed out waiting for graceful stop to be called")
+	}
+}
+
+func TestWatchLimitAtStartup(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("FSEvents has no per-directory watches to limit")
+	}
+	logger := hclog.Default()
+	repoRoot := titanfs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	assert.NilError(t, repoRoot.UntypedJoin("a", "b").MkdirAll(0775), "MkdirAll")
+
+	_, err := New("testServer", logger, repoRoot, "some-version", "/log/file/path", titanfs.AbsoluteSystemPathFromUpstream(t.TempDir()).UntypedJoin("file-hashes.json"), titanfs.DaemonOptions{
+		MaxWatchedPaths: 2,
+	})
+	assert.ErrorIs(t, err, filewatcher.ErrWatchLimitReached)
+
+	// Ignoring directories keeps us within the limit, which includes the cookie directory
+	s, err := New("testServer", logger, repoRoot, "some-version", "/log/file/path", titanfs.AbsoluteSystemPathFromUpstream(t.TempDir()).UntypedJoin("file-hashes.json"), titanfs.DaemonOptions{
+		MaxWatchedPaths: 2,
+		Ignore:          []string{"a"},
+	})
+	assert.NilError(t, err, "New")
+	_ = s.Close()
+}
+
+func TestStatus(t *testing.T) {
+	logger := hclog.Default()
+	repoRoot := titanfs.AbsoluteSystemPathFromUpstream(t.TempDir())
+
+	s, err := New("testServer", logger, repoRoot, "some-version", "/log/file/path", titanfs.AbsoluteSystemPathFromUpstream(t.TempDir()).UntypedJoin("file-hashes.json"), titanfs.DaemonOptions{})
+	assert.NilError(t, err, "New")
+	defer func() { _ = s.Close() }()
+
+	ctx := context.Background()
+	_, err = s.NotifyOutputsWritten(ctx, &titandprotocol.NotifyOutputsWrittenRequest{
+		Hash:        "the-hash",
+		OutputGlobs: []string{"dist/**", ".next/**"},
+	})
+	assert.NilError(t, err, "NotifyOutputsWritten")
+	for i := 0; i < _maxRecentWatchErrors+2; i++ {
+		s.OnFileWatchError(fmt.Errorf("error %v", i))
+	}
+
+	resp, err := s.Status(ctx, &titandprotocol.StatusRequest{})
+	assert.NilError(t, err, "Status")
+	status := resp.DaemonStatus
+	assert.Equal(t, status.Version, "some-version")
+	assert.Equal(t, status.RepoRoot, repoRoot.ToString())
+	assert.Assert(t, status.Watching)
+	assert.Assert(t, status.WatchedPaths > 0)
+	assert.Equal(t, status.TrackedHashes, uint64(1))
+	assert.Equal(t, status.TrackedGlobs, uint64(2))
+	assert.Assert(t, status.MemoryBytes > 0)
+	// Only the most recent errors are kept
+	assert.Equal(t, len(status.RecentErrors), _maxRecentWatchErrors)
+	assert.Equal(t, status.RecentErrors[0].Message, "error 2")
+
+	s.OnFileWatchClosed()
+	resp, err = s.Status(ctx, &titandprotocol.StatusRequest{})
+	assert.NilError(t, err, "Status")
+	assert.Assert(t, !resp.DaemonStatus.Watching)
+}
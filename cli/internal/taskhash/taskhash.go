@@ -5,6 +5,7 @@ package taskhash
 
 import (
 	"fmt"
+	"reflect"
 	"sort"
 	"strings"
 	"sync"
@@ -16,6 +17,7 @@ import (
 	"github.com/khulnasoft/titanrepo/cli/internal/hashing"
 	"github.com/khulnasoft/titanrepo/cli/internal/inference"
 	"github.com/khulnasoft/titanrepo/cli/internal/nodes"
+	"github.com/khulnasoft/titanrepo/cli/internal/scm"
 	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
 	"github.com/khulnasoft/titanrepo/cli/internal/util"
 	"github.com/pyr-sh/dag"
@@ -29,23 +31,42 @@ import (
 // package-task hashing is threadsafe, provided topographical order is
 // respected.
 type Tracker struct {
-	rootNode            string
-	globalHash          string
-	pipeline            fs.Pipeline
-	packageInfos        map[interface{}]*fs.PackageJSON
-	mu                  sync.RWMutex
-	packageInputsHashes packageFileHashes
-	packageTaskHashes   map[string]string // taskID -> hash
+	repoRoot               titanpath.AbsoluteSystemPath
+	rootNode               string
+	globalHash             string
+	pipeline               fs.Pipeline
+	rootPipeline           fs.Pipeline // the pipeline without the overrides from workspace configurations
+	packageInfos           map[interface{}]*fs.PackageJSON
+	frameworks             []inference.Framework // inferred in addition to the built-in frameworks
+	envMode                util.EnvMode
+	passThroughEnv         []string // names of the variables passed to tasks in strict env mode
+	mu                     sync.RWMutex
+	packageInputsHashes    packageFileHashes
+	packageTaskHashes      map[string]string            // taskID -> hash
+	packageTaskEnvVars     map[string][]string          // taskID -> names of env vars included in the hash
+	packageTaskDotEnv      map[string]map[string]string // taskID -> variables from .env files
+	packageTaskEnvPrefixes map[string][]string          // taskID -> env prefixes of the inferred framework
 }
 
 // NewTracker creates a tracker for package-inputs combinations and package-task combinations.
-func NewTracker(rootNode string, globalHash string, pipeline fs.Pipeline, packageInfos map[interface{}]*fs.PackageJSON) *Tracker {
+// The global hash covers rootPipeline, so only tasks whose definitions were changed by the
+// titan.json of their workspace hash their definitions. passThroughEnv lists the variables
+// that are passed to tasks in strict env mode, without their values being hashed.
+func NewTracker(repoRoot titanpath.AbsoluteSystemPath, rootNode string, globalHash string, pipeline fs.Pipeline, rootPipeline fs.Pipeline, packageInfos map[interface{}]*fs.PackageJSON, frameworks []inference.Framework, envMode util.EnvMode, passThroughEnv []string) *Tracker {
 	return &Tracker{
-		rootNode:          rootNode,
-		globalHash:        globalHash,
-		pipeline:          pipeline,
-		packageInfos:      packageInfos,
-		packageTaskHashes: make(map[string]string),
+		repoRoot:               repoRoot,
+		rootNode:               rootNode,
+		globalHash:             globalHash,
+		pipeline:               pipeline,
+		rootPipeline:           rootPipeline,
+		packageInfos:           packageInfos,
+		frameworks:             frameworks,
+		envMode:                envMode,
+		passThroughEnv:         passThroughEnv,
+		packageTaskHashes:      make(map[string]string),
+		packageTaskEnvVars:     make(map[string][]string),
+		packageTaskDotEnv:      make(map[string]map[string]string),
+		packageTaskEnvPrefixes: make(map[string][]string),
 	}
 }
 
@@ -79,13 +100,14 @@ func safeCompileIgnoreFile(filepath string) (*gitignore.GitIgnore, error) {
 	return gitignore.CompileIgnoreLines([]string{}...), nil
 }
 
-func (pfs *packageFileSpec) hash(pkg *fs.PackageJSON, repoRoot titanpath.AbsoluteSystemPath) (string, error) {
-	hashObject, pkgDepsErr := hashing.GetPackageDeps(repoRoot, &hashing.PackageDepsOptions{
+func (pfs *packageFileSpec) hash(pkg *fs.PackageJSON, repoRoot titanpath.AbsoluteSystemPath, scm scm.SCM, fileHashCache *hashing.FileHashCache) (string, error) {
+	hashObject, pkgDepsErr := scm.GetPackageFileHashes(repoRoot, &hashing.PackageDepsOptions{
 		PackagePath:   pkg.Dir,
 		InputPatterns: pfs.inputs,
+		FileHashCache: fileHashCache,
 	})
 	if pkgDepsErr != nil {
-		manualHashObject, err := manuallyHashPackage(pkg, pfs.inputs, repoRoot)
+		manualHashObject, err := manuallyHashPackage(pkg, pfs.inputs, repoRoot, fileHashCache)
 		if err != nil {
 			return "", err
 		}
@@ -98,7 +120,7 @@ func (pfs *packageFileSpec) hash(pkg *fs.PackageJSON, repoRoot titanpath.Absolut
 	return hashOfFiles, nil
 }
 
-func manuallyHashPackage(pkg *fs.PackageJSON, inputs []string, rootPath titanpath.AbsoluteSystemPath) (map[titanpath.AnchoredUnixPath]string, error) {
+func manuallyHashPackage(pkg *fs.PackageJSON, inputs []string, rootPath titanpath.AbsoluteSystemPath, fileHashCache *hashing.FileHashCache) (map[titanpath.AnchoredUnixPath]string, error) {
 	hashObject := make(map[titanpath.AnchoredUnixPath]string)
 	// Instead of implementing all gitignore properly, we hack it. We only respect .gitignore in the root and in
 	// the directory of a package.
@@ -134,7 +156,7 @@ func manuallyHashPackage(pkg *fs.PackageJSON, inputs []string, rootPath titanpat
 						return nil
 					}
 				}
-				hash, err := fs.GitLikeHashFile(convertedName.ToString())
+				hash, err := fileHashCache.HashFile(convertedName)
 				if err != nil {
 					return fmt.Errorf("could not hash file %v. \n%w", convertedName.ToString(), err)
 				}
@@ -157,7 +179,7 @@ type packageFileHashes map[packageFileHashKey]string
 
 // CalculateFileHashes hashes each unique package-inputs combination that is present
 // in the task graph. Must be called before calculating task hashes.
-func (th *Tracker) CalculateFileHashes(allTasks []dag.Vertex, workerCount int, repoRoot titanpath.AbsoluteSystemPath) error {
+func (th *Tracker) CalculateFileHashes(allTasks []dag.Vertex, workerCount int, repoRoot titanpath.AbsoluteSystemPath, scm scm.SCM, fileHashCache *hashing.FileHashCache) error {
 	hashTasks := make(util.Set)
 
 	for _, v := range allTasks {
@@ -197,7 +219,7 @@ func (th *Tracker) CalculateFileHashes(allTasks []dag.Vertex, workerCount int, r
 				if !ok {
 					return fmt.Errorf("cannot find package %v", packageFileSpec.pkg)
 				}
-				hash, err := packageFileSpec.hash(pkg, repoRoot)
+				hash, err := packageFileSpec.hash(pkg, repoRoot, scm, fileHashCache)
 				if err != nil {
 					return err
 				}
@@ -232,6 +254,25 @@ type taskHashInputs struct {
 	taskDependencyHashes []string
 }
 
+// taskHashExtensions are hashed along with taskHashInputs only when one of them is set, so
+// that the hashes of tasks that don't use them are the same as in earlier versions. The global
+// hash leaves unset task settings out of the pipeline for the same reason.
+type taskHashExtensions struct {
+	// envMode and passThroughEnv are only set in strict env mode, where tasks see just the
+	// variables that were declared
+	envMode        string
+	passThroughEnv []string
+	// workspaceTaskDefinition is the hash of the task's definition if the titan.json of its
+	// workspace changed it from the one in the root pipeline
+	workspaceTaskDefinition string
+	// dotEnvPairs are the variables read from the task's .env files
+	dotEnvPairs []string
+}
+
+func (e *taskHashExtensions) isEmpty() bool {
+	return e.envMode == "" && len(e.passThroughEnv) == 0 && e.workspaceTaskDefinition == "" && len(e.dotEnvPairs) == 0
+}
+
 func (th *Tracker) calculateDependencyHashes(dependencySet dag.Set) ([]string, error) {
 	dependencyHashSet := make(util.Set)
 
@@ -273,7 +314,10 @@ func (th *Tracker) CalculateTaskHash(packageTask *nodes.PackageTask, dependencyS
 	}
 
 	var envPrefixes []string
-	framework := inference.InferFramework(packageTask.Pkg)
+	var framework *inference.Framework
+	if !packageTask.TaskDefinition.DisableFrameworkInference {
+		framework = inference.InferFramework(packageTask.Pkg, th.frameworks...)
+	}
 	if framework != nil && framework.EnvPrefix != "" {
 		// log auto detected framework and env prefix
 		logger.Debug(fmt.Sprintf("auto detected framework for %s", packageTask.PackageName), "framework", framework.Slug, "env_prefix", framework.EnvPrefix)
@@ -281,6 +325,11 @@ func (th *Tracker) CalculateTaskHash(packageTask *nodes.PackageTask, dependencyS
 	}
 
 	hashableEnvPairs := env.GetHashableEnvPairs(packageTask.TaskDefinition.EnvVarDependencies, envPrefixes)
+	// .env files are relative to the package
+	dotEnv, err := env.ReadDotEnvFiles(packageTask.Pkg.Dir.RestoreAnchor(th.repoRoot), packageTask.TaskDefinition.DotEnv)
+	if err != nil {
+		return "", fmt.Errorf("failed to read .env files for %v: %w", packageTask.TaskID, err)
+	}
 	outputs := packageTask.HashableOutputs()
 	taskDependencyHashes, err := th.calculateDependencyHashes(dependencySet)
 	if err != nil {
@@ -289,7 +338,7 @@ func (th *Tracker) CalculateTaskHash(packageTask *nodes.PackageTask, dependencyS
 	// log any auto detected env vars
 	logger.Debug(fmt.Sprintf("task hash env vars for %s:%s", packageTask.PackageName, packageTask.Task), "vars", hashableEnvPairs)
 
-	hash, err := fs.HashObject(&taskHashInputs{
+	inputs := taskHashInputs{
 		hashOfFiles:          hashOfFiles,
 		externalDepsHash:     packageTask.Pkg.ExternalDepsHash,
 		task:                 packageTask.Task,
@@ -298,12 +347,67 @@ func (th *Tracker) CalculateTaskHash(packageTask *nodes.PackageTask, dependencyS
 		hashableEnvPairs:     hashableEnvPairs,
 		globalHash:           th.globalHash,
 		taskDependencyHashes: taskDependencyHashes,
-	})
+	}
+	var hashable interface{} = &inputs
+	extensions := taskHashExtensions{dotEnvPairs: env.GetDotEnvPairs(dotEnv)}
+	if th.envMode == util.StrictEnvMode {
+		extensions.envMode, err = util.ToEnvModeString(th.envMode)
+		if err != nil {
+			return "", err
+		}
+		extensions.passThroughEnv = make([]string, len(th.passThroughEnv))
+		copy(extensions.passThroughEnv, th.passThroughEnv)
+		sort.Strings(extensions.passThroughEnv)
+	}
+	if rootDefinition, ok := th.rootPipeline.GetTaskDefinition(packageTask.TaskID); !ok || !reflect.DeepEqual(rootDefinition, *packageTask.TaskDefinition) {
+		extensions.workspaceTaskDefinition, err = fs.HashObject(packageTask.TaskDefinition)
+		if err != nil {
+			return "", err
+		}
+	}
+	if !extensions.isEmpty() {
+		// Nested values rather than pointers, since fmt prints nested pointers as addresses
+		hashable = &struct {
+			inputs     taskHashInputs
+			extensions taskHashExtensions
+		}{inputs, extensions}
+	}
+	hash, err := fs.HashObject(hashable)
 	if err != nil {
 		return "", fmt.Errorf("failed to hash task %v: %v", packageTask.TaskID, hash)
 	}
+	envVars := make([]string, len(hashableEnvPairs))
+	for i, pair := range hashableEnvPairs {
+		envVars[i] = strings.SplitN(pair, "=", 2)[0]
+	}
 	th.mu.Lock()
 	th.packageTaskHashes[packageTask.TaskID] = hash
+	th.packageTaskEnvVars[packageTask.TaskID] = envVars
+	th.packageTaskDotEnv[packageTask.TaskID] = dotEnv
+	th.packageTaskEnvPrefixes[packageTask.TaskID] = envPrefixes
 	th.mu.Unlock()
 	return hash, nil
 }
+
+// GetEnvVars returns the names of the environment variables that were included in the
+// hash of the given task, after expanding wildcards and framework prefixes.
+func (th *Tracker) GetEnvVars(taskID string) []string {
+	th.mu.RLock()
+	defer th.mu.RUnlock()
+	return th.packageTaskEnvVars[taskID]
+}
+
+// GetEnvPrefixes returns the env var prefixes that the given task depends on, based on the
+// framework inferred for its package
+func (th *Tracker) GetEnvPrefixes(taskID string) []string {
+	th.mu.RLock()
+	defer th.mu.RUnlock()
+	return th.packageTaskEnvPrefixes[taskID]
+}
+
+// GetDotEnv returns the variables read from the .env files of the given task
+func (th *Tracker) GetDotEnv(taskID string) map[string]string {
+	th.mu.RLock()
+	defer th.mu.RUnlock()
+	return th.packageTaskDotEnv[taskID]
+}
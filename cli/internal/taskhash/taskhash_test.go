@@ -5,8 +5,12 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/hashicorp/go-hclog"
 	"github.com/khulnasoft/titanrepo/cli/internal/fs"
+	"github.com/khulnasoft/titanrepo/cli/internal/nodes"
 	"github.com/khulnasoft/titanrepo/cli/internal/titanpath"
+	"github.com/khulnasoft/titanrepo/cli/internal/util"
+	"github.com/pyr-sh/dag"
 )
 
 func Test_manuallyHashPackage(t *testing.T) {
@@ -83,7 +87,7 @@ func Test_manuallyHashPackage(t *testing.T) {
 	pkg := &fs.PackageJSON{
 		Dir: pkgName,
 	}
-	hashes, err := manuallyHashPackage(pkg, []string{}, repoRoot)
+	hashes, err := manuallyHashPackage(pkg, []string{}, repoRoot, nil)
 	if err != nil {
 		t.Fatalf("failed to calculate manual hashes: %v", err)
 	}
@@ -110,7 +114,7 @@ func Test_manuallyHashPackage(t *testing.T) {
 	}
 
 	count = 0
-	justFileHashes, err := manuallyHashPackage(pkg, []string{filepath.FromSlash("**/*file")}, repoRoot)
+	justFileHashes, err := manuallyHashPackage(pkg, []string{filepath.FromSlash("**/*file")}, repoRoot, nil)
 	if err != nil {
 		t.Fatalf("failed to calculate manual hashes: %v", err)
 	}
@@ -135,3 +139,101 @@ func Test_manuallyHashPackage(t *testing.T) {
 		t.Errorf("found extra hashes in %v", hashes)
 	}
 }
+
+// hashWebBuild returns the hash of the build task of the web package, whose files hash to
+// "files", for the given definitions of the task in the web workspace and the root pipeline.
+// It fails the test if hashing the task again gives a different hash.
+func hashWebBuild(t *testing.T, repoRoot titanpath.AbsoluteSystemPath, taskDefinition fs.TaskDefinition, rootDefinition fs.TaskDefinition, envMode util.EnvMode, passThroughEnv []string) string {
+	t.Helper()
+	pkg := &fs.PackageJSON{Name: "web", Dir: titanpath.AnchoredUnixPath("apps/web").ToSystemPath()}
+	packageTask := &nodes.PackageTask{
+		TaskID:         "web#build",
+		Task:           "build",
+		PackageName:    "web",
+		Pkg:            pkg,
+		TaskDefinition: &taskDefinition,
+	}
+	rootPipeline := fs.Pipeline{"build": rootDefinition}
+	pipeline := fs.Pipeline{"build": rootDefinition, "web#build": taskDefinition}
+	hashes := make([]string, 2)
+	for i := range hashes {
+		tracker := NewTracker(repoRoot, util.RootPkgName, "global", pipeline, rootPipeline, map[interface{}]*fs.PackageJSON{"web": pkg}, nil, envMode, passThroughEnv)
+		tracker.packageInputsHashes = packageFileHashes{specFromPackageTask(packageTask).ToKey(): "files"}
+		hash, err := tracker.CalculateTaskHash(packageTask, dag.Set{}, hclog.NewNullLogger(), nil)
+		if err != nil {
+			t.Fatalf("failed to hash task: %v", err)
+		}
+		hashes[i] = hash
+	}
+	if hashes[0] != hashes[1] {
+		t.Errorf("expected task hashes to be stable, got %v and %v", hashes[0], hashes[1])
+	}
+	return hashes[0]
+}
+
+func Test_CalculateTaskHash_EnvMode(t *testing.T) {
+	repoRoot := titanpath.AbsoluteSystemPathFromUpstream(t.TempDir())
+	taskHash := func(envMode util.EnvMode, passThroughEnv []string) string {
+		t.Helper()
+		return hashWebBuild(t, repoRoot, fs.TaskDefinition{}, fs.TaskDefinition{}, envMode, passThroughEnv)
+	}
+
+	loose := taskHash(util.LooseEnvMode, []string{"PATH"})
+	strict := taskHash(util.StrictEnvMode, []string{"PATH"})
+	if loose == strict {
+		t.Errorf("expected strict and loose env modes to hash differently, both were %v", loose)
+	}
+	if loose != taskHash(util.LooseEnvMode, []string{"PATH", "HOME"}) {
+		t.Error("expected the pass through env to not affect the hash in loose env mode")
+	}
+	if strict == taskHash(util.StrictEnvMode, []string{"PATH", "HOME"}) {
+		t.Error("expected the pass through env to affect the hash in strict env mode")
+	}
+}
+
+func Test_CalculateTaskHash_WorkspaceTaskDefinition(t *testing.T) {
+	repoRoot := titanpath.AbsoluteSystemPathFromUpstream(t.TempDir())
+	rootDefinition := fs.TaskDefinition{Outputs: fs.TaskOutputs{Inclusions: []string{"dist/**"}}}
+	taskHash := func(taskDefinition fs.TaskDefinition) string {
+		t.Helper()
+		return hashWebBuild(t, repoRoot, taskDefinition, rootDefinition, util.LooseEnvMode, nil)
+	}
+
+	// The hash that the task had before workspace configurations were supported
+	expectedInherited := "fcb31bc129693e02"
+	inherited := taskHash(rootDefinition)
+	if inherited != expectedInherited {
+		t.Errorf("expected a task inheriting the root definition to keep its hash, got %v want %v", inherited, expectedInherited)
+	}
+	overridden := taskHash(fs.TaskDefinition{Outputs: fs.TaskOutputs{Inclusions: []string{"build/**"}}, ShouldCache: true})
+	if overridden == inherited {
+		t.Error("expected a workspace override of the task definition to change the hash")
+	}
+}
+
+func Test_CalculateTaskHash_DotEnv(t *testing.T) {
+	repoRoot := titanpath.AbsoluteSystemPathFromUpstream(t.TempDir())
+	dotEnvPath := repoRoot.UntypedJoin("apps", "web", ".env")
+	if err := dotEnvPath.EnsureDir(); err != nil {
+		t.Fatalf("failed to create package dir: %v", err)
+	}
+	taskHash := func(dotEnv []string) string {
+		t.Helper()
+		taskDefinition := fs.TaskDefinition{DotEnv: dotEnv}
+		return hashWebBuild(t, repoRoot, taskDefinition, taskDefinition, util.LooseEnvMode, nil)
+	}
+
+	withoutDotEnv := taskHash(nil)
+	if err := dotEnvPath.WriteFile([]byte(""), 0644); err != nil {
+		t.Fatalf("failed to write .env: %v", err)
+	}
+	if got := taskHash([]string{".env"}); got != withoutDotEnv {
+		t.Errorf("expected an empty .env file to keep the hash, got %v want %v", got, withoutDotEnv)
+	}
+	if err := dotEnvPath.WriteFile([]byte("API_URL=http://localhost\n"), 0644); err != nil {
+		t.Fatalf("failed to write .env: %v", err)
+	}
+	if taskHash([]string{".env"}) == withoutDotEnv {
+		t.Error("expected the variables in .env files to change the hash")
+	}
+}
@@ -0,0 +1,68 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// EnvMode defines which environment variables titan passes to tasks
+type EnvMode int
+
+const (
+	// LooseEnvMode passes the entire environment to tasks
+	LooseEnvMode EnvMode = iota
+	// StrictEnvMode passes only the variables that are declared as task inputs, along with
+	// an allowlist of variables that don't affect task outputs
+	StrictEnvMode
+)
+
+const (
+	looseEnvModeString  = "loose"
+	strictEnvModeString = "strict"
+)
+
+// EnvModeStrings is an array containing the string representations for env modes
+var EnvModeStrings = []string{
+	looseEnvModeString,
+	strictEnvModeString,
+}
+
+// FromEnvModeString converts an env mode's string representation into the enum value
+func FromEnvModeString(value string) (EnvMode, error) {
+	switch value {
+	case looseEnvModeString:
+		return LooseEnvMode, nil
+	case strictEnvModeString:
+		return StrictEnvMode, nil
+	}
+
+	return LooseEnvMode, fmt.Errorf("invalid env mode: %v", value)
+}
+
+// ToEnvModeString converts an env mode enum value into the string representation
+func ToEnvModeString(value EnvMode) (string, error) {
+	switch value {
+	case LooseEnvMode:
+		return looseEnvModeString, nil
+	case StrictEnvMode:
+		return strictEnvModeString, nil
+	}
+
+	return "", fmt.Errorf("invalid env mode: %v", value)
+}
+
+// UnmarshalJSON converts an env mode string representation into an enum
+func (c *EnvMode) UnmarshalJSON(data []byte) error {
+	var rawEnvMode string
+	if err := json.Unmarshal(data, &rawEnvMode); err != nil {
+		return err
+	}
+
+	envMode, err := FromEnvModeString(rawEnvMode)
+	if err != nil {
+		return err
+	}
+
+	*c = envMode
+	return nil
+}
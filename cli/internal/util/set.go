@@ -79,6 +79,18 @@ func (s Set) Difference(other Set) Set {
 	return result
 }
 
+// Union returns a set with the elements of both s and other.
+func (s Set) Union(other Set) Set {
+	result := make(Set)
+	for _, v := range s {
+		result.Add(v)
+	}
+	for _, v := range other {
+		result.Add(v)
+	}
+	return result
+}
+
 // Some tests whether at least one element in the array passes the test implemented by the provided function.
 // It returns a Boolean value.
 func (s Set) Some(cb func(interface{}) bool) bool {
@@ -613,6 +613,44 @@ function runSmokeTests<T>(
       }
     );
 
+    suite(
+      `${npmClient} + titan prune with multiple scopes${
+        options.cwd ? " from " + options.cwd : ""
+      }`,
+      async () => {
+        const pruneCommandOutput = getCommandOutputAsArray(
+          repo.titan("prune", ["--scope=a", "--scope=c"], options)
+        );
+        assert.fixture(pruneCommandOutput[1], " - Added a");
+        assert.fixture(pruneCommandOutput[2], " - Added c");
+        assert.fixture(pruneCommandOutput[3], " - Added b");
+
+        let files: string[] = [];
+        assert.not.throws(() => {
+          files = repo.globbySync("out/**/*", {
+            cwd: options.cwd ?? repo.root,
+          });
+        }, `Could not read generated \`out\` directory after \`titan prune\``);
+        for (const pkg of ["a", "b", "c"]) {
+          const file = `out/packages/${pkg}/package.json`;
+          assert.ok(
+            files.includes(file),
+            `Expected file ${file} to be generated`
+          );
+        }
+        const install = repo.run(installCmd, installArgs, {
+          cwd: options.cwd
+            ? path.join(options.cwd, "out")
+            : path.join(repo.root, "out"),
+        });
+        assert.is(
+          install.exitCode,
+          0,
+          `Expected ${npmClient} install --frozen-lockfile to succeed`
+        );
+      }
+    );
+
     suite(
       `${npmClient} + titan prune --docker${
         options.cwd ? " from " + options.cwd : ""
@@ -3,6 +3,15 @@ export interface Schema {
   /** @default https://titan.khulnasoft.com/schema.json */
   $schema?: string;
 
+  /**
+   * Only used in the titan.json of a workspace, which must extend the root
+   * titan.json with ["//"]. Its pipeline overrides the root pipeline for that
+   * workspace only.
+   *
+   * @default undefined
+   */
+  extends?: string[];
+
   /**
    * A list of globs for implicit global hash dependencies.
    *
@@ -27,6 +36,46 @@ export interface Schema {
    */
   globalEnv?: string[];
 
+  /**
+   * A list of .env files, relative to the root of the repository, whose variables
+   * are included in the hashes of all tasks. Later files take precedence.
+   *
+   * @default []
+   */
+  globalDotEnv?: string[];
+
+  /**
+   * A list of environment variables that are passed to tasks in strict env mode,
+   * without affecting their hashes.
+   *
+   * @default []
+   */
+  globalPassThroughEnv?: string[];
+
+  /**
+   * Which environment variables are passed to tasks. "loose" passes the entire
+   * environment. "strict" passes only declared environment variables, along with
+   * those in globalPassThroughEnv.
+   *
+   * @default "loose"
+   */
+  envMode?: "loose" | "strict";
+
+  /**
+   * Frameworks to infer in addition to the built-in ones. Tasks in workspaces that use
+   * a framework depend on the environment variables that start with its envPrefix.
+   *
+   * @default []
+   */
+  frameworks?: Framework[];
+
+  /**
+   * Configuration options for the titan daemon. The daemon reads these when it starts.
+   *
+   * @default {}
+   */
+  daemon?: Daemon;
+
   /**
    * An object representing the task dependency graph of your project. titan interprets
    * these conventions to properly schedule, execute, and cache the outputs of tasks in
@@ -50,6 +99,48 @@ export interface Schema {
   remoteCache?: RemoteCache;
 }
 
+export interface Framework {
+  /** A name for the framework. */
+  slug: string;
+
+  /** The prefix of the environment variables that the framework inlines into builds. */
+  envPrefix: string;
+
+  /** The dependencies that identify a workspace as using the framework. */
+  dependencies: string[];
+
+  /**
+   * Whether a workspace must depend on all of the dependencies, or just some of them.
+   *
+   * @default "all"
+   */
+  dependencyMatch?: "all" | "some";
+}
+
+export interface Daemon {
+  /**
+   * How long the daemon waits without any requests before exiting, such as "30m" or "8h".
+   *
+   * @default "4h"
+   */
+  idleTimeout?: string;
+
+  /**
+   * The most paths the daemon watches, counting directories as well as files. If it would
+   * need to watch more, the daemon exits rather than missing changes. By default, only the
+   * operating system's limit applies.
+   */
+  maxWatchedPaths?: number;
+
+  /**
+   * Directories, relative to the repository root, that the daemon doesn't watch, in
+   * addition to .git and node_modules. Entries may be globs, such as "**\/.next".
+   *
+   * @default []
+   */
+  ignore?: string[];
+}
+
 export interface Pipeline {
   /**
    * The list of tasks and environment variables that this task depends on.
@@ -70,10 +161,44 @@ export interface Pipeline {
   /**
    * A list of environment variables, **not** prefixed with $ (e.g. $GITHUB_TOKEN), that this task depends on.
    *
+   * Entries can use * as a wildcard (e.g. MYAPP_*), and can be prefixed with ! to exclude
+   * variables matched by a wildcard (e.g. !MYAPP_SECRET_*).
+   *
    * @default []
    */
   env?: string[];
 
+  /**
+   * A list of .env files, relative to the workspace, whose variables are included in
+   * the task's hash. Later files take precedence.
+   *
+   * @default []
+   */
+  dotEnv?: string[];
+
+  /**
+   * Whether the task depends on the environment variables of the framework inferred
+   * for its workspace.
+   *
+   * @default true
+   */
+  frameworkInference?: boolean;
+
+  /**
+   * A command to run for the task instead of the package.json script of the same
+   * name. It runs through a shell, like package.json scripts.
+   *
+   * @default undefined
+   */
+  command?: string;
+
+  /**
+   * The directory, relative to the workspace, in which `command` runs.
+   *
+   * @default undefined
+   */
+  cwd?: string;
+
   /**
    * The set of glob patterns of a task's cacheable filesystem outputs.
    *
@@ -129,4 +254,9 @@ export interface RemoteCache {
    * @default false
    */
   signature?: boolean;
+  /**
+   * The id of the team that artifacts are uploaded to and downloaded from. The team set with
+   * `titan link` or the `--team` flag takes precedence.
+   */
+  teamId?: string;
 }